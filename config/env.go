@@ -1,14 +1,19 @@
 package config
 
 import (
+	"encoding/base64"
 	"log"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/midtrans/midtrans-go"
 )
 
-type environmentVariables struct {
+// EnvironmentVariables is the configuration LoadEnv reads, tests set Env to one directly
+type EnvironmentVariables struct {
 	ENV              string
 	PostgresHost     string
 	PostgresPort     string
@@ -32,11 +37,46 @@ type environmentVariables struct {
 	TwilioVerifyServiceSID string
 
 	FonnteAPIKey string
+
+	// JournalMasterKeys wraps the per-user journal data keys, JournalMasterKeyID is the one used for new wraps
+	JournalMasterKeyID string
+	JournalMasterKeys  map[string][]byte
+
+	// Patients cancel or reschedule for free up to CancellationFreeHours before a session,
+	// later cancellations refund LateCancellationRefundPercent of the price
+	CancellationFreeHours         int
+	LateCancellationRefundPercent int
+
+	// Snap payments expire after PaymentWindowMinutes, appointments still unpaid
+	// PaymentReleaseGraceMinutes after their payment was due are cancelled and their slots freed
+	PaymentWindowMinutes       int
+	PaymentReleaseGraceMinutes int
+
+	// Subscribed external calendars are fetched every CalendarSyncMinutes, 0 turns polling off
+	CalendarSyncMinutes int
+
+	// Confirmed appointments are reminded about at each of these offsets before they start,
+	// longest first
+	AppointmentReminderOffsets []time.Duration
+
+	// A slot offered to a waitlisted patient is held for WaitlistHoldMinutes
+	WaitlistHoldMinutes int
+
+	// Online sessions meet in a room under MeetingBaseURL, joinable from MeetingJoinLeadMinutes
+	// before the start until the end. The server must use token authentication: join links carry
+	// a token signed with MeetingJWTSecret for one participant that only works in that window.
+	MeetingBaseURL         string
+	MeetingJoinLeadMinutes int
+	MeetingJWTAppID        string
+	MeetingJWTSecret       string
+
+	// AppBaseURL is the patient and therapist facing web app, used for links sent outside the app
+	AppBaseURL string
 }
 
-var Env *environmentVariables
+var Env *EnvironmentVariables
 func LoadEnv() {
-	env := &environmentVariables{}
+	env := &EnvironmentVariables{}
 	var err error
 	env.ENV = os.Getenv("ENV")
 	if env.ENV == "" {
@@ -78,5 +118,105 @@ func LoadEnv() {
         log.Fatal("Fonnte API Key is not set")
     }
 
+	env.JournalMasterKeyID, env.JournalMasterKeys = parseMasterKeys(os.Getenv("JOURNAL_MASTER_KEYS"))
+
+	env.CancellationFreeHours = parseIntEnv("CANCELLATION_FREE_HOURS", 24)
+	env.LateCancellationRefundPercent = parseIntEnv("LATE_CANCELLATION_REFUND_PERCENT", 50)
+	if env.LateCancellationRefundPercent < 0 || env.LateCancellationRefundPercent > 100 {
+		log.Fatal("LATE_CANCELLATION_REFUND_PERCENT must be between 0 and 100")
+	}
+
+	env.PaymentWindowMinutes = parseIntEnv("PAYMENT_WINDOW_MINUTES", 5)
+	if env.PaymentWindowMinutes == 0 {
+		log.Fatal("PAYMENT_WINDOW_MINUTES must be positive")
+	}
+	env.PaymentReleaseGraceMinutes = parseIntEnv("PAYMENT_RELEASE_GRACE_MINUTES", 10)
+
+	env.CalendarSyncMinutes = parseIntEnv("CALENDAR_SYNC_MINUTES", 30)
+
+	env.AppointmentReminderOffsets = parseOffsetsEnv("APPOINTMENT_REMINDER_OFFSETS", "24h,1h")
+
+	env.WaitlistHoldMinutes = parseIntEnv("WAITLIST_HOLD_MINUTES", 30)
+	if env.WaitlistHoldMinutes == 0 {
+		log.Fatal("WAITLIST_HOLD_MINUTES must be positive")
+	}
+
+	env.MeetingBaseURL = strings.TrimRight(os.Getenv("MEETING_BASE_URL"), "/")
+	env.MeetingJoinLeadMinutes = parseIntEnv("MEETING_JOIN_LEAD_MINUTES", 10)
+	env.MeetingJWTAppID = os.Getenv("MEETING_JWT_APP_ID")
+	env.MeetingJWTSecret = os.Getenv("MEETING_JWT_SECRET")
+	// Without token authentication anyone who has a room's link could join it at any time
+	if env.MeetingBaseURL == "" || env.MeetingJWTAppID == "" || env.MeetingJWTSecret == "" {
+		log.Fatal("MEETING_BASE_URL, MEETING_JWT_APP_ID and MEETING_JWT_SECRET must be set, meetings need a Jitsi server with token authentication")
+	}
+
+	env.AppBaseURL = strings.TrimRight(os.Getenv("APP_BASE_URL"), "/")
+	if env.AppBaseURL == "" {
+		env.AppBaseURL = "https://hand.tbn1.site"
+	}
+
 	Env = env
 }
+
+// parseIntEnv reads an optional non-negative integer, falling back when it is not set
+func parseIntEnv(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		log.Fatalf("%s must be a non-negative integer", name)
+	}
+	return parsed
+}
+
+// parseOffsetsEnv reads a comma separated list of durations such as "24h,1h,15m"
+func parseOffsetsEnv(name, fallback string) []time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		value = fallback
+	}
+
+	seen := make(map[time.Duration]bool)
+	var offsets []time.Duration
+	for _, entry := range strings.Split(value, ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(entry))
+		if err != nil || offset < time.Minute || offset > 7*24*time.Hour {
+			log.Fatalf("%s entries must be durations between 1m and 168h", name)
+		}
+		if !seen[offset] {
+			seen[offset] = true
+			offsets = append(offsets, offset)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return offsets
+}
+
+// parseMasterKeys reads "id:base64key,id:base64key", the first entry is the active key and
+// the rest are retired keys kept around until every data key has been rewrapped.
+func parseMasterKeys(value string) (string, map[string][]byte) {
+	if value == "" {
+		log.Fatal("JOURNAL_MASTER_KEYS is not set, generate a key with `openssl rand -base64 32` and set it as id:key")
+	}
+
+	var activeID string
+	keys := make(map[string][]byte)
+	for _, entry := range strings.Split(value, ",") {
+		id, encoded, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || id == "" {
+			log.Fatal("JOURNAL_MASTER_KEYS entries must look like id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			log.Fatalf("Journal master key %s must be 32 base64 encoded bytes, generate one with `openssl rand -base64 32`", id)
+		}
+		if activeID == "" {
+			activeID = id
+		}
+		keys[id] = key
+	}
+
+	return activeID, keys
+}
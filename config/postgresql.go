@@ -34,24 +34,49 @@ func NewPostgresql(migrations ...any) *gorm.DB {
         log.Fatalf("Failed to connect to database: %v", err)
     }
 
+    if err := Migrate(db, migrations...); err != nil {
+        log.Fatalln(err)
+    }
+
+    return db
+}
+
+// Migrate brings the schema up to date with the models, including what AutoMigrate can't express
+func Migrate(db *gorm.DB, migrations ...any) error {
     // Create enums before migrating the tables
     createEnums(db)
+    if err := migrateAppointmentStatusEnum(db); err != nil {
+        return fmt.Errorf("failed to migrate appointment statuses: %w", err)
+    }
 
     if err := migratePostgresqlTables(db, migrations...); err != nil {
-        log.Fatalln(err)
+        return err
     }
-
-    return db
+    createAppointmentSlotConstraint(db)
+    backfillMeetingRooms(db)
+    return nil
 }
 
 func createEnums(db *gorm.DB) {
     enums := map[string]string{
         "role_enum":              "CREATE TYPE role_enum AS ENUM ('admin', 'patient', 'therapist');",
-        "appointment_schedule_status_enum": "CREATE TYPE appointment_schedule_status_enum AS ENUM ('success', 'canceled');",
+        "appointment_schedule_status_enum": appointmentStatusEnumQuery,
         "consultation_enum" :  "CREATE TYPE consultation_enum AS ENUM ('online', 'offline', 'hybrid');",
         "media_enum" : "CREATE TYPE media_enum AS ENUM ('article', 'video');",
         "midtrans_status" : "CREATE TYPE midtrans_status AS ENUM ('challenge', 'pending', 'failure', 'success');",
-        "room_enum": "CREATE TYPE room_enum AS ENUM ('consultation', 'anonymous');",
+        "room_enum": "CREATE TYPE room_enum AS ENUM ('consultation', 'anonymous', 'group');",
+        "refund_status_enum": "CREATE TYPE refund_status_enum AS ENUM ('pending', 'processed', 'failed');",
+        "reminder_status_enum": "CREATE TYPE reminder_status_enum AS ENUM ('sending', 'sent', 'failed', 'skipped');",
+        "waitlist_status_enum": "CREATE TYPE waitlist_status_enum AS ENUM ('waiting', 'offered', 'booked', 'expired', 'cancelled');",
+        "waitlist_offer_status_enum": "CREATE TYPE waitlist_offer_status_enum AS ENUM ('pending', 'accepted', 'declined', 'expired');",
+        "series_frequency_enum": "CREATE TYPE series_frequency_enum AS ENUM ('weekly', 'biweekly');",
+        "series_payment_mode_enum": "CREATE TYPE series_payment_mode_enum AS ENUM ('upfront', 'per_session');",
+        "group_session_status_enum": "CREATE TYPE group_session_status_enum AS ENUM ('scheduled', 'cancelled');",
+        "group_registration_status_enum": "CREATE TYPE group_registration_status_enum AS ENUM ('pending_payment', 'confirmed', 'waitlisted', 'cancelled');",
+        "review_status_enum": "CREATE TYPE review_status_enum AS ENUM ('published', 'hidden');",
+        "taxonomy_kind_enum": "CREATE TYPE taxonomy_kind_enum AS ENUM ('specialization', 'approach');",
+        "profile_revision_status_enum": "CREATE TYPE profile_revision_status_enum AS ENUM ('pending', 'approved', 'rejected');",
+        "journal_template_enum": "CREATE TYPE journal_template_enum AS ENUM ('gratitude', 'thought_record', 'worry_log', 'free_writing');",
         // Add more enums as needed
     }
 
@@ -66,8 +91,118 @@ func createEnums(db *gorm.DB) {
             log.Printf("Enum %s already exists\n", enumName)
         }
     }
+
+    // Values added after an enum was first created
+    enumAdditions := []string{
+        "ALTER TYPE room_enum ADD VALUE IF NOT EXISTS 'group'",
+    }
+    for _, query := range enumAdditions {
+        if err := db.Exec(query).Error; err != nil {
+            log.Printf("Error extending enum: %v\n", err)
+        }
+    }
 }
 
+const appointmentStatusEnumQuery = "CREATE TYPE appointment_schedule_status_enum AS ENUM ('pending_payment', 'confirmed', 'in_session', 'completed', 'no_show', 'cancelled_by_patient', 'cancelled_by_therapist', 'rescheduled');"
+
+// migrateAppointmentStatusEnum replaces the old success/canceled statuses with the full
+// appointment lifecycle. Old bookings are mapped using their payment status, and paid ones
+// with a written conclusion count as completed.
+func migrateAppointmentStatusEnum(db *gorm.DB) error {
+    var legacy bool
+    db.Raw(`SELECT EXISTS (
+        SELECT 1
+        FROM pg_enum JOIN pg_type ON pg_type.oid = pg_enum.enumtypid
+        WHERE pg_type.typname = 'appointment_schedule_status_enum' AND pg_enum.enumlabel = 'success'
+    )`).Scan(&legacy)
+    if !legacy {
+        return nil
+    }
+
+    return db.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Exec("ALTER TYPE appointment_schedule_status_enum RENAME TO appointment_schedule_status_enum_old").Error; err != nil {
+            return err
+        }
+        if err := tx.Exec(appointmentStatusEnumQuery).Error; err != nil {
+            return err
+        }
+
+        if tx.Migrator().HasTable("appointments") {
+            err := tx.Exec(`ALTER TABLE appointments ALTER COLUMN status TYPE appointment_schedule_status_enum USING (
+                CASE
+                    WHEN status::text = 'success' AND payment_status = 'success' AND EXISTS (
+                        SELECT 1 FROM consultation_histories
+                        WHERE consultation_histories.appointment_id = appointments.id AND consultation_histories.conclusion <> ''
+                    ) THEN 'completed'
+                    WHEN status::text = 'success' AND payment_status = 'success' THEN 'confirmed'
+                    WHEN status::text = 'success' AND payment_status IN ('pending', 'challenge') THEN 'pending_payment'
+                    ELSE 'cancelled_by_patient'
+                END
+            )::appointment_schedule_status_enum`).Error
+            if err != nil {
+                return err
+            }
+        }
+
+        if err := tx.Exec("DROP TYPE appointment_schedule_status_enum_old").Error; err != nil {
+            return err
+        }
+        log.Println("Migrated appointment_schedule_status_enum to the appointment lifecycle statuses")
+        return nil
+    })
+}
+
+// createAppointmentSlotConstraint lets only one appointment hold any part of a therapist's time at
+// a time. An active appointment blocks its session and the buffer after it, so bookings of
+// different lengths can't overlap either. Bookings also take an advisory lock, the constraint is
+// the guarantee at the database level. It replaces a unique index that only caught bookings
+// starting at the same moment.
+func createAppointmentSlotConstraint(db *gorm.DB) {
+    err := db.Transaction(func(tx *gorm.DB) error {
+        // btree_gist lets the gist index compare therapist IDs for equality
+        if err := tx.Exec("CREATE EXTENSION IF NOT EXISTS btree_gist").Error; err != nil {
+            return err
+        }
+        // Adding minutes to a timestamptz doesn't depend on the time zone, but Postgres only
+        // knows that once it is wrapped in an immutable function
+        err := tx.Exec(`CREATE OR REPLACE FUNCTION appointment_slot(start timestamptz, minutes integer)
+            RETURNS tstzrange LANGUAGE sql IMMUTABLE
+            AS $$ SELECT tstzrange(start, start + minutes * interval '1 minute') $$`).Error
+        if err != nil {
+            return err
+        }
+
+        var exists bool
+        if err := tx.Raw("SELECT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'appointments_active_slot_excl')").Scan(&exists).Error; err != nil {
+            return err
+        }
+        if !exists {
+            err := tx.Exec(`ALTER TABLE appointments ADD CONSTRAINT appointments_active_slot_excl
+                EXCLUDE USING gist (
+                    therapist_id WITH =,
+                    appointment_slot(appointment_date, duration_minutes + buffer_minutes) WITH &&
+                ) WHERE (status IN ('pending_payment', 'confirmed', 'in_session'))`).Error
+            if err != nil {
+                return err
+            }
+        }
+        return tx.Exec("DROP INDEX IF EXISTS idx_appointments_active_slot").Error
+    })
+    if err != nil {
+        // Overlapping bookings made before the constraint existed have to be resolved by hand first
+        log.Printf("Error creating constraint appointments_active_slot_excl: %v\n", err)
+    }
+}
+
+// backfillMeetingRooms gives online appointments confirmed before meeting rooms existed a room
+func backfillMeetingRooms(db *gorm.DB) {
+    err := db.Exec(`UPDATE appointments
+        SET meeting_room = 'hand-' || replace(uuid_generate_v4()::text, '-', '')
+        WHERE type = 'online' AND status IN ('confirmed', 'in_session') AND meeting_room IS NULL`).Error
+    if err != nil {
+        log.Printf("Error backfilling meeting rooms: %v\n", err)
+    }
+}
 
 func checkEnumExists(db *gorm.DB, enumName string) bool {
     var exists bool
@@ -1,6 +1,8 @@
 package controller
 
 import (
+	"errors"
+	"log"
 	"net/http"
 	"time"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/Hand-TBN1/hand-backend/utilities"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type AppointmentController struct {
@@ -24,6 +27,7 @@ func (ctrl *AppointmentController) CreateAppointment(c *gin.Context) {
 		TherapistID      string `json:"therapist_id"`
 		Date             string `json:"date"` // "2024-09-29T15:00:00"
 		ConsultationType string `json:"consultation_type"`
+		SessionTypeID    string `json:"session_type_id"` // Optional, defaults to a one hour session
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -58,41 +62,82 @@ func (ctrl *AppointmentController) CreateAppointment(c *gin.Context) {
 
 	userClaims := claims.(*utilities.Claims)
 
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid user ID in token").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	therapistUUID, err := uuid.Parse(req.TherapistID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid therapist ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
 	therapist, err := ctrl.TherapistService.GetTherapistDetails(req.TherapistID)
 	if err != nil {
 		apiErr := apierror.NewApiErrorBuilder().
-			WithStatus(http.StatusInternalServerError).
-			WithMessage(apierror.ErrInternalServerError).
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
 			Build()
 		c.JSON(apiErr.HttpStatus, apiErr)
 		return
 	}
 
+	if err := services.CheckConsultationType(therapist, models.ConsultationType(req.ConsultationType)); err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
 	appointment := models.Appointment{
 		ID:              uuid.New(),
-		UserID:          uuid.MustParse(userClaims.UserID),
-		TherapistID:     uuid.MustParse(req.TherapistID),
+		UserID:          userUUID,
+		TherapistID:     therapistUUID,
 		AppointmentDate: appointmentDate,
-		Price:           therapist.AppointmentRate,
 		PaymentStatus:   models.MidtransStatusPending,
 		Type:            models.ConsultationType(req.ConsultationType),
-		Status:          models.Success, 
 		CreatedAt:       time.Now(),
 	}
 
-	// Save appointment to the database
+	var sessionTypeID *uuid.UUID
+	if req.SessionTypeID != "" {
+		parsed, err := uuid.Parse(req.SessionTypeID)
+		if err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Invalid session type ID").
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+		sessionTypeID = &parsed
+	}
+	if err := ctrl.AppointmentService.ApplySessionType(&appointment, therapist, sessionTypeID); err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	// Save appointment to the database, this fails with a conflict if the slot is taken
 	if err := ctrl.AppointmentService.CreateAppointment(&appointment); err != nil {
-		apiErr := apierror.NewApiErrorBuilder().
-			WithStatus(http.StatusInternalServerError).
-			WithMessage("Failed to create appointment").
-			Build()
-		c.JSON(apiErr.HttpStatus, apiErr)
+		respondAppointmentError(c, err)
 		return
 	}
 
 	// Create payment for the appointment
 	paymentResponse, err := ctrl.PaymentService.CreatePayment(appointment.ID.String(), appointment.Price)
 	if err != nil {
+		// Release the slot again, the booking can never be paid
+		if _, cancelErr := ctrl.AppointmentService.TransitionStatus(appointment.ID, models.CancelledByPatient, nil, "payment_creation_failed"); cancelErr != nil {
+			log.Printf("Failed to release appointment %s after payment error: %v", appointment.ID, cancelErr)
+		}
 		apiErr := apierror.NewApiErrorBuilder().
 			WithStatus(http.StatusInternalServerError).
 			WithMessage(err.Error()).
@@ -105,6 +150,9 @@ func (ctrl *AppointmentController) CreateAppointment(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"message":      "Appointment created successfully",
 		"appointment_id": appointment.ID,
+		"status":         appointment.Status,
+		"price":          appointment.Price,
+		"duration_minutes": appointment.DurationMinutes,
 		"payment_status": appointment.PaymentStatus,
 		"redirect_url": paymentResponse.RedirectURL, 
 	})
@@ -125,6 +173,14 @@ func (ctrl *AppointmentController) GetAppointmentHistory(c *gin.Context) {
 	userClaims := claims.(*utilities.Claims)
 
 	status := c.Query("status")
+	if status != "" && !models.AppointmentScheduleStatus(status).IsValid() {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid appointment status").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
 
 	appointments, err := ctrl.AppointmentService.GetAppointmentsByUserID(userClaims.UserID, status)
 	if err != nil {
@@ -151,8 +207,10 @@ func (ctrl *AppointmentController) GetAppointmentHistory(c *gin.Context) {
 			"price":            appointment.Price,
 			"appointment_date": appointment.AppointmentDate,
 			"type":             appointment.Type,
-			"status":           appointment.PaymentStatus,
+			"status":           appointment.Status,
+			"status_changed_at": appointment.StatusChangedAt,
 			"payment_status":   appointment.PaymentStatus,
+			"meeting":          meetingAccess(c, &appointment),
 		})
 	}
 	if len(result) == 0 {
@@ -211,5 +269,314 @@ func (ctrl *AppointmentController) GetUpcomingAppointments(c *gin.Context) {
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"appointments": appointments})
+    result := make([]appointmentWithMeeting, 0, len(appointments))
+    for i := range appointments {
+        result = append(result, appointmentWithMeeting{
+            Appointment: appointments[i],
+            Meeting:     meetingAccess(c, &appointments[i]),
+        })
+    }
+
+    c.JSON(http.StatusOK, gin.H{"appointments": result})
+}
+
+// appointmentWithMeeting adds the meeting room to the appointment fields in responses
+type appointmentWithMeeting struct {
+    models.Appointment
+    Meeting *services.MeetingAccess `json:"meeting"`
+}
+
+// GetAppointmentDetail - An appointment as its patient or therapist sees it, with the meeting room of online sessions
+func (ctrl *AppointmentController) GetAppointmentDetail(c *gin.Context) {
+	appointmentID, err := uuid.Parse(c.Param("appointmentID"))
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid appointment ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	appointment, err := ctrl.AppointmentService.GetAppointmentDetails(appointmentID)
+	if err != nil || (appointment.UserID != userID && appointment.TherapistID != userID) {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Appointment not found").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	location := ""
+	if appointment.Therapist.Therapist != nil {
+		location = appointment.Therapist.Therapist.Location
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": appointment.ID,
+		"therapist": gin.H{
+			"id":        appointment.Therapist.ID,
+			"name":      appointment.Therapist.Name,
+			"image_url": appointment.Therapist.ImageURL,
+			"location":  location,
+		},
+		"patient": gin.H{
+			"id":        appointment.User.ID,
+			"name":      appointment.User.Name,
+			"image_url": appointment.User.ImageURL,
+		},
+		"price":               appointment.Price,
+		"appointment_date":    appointment.AppointmentDate,
+		"duration_minutes":    appointment.DurationMinutes,
+		"type":                appointment.Type,
+		"status":              appointment.Status,
+		"status_changed_at":   appointment.StatusChangedAt,
+		"payment_status":      appointment.PaymentStatus,
+		"rescheduled_from_id": appointment.RescheduledFromID,
+		"meeting":             meetingAccess(c, appointment),
+	})
+}
+
+// GetAppointmentStatusHistory - Status changes of an appointment, visible to its patient and therapist
+func (ctrl *AppointmentController) GetAppointmentStatusHistory(c *gin.Context) {
+	appointmentID, err := uuid.Parse(c.Param("appointmentID"))
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid appointment ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	claims, exists := c.Get("claims")
+	if !exists {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusUnauthorized).
+			WithMessage(apierror.ErrUnauthorized).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	appointment, err := ctrl.AppointmentService.GetAppointmentByID(appointmentID)
+	if err != nil || (appointment.UserID.String() != userClaims.UserID && appointment.TherapistID.String() != userClaims.UserID) {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Appointment not found").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	history, err := ctrl.AppointmentService.GetStatusHistory(appointmentID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to fetch appointment history").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": appointment.ID,
+		"status":         appointment.Status,
+		"history":        history,
+	})
+}
+
+// GetCancellationQuote - What the patient would get back if they cancelled now
+func (ctrl *AppointmentController) GetCancellationQuote(c *gin.Context) {
+	appointmentID, patientID, ok := appointmentAndPatientIDs(c)
+	if !ok {
+		return
+	}
+
+	appointment, quote, err := ctrl.AppointmentService.QuoteCancellation(appointmentID, patientID)
+	if err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": appointment.ID,
+		"status":         appointment.Status,
+		"price":          appointment.Price,
+		"quote":          quote,
+	})
+}
+
+// CancelAppointment - Patient cancels a booking, the refund follows the cancellation policy
+func (ctrl *AppointmentController) CancelAppointment(c *gin.Context) {
+	appointmentID, patientID, ok := appointmentAndPatientIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(apierror.ErrInvalidInput).
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+	}
+
+	appointment, refund, err := ctrl.AppointmentService.CancelByPatient(appointmentID, patientID, req.Reason)
+	if err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Appointment cancelled successfully",
+		"appointment_id": appointment.ID,
+		"status":         appointment.Status,
+		"refund":         refund,
+	})
+}
+
+// RescheduleAppointment - Patient moves a confirmed booking to another free slot
+func (ctrl *AppointmentController) RescheduleAppointment(c *gin.Context) {
+	appointmentID, patientID, ok := appointmentAndPatientIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Date string `json:"date" binding:"required"` // "2024-09-29T15:00:00+07:00"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(apierror.ErrInvalidInput).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	date, err := time.Parse(time.RFC3339, req.Date)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid date format").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	appointment, err := ctrl.AppointmentService.RescheduleByPatient(appointmentID, patientID, date)
+	if err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":             "Appointment rescheduled successfully",
+		"appointment_id":      appointment.ID,
+		"rescheduled_from_id": appointment.RescheduledFromID,
+		"appointment_date":    appointment.AppointmentDate,
+		"status":              appointment.Status,
+	})
+}
+
+func appointmentAndPatientIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	appointmentID, err := uuid.Parse(c.Param("appointmentID"))
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid appointment ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	claims, exists := c.Get("claims")
+	if !exists {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusUnauthorized).
+			WithMessage(apierror.ErrUnauthorized).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	patientID, err := uuid.Parse(claims.(*utilities.Claims).UserID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid user ID in token").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return appointmentID, patientID, true
+}
+
+func respondAppointmentError(c *gin.Context, err error) {
+	status, message := http.StatusInternalServerError, apierror.ErrInternalServerError
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status, message = http.StatusNotFound, "Appointment not found"
+	case errors.Is(err, services.ErrInvalidStatusTransition):
+		status, message = http.StatusConflict, err.Error()
+	case errors.Is(err, services.ErrInvalidConsultationType):
+		status, message = http.StatusBadRequest, "The therapist does not offer this consultation type"
+	case errors.Is(err, services.ErrSessionTypeNotFound):
+		status, message = http.StatusBadRequest, "Session type not found"
+	case errors.Is(err, services.ErrSlotUnavailable):
+		status, message = http.StatusConflict, "The selected time slot is no longer available"
+	case errors.Is(err, services.ErrAppointmentStarted):
+		status, message = http.StatusConflict, "The appointment has already started"
+	case errors.Is(err, services.ErrAppointmentNotStarted):
+		status, message = http.StatusConflict, "The appointment has not started yet"
+	case errors.Is(err, services.ErrSessionNotOpen):
+		status, message = http.StatusConflict, "The session can only be started from shortly before its start until its end"
+	case errors.Is(err, services.ErrSessionNotHeld):
+		status, message = http.StatusConflict, "Consultation notes can only be written once the session has started"
+	case errors.Is(err, services.ErrRescheduleWindowClosed):
+		status, message = http.StatusBadRequest, "Appointments can only be rescheduled before the free cancellation window closes"
+	}
+
+	apiErr := apierror.NewApiErrorBuilder().
+		WithStatus(status).
+		WithMessage(message).
+		Build()
+	c.JSON(apiErr.HttpStatus, apiErr)
+}
+
+// meetingAccess is the meeting room of an appointment for the requesting user. A join link that
+// cannot be signed is left out rather than failing the whole response.
+func meetingAccess(c *gin.Context, appointment *models.Appointment) *services.MeetingAccess {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil
+	}
+	userClaims := claims.(*utilities.Claims)
+	userID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		return nil
+	}
+
+	access, err := services.MeetingAccessFor(appointment, userID, userClaims.Name, time.Now())
+	if err != nil {
+		log.Printf("Failed to build the meeting link of appointment %s: %v", appointment.ID, err)
+		return nil
+	}
+	return access
 }
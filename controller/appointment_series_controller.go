@@ -0,0 +1,335 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type AppointmentSeriesController struct {
+	SeriesService      *services.AppointmentSeriesService
+	AppointmentService *services.AppointmentService
+	PaymentService     *services.PaymentService
+	TherapistService   *services.TherapistService
+}
+
+// CreateSeries - Book a weekly or biweekly series of appointments with a therapist in one go
+func (ctrl *AppointmentSeriesController) CreateSeries(c *gin.Context) {
+	var req struct {
+		TherapistID      string `json:"therapist_id" binding:"required"`
+		Date             string `json:"date" binding:"required"` // First occurrence, "2024-09-29T15:00:00+07:00"
+		ConsultationType string `json:"consultation_type" binding:"required"`
+		SessionTypeID    string `json:"session_type_id"`              // Optional, defaults to a one hour session
+		Frequency        string `json:"frequency" binding:"required"` // weekly or biweekly
+		Occurrences      int    `json:"occurrences" binding:"required"`
+		PaymentMode      string `json:"payment_mode" binding:"required"` // upfront or per_session
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(apierror.ErrInvalidInput).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	first, err := time.Parse(time.RFC3339, req.Date)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid date format").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	therapistID, err := uuid.Parse(req.TherapistID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid therapist ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	therapist, err := ctrl.TherapistService.GetTherapistDetails(req.TherapistID)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	if err := services.CheckConsultationType(therapist, models.ConsultationType(req.ConsultationType)); err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+
+	series := models.AppointmentSeries{
+		UserID:           patientID,
+		TherapistID:      therapistID,
+		ConsultationType: models.ConsultationType(req.ConsultationType),
+		Frequency:        models.SeriesFrequency(req.Frequency),
+		Occurrences:      req.Occurrences,
+		PaymentMode:      models.SeriesPaymentMode(req.PaymentMode),
+	}
+	if req.SessionTypeID != "" {
+		sessionTypeID, err := uuid.Parse(req.SessionTypeID)
+		if err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Invalid session type ID").
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+		series.SessionTypeID = &sessionTypeID
+	}
+
+	appointments, err := ctrl.SeriesService.BookSeries(&series, therapist, first)
+	if err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+
+	// A series paid upfront is one payment for all occurrences, otherwise the first is paid now
+	orderID, amount := appointments[0].ID.String(), appointments[0].Price
+	if series.PaymentMode == models.SeriesPayUpfront {
+		orderID, amount = series.ID.String(), 0
+		for _, appointment := range appointments {
+			amount += appointment.Price
+		}
+	}
+
+	paymentResponse, err := ctrl.PaymentService.CreatePayment(orderID, amount)
+	if err != nil {
+		// Release the whole series again, it can never be paid
+		for _, appointment := range appointments {
+			if _, cancelErr := ctrl.AppointmentService.TransitionStatus(appointment.ID, models.CancelledByPatient, nil, "payment_creation_failed"); cancelErr != nil {
+				log.Printf("Failed to release appointment %s after payment error: %v", appointment.ID, cancelErr)
+			}
+		}
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage(err.Error()).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Appointment series created successfully",
+		"series":       series,
+		"occurrences":  seriesOccurrences(appointments),
+		"amount":       amount,
+		"redirect_url": paymentResponse.RedirectURL,
+	})
+}
+
+// GetSeries - A series with all its occurrences, for its patient or therapist
+func (ctrl *AppointmentSeriesController) GetSeries(c *gin.Context) {
+	seriesID, userID, ok := seriesAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	series, appointments, err := ctrl.SeriesService.GetSeries(seriesID, userID)
+	if err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"series":      series,
+		"occurrences": seriesOccurrences(appointments),
+	})
+}
+
+// CancelSeries - Patient cancels every occurrence that has not started yet
+func (ctrl *AppointmentSeriesController) CancelSeries(c *gin.Context) {
+	seriesID, patientID, ok := seriesAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(apierror.ErrInvalidInput).
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+	}
+
+	appointments, refunds, err := ctrl.SeriesService.CancelFuture(seriesID, patientID, req.Reason)
+	if err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+	if refunds == nil {
+		refunds = []models.Refund{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Upcoming appointments of the series cancelled successfully",
+		"occurrences": seriesOccurrences(appointments),
+		"refunds":     refunds,
+	})
+}
+
+// RescheduleSeries - Patient moves every occurrence that has not started yet, keeping the interval
+func (ctrl *AppointmentSeriesController) RescheduleSeries(c *gin.Context) {
+	seriesID, patientID, ok := seriesAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Date string `json:"date" binding:"required"` // New start of the next occurrence, "2024-09-29T15:00:00+07:00"
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(apierror.ErrInvalidInput).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	date, err := time.Parse(time.RFC3339, req.Date)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid date format").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	appointments, err := ctrl.SeriesService.RescheduleFuture(seriesID, patientID, date)
+	if err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Upcoming appointments of the series rescheduled successfully",
+		"occurrences": seriesOccurrences(appointments),
+	})
+}
+
+// PayOccurrence - Patient pays one occurrence of a series paid per session
+func (ctrl *AppointmentSeriesController) PayOccurrence(c *gin.Context) {
+	appointmentID, patientID, ok := appointmentAndPatientIDs(c)
+	if !ok {
+		return
+	}
+
+	appointment, err := ctrl.SeriesService.StartOccurrencePayment(appointmentID, patientID)
+	if err != nil {
+		respondSeriesError(c, err)
+		return
+	}
+
+	paymentResponse, err := ctrl.PaymentService.CreatePayment(appointment.ID.String(), appointment.Price)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage(err.Error()).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"appointment_id": appointment.ID,
+		"price":          appointment.Price,
+		"payment_due_at": appointment.PaymentDueAt,
+		"redirect_url":   paymentResponse.RedirectURL,
+	})
+}
+
+func seriesOccurrences(appointments []models.Appointment) []gin.H {
+	result := make([]gin.H, 0, len(appointments))
+	for _, appointment := range appointments {
+		result = append(result, gin.H{
+			"appointment_id":      appointment.ID,
+			"appointment_date":    appointment.AppointmentDate,
+			"duration_minutes":    appointment.DurationMinutes,
+			"price":               appointment.Price,
+			"status":              appointment.Status,
+			"payment_status":      appointment.PaymentStatus,
+			"payment_due_at":      appointment.PaymentDueAt,
+			"rescheduled_from_id": appointment.RescheduledFromID,
+		})
+	}
+	return result
+}
+
+func seriesAndUserIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	seriesID, err := uuid.Parse(c.Param("seriesID"))
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid series ID").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return seriesID, userID, true
+}
+
+func respondSeriesError(c *gin.Context, err error) {
+	var conflict *services.SeriesConflictError
+	var status int
+	var message string
+	var payload interface{}
+	switch {
+	case errors.As(err, &conflict):
+		status, message = http.StatusConflict, "Some occurrences of the series are not available"
+		payload = gin.H{"unavailable_dates": conflict.Dates}
+	case errors.Is(err, services.ErrInvalidSeries):
+		status = http.StatusBadRequest
+		message = fmt.Sprintf("A series is weekly or biweekly with 2 to %d occurrences, paid upfront or per_session", services.MaxSeriesOccurrences)
+	case errors.Is(err, services.ErrNothingToPay):
+		status, message = http.StatusConflict, "Only unpaid occurrences of a series paid per session are paid on their own"
+	case errors.Is(err, services.ErrSeriesPaymentPending):
+		status, message = http.StatusConflict, "The series can be rescheduled once its payment is complete"
+	default:
+		respondAppointmentError(c, err)
+		return
+	}
+
+	apiErr := apierror.NewApiErrorBuilder().
+		WithStatus(status).
+		WithMessage(message).
+		WithPayload(payload).
+		Build()
+	c.JSON(apiErr.HttpStatus, apiErr)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type CalendarFeedController struct {
+	CalendarFeedService *services.CalendarFeedService
+}
+
+// GetFeed - Whether the logged in user has a calendar feed, the URL itself is only shown when
+// the token is generated
+func (ctrl *CalendarFeedController) GetFeed(c *gin.Context) {
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	feed, apiErr := ctrl.CalendarFeedService.GetFeed(userID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+	if feed == nil {
+		c.JSON(http.StatusOK, gin.H{"active": false})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"active":           true,
+		"created_at":       feed.CreatedAt,
+		"updated_at":       feed.UpdatedAt,
+		"last_accessed_at": feed.LastAccessedAt,
+	})
+}
+
+// RegenerateToken - Create a feed URL, or replace it when the old one leaked
+func (ctrl *CalendarFeedController) RegenerateToken(c *gin.Context) {
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	token, apiErr := ctrl.CalendarFeedService.RegenerateToken(userID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	scheme := "https"
+	if c.Request.TLS == nil && c.GetHeader("X-Forwarded-Proto") != "https" {
+		scheme = "http"
+	}
+	path := "/api/calendar/ics/" + token + ".ics"
+	c.JSON(http.StatusCreated, gin.H{
+		"feed_url":   scheme + "://" + c.Request.Host + path,
+		"webcal_url": "webcal://" + c.Request.Host + path,
+	})
+}
+
+func (ctrl *CalendarFeedController) RevokeFeed(c *gin.Context) {
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	if apiErr := ctrl.CalendarFeedService.RevokeFeed(userID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetICS - The feed itself, authenticated by the token in the URL so calendar apps can poll it
+func (ctrl *CalendarFeedController) GetICS(c *gin.Context) {
+	token := strings.TrimSuffix(c.Param("token"), ".ics")
+
+	calendar, apiErr := ctrl.CalendarFeedService.RenderFeed(token)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Data(http.StatusOK, "text/calendar; charset=utf-8", []byte(calendar))
+}
+
+func userIDFromClaims(c *gin.Context) (uuid.UUID, bool) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(claims.(*utilities.Claims).UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return uuid.Nil, false
+	}
+	return userID, true
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type ClinicController struct {
+	ClinicService *services.ClinicService
+}
+
+type ClinicDTO struct {
+	Name      string   `json:"name" binding:"required"`
+	Address   string   `json:"address" binding:"required"`
+	City      string   `json:"city" binding:"required"`
+	Latitude  *float64 `json:"latitude" binding:"required"`
+	Longitude *float64 `json:"longitude" binding:"required"`
+}
+
+func (dto ClinicDTO) clinic() *models.Clinic {
+	return &models.Clinic{
+		Name:      dto.Name,
+		Address:   dto.Address,
+		City:      dto.City,
+		Latitude:  *dto.Latitude,
+		Longitude: *dto.Longitude,
+	}
+}
+
+// CreateClinic - Admin adds a clinic
+func (ctrl *ClinicController) CreateClinic(c *gin.Context) {
+	var req ClinicDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	clinic := req.clinic()
+	if apiErr := ctrl.ClinicService.CreateClinic(clinic); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, clinic)
+}
+
+// UpdateClinic - Admin corrects a clinic's details
+func (ctrl *ClinicController) UpdateClinic(c *gin.Context) {
+	clinicID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid clinic ID"})
+		return
+	}
+
+	var req ClinicDTO
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	clinic, apiErr := ctrl.ClinicService.UpdateClinic(clinicID, req.clinic())
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, clinic)
+}
+
+// GetClinics - Clinics by name, filter with city
+func (ctrl *ClinicController) GetClinics(c *gin.Context) {
+	clinics, apiErr := ctrl.ClinicService.GetClinics(c.Query("city"))
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, clinics)
+}
+
+// GetTherapistClinics - Clinics where a therapist sees patients in person
+func (ctrl *ClinicController) GetTherapistClinics(c *gin.Context) {
+	therapistID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+		return
+	}
+
+	clinics, apiErr := ctrl.ClinicService.GetTherapistClinics(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, clinics)
+}
+
+func (ctrl *ClinicController) GetMyClinics(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	clinics, apiErr := ctrl.ClinicService.GetTherapistClinics(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, clinics)
+}
+
+// SetMyClinics - Therapist replaces the clinics they practice at, an empty list removes them all
+func (ctrl *ClinicController) SetMyClinics(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		ClinicIDs []uuid.UUID `json:"clinic_ids"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	clinics, apiErr := ctrl.ClinicService.SetTherapistClinics(therapistID, req.ClinicIDs)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, clinics)
+}
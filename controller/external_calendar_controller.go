@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SubscribeCalendarDTO struct {
+	Name string `json:"name" binding:"required"`
+	URL  string `json:"url" binding:"required"`
+}
+
+type ExternalCalendarController struct {
+	ExternalCalendarService *services.ExternalCalendarService
+}
+
+func (ctrl *ExternalCalendarController) GetCalendars(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	calendars, apiErr := ctrl.ExternalCalendarService.GetCalendars(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, calendars)
+}
+
+// SubscribeCalendar - Register an ICS URL that is polled for busy time
+func (ctrl *ExternalCalendarController) SubscribeCalendar(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto SubscribeCalendarDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	calendar, apiErr := ctrl.ExternalCalendarService.Subscribe(c.Request.Context(), therapistID, dto.Name, dto.URL)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendar)
+}
+
+// ImportCalendar - Upload an ICS file as a new calendar (form fields "file" and "name")
+func (ctrl *ExternalCalendarController) ImportCalendar(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(c.PostForm("name"))
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return
+	}
+	data, ok := readCalendarUpload(c)
+	if !ok {
+		return
+	}
+
+	calendar, apiErr := ctrl.ExternalCalendarService.Import(therapistID, nil, name, data)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, calendar)
+}
+
+// ReplaceCalendarFile - Upload a newer export of an uploaded calendar
+func (ctrl *ExternalCalendarController) ReplaceCalendarFile(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	calendarID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar ID"})
+		return
+	}
+	data, ok := readCalendarUpload(c)
+	if !ok {
+		return
+	}
+
+	calendar, apiErr := ctrl.ExternalCalendarService.Import(therapistID, &calendarID, strings.TrimSpace(c.PostForm("name")), data)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+func (ctrl *ExternalCalendarController) SyncCalendar(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	calendarID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar ID"})
+		return
+	}
+
+	calendar, apiErr := ctrl.ExternalCalendarService.Sync(c.Request.Context(), therapistID, calendarID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
+
+func (ctrl *ExternalCalendarController) DeleteCalendar(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	calendarID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid calendar ID"})
+		return
+	}
+
+	if apiErr := ctrl.ExternalCalendarService.DeleteCalendar(therapistID, calendarID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func readCalendarUpload(c *gin.Context) ([]byte, bool) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File is required"})
+		return nil, false
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return nil, false
+	}
+	defer file.Close()
+
+	// One byte over the limit is enough for the service to reject it
+	data, err := io.ReadAll(io.LimitReader(file, 5<<20+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return nil, false
+	}
+	return data, true
+}
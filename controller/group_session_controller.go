@@ -0,0 +1,414 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type GroupSessionController struct {
+	GroupSessionService *services.GroupSessionService
+	PaymentService      *services.PaymentService
+	TherapistService    *services.TherapistService
+}
+
+// CreateSession - Therapist schedules a group session in free time of their schedule
+func (ctrl *GroupSessionController) CreateSession(c *gin.Context) {
+	var req struct {
+		Topic            string `json:"topic" binding:"required"`
+		Description      string `json:"description"`
+		ConsultationType string `json:"consultation_type" binding:"required"` // online or offline
+		StartsAt         string `json:"starts_at" binding:"required"`         // "2024-09-29T15:00:00+07:00"
+		DurationMinutes  int    `json:"duration_minutes" binding:"required"`
+		Capacity         int    `json:"capacity" binding:"required"`
+		Price            int64  `json:"price"` // Zero for free sessions
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(apierror.ErrInvalidInput).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	startsAt, err := time.Parse(time.RFC3339, req.StartsAt)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid date format").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+	therapist, err := ctrl.TherapistService.GetTherapistDetails(therapistID.String())
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	session := models.GroupSession{
+		TherapistID:     therapistID,
+		Topic:           req.Topic,
+		Description:     req.Description,
+		Type:            models.ConsultationType(req.ConsultationType),
+		StartsAt:        startsAt,
+		DurationMinutes: req.DurationMinutes,
+		Capacity:        req.Capacity,
+		Price:           req.Price,
+	}
+	if err := ctrl.GroupSessionService.CreateSession(&session, therapist); err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":       "Group session created successfully",
+		"group_session": session,
+	})
+}
+
+// GetMySessions - Therapist's own group sessions with their join links
+func (ctrl *GroupSessionController) GetMySessions(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	sessions, err := ctrl.GroupSessionService.GetTherapistSessions(therapistID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	result := make([]gin.H, 0, len(sessions))
+	for i := range sessions {
+		result = append(result, gin.H{
+			"group_session": sessions[i],
+			"meeting":       groupMeetingAccess(c, &sessions[i].GroupSession, nil),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// GetRoster - Who is attending, paying or waiting for one of the therapist's group sessions
+func (ctrl *GroupSessionController) GetRoster(c *gin.Context) {
+	sessionID, therapistID, ok := groupSessionAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	session, registrations, err := ctrl.GroupSessionService.GetRoster(sessionID, therapistID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	roster := make([]gin.H, 0, len(registrations))
+	for _, registration := range registrations {
+		roster = append(roster, gin.H{
+			"registration_id": registration.ID,
+			"patient_id":      registration.PatientID,
+			"patient_name":    registration.Patient.Name,
+			"status":          registration.Status,
+			"payment_status":  registration.PaymentStatus,
+			"registered_at":   registration.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"group_session": session,
+		"roster":        roster,
+	})
+}
+
+// CancelSession - Therapist calls off a group session, paid seats are refunded in full
+func (ctrl *GroupSessionController) CancelSession(c *gin.Context) {
+	sessionID, therapistID, ok := groupSessionAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(apierror.ErrInvalidInput).
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+	}
+
+	session, refunds, err := ctrl.GroupSessionService.CancelSession(sessionID, therapistID, req.Reason)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+	if refunds == nil {
+		refunds = []models.Refund{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":       "Group session cancelled successfully",
+		"group_session": session,
+		"refunds":       refunds,
+	})
+}
+
+// ListSessions - Upcoming group sessions patients can register for, filtered by therapist_id,
+// consultation_type and a from/to date range (YYYY-MM-DD)
+func (ctrl *GroupSessionController) ListSessions(c *gin.Context) {
+	var filter services.GroupSessionFilter
+	if therapist := c.Query("therapist_id"); therapist != "" {
+		therapistID, err := uuid.Parse(therapist)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+			return
+		}
+		filter.TherapistID = &therapistID
+	}
+	filter.Type = models.ConsultationType(c.Query("consultation_type"))
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	if from := c.Query("from"); from != "" {
+		date, err := time.ParseInLocation("2006-01-02", from, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from format. Use YYYY-MM-DD."})
+			return
+		}
+		filter.From = date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.ParseInLocation("2006-01-02", to, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to format. Use YYYY-MM-DD."})
+			return
+		}
+		filter.To = date.AddDate(0, 0, 1)
+	}
+
+	sessions, err := ctrl.GroupSessionService.ListSessions(filter)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+func (ctrl *GroupSessionController) GetSession(c *gin.Context) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group session ID"})
+		return
+	}
+
+	session, err := ctrl.GroupSessionService.GetSession(sessionID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, session)
+}
+
+// GetMyRegistrations - Patient's group session registrations, with join links for confirmed seats
+func (ctrl *GroupSessionController) GetMyRegistrations(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	registrations, err := ctrl.GroupSessionService.GetPatientRegistrations(patientID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	result := make([]gin.H, 0, len(registrations))
+	for i := range registrations {
+		registration := &registrations[i]
+		result = append(result, gin.H{
+			"registration":   registration,
+			"group_session":  registration.GroupSession,
+			"therapist_name": registration.GroupSession.Therapist.Name,
+			"meeting":        groupMeetingAccess(c, &registration.GroupSession, registration),
+		})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// Register - Patient takes a seat in a group session, or a place on its waitlist when it is full
+func (ctrl *GroupSessionController) Register(c *gin.Context) {
+	sessionID, patientID, ok := groupSessionAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	registration, session, err := ctrl.GroupSessionService.Register(sessionID, patientID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	response := gin.H{
+		"message":      "Registered for the group session successfully",
+		"registration": registration,
+	}
+	if registration.Status == models.RegistrationPendingPayment {
+		paymentResponse, err := ctrl.PaymentService.CreatePayment(registration.ID.String(), session.Price)
+		if err != nil {
+			// Give the seat back, it can never be paid
+			if _, _, cancelErr := ctrl.GroupSessionService.CancelRegistration(sessionID, patientID); cancelErr != nil {
+				log.Printf("Failed to release group registration %s after payment error: %v", registration.ID, cancelErr)
+			}
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusInternalServerError).
+				WithMessage(err.Error()).
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+		response["redirect_url"] = paymentResponse.RedirectURL
+	}
+	if registration.Status == models.RegistrationWaitlisted {
+		response["message"] = "The group session is full, you are on its waitlist"
+	}
+
+	c.JSON(http.StatusCreated, response)
+}
+
+// PayRegistration - Patient pays for a seat, e.g. one they got from the waitlist
+func (ctrl *GroupSessionController) PayRegistration(c *gin.Context) {
+	sessionID, patientID, ok := groupSessionAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	registration, session, err := ctrl.GroupSessionService.StartPayment(sessionID, patientID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	paymentResponse, err := ctrl.PaymentService.CreatePayment(registration.ID.String(), session.Price)
+	if err != nil {
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage(err.Error()).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"registration_id": registration.ID,
+		"price":           session.Price,
+		"payment_due_at":  registration.PaymentDueAt,
+		"redirect_url":    paymentResponse.RedirectURL,
+	})
+}
+
+// CancelRegistration - Patient gives up their seat or waitlist place, paid seats are refunded by
+// the cancellation policy
+func (ctrl *GroupSessionController) CancelRegistration(c *gin.Context) {
+	sessionID, patientID, ok := groupSessionAndUserIDs(c)
+	if !ok {
+		return
+	}
+
+	registration, refund, err := ctrl.GroupSessionService.CancelRegistration(sessionID, patientID)
+	if err != nil {
+		respondGroupSessionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Group session registration cancelled successfully",
+		"registration": registration,
+		"refund":       refund,
+	})
+}
+
+func groupSessionAndUserIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid group session ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return sessionID, userID, true
+}
+
+// groupMeetingAccess is the meeting room of a group session for the requesting user, left out
+// like meetingAccess when the link cannot be signed
+func groupMeetingAccess(c *gin.Context, session *models.GroupSession, registration *models.GroupRegistration) *services.MeetingAccess {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil
+	}
+	userClaims := claims.(*utilities.Claims)
+	userID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		return nil
+	}
+
+	access, err := services.GroupMeetingAccessFor(session, registration, userID, userClaims.Name, time.Now())
+	if err != nil {
+		log.Printf("Failed to build the meeting link of group session %s: %v", session.ID, err)
+		return nil
+	}
+	return access
+}
+
+func respondGroupSessionError(c *gin.Context, err error) {
+	status, message := http.StatusInternalServerError, apierror.ErrInternalServerError
+	switch {
+	case errors.Is(err, services.ErrInvalidGroupSession):
+		status = http.StatusBadRequest
+		message = fmt.Sprintf("A group session needs a topic, a start in the future, 1 to %d seats and a duration of %d to %d minutes",
+			services.MaxGroupCapacity, services.MinGroupSessionMinutes, services.MaxGroupSessionMinutes)
+	case errors.Is(err, services.ErrInvalidConsultationType):
+		status, message = http.StatusBadRequest, "Group sessions are held online or offline, in a way the therapist offers"
+	case errors.Is(err, services.ErrGroupSessionConflict):
+		status, message = http.StatusConflict, "The group session overlaps other sessions or time off in your schedule"
+	case errors.Is(err, services.ErrGroupSessionNotFound):
+		status, message = http.StatusNotFound, "Group session not found"
+	case errors.Is(err, services.ErrGroupSessionClosed):
+		status, message = http.StatusConflict, "The group session has been cancelled or already started"
+	case errors.Is(err, services.ErrAlreadyRegistered):
+		status, message = http.StatusConflict, "You are already registered for this group session"
+	case errors.Is(err, services.ErrRegistrationNotFound):
+		status, message = http.StatusNotFound, "Group session registration not found"
+	case errors.Is(err, services.ErrNothingToPay):
+		status, message = http.StatusConflict, "Only seats awaiting payment can be paid"
+	}
+
+	apiErr := apierror.NewApiErrorBuilder().
+		WithStatus(status).
+		WithMessage(message).
+		Build()
+	c.JSON(apiErr.HttpStatus, apiErr)
+}
@@ -1,8 +1,12 @@
 package controller
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Hand-TBN1/hand-backend/models"
@@ -12,20 +16,53 @@ import (
 	"github.com/google/uuid"
 )
 
+// Content may be left empty for guided entries, it is then composed from the answers
 type CreateJournalDTO struct {
-	Content string `json:"content" binding:"required"`
+	Content    string            `json:"content"`
+	TemplateID *uuid.UUID        `json:"template_id"`
+	PromptID   *uuid.UUID        `json:"prompt_id"`
+	Answers    map[string]string `json:"answers"`
+	Tags       []string          `json:"tags"`
+	CheckInID  *uuid.UUID        `json:"check_in_id"`
 }
 
+// Leaving out answers, tags or check_in_id keeps the current values
 type UpdateJournalDTO struct {
-	Content string `json:"content" binding:"required"`
+	Content       string            `json:"content"`
+	Answers       map[string]string `json:"answers"`
+	Tags          []string          `json:"tags"`
+	CheckInID     *uuid.UUID        `json:"check_in_id"`
+	UnlinkCheckIn bool              `json:"unlink_check_in"`
 }
 
 type JournalResponseDTO struct {
-    ID      uuid.UUID `json:"id"`
-    Content string    `json:"content"`
-    UserID  uuid.UUID `json:"user_id"`
+    ID         uuid.UUID         `json:"id"`
+    Content    string            `json:"content"`
+    UserID     uuid.UUID         `json:"user_id"`
+    TemplateID *uuid.UUID        `json:"template_id,omitempty"`
+    PromptID   *uuid.UUID        `json:"prompt_id,omitempty"`
+    Answers    map[string]string `json:"answers,omitempty"`
+    Tags       []string          `json:"tags"`
+    CheckInID  *uuid.UUID        `json:"check_in_id"`
+
+    SentimentScore *float64                 `json:"sentiment_score"`
+    SentimentLabel utilities.SentimentLabel `json:"sentiment_label,omitempty"`
+}
+
+type JournalSearchResponseDTO struct {
+	Results  []services.JournalSearchResult `json:"results"`
+	Page     int                            `json:"page"`
+	PageSize int                            `json:"page_size"`
+	Total    int64                          `json:"total"`
 }
 
+const (
+	defaultJournalPageSize = 10
+	maxJournalPageSize     = 50
+	defaultInsightsDays    = 30
+	maxInsightsDays        = 366
+)
+
 type JournalController struct {
 	JournalService *services.JournalService
 }
@@ -60,7 +97,7 @@ func (ctrl *JournalController) GetUserJournals(c *gin.Context) {
         date = &startOfDayUTC
     }
 
-    journals, apiErr := ctrl.JournalService.GetUserJournals(userUUID, date)
+    journals, apiErr := ctrl.JournalService.GetUserJournals(userUUID, date, c.Query("tag"))
     if apiErr != nil {
         c.JSON(apiErr.HttpStatus, apiErr)
         return
@@ -69,11 +106,7 @@ func (ctrl *JournalController) GetUserJournals(c *gin.Context) {
     // Map journals to the response DTO
     var response []JournalResponseDTO
     for _, journal := range journals {
-        response = append(response, JournalResponseDTO{
-            ID:      journal.ID,
-            Content: journal.Content,
-            UserID:  journal.UserID,
-        })
+        response = append(response, toJournalResponseDTO(&journal))
     }
 
     // Return the mapped journals
@@ -88,7 +121,6 @@ func (ctrl *JournalController) CreateJournal(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
 		return
 	}
-	log.Printf("Received content: %v", dto.Content)
 
 	claims, exists := c.Get("claims")
 	if !exists {
@@ -107,15 +139,21 @@ func (ctrl *JournalController) CreateJournal(c *gin.Context) {
 
 
 	journal := models.Journal{
-		ID:        uuid.New(),
-		Content:   dto.Content,
-		UserID:    userUUID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+		ID:         uuid.New(),
+		Content:    dto.Content,
+		UserID:     userUUID,
+		TemplateID: dto.TemplateID,
+		PromptID:   dto.PromptID,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
 	}
 	log.Printf("Generated Journal ID: %v", journal.ID)
 
-	apiErr := ctrl.JournalService.CreateJournal(&journal)
+	apiErr := ctrl.JournalService.CreateJournal(&journal, services.JournalInput{
+		Answers:   dto.Answers,
+		Tags:      dto.Tags,
+		CheckInID: dto.CheckInID,
+	})
 	if apiErr != nil {
 		c.JSON(apiErr.HttpStatus, apiErr)
 		return
@@ -123,3 +161,349 @@ func (ctrl *JournalController) CreateJournal(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, gin.H{"message": "Journal created successfully"})
 }
+
+func (ctrl *JournalController) UpdateJournal(c *gin.Context) {
+	var dto UpdateJournalDTO
+
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+		return
+	}
+
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	journalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid journal ID"})
+		return
+	}
+
+	journal, apiErr := ctrl.JournalService.UpdateJournal(userUUID, journalID, dto.Content, services.JournalInput{
+		Answers:       dto.Answers,
+		Tags:          dto.Tags,
+		CheckInID:     dto.CheckInID,
+		UnlinkCheckIn: dto.UnlinkCheckIn,
+	})
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, toJournalResponseDTO(journal))
+}
+
+func (ctrl *JournalController) DeleteJournal(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	journalID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid journal ID"})
+		return
+	}
+
+	if apiErr := ctrl.JournalService.DeleteJournal(userUUID, journalID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SearchJournals - Full-text search with optional start_date/end_date (YYYY-MM-DD, inclusive) and pagination
+func (ctrl *JournalController) SearchJournals(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	params := services.JournalSearchParams{Query: c.Query("q")}
+	if params.Query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'q' is required"})
+		return
+	}
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	if startParam := c.Query("start_date"); startParam != "" {
+		start, err := time.ParseInLocation("2006-01-02", startParam, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD."})
+			return
+		}
+		start = start.UTC()
+		params.From = &start
+	}
+	if endParam := c.Query("end_date"); endParam != "" {
+		end, err := time.ParseInLocation("2006-01-02", endParam, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD."})
+			return
+		}
+		end = end.AddDate(0, 0, 1).UTC()
+		params.To = &end
+	}
+	if params.From != nil && params.To != nil && !params.From.Before(*params.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_date must not be after end_date"})
+		return
+	}
+
+	params.Page, params.PageSize, err = parsePagination(c, defaultJournalPageSize, maxJournalPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, total, apiErr := ctrl.JournalService.SearchJournals(userUUID, params)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, JournalSearchResponseDTO{
+		Results:  results,
+		Page:     params.Page,
+		PageSize: params.PageSize,
+		Total:    total,
+	})
+}
+
+func (ctrl *JournalController) GetTags(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	tags, apiErr := ctrl.JournalService.GetTags(userUUID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func (ctrl *JournalController) DeleteTag(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	tagID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tag ID"})
+		return
+	}
+
+	if apiErr := ctrl.JournalService.DeleteTag(userUUID, tagID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetCalendar - Check-in mood and journal count for every day of ?month=YYYY-MM (default: current month)
+func (ctrl *JournalController) GetCalendar(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	month := time.Now().In(loc)
+	if monthParam := c.Query("month"); monthParam != "" {
+		month, err = time.ParseInLocation("2006-01", monthParam, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format. Use YYYY-MM."})
+			return
+		}
+	}
+
+	days, apiErr := ctrl.JournalService.GetCalendar(userUUID, month.Year(), month.Month(), loc)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"month": month.Format("2006-01"),
+		"days":  days,
+	})
+}
+
+// GetMoodInsights - Compare check-in moods with journal sentiment, from/to default to the last 30 days
+func (ctrl *JournalController) GetMoodInsights(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	loc, _ := time.LoadLocation("Asia/Jakarta")
+	to := time.Now().In(loc)
+	if toParam := c.Query("to"); toParam != "" {
+		to, err = time.ParseInLocation("2006-01-02", toParam, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to format. Use YYYY-MM-DD."})
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -(defaultInsightsDays - 1))
+	if fromParam := c.Query("from"); fromParam != "" {
+		from, err = time.ParseInLocation("2006-01-02", fromParam, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from format. Use YYYY-MM-DD."})
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) > maxInsightsDays*24*time.Hour {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("from must be before to and at most %d days apart", maxInsightsDays)})
+		return
+	}
+
+	insights, apiErr := ctrl.JournalService.GetMoodInsights(userUUID, from, to, loc)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, insights)
+}
+
+// BackfillSentiment - Score journals that are missing a score or were scored by an older lexicon
+func (ctrl *JournalController) BackfillSentiment(c *gin.Context) {
+	scored, err := ctrl.JournalService.BackfillSentiment()
+	if err != nil {
+		log.Printf("Journal sentiment backfill stopped after %d journals: %v", scored, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to score journals", "scored_journals": scored})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Journal sentiment backfilled successfully", "scored_journals": scored})
+}
+
+// RotateKeys - Re-encrypt every user's journals under a fresh data key
+func (ctrl *JournalController) RotateKeys(c *gin.Context) {
+	rotated, err := ctrl.JournalService.RotateAllKeys()
+	if err != nil {
+		log.Printf("Journal key rotation stopped after %d users: %v", rotated, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate journal keys", "rotated_users": rotated})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Journal keys rotated successfully", "rotated_users": rotated})
+}
+
+// parsePagination reads the page and page_size query parameters, page starts at 1
+func parsePagination(c *gin.Context, defaultSize, maxSize int) (int, int, error) {
+	page, pageSize := 1, defaultSize
+
+	if pageParam := c.Query("page"); pageParam != "" {
+		parsed, err := strconv.Atoi(pageParam)
+		if err != nil || parsed < 1 {
+			return 0, 0, errors.New("'page' must be a positive integer")
+		}
+		page = parsed
+	}
+	if sizeParam := c.Query("page_size"); sizeParam != "" {
+		parsed, err := strconv.Atoi(sizeParam)
+		if err != nil || parsed < 1 || parsed > maxSize {
+			return 0, 0, fmt.Errorf("'page_size' must be between 1 and %d", maxSize)
+		}
+		pageSize = parsed
+	}
+
+	return page, pageSize, nil
+}
+
+func toJournalResponseDTO(journal *models.Journal) JournalResponseDTO {
+	response := JournalResponseDTO{
+		ID:         journal.ID,
+		Content:    journal.Content,
+		UserID:     journal.UserID,
+		TemplateID: journal.TemplateID,
+		PromptID:   journal.PromptID,
+		Tags:       make([]string, len(journal.Tags)),
+		CheckInID:  journal.CheckInID,
+	}
+	for i, tag := range journal.Tags {
+		response.Tags[i] = tag.Name
+	}
+	if journal.SentimentScore != nil {
+		response.SentimentScore = journal.SentimentScore
+		response.SentimentLabel = utilities.SentimentLabelFor(*journal.SentimentScore)
+	}
+	if journal.Answers != "" {
+		if err := json.Unmarshal([]byte(journal.Answers), &response.Answers); err != nil {
+			log.Printf("Failed to decode answers of journal %s: %v", journal.ID, err)
+		}
+	}
+	return response
+}
@@ -0,0 +1,273 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type JournalTemplateDTO struct {
+	Name        string                         `json:"name" binding:"required"`
+	Category    models.JournalTemplateCategory `json:"category" binding:"required"`
+	Description string                         `json:"description"`
+	Fields      models.JournalTemplateFields   `json:"fields" binding:"required"`
+	IsActive    *bool                          `json:"is_active"`
+}
+
+type JournalPromptDTO struct {
+	Text       string     `json:"text" binding:"required"`
+	TemplateID *uuid.UUID `json:"template_id"`
+	MinMood    *int       `json:"min_mood"`
+	MaxMood    *int       `json:"max_mood"`
+	IsActive   *bool      `json:"is_active"`
+}
+
+type JournalTemplateController struct {
+	JournalTemplateService *services.JournalTemplateService
+	CheckInService         *services.CheckInService
+}
+
+// GetTemplates - Active templates, admins can pass include_inactive=true
+func (ctrl *JournalTemplateController) GetTemplates(c *gin.Context) {
+	templates, apiErr := ctrl.JournalTemplateService.GetTemplates(ctrl.includeInactive(c))
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+func (ctrl *JournalTemplateController) CreateTemplate(c *gin.Context) {
+	var dto JournalTemplateDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	if !isJournalTemplateCategory(dto.Category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template category"})
+		return
+	}
+
+	template := models.JournalTemplate{
+		ID:          uuid.New(),
+		Name:        dto.Name,
+		Category:    dto.Category,
+		Description: dto.Description,
+		Fields:      dto.Fields,
+		IsActive:    dto.IsActive == nil || *dto.IsActive,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+
+	if apiErr := ctrl.JournalTemplateService.SaveTemplate(&template); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, template)
+}
+
+func (ctrl *JournalTemplateController) UpdateTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	var dto JournalTemplateDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	if !isJournalTemplateCategory(dto.Category) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template category"})
+		return
+	}
+
+	template, apiErr := ctrl.JournalTemplateService.GetTemplate(id)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	template.Name = dto.Name
+	template.Category = dto.Category
+	template.Description = dto.Description
+	template.Fields = dto.Fields
+	if dto.IsActive != nil {
+		template.IsActive = *dto.IsActive
+	}
+	template.UpdatedAt = time.Now()
+
+	if apiErr := ctrl.JournalTemplateService.SaveTemplate(template); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func (ctrl *JournalTemplateController) ArchiveTemplate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+		return
+	}
+
+	if apiErr := ctrl.JournalTemplateService.ArchiveTemplate(id); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *JournalTemplateController) GetPrompts(c *gin.Context) {
+	prompts, apiErr := ctrl.JournalTemplateService.GetPrompts(ctrl.includeInactive(c))
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, prompts)
+}
+
+func (ctrl *JournalTemplateController) CreatePrompt(c *gin.Context) {
+	var dto JournalPromptDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	prompt := models.JournalPrompt{
+		ID:         uuid.New(),
+		Text:       dto.Text,
+		TemplateID: dto.TemplateID,
+		MinMood:    dto.MinMood,
+		MaxMood:    dto.MaxMood,
+		IsActive:   dto.IsActive == nil || *dto.IsActive,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
+
+	if apiErr := ctrl.JournalTemplateService.SavePrompt(&prompt); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, prompt)
+}
+
+func (ctrl *JournalTemplateController) UpdatePrompt(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt ID"})
+		return
+	}
+
+	var dto JournalPromptDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	prompt, apiErr := ctrl.JournalTemplateService.GetPrompt(id)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	prompt.Text = dto.Text
+	prompt.TemplateID = dto.TemplateID
+	prompt.MinMood = dto.MinMood
+	prompt.MaxMood = dto.MaxMood
+	if dto.IsActive != nil {
+		prompt.IsActive = *dto.IsActive
+	}
+	prompt.UpdatedAt = time.Now()
+
+	if apiErr := ctrl.JournalTemplateService.SavePrompt(prompt); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, prompt)
+}
+
+func (ctrl *JournalTemplateController) ArchivePrompt(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid prompt ID"})
+		return
+	}
+
+	if apiErr := ctrl.JournalTemplateService.ArchivePrompt(id); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetDailyPrompt - Suggest today's prompt, steered by the mood of today's check-in
+func (ctrl *JournalTemplateController) GetDailyPrompt(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	var mood *int
+	checkIn, err := ctrl.CheckInService.CheckTodayCheckIn(userUUID)
+	if err == nil {
+		mood = &checkIn.MoodScore
+	} else if err != gorm.ErrRecordNotFound {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	location, _ := time.LoadLocation("Asia/Jakarta")
+	today := time.Now().In(location).Format("2006-01-02")
+
+	prompt, apiErr := ctrl.JournalTemplateService.GetDailyPrompt(userUUID, mood, today)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"date":       today,
+		"mood_score": mood,
+		"prompt":     prompt,
+	})
+}
+
+func (ctrl *JournalTemplateController) includeInactive(c *gin.Context) bool {
+	claims, exists := c.Get("claims")
+	if !exists || claims.(*utilities.Claims).Role != string(models.Admin) {
+		return false
+	}
+	return c.Query("include_inactive") == "true"
+}
+
+func isJournalTemplateCategory(category models.JournalTemplateCategory) bool {
+	switch category {
+	case models.GratitudeTemplate, models.ThoughtRecordTemplate, models.WorryLogTemplate, models.FreeWritingTemplate:
+		return true
+	}
+	return false
+}
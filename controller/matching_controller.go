@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultRecommendations = 10
+	maxRecommendations     = 20
+)
+
+type MatchingController struct {
+	MatchingService *services.MatchingService
+}
+
+func (ctrl *MatchingController) GetQuestionnaire(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	questionnaire, apiErr := ctrl.MatchingService.GetQuestionnaire(patientID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, questionnaire)
+}
+
+// SaveQuestionnaire - Patient answers the intake: concern_ids (specializations), language,
+// gender, budget_max, consultation_type, preferred_days (0 is Sunday) and preferred_times
+// (morning, afternoon, evening). Left out answers mean no preference.
+func (ctrl *MatchingController) SaveQuestionnaire(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var answers models.MatchingAnswers
+	if err := c.ShouldBindJSON(&answers); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	questionnaire, apiErr := ctrl.MatchingService.SaveQuestionnaire(patientID, answers)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, questionnaire)
+}
+
+// GetRecommendations - Therapists best fitting the patient's questionnaire, with why they fit
+func (ctrl *MatchingController) GetRecommendations(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+	limit := defaultRecommendations
+	if limitParam := c.Query("limit"); limitParam != "" {
+		var err error
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxRecommendations {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'limit' must be between 1 and %d", maxRecommendations)})
+			return
+		}
+	}
+
+	recommendations, apiErr := ctrl.MatchingService.Recommend(patientID, limit)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recommendations": recommendations})
+}
+
+func (ctrl *MatchingController) GetWeights(c *gin.Context) {
+	weights, apiErr := ctrl.MatchingService.GetWeights()
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, weights)
+}
+
+// UpdateWeights - Admin sets how much each criterion counts towards the match score
+func (ctrl *MatchingController) UpdateWeights(c *gin.Context) {
+	adminID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Concerns     *float64 `json:"concerns" binding:"required"`
+		Language     *float64 `json:"language" binding:"required"`
+		Gender       *float64 `json:"gender" binding:"required"`
+		Budget       *float64 `json:"budget" binding:"required"`
+		Availability *float64 `json:"availability" binding:"required"`
+		Rating       *float64 `json:"rating" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	weights, apiErr := ctrl.MatchingService.UpdateWeights(adminID, models.MatchingWeights{
+		Concerns:     *req.Concerns,
+		Language:     *req.Language,
+		Gender:       *req.Gender,
+		Budget:       *req.Budget,
+		Availability: *req.Availability,
+		Rating:       *req.Rating,
+	})
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, weights)
+}
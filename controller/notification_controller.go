@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationPreferencesDTO struct {
+	AppointmentReminders *bool `json:"appointment_reminders"`
+	CheckInReminders     *bool `json:"check_in_reminders"`
+}
+
+type NotificationController struct {
+	NotificationService *services.NotificationService
+}
+
+func (ctrl *NotificationController) GetPreferences(c *gin.Context) {
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	preference, apiErr := ctrl.NotificationService.GetPreferences(userID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, preference)
+}
+
+// UpdatePreferences - Turn notifications on or off, fields that are left out keep their value
+func (ctrl *NotificationController) UpdatePreferences(c *gin.Context) {
+	userID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto NotificationPreferencesDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	preference, apiErr := ctrl.NotificationService.UpdatePreferences(userID, dto.AppointmentReminders, dto.CheckInReminders)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, preference)
+}
@@ -0,0 +1,58 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RefundController struct {
+	RefundService *services.RefundService
+}
+
+// GetRefunds - All refunds for admins, filter with status=pending to find the ones still to pay out
+func (ctrl *RefundController) GetRefunds(c *gin.Context) {
+	status := models.RefundStatus(c.Query("status"))
+	switch status {
+	case "", models.RefundPending, models.RefundProcessed, models.RefundFailed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund status"})
+		return
+	}
+
+	refunds, apiErr := ctrl.RefundService.GetRefunds(status)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// GetMyRefunds - Refunds owed or paid to the logged in patient
+func (ctrl *RefundController) GetMyRefunds(c *gin.Context) {
+	claims, exists := c.Get("claims")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized access"})
+		return
+	}
+
+	userClaims := claims.(*utilities.Claims)
+	userUUID, err := uuid.Parse(userClaims.UserID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID in token"})
+		return
+	}
+
+	refunds, apiErr := ctrl.RefundService.GetUserRefunds(userUUID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultReviewPageSize = 10
+	maxReviewPageSize     = 50
+)
+
+type ReviewController struct {
+	ReviewService *services.ReviewService
+}
+
+// SubmitReview - Patient rates one of their completed appointments
+func (ctrl *ReviewController) SubmitReview(c *gin.Context) {
+	appointmentID, patientID, ok := appointmentAndPatientIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Rating      int    `json:"rating" binding:"required"`
+		Comment     string `json:"comment"`
+		IsAnonymous bool   `json:"is_anonymous"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	review, apiErr := ctrl.ReviewService.SubmitReview(patientID, appointmentID, req.Rating, req.Comment, req.IsAnonymous)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, review)
+}
+
+func (ctrl *ReviewController) GetMyReviews(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	reviews, apiErr := ctrl.ReviewService.GetPatientReviews(patientID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// GetTherapistReviews - A page of a therapist's published reviews with their replies
+func (ctrl *ReviewController) GetTherapistReviews(c *gin.Context) {
+	therapistID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+		return
+	}
+	page, pageSize, err := parsePagination(c, defaultReviewPageSize, maxReviewPageSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reviews, total, apiErr := ctrl.ReviewService.GetTherapistReviews(therapistID, page, pageSize)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reviews":   reviews,
+		"page":      page,
+		"page_size": pageSize,
+		"total":     total,
+	})
+}
+
+// ReplyToReview - Therapist answers a review of one of their sessions, an empty reply removes it
+func (ctrl *ReviewController) ReplyToReview(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+	reviewID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var req struct {
+		Reply string `json:"reply"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	review, apiErr := ctrl.ReviewService.ReplyToReview(therapistID, reviewID, req.Reply)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+// GetReviews - All reviews for admins, filter with status=hidden to see the moderated ones
+func (ctrl *ReviewController) GetReviews(c *gin.Context) {
+	status := models.ReviewStatus(c.Query("status"))
+	switch status {
+	case "", models.ReviewPublished, models.ReviewHidden:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review status"})
+		return
+	}
+
+	reviews, apiErr := ctrl.ReviewService.GetReviews(status)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// ModerateReview - Admin hides a review or publishes it again
+func (ctrl *ReviewController) ModerateReview(c *gin.Context) {
+	adminID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+	reviewID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review ID"})
+		return
+	}
+
+	var req struct {
+		Status models.ReviewStatus `json:"status" binding:"required"`
+		Reason string              `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+	if req.Status != models.ReviewPublished && req.Status != models.ReviewHidden {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review status"})
+		return
+	}
+
+	review, apiErr := ctrl.ReviewService.ModerateReview(adminID, reviewID, req.Status, req.Reason)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
@@ -0,0 +1,373 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type WorkingHoursDTO struct {
+	Weekday          *time.Weekday           `json:"weekday" binding:"required"`
+	ConsultationType models.ConsultationType `json:"consultation_type" binding:"required"`
+	StartTime        string                  `json:"start_time" binding:"required"`
+	EndTime          string                  `json:"end_time" binding:"required"`
+	Breaks           models.ScheduleWindows  `json:"breaks"`
+}
+
+type DateOverrideDTO struct {
+	IsAvailable *bool                  `json:"is_available" binding:"required"`
+	Windows     models.ScheduleWindows `json:"windows"`
+}
+
+type TimeOffDTO struct {
+	StartsAt time.Time `json:"starts_at" binding:"required"`
+	EndsAt   time.Time `json:"ends_at" binding:"required"`
+	Reason   string    `json:"reason"`
+}
+
+type DateRangeDTO struct {
+	StartDate string `json:"start_date" binding:"required"`
+	EndDate   string `json:"end_date" binding:"required"`
+}
+
+// AvailabilityExceptionDTO blocks or changes many dates at once, e.g. leave or public holidays
+type AvailabilityExceptionDTO struct {
+	Ranges      []DateRangeDTO         `json:"ranges" binding:"required,min=1,dive"`
+	Weekdays    []time.Weekday         `json:"weekdays"`     // Only these weekdays of the ranges, all when empty
+	RepeatYears int                    `json:"repeat_years"` // Repeat on the same dates in the following years
+	IsAvailable *bool                  `json:"is_available" binding:"required"`
+	Windows     models.ScheduleWindows `json:"windows"`
+	DryRun      bool                   `json:"dry_run"` // Only list the conflicting appointments
+}
+
+type TimeOffRangesDTO struct {
+	Ranges      []TimeOffDTO `json:"ranges" binding:"required,min=1,dive"`
+	RepeatYears int          `json:"repeat_years"`
+	DryRun      bool         `json:"dry_run"`
+}
+
+type BookingSettingsDTO struct {
+	MinNoticeHours    *int `json:"min_notice_hours" binding:"required"`
+	BookingWindowDays *int `json:"booking_window_days" binding:"required"`
+}
+
+type ScheduleController struct {
+	ScheduleService *services.ScheduleService
+}
+
+// GetMyWorkingHours - The logged in therapist's weekly hours
+func (ctrl *ScheduleController) GetMyWorkingHours(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+	ctrl.respondWorkingHours(c, therapistID)
+}
+
+// GetWorkingHours - A therapist's weekly hours, public so patients can see when to book
+func (ctrl *ScheduleController) GetWorkingHours(c *gin.Context) {
+	therapistID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+		return
+	}
+	ctrl.respondWorkingHours(c, therapistID)
+}
+
+// ReplaceWorkingHours - Replace the whole week, each block is one weekday, type and time range
+func (ctrl *ScheduleController) ReplaceWorkingHours(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto struct {
+		Hours []WorkingHoursDTO `json:"hours" binding:"required,dive"`
+	}
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	hours := make([]models.WorkingHours, len(dto.Hours))
+	for i, block := range dto.Hours {
+		hours[i] = models.WorkingHours{
+			Weekday:          *block.Weekday,
+			ConsultationType: block.ConsultationType,
+			StartTime:        block.StartTime,
+			EndTime:          block.EndTime,
+			Breaks:           block.Breaks,
+		}
+	}
+
+	saved, apiErr := ctrl.ScheduleService.ReplaceWorkingHours(therapistID, hours)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"is_default": false, "hours": saved})
+}
+
+// GetDateOverrides - Overrides between from and to (YYYY-MM-DD), defaults to the next 30 days
+func (ctrl *ScheduleController) GetDateOverrides(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	from := services.LocalDay(time.Now())
+	to := from.AddDate(0, 0, 30)
+	var err error
+	if fromParam := c.Query("from"); fromParam != "" {
+		if from, err = time.Parse("2006-01-02", fromParam); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from format. Use YYYY-MM-DD."})
+			return
+		}
+	}
+	if toParam := c.Query("to"); toParam != "" {
+		if to, err = time.Parse("2006-01-02", toParam); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to format. Use YYYY-MM-DD."})
+			return
+		}
+	}
+
+	overrides, apiErr := ctrl.ScheduleService.GetDateOverrides(therapistID, from, to)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, overrides)
+}
+
+// SetDateOverride - Take a date off, or work other hours than usual on it
+func (ctrl *ScheduleController) SetDateOverride(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD."})
+		return
+	}
+
+	var dto DateOverrideDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	override, apiErr := ctrl.ScheduleService.SetDateOverride(therapistID, date, *dto.IsAvailable, dto.Windows)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, override)
+}
+
+// DeleteDateOverride - Go back to the weekly hours on a date
+func (ctrl *ScheduleController) DeleteDateOverride(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", c.Param("date"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format. Use YYYY-MM-DD."})
+		return
+	}
+
+	if apiErr := ctrl.ScheduleService.DeleteDateOverride(therapistID, date); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ApplyAvailabilityException - Override date ranges in one request, listing the booked
+// appointments that fall in the blocked time so they can be rescheduled
+func (ctrl *ScheduleController) ApplyAvailabilityException(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto AvailabilityExceptionDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	exception := services.AvailabilityException{
+		Weekdays:    dto.Weekdays,
+		RepeatYears: dto.RepeatYears,
+		IsAvailable: *dto.IsAvailable,
+		Windows:     dto.Windows,
+	}
+	for _, r := range dto.Ranges {
+		from, err := time.Parse("2006-01-02", r.StartDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD."})
+			return
+		}
+		to, err := time.Parse("2006-01-02", r.EndDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD."})
+			return
+		}
+		exception.Ranges = append(exception.Ranges, services.DateRange{From: from, To: to})
+	}
+
+	overrides, conflicts, apiErr := ctrl.ScheduleService.ApplyAvailabilityException(therapistID, exception, dto.DryRun)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"dry_run": dto.DryRun, "overrides": overrides, "conflicts": conflicts})
+}
+
+func (ctrl *ScheduleController) GetTimeOff(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	timeOff, apiErr := ctrl.ScheduleService.GetTimeOff(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, timeOff)
+}
+
+func (ctrl *ScheduleController) AddTimeOff(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto TimeOffDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	timeOff := models.TimeOff{
+		ID:          uuid.New(),
+		TherapistID: therapistID,
+		StartsAt:    dto.StartsAt,
+		EndsAt:      dto.EndsAt,
+		Reason:      dto.Reason,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if apiErr := ctrl.ScheduleService.AddTimeOff(&timeOff); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, timeOff)
+}
+
+// AddTimeOffRanges - Add several time off ranges in one request, listing the booked
+// appointments that fall in them
+func (ctrl *ScheduleController) AddTimeOffRanges(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto TimeOffRangesDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	ranges := make([]models.TimeOff, len(dto.Ranges))
+	for i, r := range dto.Ranges {
+		ranges[i] = models.TimeOff{StartsAt: r.StartsAt, EndsAt: r.EndsAt, Reason: r.Reason}
+	}
+
+	timeOff, conflicts, apiErr := ctrl.ScheduleService.AddTimeOffRanges(therapistID, ranges, dto.RepeatYears, dto.DryRun)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	status := http.StatusCreated
+	if dto.DryRun {
+		status = http.StatusOK
+	}
+	c.JSON(status, gin.H{"dry_run": dto.DryRun, "time_off": timeOff, "conflicts": conflicts})
+}
+
+func (ctrl *ScheduleController) DeleteTimeOff(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	timeOffID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time off ID"})
+		return
+	}
+
+	if apiErr := ctrl.ScheduleService.DeleteTimeOff(therapistID, timeOffID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateBookingSettings - How short notice and how far ahead patients may book
+func (ctrl *ScheduleController) UpdateBookingSettings(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto BookingSettingsDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	if apiErr := ctrl.ScheduleService.UpdateBookingSettings(therapistID, *dto.MinNoticeHours, *dto.BookingWindowDays); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"min_notice_hours":    *dto.MinNoticeHours,
+		"booking_window_days": *dto.BookingWindowDays,
+	})
+}
+
+func (ctrl *ScheduleController) respondWorkingHours(c *gin.Context, therapistID uuid.UUID) {
+	hours, isDefault, apiErr := ctrl.ScheduleService.GetWorkingHours(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"is_default": isDefault, "hours": hours})
+}
+
+// therapistIDFromClaims reads the logged in therapist, the routes only let therapists through
+func therapistIDFromClaims(c *gin.Context) (uuid.UUID, bool) {
+	return userIDFromClaims(c)
+}
@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type SessionTypeDTO struct {
+	Name             string                  `json:"name" binding:"required"`
+	Description      string                  `json:"description"`
+	ConsultationType models.ConsultationType `json:"consultation_type" binding:"required"`
+	DurationMinutes  int                     `json:"duration_minutes" binding:"required"`
+	BufferMinutes    int                     `json:"buffer_minutes"`
+	Price            int64                   `json:"price"`
+	IsActive         *bool                   `json:"is_active"`
+}
+
+type SessionTypeController struct {
+	SessionTypeService *services.SessionTypeService
+}
+
+// GetSessionTypes - Active session types of a therapist, for patients choosing what to book
+func (ctrl *SessionTypeController) GetSessionTypes(c *gin.Context) {
+	therapistID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+		return
+	}
+
+	sessionTypes, apiErr := ctrl.SessionTypeService.GetSessionTypes(therapistID, false)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionTypes)
+}
+
+// GetMySessionTypes - All session types of the logged in therapist, inactive ones included
+func (ctrl *SessionTypeController) GetMySessionTypes(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	sessionTypes, apiErr := ctrl.SessionTypeService.GetSessionTypes(therapistID, true)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionTypes)
+}
+
+func (ctrl *SessionTypeController) CreateSessionType(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto SessionTypeDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	sessionType := models.SessionType{
+		ID:               uuid.New(),
+		TherapistID:      therapistID,
+		Name:             dto.Name,
+		Description:      dto.Description,
+		ConsultationType: dto.ConsultationType,
+		DurationMinutes:  dto.DurationMinutes,
+		BufferMinutes:    dto.BufferMinutes,
+		Price:            dto.Price,
+		IsActive:         dto.IsActive == nil || *dto.IsActive,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+	if apiErr := ctrl.SessionTypeService.SaveSessionType(&sessionType); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, sessionType)
+}
+
+func (ctrl *SessionTypeController) UpdateSessionType(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	sessionTypeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session type ID"})
+		return
+	}
+
+	var dto SessionTypeDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	sessionType, apiErr := ctrl.SessionTypeService.GetSessionType(therapistID, sessionTypeID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	sessionType.Name = dto.Name
+	sessionType.Description = dto.Description
+	sessionType.ConsultationType = dto.ConsultationType
+	sessionType.DurationMinutes = dto.DurationMinutes
+	sessionType.BufferMinutes = dto.BufferMinutes
+	sessionType.Price = dto.Price
+	if dto.IsActive != nil {
+		sessionType.IsActive = *dto.IsActive
+	}
+	sessionType.UpdatedAt = time.Now()
+
+	if apiErr := ctrl.SessionTypeService.SaveSessionType(sessionType); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, sessionType)
+}
+
+func (ctrl *SessionTypeController) DeactivateSessionType(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	sessionTypeID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session type ID"})
+		return
+	}
+
+	if apiErr := ctrl.SessionTypeService.DeactivateSessionType(therapistID, sessionTypeID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
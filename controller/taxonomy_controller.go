@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TaxonomyController struct {
+	TaxonomyService *services.TaxonomyService
+}
+
+// GetTerms - Active specializations and approaches, filter with kind
+func (ctrl *TaxonomyController) GetTerms(c *gin.Context) {
+	ctrl.getTerms(c, false)
+}
+
+// GetAllTerms - Admins also see deactivated terms
+func (ctrl *TaxonomyController) GetAllTerms(c *gin.Context) {
+	ctrl.getTerms(c, true)
+}
+
+func (ctrl *TaxonomyController) getTerms(c *gin.Context, includeInactive bool) {
+	kind := models.TaxonomyKind(c.Query("kind"))
+	if kind != "" && kind != models.KindSpecialization && kind != models.KindApproach {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kind"})
+		return
+	}
+
+	terms, apiErr := ctrl.TaxonomyService.GetTerms(kind, includeInactive)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, terms)
+}
+
+// CreateTerm - Admin adds a specialization or approach
+func (ctrl *TaxonomyController) CreateTerm(c *gin.Context) {
+	var req struct {
+		Kind models.TaxonomyKind `json:"kind" binding:"required"`
+		Name string              `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	term, apiErr := ctrl.TaxonomyService.CreateTerm(req.Kind, req.Name)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusCreated, term)
+}
+
+// UpdateTerm - Admin renames a term or deactivates it so it can no longer be picked
+func (ctrl *TaxonomyController) UpdateTerm(c *gin.Context) {
+	termID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid term ID"})
+		return
+	}
+
+	var req struct {
+		Name     *string `json:"name"`
+		IsActive *bool   `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	term, apiErr := ctrl.TaxonomyService.UpdateTerm(termID, req.Name, req.IsActive)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, term)
+}
@@ -1,8 +1,11 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/Hand-TBN1/hand-backend/apierror"
@@ -14,12 +17,17 @@ import (
 )
 
 type TherapistController struct {
-	TherapistService           *services.TherapistService
-	AppointmentService         *services.AppointmentService
-	ConsultationHistoryService *services.ConsultationHistoryService
-	PrescriptionService        *services.PrescriptionService
+	TherapistService        *services.TherapistService
+	AppointmentService      *services.AppointmentService
+	TherapistProfileService *services.TherapistProfileService
 }
 
+const (
+	defaultTherapistPageSize = 20
+	maxTherapistPageSize     = 50
+	defaultSearchRadiusKm    = 10
+)
+
 type CreateTherapistDTO struct {
 	Name             string               `json:"name" binding:"required"`
 	Email            string               `json:"email" binding:"required"`
@@ -29,30 +37,100 @@ type CreateTherapistDTO struct {
 	Specialization   string               `json:"specialization" binding:"required"`
 	Consultation     models.ConsultationType `json:"consultation" binding:"required"`
 	AppointmentRate  int64                `json:"appointment_rate" binding:"required"`
+	Languages        []string             `json:"languages"` // ISO 639-1 codes, e.g. ["id", "en"]
+	Gender           models.Gender        `json:"gender"`
 }
 
+// GetTherapistsFiltered - Therapist search. Filters: consultation, location, specialization,
+// min_price, max_price, min_rating, language, gender, date (YYYY-MM-DD, free that day), city
+// and lat, lng with radius_km for offline therapists with a clinic nearby. sort is rating
+// (default), price_asc, price_desc, availability or distance (default near a location); pages
+// continue from cursor.
 func (ctrl *TherapistController) GetTherapistsFiltered(c *gin.Context) {
-	consultationType := c.Query("consultation")
-	location := c.Query("location")
-	dateStr := c.Query("date")
-
-	var date time.Time
-	if dateStr != "" {
-		var err error
-		date, err = time.Parse("2006-01-02", dateStr)
+	params := services.TherapistSearchParams{
+		ConsultationType: models.ConsultationType(c.Query("consultation")),
+		Location:         c.Query("location"),
+		Specialization:   c.Query("specialization"),
+		Language:         c.Query("language"),
+		Gender:           models.Gender(c.Query("gender")),
+		City:             c.Query("city"),
+		Sort:             c.Query("sort"),
+		Cursor:           c.Query("cursor"),
+		Limit:            defaultTherapistPageSize,
+	}
+
+	switch params.Sort {
+	case "", services.TherapistSortRating, services.TherapistSortPriceAsc, services.TherapistSortPriceDesc,
+		services.TherapistSortAvailability, services.TherapistSortDistance:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid sort"})
+		return
+	}
+	if params.Gender != "" && params.Gender != models.Female && params.Gender != models.Male {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gender"})
+		return
+	}
+	if limitParam := c.Query("limit"); limitParam != "" {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 || limit > maxTherapistPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'limit' must be between 1 and %d", maxTherapistPageSize)})
+			return
+		}
+		params.Limit = limit
+	}
+	for name, target := range map[string]**int64{"min_price": &params.MinPrice, "max_price": &params.MaxPrice} {
+		if value := c.Query(name); value != "" {
+			price, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || price < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'%s' must be a non-negative integer", name)})
+				return
+			}
+			*target = &price
+		}
+	}
+	if value := c.Query("min_rating"); value != "" {
+		rating, err := strconv.ParseFloat(value, 64)
+		if err != nil || rating < 0 || rating > 5 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'min_rating' must be between 0 and 5"})
+			return
+		}
+		params.MinRating = &rating
+	}
+	if dateStr := c.Query("date"); dateStr != "" {
+		date, err := time.Parse("2006-01-02", dateStr)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
 			return
 		}
+		params.Date = date
+	}
+	if c.Query("lat") != "" || c.Query("lng") != "" {
+		lat, latErr := strconv.ParseFloat(c.Query("lat"), 64)
+		lng, lngErr := strconv.ParseFloat(c.Query("lng"), 64)
+		point := services.GeoPoint{Latitude: lat, Longitude: lng}
+		if latErr != nil || lngErr != nil || !point.IsValid() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "'lat' and 'lng' must be a valid latitude and longitude"})
+			return
+		}
+		params.Near = &point
+		params.RadiusKm = defaultSearchRadiusKm
+		if value := c.Query("radius_km"); value != "" {
+			radius, err := strconv.ParseFloat(value, 64)
+			if err != nil || radius <= 0 || radius > services.MaxSearchRadiusKm {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("'radius_km' must be above 0 and at most %d", services.MaxSearchRadiusKm)})
+				return
+			}
+			params.RadiusKm = radius
+		}
 	}
 
-	therapists, apiErr := ctrl.TherapistService.GetTherapistsFiltered(consultationType, location, date)
+	page, apiErr := ctrl.TherapistService.SearchTherapists(params)
 	if apiErr != nil {
 		c.JSON(apiErr.HttpStatus, apiErr)
 		return
 	}
 
-	c.JSON(http.StatusOK, therapists)
+	c.JSON(http.StatusOK, page)
 }
 
 func (ctrl *TherapistController) CreateTherapist(c *gin.Context) {
@@ -62,6 +140,10 @@ func (ctrl *TherapistController) CreateTherapist(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
 		return
 	}
+	if createTherapistDTO.Gender != "" && createTherapistDTO.Gender != models.Female && createTherapistDTO.Gender != models.Male {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid gender"})
+		return
+	}
 	var existingUser models.User
 	if err := ctrl.TherapistService.DB.Where("email = ?", createTherapistDTO.Email).First(&existingUser).Error; err == nil {
 		c.JSON(http.StatusConflict, gin.H{"error": "User with this email already exists"})
@@ -99,6 +181,8 @@ func (ctrl *TherapistController) CreateTherapist(c *gin.Context) {
 		Specialization:  createTherapistDTO.Specialization,
 		Consultation:    createTherapistDTO.Consultation,
 		AppointmentRate: createTherapistDTO.AppointmentRate,
+		Languages:       services.NormalizeLanguages(createTherapistDTO.Languages),
+		Gender:          createTherapistDTO.Gender,
 		CreatedAt:       time.Now(),
 		UpdatedAt:       time.Now(),
 	}
@@ -114,7 +198,10 @@ func (ctrl *TherapistController) CreateTherapist(c *gin.Context) {
 
 func (ctrl *TherapistController) UpdateAvailability(c *gin.Context) {
 	claims, exists := c.Get("claims")
-	var availabilityDTO map[string]interface{}
+	var availabilityDTO struct {
+		Date        string `json:"date" binding:"required"`
+		IsAvailable *bool  `json:"is_available" binding:"required"`
+	}
 	
 	if !exists {
 		c.JSON(http.StatusUnauthorized, apierror.NewApiErrorBuilder().
@@ -135,30 +222,19 @@ func (ctrl *TherapistController) UpdateAvailability(c *gin.Context) {
 		return
 	}
 
+	// Both fields are required, a missing or mistyped one used to panic the handler
 	if err := c.ShouldBindJSON(&availabilityDTO); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "'date' and 'is_available' are required", "details": err.Error()})
 		return
 	}
 
-	if _, ok := availabilityDTO["is_available"]; !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "'is_available' is required"})
-		return
-	}
-	
-	var finalDTO struct {
-		Date        string `json:"date"`
-		IsAvailable bool   `json:"is_available"`
-	}
-	
-	finalDTO.Date = availabilityDTO["date"].(string)
-	finalDTO.IsAvailable = availabilityDTO["is_available"].(bool)
-	date, err := time.Parse("2006-01-02",finalDTO.Date)
+	date, err := time.Parse("2006-01-02", availabilityDTO.Date)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
 		return
 	}
 
-	apiErr := ctrl.TherapistService.UpdateAvailabilityByDate(therapistUUID.String(), date, finalDTO.IsAvailable)
+	apiErr := ctrl.TherapistService.UpdateAvailabilityByDate(therapistUUID.String(), date, *availabilityDTO.IsAvailable)
 	if apiErr != nil {
 		c.JSON(apiErr.HttpStatus, apiErr)
 		return
@@ -176,6 +252,11 @@ func (ctrl *TherapistController) GetTherapistDetails(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
 		return
 	}
+	profile, apiErr := ctrl.TherapistProfileService.GetProfile(therapist.UserID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
 
 	// Respond with both Therapist and User details
 	c.JSON(http.StatusOK, gin.H{
@@ -189,6 +270,9 @@ func (ctrl *TherapistController) GetTherapistDetails(c *gin.Context) {
 			"specialization": therapist.Specialization,
 			"consultation_type": therapist.Consultation,
 			"appointment_rate": therapist.AppointmentRate,
+			"rating":           math.Round(therapist.RatingAverage*10) / 10,
+			"review_count":     therapist.ReviewCount,
+			"profile":          profile,
 		},
 	})
 }
@@ -199,8 +283,17 @@ func (ctrl *TherapistController) GetTherapistSchedule(c *gin.Context) {
 	therapistID := c.Param("id")
 	date := c.Query("date") // Optional
 	consultationType := c.Query("type") // online/offline
+	sessionTypeID := c.Query("session_type_id") // Optional, defaults to a one hour session
 
-	schedules, err := ctrl.TherapistService.GetAvailableSchedules(therapistID, date, consultationType)
+	schedules, err := ctrl.TherapistService.GetAvailableSchedules(therapistID, date, consultationType, sessionTypeID)
+	if errors.Is(err, services.ErrSessionTypeNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session type not found"})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidConsultationType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The session type is not offered for this consultation type"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Schedule not found"})
 		return
@@ -230,16 +323,99 @@ func (ctrl *TherapistController) GetTherapistAppointments(c *gin.Context) {
 	c.JSON(http.StatusOK, appointments)
 }
 
-// AddPrescriptionAndMedication allows therapists to add a prescription and medication after the appointment
-func (ctrl *TherapistController) AddPrescriptionAndMedication(c *gin.Context) {
+// DeclineAppointment - Therapist cancels a booking before it starts, the patient gets a full refund
+func (ctrl *TherapistController) DeclineAppointment(c *gin.Context) {
+	appointmentID, therapistID, ok := appointmentAndTherapistIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiErr := apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(apierror.ErrInvalidInput).
+				Build()
+			c.JSON(apiErr.HttpStatus, apiErr)
+			return
+		}
+	}
+
+	appointment, refund, err := ctrl.AppointmentService.DeclineByTherapist(appointmentID, therapistID, req.Reason)
+	if err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Appointment declined successfully",
+		"appointment_id": appointment.ID,
+		"status":         appointment.Status,
+		"refund":         refund,
+	})
+}
+
+// StartAppointment - Therapist starts a confirmed session
+func (ctrl *TherapistController) StartAppointment(c *gin.Context) {
+	ctrl.changeAppointmentStatus(c, ctrl.AppointmentService.StartSession, "Session started")
+}
+
+// CompleteAppointment - Therapist ends a session in progress
+func (ctrl *TherapistController) CompleteAppointment(c *gin.Context) {
+	ctrl.changeAppointmentStatus(c, ctrl.AppointmentService.CompleteSession, "Session completed")
+}
+
+// MarkAppointmentNoShow - Therapist records that the patient did not come
+func (ctrl *TherapistController) MarkAppointmentNoShow(c *gin.Context) {
+	ctrl.changeAppointmentStatus(c, ctrl.AppointmentService.MarkNoShow, "Appointment marked as no-show")
+}
+
+func (ctrl *TherapistController) changeAppointmentStatus(c *gin.Context, change func(appointmentID, therapistID uuid.UUID) (*models.Appointment, error), message string) {
+	appointmentID, therapistID, ok := appointmentAndTherapistIDs(c)
+	if !ok {
+		return
+	}
+
+	appointment, err := change(appointmentID, therapistID)
+	if err != nil {
+		respondAppointmentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           message,
+		"appointment_id":    appointment.ID,
+		"status":            appointment.Status,
+		"status_changed_at": appointment.StatusChangedAt,
+	})
+}
+
+func appointmentAndTherapistIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
 	appointmentID, err := uuid.Parse(c.Param("appointmentID"))
-	fmt.Println(appointmentID)
 	if err != nil {
 		apiErr := apierror.NewApiErrorBuilder().
 			WithStatus(http.StatusBadRequest).
 			WithMessage("Invalid appointment ID").
 			Build()
 		c.JSON(apiErr.HttpStatus, apiErr)
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	return appointmentID, therapistID, true
+}
+
+// AddPrescriptionAndMedication allows therapists to add a prescription and medication to one of
+// their sessions once it has started
+func (ctrl *TherapistController) AddPrescriptionAndMedication(c *gin.Context) {
+	appointmentID, therapistID, ok := appointmentAndTherapistIDs(c)
+	if !ok {
 		return
 	}
 
@@ -261,45 +437,25 @@ func (ctrl *TherapistController) AddPrescriptionAndMedication(c *gin.Context) {
 		return
 	}
 
-	// Save the consultation history
 	consultationHistory := models.ConsultationHistory{
 		ID:         uuid.New(),
-		AppointmentID:    appointmentID,
 		Conclusion:       req.Conclusion,
 		ConsultationDate: time.Now(),
 		CreatedAt:  time.Now(),
 		UpdatedAt:  time.Now(),
 	}
-
-	fmt.Println(consultationHistory);
-	fmt.Println("Service", ctrl.ConsultationHistoryService)
-	fmt.Println("tes", ctrl.ConsultationHistoryService.DB)
-
-	if err := ctrl.ConsultationHistoryService.CreateConsultationHistory(&consultationHistory); err != nil {
-		apiErr := apierror.NewApiErrorBuilder().
-			WithStatus(http.StatusInternalServerError).
-			WithMessage(apierror.ErrInternalServerError).
-			Build()
-		c.JSON(apiErr.HttpStatus, apiErr)
-		return
-	}
-
-	// Save each medication with the associated consultation history
-	for _, med := range req.Medications {
-		prescription := models.Prescription{
-			ConsultationHistoryID: consultationHistory.ID,
+	prescriptions := make([]models.Prescription, len(req.Medications))
+	for i, med := range req.Medications {
+		prescriptions[i] = models.Prescription{
 			MedicationID:          med.MedicationID,
 			Dosage:                med.Dosage,
 			Quantity: 				med.Quantity,
 		}
-		if err := ctrl.PrescriptionService.CreatePrescription(&prescription); err != nil {
-			apiErr := apierror.NewApiErrorBuilder().
-				WithStatus(http.StatusInternalServerError).
-				WithMessage("Failed to save prescription").
-				Build()
-			c.JSON(apiErr.HttpStatus, apiErr)
-			return
-		}
+	}
+
+	if err := ctrl.AppointmentService.RecordConsultation(appointmentID, therapistID, &consultationHistory, prescriptions); err != nil {
+		respondAppointmentError(c, err)
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Prescription and medication saved successfully"})
@@ -0,0 +1,128 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type TherapistProfileController struct {
+	TherapistProfileService *services.TherapistProfileService
+}
+
+// GetMyProfile - The therapist's approved profile and their latest revision, so they can see
+// whether a change is still waiting or why it was rejected
+func (ctrl *TherapistProfileController) GetMyProfile(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	profile, apiErr := ctrl.TherapistProfileService.GetProfile(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+	revision, apiErr := ctrl.TherapistProfileService.GetLatestRevision(therapistID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"profile": profile, "latest_revision": revision})
+}
+
+// SubmitProfile - Therapist proposes a new profile, it is published once an admin approves it
+func (ctrl *TherapistProfileController) SubmitProfile(c *gin.Context) {
+	therapistID, ok := therapistIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var profile models.TherapistProfile
+	if err := c.ShouldBindJSON(&profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	revision, apiErr := ctrl.TherapistProfileService.SubmitRevision(therapistID, profile)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, revision)
+}
+
+// GetRevisions - Admin review queue, pending revisions unless status says otherwise
+func (ctrl *TherapistProfileController) GetRevisions(c *gin.Context) {
+	status := models.ProfileRevisionStatus(c.DefaultQuery("status", string(models.RevisionPending)))
+	switch status {
+	case models.RevisionPending, models.RevisionApproved, models.RevisionRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision status"})
+		return
+	}
+
+	revisions, apiErr := ctrl.TherapistProfileService.GetRevisions(status)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, revisions)
+}
+
+func (ctrl *TherapistProfileController) ApproveRevision(c *gin.Context) {
+	adminID, revisionID, ok := adminAndRevisionIDs(c)
+	if !ok {
+		return
+	}
+
+	revision, apiErr := ctrl.TherapistProfileService.ApproveRevision(adminID, revisionID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+func (ctrl *TherapistProfileController) RejectRevision(c *gin.Context) {
+	adminID, revisionID, ok := adminAndRevisionIDs(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	revision, apiErr := ctrl.TherapistProfileService.RejectRevision(adminID, revisionID, req.Reason)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
+
+func adminAndRevisionIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	adminID, ok := userIDFromClaims(c)
+	if !ok {
+		return uuid.Nil, uuid.Nil, false
+	}
+	revisionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+	return adminID, revisionID, true
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type JoinWaitlistDTO struct {
+	TherapistID      string                  `json:"therapist_id" binding:"required"`
+	ConsultationType models.ConsultationType `json:"consultation_type" binding:"required"`
+	SessionTypeID    string                  `json:"session_type_id"`
+	StartDate        string                  `json:"start_date" binding:"required"`
+	EndDate          string                  `json:"end_date" binding:"required"`
+}
+
+type WaitlistController struct {
+	WaitlistService    *services.WaitlistService
+	AppointmentService *services.AppointmentService
+	PaymentService     *services.PaymentService
+}
+
+// JoinWaitlist - Wait for a slot with a fully booked therapist between two dates
+func (ctrl *WaitlistController) JoinWaitlist(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	var dto JoinWaitlistDTO
+	if err := c.ShouldBindJSON(&dto); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		return
+	}
+
+	therapistID, err := uuid.Parse(dto.TherapistID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid therapist ID"})
+		return
+	}
+	fromDate, err := time.Parse("2006-01-02", dto.StartDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_date format. Use YYYY-MM-DD."})
+		return
+	}
+	toDate, err := time.Parse("2006-01-02", dto.EndDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_date format. Use YYYY-MM-DD."})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		ID:               uuid.New(),
+		PatientID:        patientID,
+		TherapistID:      therapistID,
+		ConsultationType: dto.ConsultationType,
+		FromDate:         fromDate,
+		ToDate:           toDate,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+	if dto.SessionTypeID != "" {
+		sessionTypeID, err := uuid.Parse(dto.SessionTypeID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session type ID"})
+			return
+		}
+		entry.SessionTypeID = &sessionTypeID
+	}
+
+	if apiErr := ctrl.WaitlistService.JoinWaitlist(&entry); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	// A slot may already be free, e.g. one released since the patient looked
+	if _, err := ctrl.WaitlistService.MatchTherapist(c.Request.Context(), therapistID); err != nil {
+		log.Printf("Failed to match waitlist for therapist %s: %v", therapistID, err)
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (ctrl *WaitlistController) GetEntries(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	entries, apiErr := ctrl.WaitlistService.GetEntries(patientID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func (ctrl *WaitlistController) LeaveWaitlist(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	entryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid waitlist entry ID"})
+		return
+	}
+
+	if apiErr := ctrl.WaitlistService.LeaveWaitlist(patientID, entryID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (ctrl *WaitlistController) GetOffers(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	offers, apiErr := ctrl.WaitlistService.GetPendingOffers(patientID)
+	if apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, offers)
+}
+
+// AcceptOffer - Book the held slot and pay for it like a regular booking
+func (ctrl *WaitlistController) AcceptOffer(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	offerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer ID"})
+		return
+	}
+
+	appointment, err := ctrl.WaitlistService.AcceptOffer(patientID, offerID)
+	switch {
+	case errors.Is(err, services.ErrWaitlistOfferNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending offer found"})
+		return
+	case errors.Is(err, services.ErrWaitlistOfferExpired):
+		c.JSON(http.StatusGone, gin.H{"error": "The offer has expired"})
+		return
+	case err != nil:
+		respondAppointmentError(c, err)
+		return
+	}
+
+	paymentResponse, err := ctrl.PaymentService.CreatePayment(appointment.ID.String(), appointment.Price)
+	if err != nil {
+		// Release the slot again, the booking can never be paid
+		if _, cancelErr := ctrl.AppointmentService.TransitionStatus(appointment.ID, models.CancelledByPatient, nil, "payment_creation_failed"); cancelErr != nil {
+			log.Printf("Failed to release appointment %s after payment error: %v", appointment.ID, cancelErr)
+		}
+		apiErr := apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage(err.Error()).
+			Build()
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Appointment created successfully",
+		"appointment_id":   appointment.ID,
+		"status":           appointment.Status,
+		"price":            appointment.Price,
+		"duration_minutes": appointment.DurationMinutes,
+		"payment_status":   appointment.PaymentStatus,
+		"redirect_url":     paymentResponse.RedirectURL,
+	})
+}
+
+// DeclineOffer - Release the held slot and keep waiting for another one
+func (ctrl *WaitlistController) DeclineOffer(c *gin.Context) {
+	patientID, ok := userIDFromClaims(c)
+	if !ok {
+		return
+	}
+
+	offerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offer ID"})
+		return
+	}
+
+	if apiErr := ctrl.WaitlistService.DeclineOffer(patientID, offerID); apiErr != nil {
+		c.JSON(apiErr.HttpStatus, apiErr)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
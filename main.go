@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/Hand-TBN1/hand-backend/config"
 	"github.com/Hand-TBN1/hand-backend/middleware"
@@ -23,25 +25,7 @@ func main() {
     config.LoadEnv()
 
     // Pass all models to the migration function
-    db := config.NewPostgresql(
-        &models.User{},
-        &models.Therapist{},
-        &models.CheckIn{},
-        &models.ChatMessage{},
-        &models.ChatRoom{},
-        &models.PositiveAffirmation{},
-        &models.EmergencyHistory{},
-        &models.Media{},
-        &models.Journal{},
-        &models.Availability{},
-        &models.PersonalHealthPlan{},
-        &models.Appointment{},
-        &models.ConsultationHistory{},
-        &models.Medication{},
-        &models.Prescription{},
-        &models.MedicationHistoryTransaction{},
-        &models.MedicationHistoryItem{},
-    )
+    db := config.NewPostgresql(models.All...)
 
     redisClient := config.NewRedis()
     config.LoadR2Config()
@@ -59,6 +43,34 @@ func main() {
     config.SetupMidtrans()
     paymentService := &services.PaymentService{}
     checkInService := &services.CheckInService{DB: db}
+    dataKeyService := &services.DataKeyService{DB: db}
+    journalService := &services.JournalService{DB: db, DataKeyService: dataKeyService}
+
+    if _, err := dataKeyService.RewrapKeys(); err != nil {
+        log.Println("Error rewrapping journal data keys:", err)
+    }
+    if _, err := journalService.EncryptLegacyJournals(); err != nil {
+        log.Println("Error encrypting journals:", err)
+    }
+    if _, err := journalService.BackfillSentiment(); err != nil {
+        log.Println("Error scoring journal sentiment:", err)
+    }
+    journalTemplateService := &services.JournalTemplateService{DB: db}
+    if err := journalTemplateService.SeedDefaultTemplates(); err != nil {
+        log.Println("Error seeding journal templates:", err)
+    }
+
+    notificationSender := &services.FonnteSender{APIKey: config.Env.FonnteAPIKey}
+    waitlistService := &services.WaitlistService{
+        DB:           db,
+        Sender:       notificationSender,
+        HoldDuration: time.Duration(config.Env.WaitlistHoldMinutes) * time.Minute,
+    }
+    groupSessionService := &services.GroupSessionService{
+        DB:           db,
+        Sender:       notificationSender,
+        HoldDuration: time.Duration(config.Env.WaitlistHoldMinutes) * time.Minute,
+    }
 
     engine := config.NewGin()
     engine.Use(middleware.CORS())
@@ -69,11 +81,21 @@ func main() {
     routes.RegisterMediaRoutes(engine, db)
     routes.RegisterConsultationRoutes(engine, db)
     routes.RegisterMedicationTransactionHistoryRoutes(engine, db, paymentService)
-    routes.RegisterTherapistRoutes(engine, db)
+    routes.RegisterTherapistRoutes(engine, db, notificationSender)
     routes.SetupPaymentRoutes(engine, db)  
     routes.RegisterUserRoutes(engine, db)  
     routes.RegisterAppointmentRoutes(engine, db,paymentService)  
+    routes.RegisterRefundRoutes(engine, db)
+    routes.RegisterReviewRoutes(engine, db)
+    routes.RegisterClinicRoutes(engine, db)
+    routes.RegisterTherapistProfileRoutes(engine, db)
+    routes.RegisterMatchingRoutes(engine, db)
+    routes.RegisterCalendarRoutes(engine, db)
+    routes.RegisterNotificationRoutes(engine, db)
+    routes.RegisterWaitlistRoutes(engine, db, paymentService, waitlistService)
+    routes.RegisterGroupSessionRoutes(engine, db, paymentService, groupSessionService)
     routes.RegisterJournalRoutes(engine, db)
+    routes.RegisterJournalTemplateRoutes(engine, db)
     routes.RegisterPrescriptionRoutes(engine, db)
     routes.RegisterChatRoutes(engine,db)
     routes.RegisterCloudflareRoutes(engine)
@@ -97,6 +119,76 @@ func main() {
     if err != nil {
         log.Fatalf("Error scheduling the task: %v", err)
     }
+
+    reminderService := &services.ReminderService{
+        DB:      db,
+        Sender:  notificationSender,
+        Offsets: config.Env.AppointmentReminderOffsets,
+    }
+    _, err = c.AddFunc("@every 1m", func() {
+        if _, err := reminderService.SendDueReminders(context.Background()); err != nil {
+            log.Println("Error sending appointment reminders:", err)
+        }
+    })
+    if err != nil {
+        log.Fatalf("Error scheduling the appointment reminders: %v", err)
+    }
+
+    // Appointments whose payment webhook never came are released a grace period after their payment was due
+    appointmentService := &services.AppointmentService{DB: db}
+    _, err = c.AddFunc("@every 1m", func() {
+        grace := time.Duration(config.Env.PaymentReleaseGraceMinutes) * time.Minute
+        released, err := appointmentService.ReleaseUnpaidAppointments(time.Now().Add(-grace))
+        if err != nil {
+            log.Println("Error releasing unpaid appointments:", err)
+        }
+        if released > 0 {
+            log.Printf("Released %d unpaid appointments", released)
+        }
+
+        // Seats given up or left unpaid go to the group session waitlists
+        releasedSeats, err := groupSessionService.ReleaseUnpaidRegistrations(time.Now().Add(-grace))
+        if err != nil {
+            log.Println("Error releasing unpaid group registrations:", err)
+        }
+        if releasedSeats > 0 {
+            log.Printf("Released %d unpaid group registrations", releasedSeats)
+        }
+        if _, err := groupSessionService.FillFreedSeats(context.Background()); err != nil {
+            log.Println("Error filling freed group session seats:", err)
+        }
+    })
+    if err != nil {
+        log.Fatalf("Error scheduling the unpaid appointment release: %v", err)
+    }
+
+    // Holds that ran out go to the next patient in the same run
+    _, err = c.AddFunc("@every 1m", func() {
+        if _, err := waitlistService.ExpireOffers(); err != nil {
+            log.Println("Error expiring waitlist offers:", err)
+        }
+        if _, err := waitlistService.MatchAll(context.Background()); err != nil {
+            log.Println("Error matching the waitlist:", err)
+        }
+    })
+    if err != nil {
+        log.Fatalf("Error scheduling the waitlist: %v", err)
+    }
+
+    if config.Env.CalendarSyncMinutes > 0 {
+        externalCalendarService := &services.ExternalCalendarService{DB: db, Fetcher: services.NewHTTPCalendarFetcher()}
+        _, err = c.AddFunc(fmt.Sprintf("@every %dm", config.Env.CalendarSyncMinutes), func() {
+            synced, err := externalCalendarService.SyncAll(context.Background())
+            if err != nil {
+                log.Println("Error syncing external calendars:", err)
+                return
+            }
+            log.Printf("Synced %d external calendars", synced)
+        })
+        if err != nil {
+            log.Fatalf("Error scheduling the calendar sync: %v", err)
+        }
+    }
     c.Start()
     
 
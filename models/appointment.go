@@ -10,18 +10,70 @@ type AppointmentScheduleStatus string
 
 
 const (
-    Success  AppointmentScheduleStatus = "success"
-    Canceled AppointmentScheduleStatus = "canceled"
+    PendingPayment       AppointmentScheduleStatus = "pending_payment"
+    Confirmed            AppointmentScheduleStatus = "confirmed"
+    InSession            AppointmentScheduleStatus = "in_session"
+    Completed            AppointmentScheduleStatus = "completed"
+    NoShow               AppointmentScheduleStatus = "no_show"
+    CancelledByPatient   AppointmentScheduleStatus = "cancelled_by_patient"
+    CancelledByTherapist AppointmentScheduleStatus = "cancelled_by_therapist"
+    Rescheduled          AppointmentScheduleStatus = "rescheduled"
 )
 
+// appointmentTransitions lists every status an appointment may move to from a given status.
+// Statuses missing from the map are final. A settled payment confirms a booking, therapists
+// don't confirm bookings themselves but can decline them.
+var appointmentTransitions = map[AppointmentScheduleStatus][]AppointmentScheduleStatus{
+    PendingPayment: {Confirmed, CancelledByPatient, CancelledByTherapist},
+    Confirmed:      {InSession, NoShow, CancelledByPatient, CancelledByTherapist, Rescheduled},
+    InSession:      {Completed},
+}
+
+// SlotHoldingStatuses are the statuses in which an appointment keeps its time slot taken
+var SlotHoldingStatuses = []AppointmentScheduleStatus{PendingPayment, Confirmed, InSession}
+
+func (status AppointmentScheduleStatus) IsValid() bool {
+    switch status {
+    case PendingPayment, Confirmed, InSession, Completed, NoShow, CancelledByPatient, CancelledByTherapist, Rescheduled:
+        return true
+    }
+    return false
+}
+
+func (status AppointmentScheduleStatus) CanTransitionTo(next AppointmentScheduleStatus) bool {
+    for _, allowed := range appointmentTransitions[status] {
+        if allowed == next {
+            return true
+        }
+    }
+    return false
+}
+
+func (status AppointmentScheduleStatus) IsFinal() bool {
+    return len(appointmentTransitions[status]) == 0
+}
+
 type Appointment struct {
     ID              uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
     UserID          uuid.UUID `gorm:"type:uuid;not null"`
     TherapistID     uuid.UUID `gorm:"type:uuid;not null"`
     Type            ConsultationType `gorm:"type:consultation_enum"`
-    Status          AppointmentScheduleStatus `gorm:"type:appointment_schedule_status_enum"`
+    Status          AppointmentScheduleStatus `gorm:"type:appointment_schedule_status_enum;not null;default:'pending_payment'"`
+    StatusChangedAt *time.Time
+    // Set on the new appointment when a patient moves a session, points at the old one
+    RescheduledFromID *uuid.UUID `gorm:"type:uuid"`
+    // Occurrences of a recurring series point at it
+    SeriesID        *uuid.UUID `gorm:"type:uuid;index"`
     Price           int64
+    // Length of the session and of the free time kept after it, copied from the session type
+    SessionTypeID   *uuid.UUID `gorm:"type:uuid"`
+    DurationMinutes int        `gorm:"not null;default:60"`
+    BufferMinutes   int        `gorm:"not null;default:0"`
     PaymentStatus   MidtransStatus `gorm:"type:midtrans_status;not null"`
+    // Unpaid appointments are released once this has passed
+    PaymentDueAt    *time.Time
+    // Online sessions get a room once confirmed, only handed to the participants while joinable
+    MeetingRoom     *string `gorm:"uniqueIndex" json:"-"`
     AppointmentDate time.Time
     CreatedAt       time.Time
     UpdatedAt       time.Time
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type SeriesFrequency string
+
+const (
+	SeriesWeekly   SeriesFrequency = "weekly"
+	SeriesBiweekly SeriesFrequency = "biweekly"
+)
+
+// Weeks is the number of weeks between two occurrences, 0 for an unknown frequency
+func (frequency SeriesFrequency) Weeks() int {
+	switch frequency {
+	case SeriesWeekly:
+		return 1
+	case SeriesBiweekly:
+		return 2
+	}
+	return 0
+}
+
+type SeriesPaymentMode string
+
+const (
+	// The whole series is paid in one transaction when it is booked
+	SeriesPayUpfront SeriesPaymentMode = "upfront"
+	// Every occurrence is paid on its own, the first one when the series is booked
+	SeriesPayPerSession SeriesPaymentMode = "per_session"
+)
+
+func (mode SeriesPaymentMode) IsValid() bool {
+	return mode == SeriesPayUpfront || mode == SeriesPayPerSession
+}
+
+// AppointmentSeries is a patient's recurring booking with a therapist. Every occurrence is an
+// appointment of its own pointing back at the series, a series paid upfront uses its ID as the
+// payment's order ID.
+type AppointmentSeries struct {
+	ID               uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	UserID           uuid.UUID         `gorm:"type:uuid;not null;index" json:"user_id"`
+	TherapistID      uuid.UUID         `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	ConsultationType ConsultationType  `gorm:"type:consultation_enum;not null" json:"consultation_type"`
+	SessionTypeID    *uuid.UUID        `gorm:"type:uuid" json:"session_type_id"`
+	Frequency        SeriesFrequency   `gorm:"type:series_frequency_enum;not null" json:"frequency"`
+	Occurrences      int               `gorm:"not null" json:"occurrences"`
+	PaymentMode      SeriesPaymentMode `gorm:"type:series_payment_mode_enum;not null" json:"payment_mode"`
+	CreatedAt        time.Time         `json:"created_at"`
+	UpdatedAt        time.Time         `json:"updated_at"`
+}
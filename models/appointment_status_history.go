@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AppointmentStatusHistory records one status change of an appointment. FromStatus is nil for
+// the booking itself and ChangedBy is nil when the system made the change, e.g. a payment webhook.
+type AppointmentStatusHistory struct {
+	ID            uuid.UUID                  `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	AppointmentID uuid.UUID                  `gorm:"type:uuid;not null;index" json:"appointment_id"`
+	Appointment   Appointment                `gorm:"foreignKey:AppointmentID" json:"-"`
+	FromStatus    *AppointmentScheduleStatus `gorm:"type:appointment_schedule_status_enum" json:"from_status"`
+	ToStatus      AppointmentScheduleStatus  `gorm:"type:appointment_schedule_status_enum;not null" json:"to_status"`
+	ChangedBy     *uuid.UUID                 `gorm:"type:uuid" json:"changed_by"`
+	Reason        string                     `json:"reason"`
+	CreatedAt     time.Time                  `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import "testing"
+
+func TestCanTransitionTo(t *testing.T) {
+	statuses := []AppointmentScheduleStatus{
+		PendingPayment, Confirmed, InSession, Completed, NoShow, CancelledByPatient, CancelledByTherapist, Rescheduled,
+	}
+	allowed := map[AppointmentScheduleStatus][]AppointmentScheduleStatus{
+		PendingPayment: {Confirmed, CancelledByPatient, CancelledByTherapist},
+		Confirmed:      {InSession, NoShow, CancelledByPatient, CancelledByTherapist, Rescheduled},
+		InSession:      {Completed},
+	}
+
+	for _, from := range statuses {
+		for _, to := range statuses {
+			want := false
+			for _, next := range allowed[from] {
+				want = want || next == to
+			}
+			if got := from.CanTransitionTo(to); got != want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", from, to, got, want)
+			}
+		}
+		if got, want := from.IsFinal(), len(allowed[from]) == 0; got != want {
+			t.Errorf("%s.IsFinal() = %v, want %v", from, got, want)
+		}
+	}
+}
+
+func TestCanTransitionToUnknownStatus(t *testing.T) {
+	if AppointmentScheduleStatus("success").CanTransitionTo(Confirmed) {
+		t.Error("an unknown status must not transition anywhere")
+	}
+	if Confirmed.CanTransitionTo("success") {
+		t.Error("no status may transition to an unknown one")
+	}
+}
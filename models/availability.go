@@ -11,6 +11,8 @@ type Availability struct {
 	TherapistID     uuid.UUID `gorm:"type:uuid;not null;foreignKey:UserID"`
 	Date            time.Time `gorm:"not null"`
 	IsAvailable     bool      `gorm:"default:false"`
+	// Windows replaces the weekly working hours on this date, nil keeps them
+	Windows         ScheduleWindows `gorm:"type:jsonb"`
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 }
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CalendarFeed gives a user a private iCalendar URL. Only a hash of the token is kept, so a
+// lost URL cannot be shown again and the user regenerates it instead.
+type CalendarFeed struct {
+	ID             uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	UserID         uuid.UUID  `gorm:"type:uuid;not null;unique" json:"user_id"`
+	TokenHash      string     `gorm:"type:char(64);not null;unique" json:"-"`
+	LastAccessedAt *time.Time `json:"last_accessed_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
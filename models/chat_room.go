@@ -12,6 +12,9 @@ type ChatRoomType string
 const (
     ConsultationRoom ChatRoomType = "consultation"
     AnonymousRoom    ChatRoomType = "anonymous"
+    // Group rooms belong to a group session, both users are its therapist and the attendees
+    // are the session's confirmed registrations
+    GroupRoom        ChatRoomType = "group"
 )
 
 type ChatRoom struct {
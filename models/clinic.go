@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Clinic is a place where therapists see patients in person
+type Clinic struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	Name      string    `gorm:"not null" json:"name"`
+	Address   string    `gorm:"not null" json:"address"`
+	City      string    `gorm:"not null;index" json:"city"`
+	Latitude  float64   `gorm:"not null;index:idx_clinics_coordinates" json:"latitude"`
+	Longitude float64   `gorm:"not null;index:idx_clinics_coordinates" json:"longitude"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TherapistClinic links a therapist to a clinic they practice at, a therapist may practice at
+// several clinics
+type TherapistClinic struct {
+	TherapistID uuid.UUID `gorm:"type:uuid;primaryKey" json:"therapist_id"`
+	ClinicID    uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"clinic_id"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	Clinic Clinic `gorm:"foreignKey:ClinicID" json:"-"`
+}
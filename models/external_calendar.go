@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ExternalCalendar is a calendar a therapist keeps elsewhere, e.g. at a hospital. Calendars
+// with a SourceURL are polled, uploaded ones change only when the therapist uploads again.
+type ExternalCalendar struct {
+	ID            uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID   uuid.UUID  `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	Name          string     `gorm:"not null" json:"name"`
+	SourceURL     string     `json:"source_url,omitempty"`
+	LastSyncedAt  *time.Time `json:"last_synced_at"`
+	LastSyncError string     `json:"last_sync_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ExternalBusyBlock is one busy occurrence of an external calendar, recurring events are stored
+// expanded over the booking horizon
+type ExternalBusyBlock struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	CalendarID  uuid.UUID `gorm:"type:uuid;not null;index" json:"calendar_id"`
+	TherapistID uuid.UUID `gorm:"type:uuid;not null;index:idx_external_busy_blocks_therapist_time" json:"therapist_id"`
+	StartsAt    time.Time `gorm:"not null;index:idx_external_busy_blocks_therapist_time" json:"starts_at"`
+	EndsAt      time.Time `gorm:"not null" json:"ends_at"`
+}
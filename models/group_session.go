@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type GroupSessionStatus string
+
+const (
+	GroupSessionScheduled GroupSessionStatus = "scheduled"
+	GroupSessionCancelled GroupSessionStatus = "cancelled"
+)
+
+type GroupRegistrationStatus string
+
+const (
+	RegistrationPendingPayment GroupRegistrationStatus = "pending_payment"
+	RegistrationConfirmed      GroupRegistrationStatus = "confirmed"
+	RegistrationWaitlisted     GroupRegistrationStatus = "waitlisted"
+	RegistrationCancelled      GroupRegistrationStatus = "cancelled"
+)
+
+// SeatHoldingRegistrations are the registrations that count against a group session's capacity
+var SeatHoldingRegistrations = []GroupRegistrationStatus{RegistrationPendingPayment, RegistrationConfirmed}
+
+// GroupSession is a support group or workshop a therapist runs for several patients at once.
+// It blocks the therapist's schedule like an appointment and its attendees share a chat room.
+type GroupSession struct {
+	ID              uuid.UUID          `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID     uuid.UUID          `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	Topic           string             `gorm:"not null" json:"topic"`
+	Description     string             `json:"description"`
+	Type            ConsultationType   `gorm:"type:consultation_enum;not null" json:"type"`
+	StartsAt        time.Time          `gorm:"not null;index" json:"starts_at"`
+	DurationMinutes int                `gorm:"not null" json:"duration_minutes"`
+	Capacity        int                `gorm:"not null" json:"capacity"`
+	Price           int64              `gorm:"not null" json:"price"`
+	Status          GroupSessionStatus `gorm:"type:group_session_status_enum;not null;default:'scheduled'" json:"status"`
+	ChatRoomID      uuid.UUID          `gorm:"type:uuid;not null" json:"chat_room_id"`
+	// Online sessions have a meeting room, only handed to attendees while joinable
+	MeetingRoom *string   `gorm:"uniqueIndex" json:"-"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+
+	Therapist User `gorm:"foreignKey:TherapistID" json:"-"`
+}
+
+// GroupRegistration is a patient's seat in a group session. A patient has one registration per
+// session, registering again after cancelling reuses it. Waitlisted patients move up in order of
+// registration when a seat frees up.
+type GroupRegistration struct {
+	ID             uuid.UUID               `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	GroupSessionID uuid.UUID               `gorm:"type:uuid;not null;uniqueIndex:idx_group_registrations_patient" json:"group_session_id"`
+	PatientID      uuid.UUID               `gorm:"type:uuid;not null;uniqueIndex:idx_group_registrations_patient" json:"patient_id"`
+	Status         GroupRegistrationStatus `gorm:"type:group_registration_status_enum;not null" json:"status"`
+	PaymentStatus  MidtransStatus          `gorm:"type:midtrans_status;not null" json:"payment_status"`
+	// Unpaid registrations give up their seat once this has passed
+	PaymentDueAt *time.Time `json:"payment_due_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+
+	GroupSession GroupSession `gorm:"foreignKey:GroupSessionID" json:"-"`
+	Patient      User         `gorm:"foreignKey:PatientID" json:"-"`
+}
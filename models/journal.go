@@ -7,10 +7,33 @@ import (
 )
 
 type Journal struct {
-	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
-	Content   string    `json:"content" gorm:"type:text;not null"`
-	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null"` 
-	User      User      `gorm:"foreignKey:UserID"`
+	ID        uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	Content   string     `json:"content" gorm:"type:text;not null"`
+	DataKeyID *uuid.UUID `json:"-" gorm:"type:uuid"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null"`
+	User      User       `gorm:"foreignKey:UserID"`
+
+	// Guided journaling: Answers is the JSON encoded map of template field key to answer,
+	// encrypted together with Content
+	TemplateID *uuid.UUID       `json:"template_id" gorm:"type:uuid"`
+	Template   *JournalTemplate `json:"-" gorm:"foreignKey:TemplateID"`
+	PromptID   *uuid.UUID       `json:"prompt_id" gorm:"type:uuid"`
+	Prompt     *JournalPrompt   `json:"-" gorm:"foreignKey:PromptID"`
+	Answers    string           `json:"-" gorm:"type:text"`
+
+	Tags      []JournalTag `json:"tags" gorm:"many2many:journal_tag_links"`
+	CheckInID *uuid.UUID   `json:"check_in_id" gorm:"type:uuid"`
+	CheckIn   *CheckIn     `json:"-" gorm:"foreignKey:CheckInID"`
+
+	// SentimentScore runs from -1 to 1 and is computed locally from the plaintext on save,
+	// SentimentVersion records which lexicon produced it
+	SentimentScore   *float64 `json:"sentiment_score"`
+	SentimentVersion int      `json:"-" gorm:"not null;default:0"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	// Content is stored encrypted with the data key DataKeyID, rows without one predate
+	// encryption at rest. SearchVector holds keyed hashes of the lexemes, never plain words.
+	SearchVector string `json:"-" gorm:"type:tsvector;index:idx_journals_search_vector,type:gin;->:false;<-:false"`
 }
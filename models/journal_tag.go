@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// JournalTag is a user-defined label, names are stored lowercased and unique per user
+type JournalTag struct {
+	ID        uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_journal_tags_user_name" json:"-"`
+	Name      string    `gorm:"not null;uniqueIndex:idx_journal_tags_user_name" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Associations
+	User User `gorm:"foreignKey:UserID" json:"-"`
+}
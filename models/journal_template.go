@@ -0,0 +1,80 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type JournalTemplateCategory string
+
+const (
+	GratitudeTemplate     JournalTemplateCategory = "gratitude"
+	ThoughtRecordTemplate JournalTemplateCategory = "thought_record"
+	WorryLogTemplate      JournalTemplateCategory = "worry_log"
+	FreeWritingTemplate   JournalTemplateCategory = "free_writing"
+)
+
+type JournalFieldType string
+
+const (
+	TextField   JournalFieldType = "text"
+	NumberField JournalFieldType = "number"
+	ScaleField  JournalFieldType = "scale" // 0 - 10
+)
+
+type JournalTemplateField struct {
+	Key         string           `json:"key"`
+	Label       string           `json:"label"`
+	Type        JournalFieldType `json:"type"`
+	Required    bool             `json:"required"`
+	Placeholder string           `json:"placeholder,omitempty"`
+}
+
+// JournalTemplateFields is stored as jsonb
+type JournalTemplateFields []JournalTemplateField
+
+func (fields JournalTemplateFields) Value() (driver.Value, error) {
+	return json.Marshal(fields)
+}
+
+func (fields *JournalTemplateFields) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, fields)
+	case string:
+		return json.Unmarshal([]byte(v), fields)
+	case nil:
+		*fields = nil
+		return nil
+	}
+	return errors.New("unsupported type for JournalTemplateFields")
+}
+
+type JournalTemplate struct {
+	ID          uuid.UUID               `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	Name        string                  `gorm:"not null" json:"name"`
+	Category    JournalTemplateCategory `gorm:"type:journal_template_enum;not null" json:"category"`
+	Description string                  `json:"description"`
+	Fields      JournalTemplateFields   `gorm:"type:jsonb;not null" json:"fields"`
+	IsActive    bool                    `gorm:"not null" json:"is_active"`
+	CreatedAt   time.Time               `json:"created_at"`
+	UpdatedAt   time.Time               `json:"updated_at"`
+}
+
+// JournalPrompt is a single question suggested to patients. MinMood and MaxMood limit it to
+// days whose check-in mood falls in that range, nil means any mood (or no check-in).
+type JournalPrompt struct {
+	ID         uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TemplateID *uuid.UUID       `gorm:"type:uuid" json:"template_id"`
+	Template   *JournalTemplate `gorm:"foreignKey:TemplateID" json:"template,omitempty"`
+	Text       string           `gorm:"type:text;not null" json:"text"`
+	MinMood    *int             `json:"min_mood"`
+	MaxMood    *int             `json:"max_mood"`
+	IsActive   bool             `gorm:"not null" json:"is_active"`
+	CreatedAt  time.Time        `json:"created_at"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Parts of the day patients can prefer their sessions in, in Jakarta time
+const (
+	PartOfDayMorning   = "morning"
+	PartOfDayAfternoon = "afternoon"
+	PartOfDayEvening   = "evening"
+)
+
+// MatchingAnswers are a patient's intake answers. Empty answers mean no preference.
+type MatchingAnswers struct {
+	// Specialization terms the patient wants help with
+	ConcernIDs       []uuid.UUID      `json:"concern_ids"`
+	Language         string           `json:"language"`
+	Gender           Gender           `json:"gender"`
+	BudgetMax        *int64           `json:"budget_max"`
+	ConsultationType ConsultationType `json:"consultation_type"`
+	PreferredDays    []time.Weekday   `json:"preferred_days"`
+	PreferredTimes   []string         `json:"preferred_times"`
+}
+
+func (answers MatchingAnswers) Value() (driver.Value, error) {
+	return json.Marshal(answers)
+}
+
+func (answers *MatchingAnswers) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, answers)
+	case string:
+		return json.Unmarshal([]byte(v), answers)
+	}
+	return errors.New("unsupported type for MatchingAnswers")
+}
+
+// MatchingQuestionnaire is the patient's latest intake, answering again replaces it
+type MatchingQuestionnaire struct {
+	ID        uuid.UUID       `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	PatientID uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex" json:"patient_id"`
+	Answers   MatchingAnswers `gorm:"type:jsonb;not null" json:"answers"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// MatchingWeights are how much each part of the fit counts towards a therapist's match score.
+// There is a single row, admins tune it.
+type MatchingWeights struct {
+	ID           int        `gorm:"primaryKey" json:"-"`
+	Concerns     float64    `gorm:"not null" json:"concerns"`
+	Language     float64    `gorm:"not null" json:"language"`
+	Gender       float64    `gorm:"not null" json:"gender"`
+	Budget       float64    `gorm:"not null" json:"budget"`
+	Availability float64    `gorm:"not null" json:"availability"`
+	Rating       float64    `gorm:"not null" json:"rating"`
+	UpdatedBy    *uuid.UUID `gorm:"type:uuid" json:"updated_by"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,49 @@
+package models
+
+// All are the models the database is migrated to, used by the API and the database tests
+var All = []any{
+	&User{},
+	&Therapist{},
+	&Clinic{},
+	&TherapistClinic{},
+	&TaxonomyTerm{},
+	&TherapistTaxonomyTerm{},
+	&TherapistProfileRevision{},
+	&MatchingQuestionnaire{},
+	&MatchingWeights{},
+	&CheckIn{},
+	&ChatMessage{},
+	&ChatRoom{},
+	&PositiveAffirmation{},
+	&EmergencyHistory{},
+	&Media{},
+	&JournalTemplate{},
+	&JournalPrompt{},
+	&JournalTag{},
+	&Journal{},
+	&UserDataKey{},
+	&Availability{},
+	&WorkingHours{},
+	&TimeOff{},
+	&ExternalCalendar{},
+	&ExternalBusyBlock{},
+	&SessionType{},
+	&PersonalHealthPlan{},
+	&Appointment{},
+	&AppointmentStatusHistory{},
+	&Refund{},
+	&CalendarFeed{},
+	&WaitlistEntry{},
+	&WaitlistOffer{},
+	&AppointmentSeries{},
+	&GroupSession{},
+	&GroupRegistration{},
+	&Review{},
+	&NotificationPreference{},
+	&AppointmentReminder{},
+	&ConsultationHistory{},
+	&Medication{},
+	&Prescription{},
+	&MedicationHistoryTransaction{},
+	&MedicationHistoryItem{},
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// NotificationPreference holds what a user wants to be notified about, users without a row get
+// every notification
+type NotificationPreference struct {
+	UserID               uuid.UUID `gorm:"type:uuid;primary_key" json:"user_id"`
+	AppointmentReminders bool      `gorm:"not null" json:"appointment_reminders"`
+	CheckInReminders     bool      `gorm:"not null" json:"check_in_reminders"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+type ReminderStatus string
+
+const (
+	ReminderSending ReminderStatus = "sending"
+	ReminderSent    ReminderStatus = "sent"
+	ReminderFailed  ReminderStatus = "failed"
+	ReminderSkipped ReminderStatus = "skipped"
+)
+
+// AppointmentReminder records one reminder to one recipient. The unique index lets only one
+// instance claim a reminder, and a claimed reminder is never sent again.
+type AppointmentReminder struct {
+	ID            uuid.UUID      `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	AppointmentID uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_appointment_reminders_once" json:"appointment_id"`
+	RecipientID   uuid.UUID      `gorm:"type:uuid;not null;uniqueIndex:idx_appointment_reminders_once" json:"recipient_id"`
+	OffsetMinutes int            `gorm:"not null;uniqueIndex:idx_appointment_reminders_once" json:"offset_minutes"`
+	Status        ReminderStatus `gorm:"type:reminder_status_enum;not null" json:"status"`
+	Attempts      int            `gorm:"not null;default:0" json:"attempts"`
+	LastError     string         `json:"last_error,omitempty"`
+	ClaimedAt     time.Time      `json:"claimed_at"`
+	SentAt        *time.Time     `json:"sent_at"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+}
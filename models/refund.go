@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RefundStatus string
+
+const (
+	RefundPending   RefundStatus = "pending"
+	RefundProcessed RefundStatus = "processed"
+	RefundFailed    RefundStatus = "failed"
+)
+
+// Refund is money owed back to a patient for an appointment or a group session registration.
+// Refunds are computed and recorded here when the booking changes, the payment integration
+// picks up the pending ones.
+type Refund struct {
+	ID                  uuid.UUID         `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	AppointmentID       *uuid.UUID        `gorm:"type:uuid;index" json:"appointment_id"`
+	Appointment         Appointment       `gorm:"foreignKey:AppointmentID" json:"-"`
+	GroupRegistrationID *uuid.UUID        `gorm:"type:uuid;index" json:"group_registration_id,omitempty"`
+	GroupRegistration   GroupRegistration `gorm:"foreignKey:GroupRegistrationID" json:"-"`
+	UserID              uuid.UUID         `gorm:"type:uuid;not null" json:"user_id"`
+	Amount              int64             `gorm:"not null" json:"amount"`
+	Percent             int               `gorm:"not null" json:"percent"`
+	Reason              string            `json:"reason"`
+	Status              RefundStatus      `gorm:"type:refund_status_enum;not null;default:'pending'" json:"status"`
+	ProcessedAt         *time.Time        `json:"processed_at"`
+	CreatedAt           time.Time         `json:"created_at"`
+	UpdatedAt           time.Time         `json:"updated_at"`
+}
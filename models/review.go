@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ReviewStatus string
+
+const (
+	ReviewPublished ReviewStatus = "published"
+	ReviewHidden    ReviewStatus = "hidden"
+)
+
+// Review is a patient's rating of a completed appointment, one per appointment. Only published
+// reviews count towards the therapist's rating.
+type Review struct {
+	ID            uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	AppointmentID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"appointment_id"`
+	PatientID     uuid.UUID `gorm:"type:uuid;not null;index" json:"-"`
+	TherapistID   uuid.UUID `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	Rating        int       `gorm:"not null" json:"rating"`
+	Comment       string    `json:"comment"`
+	// Anonymous reviews never show the patient's name, not even to the therapist
+	IsAnonymous bool         `gorm:"not null;default:false" json:"is_anonymous"`
+	Status      ReviewStatus `gorm:"type:review_status_enum;not null;default:'published'" json:"status"`
+	Reply       string       `json:"reply"`
+	RepliedAt   *time.Time   `json:"replied_at"`
+	// Set when an admin hides or restores the review
+	ModerationReason string     `json:"moderation_reason,omitempty"`
+	ModeratedBy      *uuid.UUID `gorm:"type:uuid" json:"-"`
+	ModeratedAt      *time.Time `json:"moderated_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Patient User `gorm:"foreignKey:PatientID" json:"-"`
+}
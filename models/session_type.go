@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionType is a kind of session a therapist offers. BufferMinutes is kept free after each
+// session and ConsultationType hybrid means the session can be held online or offline.
+type SessionType struct {
+	ID               uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID      uuid.UUID        `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	Name             string           `gorm:"not null" json:"name"`
+	Description      string           `json:"description"`
+	ConsultationType ConsultationType `gorm:"type:consultation_enum;not null" json:"consultation_type"`
+	DurationMinutes  int              `gorm:"not null" json:"duration_minutes"`
+	BufferMinutes    int              `gorm:"not null" json:"buffer_minutes"`
+	Price            int64            `gorm:"not null" json:"price"`
+	IsActive         bool             `gorm:"not null" json:"is_active"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
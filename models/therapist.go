@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +17,36 @@ const (
 	Hybrid  ConsultationType = "hybrid"
 )
 
+type Gender string
+
+const (
+	Female Gender = "female"
+	Male   Gender = "male"
+)
+
+// Languages is a list of lowercase ISO 639-1 codes stored as jsonb, e.g. ["id", "en"]
+type Languages []string
+
+func (languages Languages) Value() (driver.Value, error) {
+	if languages == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(languages)
+}
+
+func (languages *Languages) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, languages)
+	case string:
+		return json.Unmarshal([]byte(v), languages)
+	case nil:
+		*languages = nil
+		return nil
+	}
+	return errors.New("unsupported type for Languages")
+}
+
 type Therapist struct {
 	ID              uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
 	UserID          uuid.UUID        `gorm:"type:uuid;not null;foreignKey:UserID;unique"`
@@ -21,8 +54,36 @@ type Therapist struct {
 	Location        string
 	Specialization  string
 	Consultation    ConsultationType `gorm:"type:consultation_enum"`
-	AppointmentRate int64
+	AppointmentRate int64 `gorm:"index"`
+	// Patients must book at least MinNoticeHours ahead and at most BookingWindowDays ahead
+	MinNoticeHours    int `gorm:"not null;default:0"`
+	BookingWindowDays int `gorm:"not null;default:60"`
+	// Average and count of the published reviews, kept up to date as reviews change
+	RatingAverage float64 `gorm:"not null;default:0;index:idx_therapists_rating"`
+	ReviewCount   int     `gorm:"not null;default:0;index:idx_therapists_rating"`
+	// Languages the therapist holds sessions in and their gender, for patients who have a preference
+	Languages Languages `gorm:"type:jsonb;not null;default:'[]';index:idx_therapists_languages,type:gin"`
+	Gender    Gender    `gorm:"type:varchar(10)"`
+	// Profile details, changed through admin-approved revisions
+	Bio               string      `gorm:"type:text"`
+	Education         Credentials `gorm:"type:jsonb;not null;default:'[]'"`
+	Certifications    Credentials `gorm:"type:jsonb;not null;default:'[]'"`
+	YearsOfExperience int         `gorm:"not null;default:0"`
+	// Rates of online and offline sessions, AppointmentRate applies when unset
+	OnlineRate  *int64
+	OfflineRate *int64
 	CreatedAt       time.Time
 	UpdatedAt       time.Time
 
 }
+
+// RateFor is the therapist's rate for a default session of the consultation type
+func (therapist *Therapist) RateFor(consultationType ConsultationType) int64 {
+	switch {
+	case consultationType == Online && therapist.OnlineRate != nil:
+		return *therapist.OnlineRate
+	case consultationType == Offline && therapist.OfflineRate != nil:
+		return *therapist.OfflineRate
+	}
+	return therapist.AppointmentRate
+}
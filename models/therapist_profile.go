@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type TaxonomyKind string
+
+const (
+	KindSpecialization TaxonomyKind = "specialization"
+	KindApproach       TaxonomyKind = "approach"
+)
+
+// TaxonomyTerm is a specialization (e.g. anxiety) or therapeutic approach (e.g. CBT, ACT)
+// therapists pick from. Admins manage the list, deactivated terms stay on existing profiles
+// until they are next edited.
+type TaxonomyTerm struct {
+	ID        uuid.UUID    `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	Kind      TaxonomyKind `gorm:"type:taxonomy_kind_enum;not null;uniqueIndex:idx_taxonomy_terms_kind_name" json:"kind"`
+	Name      string       `gorm:"not null;uniqueIndex:idx_taxonomy_terms_kind_name" json:"name"`
+	IsActive  bool         `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// TherapistTaxonomyTerm links a therapist to a specialization or approach on their profile
+type TherapistTaxonomyTerm struct {
+	TherapistID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"therapist_id"`
+	TaxonomyTermID uuid.UUID `gorm:"type:uuid;primaryKey;index" json:"taxonomy_term_id"`
+
+	TaxonomyTerm TaxonomyTerm `gorm:"foreignKey:TaxonomyTermID" json:"-"`
+}
+
+// Credential is a degree or certification on a therapist's profile
+type Credential struct {
+	Title       string `json:"title"`
+	Institution string `json:"institution"`
+	Year        int    `json:"year,omitempty"`
+}
+
+// Credentials is a list of credentials stored as jsonb
+type Credentials []Credential
+
+func (credentials Credentials) Value() (driver.Value, error) {
+	if credentials == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(credentials)
+}
+
+func (credentials *Credentials) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, credentials)
+	case string:
+		return json.Unmarshal([]byte(v), credentials)
+	case nil:
+		*credentials = nil
+		return nil
+	}
+	return errors.New("unsupported type for Credentials")
+}
+
+// TherapistProfile is the part of a therapist's profile they edit themselves. Changes only show
+// once an admin approves them. Rates left empty fall back to the therapist's appointment rate.
+type TherapistProfile struct {
+	Bio               string      `json:"bio"`
+	SpecializationIDs []uuid.UUID `json:"specialization_ids"`
+	ApproachIDs       []uuid.UUID `json:"approach_ids"`
+	Languages         Languages   `json:"languages"`
+	Education         Credentials `json:"education"`
+	Certifications    Credentials `json:"certifications"`
+	YearsOfExperience int         `json:"years_of_experience"`
+	OnlineRate        *int64      `json:"online_rate"`
+	OfflineRate       *int64      `json:"offline_rate"`
+}
+
+func (profile TherapistProfile) Value() (driver.Value, error) {
+	return json.Marshal(profile)
+}
+
+func (profile *TherapistProfile) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, profile)
+	case string:
+		return json.Unmarshal([]byte(v), profile)
+	}
+	return errors.New("unsupported type for TherapistProfile")
+}
+
+type ProfileRevisionStatus string
+
+const (
+	RevisionPending  ProfileRevisionStatus = "pending"
+	RevisionApproved ProfileRevisionStatus = "approved"
+	RevisionRejected ProfileRevisionStatus = "rejected"
+)
+
+// TherapistProfileRevision is a profile change waiting for or past admin review. A therapist has
+// at most one pending revision, submitting again replaces it.
+type TherapistProfileRevision struct {
+	ID          uuid.UUID             `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID uuid.UUID             `gorm:"type:uuid;not null;index;uniqueIndex:idx_profile_revisions_pending,where:status = 'pending'" json:"therapist_id"`
+	Profile     TherapistProfile      `gorm:"type:jsonb;not null" json:"profile"`
+	Status      ProfileRevisionStatus `gorm:"type:profile_revision_status_enum;not null;default:'pending';index" json:"status"`
+	// Set when an admin approves or rejects the revision
+	ReviewedBy      *uuid.UUID `gorm:"type:uuid" json:"reviewed_by"`
+	ReviewedAt      *time.Time `json:"reviewed_at"`
+	RejectionReason string     `json:"rejection_reason"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
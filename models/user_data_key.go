@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserDataKey is a per-user key that encrypts journal content. The key itself is only
+// stored wrapped by one of the configured master keys.
+type UserDataKey struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID      uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_user_data_keys_active,where:is_active"`
+	MasterKeyID string    `gorm:"not null"`
+	WrappedKey  []byte    `gorm:"type:bytea;not null"`
+	IsActive    bool      `gorm:"not null;default:true"`
+	CreatedAt   time.Time
+	RetiredAt   *time.Time
+
+	// Associations
+	User User `gorm:"foreignKey:UserID"`
+}
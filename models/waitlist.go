@@ -0,0 +1,59 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WaitlistStatus string
+
+const (
+	WaitlistWaiting   WaitlistStatus = "waiting"
+	WaitlistOffered   WaitlistStatus = "offered"
+	WaitlistBooked    WaitlistStatus = "booked"
+	WaitlistExpired   WaitlistStatus = "expired"
+	WaitlistCancelled WaitlistStatus = "cancelled"
+)
+
+type WaitlistOfferStatus string
+
+const (
+	OfferPending  WaitlistOfferStatus = "pending"
+	OfferAccepted WaitlistOfferStatus = "accepted"
+	OfferDeclined WaitlistOfferStatus = "declined"
+	OfferExpired  WaitlistOfferStatus = "expired"
+)
+
+// WaitlistEntry is a patient waiting for any slot with a therapist between two dates
+type WaitlistEntry struct {
+	ID               uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	PatientID        uuid.UUID        `gorm:"type:uuid;not null;index" json:"patient_id"`
+	TherapistID      uuid.UUID        `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	ConsultationType ConsultationType `gorm:"type:consultation_enum;not null" json:"consultation_type"`
+	SessionTypeID    *uuid.UUID       `gorm:"type:uuid" json:"session_type_id"`
+	FromDate         time.Time        `gorm:"type:date;not null" json:"from_date"`
+	ToDate           time.Time        `gorm:"type:date;not null" json:"to_date"`
+	Status           WaitlistStatus   `gorm:"type:waitlist_status_enum;not null;default:'waiting'" json:"status"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// WaitlistOffer holds a freed slot for one waitlisted patient until ExpiresAt. While pending,
+// nobody else can book the slot.
+type WaitlistOffer struct {
+	ID               uuid.UUID           `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	EntryID          uuid.UUID           `gorm:"type:uuid;not null;index" json:"entry_id"`
+	PatientID        uuid.UUID           `gorm:"type:uuid;not null;index" json:"patient_id"`
+	TherapistID      uuid.UUID           `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	ConsultationType ConsultationType    `gorm:"type:consultation_enum;not null" json:"consultation_type"`
+	SessionTypeID    *uuid.UUID          `gorm:"type:uuid" json:"session_type_id"`
+	SlotStart        time.Time           `gorm:"not null" json:"slot_start"`
+	DurationMinutes  int                 `gorm:"not null" json:"duration_minutes"`
+	BufferMinutes    int                 `gorm:"not null" json:"buffer_minutes"`
+	Status           WaitlistOfferStatus `gorm:"type:waitlist_offer_status_enum;not null;default:'pending'" json:"status"`
+	ExpiresAt        time.Time           `gorm:"not null" json:"expires_at"`
+	AppointmentID    *uuid.UUID          `gorm:"type:uuid" json:"appointment_id"`
+	CreatedAt        time.Time           `json:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at"`
+}
@@ -0,0 +1,66 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduleWindow is a time range within a day in the therapist's local time, "HH:MM" to "HH:MM".
+// ConsultationType is only used by date overrides, empty means every type the therapist offers.
+type ScheduleWindow struct {
+	Start            string           `json:"start"`
+	End              string           `json:"end"`
+	ConsultationType ConsultationType `json:"consultation_type,omitempty"`
+}
+
+// ScheduleWindows is stored as jsonb
+type ScheduleWindows []ScheduleWindow
+
+func (windows ScheduleWindows) Value() (driver.Value, error) {
+	if windows == nil {
+		return nil, nil
+	}
+	return json.Marshal(windows)
+}
+
+func (windows *ScheduleWindows) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, windows)
+	case string:
+		return json.Unmarshal([]byte(v), windows)
+	case nil:
+		*windows = nil
+		return nil
+	}
+	return errors.New("unsupported type for ScheduleWindows")
+}
+
+// WorkingHours is one recurring block of a therapist's week. A therapist may have several blocks
+// per weekday, e.g. online mornings and offline afternoons, and Breaks are cut out of the block.
+type WorkingHours struct {
+	ID               uuid.UUID        `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID      uuid.UUID        `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	Weekday          time.Weekday     `gorm:"not null" json:"weekday"` // 0 is Sunday
+	ConsultationType ConsultationType `gorm:"type:consultation_enum;not null" json:"consultation_type"`
+	StartTime        string           `gorm:"type:varchar(5);not null" json:"start_time"`
+	EndTime          string           `gorm:"type:varchar(5);not null" json:"end_time"`
+	Breaks           ScheduleWindows  `gorm:"type:jsonb" json:"breaks"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+// TimeOff blocks a therapist's schedule between two instants, e.g. leave or a conference
+type TimeOff struct {
+	ID          uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key" json:"id"`
+	TherapistID uuid.UUID `gorm:"type:uuid;not null;index" json:"therapist_id"`
+	StartsAt    time.Time `gorm:"not null" json:"starts_at"`
+	EndsAt      time.Time `gorm:"not null" json:"ends_at"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
@@ -13,13 +13,29 @@ func RegisterAppointmentRoutes(router *gin.Engine, db *gorm.DB, paymentService *
 	appointmentService := &services.AppointmentService{DB: db}
 	therapistService := &services.TherapistService{DB:db}
 	appointmentController := &controller.AppointmentController{AppointmentService: appointmentService,PaymentService: paymentService, TherapistService:therapistService}
+	seriesController := &controller.AppointmentSeriesController{
+		SeriesService:      &services.AppointmentSeriesService{DB: db},
+		AppointmentService: appointmentService,
+		PaymentService:     paymentService,
+		TherapistService:   therapistService,
+	}
 
 	api := router.Group("/api/appointment")
 	{
 		// Ensure the user is authenticated to create appointments
 		api.POST("/create-appointment", middleware.RoleMiddleware("patient"), appointmentController.CreateAppointment)
 		api.GET("/appointment-history", middleware.RoleMiddleware("patient"), appointmentController.GetAppointmentHistory)
+		api.GET("/:appointmentID", middleware.RoleMiddleware("patient", "therapist"), appointmentController.GetAppointmentDetail)
 		api.GET("/:appointmentID/user", middleware.RoleMiddleware("patient", "therapist") ,appointmentController.GetUserByAppointmentID)
+		api.GET("/:appointmentID/status-history", middleware.RoleMiddleware("patient", "therapist"), appointmentController.GetAppointmentStatusHistory)
+		api.GET("/:appointmentID/cancellation-quote", middleware.RoleMiddleware("patient"), appointmentController.GetCancellationQuote)
+		api.POST("/:appointmentID/cancel", middleware.RoleMiddleware("patient"), appointmentController.CancelAppointment)
+		api.POST("/:appointmentID/reschedule", middleware.RoleMiddleware("patient"), appointmentController.RescheduleAppointment)
+		api.POST("/:appointmentID/pay", middleware.RoleMiddleware("patient"), seriesController.PayOccurrence)
+		api.POST("/series", middleware.RoleMiddleware("patient"), seriesController.CreateSeries)
+		api.GET("/series/:seriesID", middleware.RoleMiddleware("patient", "therapist"), seriesController.GetSeries)
+		api.POST("/series/:seriesID/cancel", middleware.RoleMiddleware("patient"), seriesController.CancelSeries)
+		api.POST("/series/:seriesID/reschedule", middleware.RoleMiddleware("patient"), seriesController.RescheduleSeries)
 		api.GET("/upcomingAppointment/:id", middleware.RoleMiddleware("therapist") ,appointmentController.GetUpcomingAppointments)
 	}
 }
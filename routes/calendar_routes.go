@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterCalendarRoutes(router *gin.Engine, db *gorm.DB) {
+	calendarFeedService := &services.CalendarFeedService{DB: db}
+	calendarFeedController := &controller.CalendarFeedController{CalendarFeedService: calendarFeedService}
+
+	api := router.Group("/api/calendar")
+	{
+		api.GET("/feed", middleware.RoleMiddleware(), calendarFeedController.GetFeed)
+		api.POST("/feed/token", middleware.RoleMiddleware(), calendarFeedController.RegenerateToken)
+		api.DELETE("/feed", middleware.RoleMiddleware(), calendarFeedController.RevokeFeed)
+
+		// No JWT, the token in the URL is the credential
+		api.GET("/ics/:token", calendarFeedController.GetICS)
+	}
+}
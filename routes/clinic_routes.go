@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterClinicRoutes(router *gin.Engine, db *gorm.DB) {
+	clinicController := &controller.ClinicController{ClinicService: &services.ClinicService{DB: db}}
+
+	api := router.Group("/api")
+	{
+		api.GET("/clinics", clinicController.GetClinics)
+		api.POST("/clinics", middleware.RoleMiddleware("admin"), clinicController.CreateClinic)
+		api.PUT("/clinics/:id", middleware.RoleMiddleware("admin"), clinicController.UpdateClinic)
+
+		api.GET("/therapist/:id/clinics", clinicController.GetTherapistClinics)
+		api.GET("/therapists/clinics", middleware.RoleMiddleware("therapist"), clinicController.GetMyClinics)
+		api.PUT("/therapists/clinics", middleware.RoleMiddleware("therapist"), clinicController.SetMyClinics)
+	}
+}
@@ -0,0 +1,38 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterGroupSessionRoutes takes the group session service from main, which also fills freed
+// seats on a schedule
+func RegisterGroupSessionRoutes(router *gin.Engine, db *gorm.DB, paymentService *services.PaymentService, groupSessionService *services.GroupSessionService) {
+	groupSessionController := &controller.GroupSessionController{
+		GroupSessionService: groupSessionService,
+		PaymentService:      paymentService,
+		TherapistService:    &services.TherapistService{DB: db},
+	}
+
+	therapistRoutes := router.Group("/api/therapists/group-sessions")
+	therapistRoutes.Use(middleware.RoleMiddleware("therapist"))
+	{
+		therapistRoutes.POST("", groupSessionController.CreateSession)
+		therapistRoutes.GET("", groupSessionController.GetMySessions)
+		therapistRoutes.GET("/:id/roster", groupSessionController.GetRoster)
+		therapistRoutes.POST("/:id/cancel", groupSessionController.CancelSession)
+	}
+
+	api := router.Group("/api/group-sessions")
+	{
+		api.GET("", groupSessionController.ListSessions)
+		api.GET("/registrations", middleware.RoleMiddleware("patient"), groupSessionController.GetMyRegistrations)
+		api.GET("/:id", groupSessionController.GetSession)
+		api.POST("/:id/register", middleware.RoleMiddleware("patient"), groupSessionController.Register)
+		api.POST("/:id/pay", middleware.RoleMiddleware("patient"), groupSessionController.PayRegistration)
+		api.POST("/:id/cancel-registration", middleware.RoleMiddleware("patient"), groupSessionController.CancelRegistration)
+	}
+}
@@ -9,7 +9,8 @@ import (
 )
 
 func RegisterJournalRoutes(router *gin.Engine, db *gorm.DB) {
-	journalService := &services.JournalService{DB: db}
+	dataKeyService := &services.DataKeyService{DB: db}
+	journalService := &services.JournalService{DB: db, DataKeyService: dataKeyService}
 	journalController := &controller.JournalController{JournalService: journalService}
 
 	api := router.Group("/api")
@@ -18,6 +19,18 @@ func RegisterJournalRoutes(router *gin.Engine, db *gorm.DB) {
 		{
 			journalRoutes.GET("", journalController.GetUserJournals)
 			journalRoutes.POST("", journalController.CreateJournal)
+			journalRoutes.GET("/search", journalController.SearchJournals)
+			journalRoutes.GET("/calendar", journalController.GetCalendar)
+			journalRoutes.GET("/insights", journalController.GetMoodInsights)
+			journalRoutes.GET("/tags", journalController.GetTags)
+			journalRoutes.DELETE("/tags/:id", journalController.DeleteTag)
+			journalRoutes.PUT("/:id", journalController.UpdateJournal)
+			journalRoutes.DELETE("/:id", journalController.DeleteJournal)
 		}
+		journalAdminRoutes := api.Group("/journals/keys", middleware.RoleMiddleware("admin"))
+		{
+			journalAdminRoutes.POST("/rotate", journalController.RotateKeys)
+		}
+		api.POST("/journals/sentiment/backfill", middleware.RoleMiddleware("admin"), journalController.BackfillSentiment)
 	}
 }
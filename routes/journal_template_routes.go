@@ -0,0 +1,35 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterJournalTemplateRoutes(router *gin.Engine, db *gorm.DB) {
+	journalTemplateService := &services.JournalTemplateService{DB: db}
+	checkInService := &services.CheckInService{DB: db}
+	journalTemplateController := &controller.JournalTemplateController{
+		JournalTemplateService: journalTemplateService,
+		CheckInService:         checkInService,
+	}
+
+	api := router.Group("/api")
+	{
+		adminRoutes := api.Group("", middleware.RoleMiddleware("admin"))
+		{
+			adminRoutes.POST("/journal-templates", journalTemplateController.CreateTemplate)
+			adminRoutes.PUT("/journal-templates/:id", journalTemplateController.UpdateTemplate)
+			adminRoutes.DELETE("/journal-templates/:id", journalTemplateController.ArchiveTemplate)
+			adminRoutes.POST("/journal-prompts", journalTemplateController.CreatePrompt)
+			adminRoutes.PUT("/journal-prompts/:id", journalTemplateController.UpdatePrompt)
+			adminRoutes.DELETE("/journal-prompts/:id", journalTemplateController.ArchivePrompt)
+		}
+
+		api.GET("/journal-templates", middleware.RoleMiddleware("patient", "admin"), journalTemplateController.GetTemplates)
+		api.GET("/journal-prompts", middleware.RoleMiddleware("patient", "admin"), journalTemplateController.GetPrompts)
+		api.GET("/journal-prompts/daily", middleware.RoleMiddleware("patient"), journalTemplateController.GetDailyPrompt)
+	}
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterMatchingRoutes(router *gin.Engine, db *gorm.DB) {
+	matchingController := &controller.MatchingController{MatchingService: &services.MatchingService{DB: db}}
+
+	matchingRoutes := router.Group("/api/matching")
+	{
+		matchingRoutes.GET("/questionnaire", middleware.RoleMiddleware("patient"), matchingController.GetQuestionnaire)
+		matchingRoutes.PUT("/questionnaire", middleware.RoleMiddleware("patient"), matchingController.SaveQuestionnaire)
+		matchingRoutes.GET("/recommendations", middleware.RoleMiddleware("patient"), matchingController.GetRecommendations)
+
+		matchingRoutes.GET("/weights", middleware.RoleMiddleware("admin"), matchingController.GetWeights)
+		matchingRoutes.PUT("/weights", middleware.RoleMiddleware("admin"), matchingController.UpdateWeights)
+	}
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterNotificationRoutes(router *gin.Engine, db *gorm.DB) {
+	notificationService := &services.NotificationService{DB: db}
+	notificationController := &controller.NotificationController{NotificationService: notificationService}
+
+	api := router.Group("/api/notifications")
+	api.Use(middleware.RoleMiddleware())
+	{
+		api.GET("/preferences", notificationController.GetPreferences)
+		api.PUT("/preferences", notificationController.UpdatePreferences)
+	}
+}
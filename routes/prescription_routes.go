@@ -12,14 +12,10 @@ func RegisterPrescriptionRoutes(router *gin.Engine, db *gorm.DB) {
 	// Create the necessary services
 	therapistService := &services.TherapistService{DB: db}
 	appointmentService := &services.AppointmentService{DB: db}
-	consultationHistoryService := &services.ConsultationHistoryService{DB: db}
-	prescriptionService := &services.PrescriptionService{DB: db}
 
 	therapistController := &controller.TherapistController{
 		TherapistService:             therapistService,
 		AppointmentService:           appointmentService,
-		ConsultationHistoryService:   consultationHistoryService,
-		PrescriptionService:          prescriptionService,
 	}
 
 	// Define API routes
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterRefundRoutes(router *gin.Engine, db *gorm.DB) {
+	refundService := &services.RefundService{DB: db}
+	refundController := &controller.RefundController{RefundService: refundService}
+
+	api := router.Group("/api/refunds")
+	{
+		api.GET("", middleware.RoleMiddleware("admin"), refundController.GetRefunds)
+		api.GET("/me", middleware.RoleMiddleware("patient"), refundController.GetMyRefunds)
+	}
+}
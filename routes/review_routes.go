@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterReviewRoutes(router *gin.Engine, db *gorm.DB) {
+	reviewController := &controller.ReviewController{ReviewService: &services.ReviewService{DB: db}}
+
+	api := router.Group("/api")
+	{
+		api.POST("/appointment/:appointmentID/review", middleware.RoleMiddleware("patient"), reviewController.SubmitReview)
+		api.GET("/therapist/:id/reviews", reviewController.GetTherapistReviews)
+		api.POST("/therapists/reviews/:id/reply", middleware.RoleMiddleware("therapist"), reviewController.ReplyToReview)
+
+		api.GET("/reviews", middleware.RoleMiddleware("admin"), reviewController.GetReviews)
+		api.GET("/reviews/me", middleware.RoleMiddleware("patient"), reviewController.GetMyReviews)
+		api.PATCH("/reviews/:id", middleware.RoleMiddleware("admin"), reviewController.ModerateReview)
+	}
+}
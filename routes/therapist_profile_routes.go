@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func RegisterTherapistProfileRoutes(router *gin.Engine, db *gorm.DB) {
+	taxonomyController := &controller.TaxonomyController{TaxonomyService: &services.TaxonomyService{DB: db}}
+	profileController := &controller.TherapistProfileController{TherapistProfileService: &services.TherapistProfileService{DB: db}}
+
+	api := router.Group("/api")
+	{
+		api.GET("/taxonomy", taxonomyController.GetTerms)
+		api.GET("/taxonomy/all", middleware.RoleMiddleware("admin"), taxonomyController.GetAllTerms)
+		api.POST("/taxonomy", middleware.RoleMiddleware("admin"), taxonomyController.CreateTerm)
+		api.PATCH("/taxonomy/:id", middleware.RoleMiddleware("admin"), taxonomyController.UpdateTerm)
+
+		api.GET("/therapists/profile", middleware.RoleMiddleware("therapist"), profileController.GetMyProfile)
+		api.PUT("/therapists/profile", middleware.RoleMiddleware("therapist"), profileController.SubmitProfile)
+
+		api.GET("/therapists/profile-revisions", middleware.RoleMiddleware("admin"), profileController.GetRevisions)
+		api.POST("/therapists/profile-revisions/:id/approve", middleware.RoleMiddleware("admin"), profileController.ApproveRevision)
+		api.POST("/therapists/profile-revisions/:id/reject", middleware.RoleMiddleware("admin"), profileController.RejectRevision)
+	}
+}
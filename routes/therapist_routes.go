@@ -8,11 +8,15 @@ import (
 	"gorm.io/gorm"
 )
 
-func RegisterTherapistRoutes(router *gin.Engine, db *gorm.DB) {
+func RegisterTherapistRoutes(router *gin.Engine, db *gorm.DB, notificationSender services.NotificationSender) {
 	therapistService := &services.TherapistService{DB: db}
-	consultationService := &services.ConsultationHistoryService{DB: db}
-	prescriptionService := &services.PrescriptionService{DB : db}
-	therapistController := &controller.TherapistController{TherapistService: therapistService, ConsultationHistoryService: consultationService, PrescriptionService: prescriptionService}
+	appointmentService := &services.AppointmentService{DB: db, Sender: notificationSender}
+	therapistController := &controller.TherapistController{TherapistService: therapistService, AppointmentService: appointmentService, TherapistProfileService: &services.TherapistProfileService{DB: db}}
+	scheduleController := &controller.ScheduleController{ScheduleService: &services.ScheduleService{DB: db}}
+	sessionTypeController := &controller.SessionTypeController{SessionTypeService: &services.SessionTypeService{DB: db}}
+	externalCalendarController := &controller.ExternalCalendarController{
+		ExternalCalendarService: &services.ExternalCalendarService{DB: db, Fetcher: services.NewHTTPCalendarFetcher()},
+	}
 
 	api := router.Group("/api")
 	{
@@ -27,10 +31,38 @@ func RegisterTherapistRoutes(router *gin.Engine, db *gorm.DB) {
 			therapistRoutes.POST("/consultation-history/:appointmentID", therapistController.AddPrescriptionAndMedication)
 			therapistRoutes.PATCH("/availability", therapistController.UpdateAvailability)
 			therapistRoutes.GET("/appointments", therapistController.GetTherapistAppointments)
+			// Bookings are confirmed by their payment, so therapists only have a decline action
+			therapistRoutes.POST("/appointments/:appointmentID/decline", therapistController.DeclineAppointment)
+			therapistRoutes.POST("/appointments/:appointmentID/start", therapistController.StartAppointment)
+			therapistRoutes.POST("/appointments/:appointmentID/complete", therapistController.CompleteAppointment)
+			therapistRoutes.POST("/appointments/:appointmentID/no-show", therapistController.MarkAppointmentNoShow)
+			therapistRoutes.GET("/working-hours", scheduleController.GetMyWorkingHours)
+			therapistRoutes.PUT("/working-hours", scheduleController.ReplaceWorkingHours)
+			therapistRoutes.GET("/availability", scheduleController.GetDateOverrides)
+			therapistRoutes.POST("/availability/bulk", scheduleController.ApplyAvailabilityException)
+			therapistRoutes.PUT("/availability/:date", scheduleController.SetDateOverride)
+			therapistRoutes.DELETE("/availability/:date", scheduleController.DeleteDateOverride)
+			therapistRoutes.GET("/time-off", scheduleController.GetTimeOff)
+			therapistRoutes.POST("/time-off", scheduleController.AddTimeOff)
+			therapistRoutes.POST("/time-off/bulk", scheduleController.AddTimeOffRanges)
+			therapistRoutes.DELETE("/time-off/:id", scheduleController.DeleteTimeOff)
+			therapistRoutes.PUT("/booking-settings", scheduleController.UpdateBookingSettings)
+			therapistRoutes.GET("/session-types", sessionTypeController.GetMySessionTypes)
+			therapistRoutes.POST("/session-types", sessionTypeController.CreateSessionType)
+			therapistRoutes.PUT("/session-types/:id", sessionTypeController.UpdateSessionType)
+			therapistRoutes.DELETE("/session-types/:id", sessionTypeController.DeactivateSessionType)
+			therapistRoutes.GET("/external-calendars", externalCalendarController.GetCalendars)
+			therapistRoutes.POST("/external-calendars", externalCalendarController.SubscribeCalendar)
+			therapistRoutes.POST("/external-calendars/import", externalCalendarController.ImportCalendar)
+			therapistRoutes.PUT("/external-calendars/:id/file", externalCalendarController.ReplaceCalendarFile)
+			therapistRoutes.POST("/external-calendars/:id/sync", externalCalendarController.SyncCalendar)
+			therapistRoutes.DELETE("/external-calendars/:id", externalCalendarController.DeleteCalendar)
 		}
 
 		api.GET("/therapists", therapistController.GetTherapistsFiltered)
 		api.GET("/therapist/:id/details", therapistController.GetTherapistDetails)
 		api.GET("/therapist/:id/schedule", therapistController.GetTherapistSchedule)
+		api.GET("/therapist/:id/working-hours", scheduleController.GetWorkingHours)
+		api.GET("/therapist/:id/session-types", sessionTypeController.GetSessionTypes)
 	}
 }
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"github.com/Hand-TBN1/hand-backend/controller"
+	"github.com/Hand-TBN1/hand-backend/middleware"
+	"github.com/Hand-TBN1/hand-backend/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// RegisterWaitlistRoutes takes the waitlist service from main, which also runs it on a schedule
+func RegisterWaitlistRoutes(router *gin.Engine, db *gorm.DB, paymentService *services.PaymentService, waitlistService *services.WaitlistService) {
+	waitlistController := &controller.WaitlistController{
+		WaitlistService:    waitlistService,
+		AppointmentService: &services.AppointmentService{DB: db},
+		PaymentService:     paymentService,
+	}
+
+	api := router.Group("/api/waitlist")
+	api.Use(middleware.RoleMiddleware("patient"))
+	{
+		api.POST("", waitlistController.JoinWaitlist)
+		api.GET("", waitlistController.GetEntries)
+		api.DELETE("/:id", waitlistController.LeaveWaitlist)
+		api.GET("/offers", waitlistController.GetOffers)
+		api.POST("/offers/:id/accept", waitlistController.AcceptOffer)
+		api.POST("/offers/:id/decline", waitlistController.DeclineOffer)
+	}
+}
@@ -0,0 +1,346 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	MaxSeriesOccurrences = 26
+	// Later occurrences of a series paid per session are due this long before they start
+	seriesPaymentLead = 48 * time.Hour
+)
+
+var (
+	ErrInvalidSeries        = errors.New("invalid appointment series")
+	ErrNothingToPay         = errors.New("appointment is not awaiting its own payment")
+	ErrSeriesPaymentPending = errors.New("series payment is still pending")
+)
+
+// SeriesConflictError lists the occurrences of a series whose slots are not available
+type SeriesConflictError struct {
+	Dates []time.Time
+}
+
+func (err *SeriesConflictError) Error() string {
+	return fmt.Sprintf("%d occurrences of the series are not available", len(err.Dates))
+}
+
+func (err *SeriesConflictError) Unwrap() error {
+	return ErrSlotUnavailable
+}
+
+type AppointmentSeriesService struct {
+	DB *gorm.DB
+}
+
+// BookSeries books every occurrence of a recurring series starting at first, or none of them
+// when any slot is taken. All occurrences await payment, a series paid upfront is due at once
+// while one paid per session only has its first occurrence due now.
+func (service *AppointmentSeriesService) BookSeries(series *models.AppointmentSeries, therapist *models.Therapist, first time.Time) ([]models.Appointment, error) {
+	if series.Frequency.Weeks() == 0 || !series.PaymentMode.IsValid() || series.Occurrences < 2 || series.Occurrences > MaxSeriesOccurrences {
+		return nil, ErrInvalidSeries
+	}
+
+	template := models.Appointment{
+		UserID:        series.UserID,
+		TherapistID:   series.TherapistID,
+		Type:          series.ConsultationType,
+		PaymentStatus: models.MidtransStatusPending,
+	}
+	if err := applySessionType(service.DB, &template, therapist, series.SessionTypeID); err != nil {
+		return nil, err
+	}
+
+	dates := make([]time.Time, series.Occurrences)
+	for i := range dates {
+		dates[i] = first.AddDate(0, 0, 7*series.Frequency.Weeks()*i)
+	}
+
+	var appointments []models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockTherapistSchedule(tx, series.TherapistID); err != nil {
+			return err
+		}
+		var conflicts []time.Time
+		for _, date := range dates {
+			bookable, err := isSlotBookable(tx, series.TherapistID, template.Type, appointmentSessionSpec(&template), date)
+			if err != nil {
+				return err
+			}
+			if !bookable {
+				conflicts = append(conflicts, date)
+			}
+		}
+		if len(conflicts) > 0 {
+			return &SeriesConflictError{Dates: conflicts}
+		}
+
+		now := time.Now()
+		series.ID = uuid.New()
+		series.CreatedAt = now
+		series.UpdatedAt = now
+		if err := tx.Create(series).Error; err != nil {
+			return err
+		}
+
+		for i, date := range dates {
+			appointment := template
+			appointment.ID = uuid.New()
+			appointment.SeriesID = &series.ID
+			appointment.AppointmentDate = date
+			appointment.CreatedAt = now
+			due := seriesPaymentDue(series.PaymentMode, i, date, now)
+			appointment.PaymentDueAt = &due
+			if err := bookAppointment(tx, &appointment, "series_booked"); err != nil {
+				return err
+			}
+			appointments = append(appointments, appointment)
+		}
+		return nil
+	})
+	if isSlotConflict(err) {
+		return nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return appointments, nil
+}
+
+// GetSeries returns a series with all its appointments by date, for its patient or therapist
+func (service *AppointmentSeriesService) GetSeries(seriesID, userID uuid.UUID) (*models.AppointmentSeries, []models.Appointment, error) {
+	var series models.AppointmentSeries
+	err := service.DB.Where("id = ? AND (user_id = ? OR therapist_id = ?)", seriesID, userID, userID).First(&series).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var appointments []models.Appointment
+	err = service.DB.Where("series_id = ?", seriesID).Order("appointment_date asc, created_at asc").Find(&appointments).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &series, appointments, nil
+}
+
+// StartOccurrencePayment readies an occurrence of a series paid per session for its payment,
+// the patient then has the payment window to pay it even if it was due sooner
+func (service *AppointmentSeriesService) StartOccurrencePayment(appointmentID, patientID uuid.UUID) (*models.Appointment, error) {
+	var appointment *models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if appointment, err = lockAppointment(tx, appointmentID); err != nil {
+			return err
+		}
+		if appointment.UserID != patientID {
+			return gorm.ErrRecordNotFound
+		}
+		if appointment.Status != models.PendingPayment || appointment.SeriesID == nil {
+			return ErrNothingToPay
+		}
+		var series models.AppointmentSeries
+		if err := tx.First(&series, "id = ?", *appointment.SeriesID).Error; err != nil {
+			return err
+		}
+		if series.PaymentMode != models.SeriesPayPerSession {
+			return ErrNothingToPay
+		}
+
+		due := time.Now().Add(paymentWindow())
+		if appointment.PaymentDueAt != nil && appointment.PaymentDueAt.After(due) {
+			return nil
+		}
+		appointment.PaymentDueAt = &due
+		return tx.Model(appointment).UpdateColumn("payment_due_at", due).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// CancelFuture cancels every occurrence of the patient's series that has not started yet, each
+// refunded by the cancellation policy like a single cancellation
+func (service *AppointmentSeriesService) CancelFuture(seriesID, patientID uuid.UUID, reason string) ([]models.Appointment, []models.Refund, error) {
+	var appointments []models.Appointment
+	var refunds []models.Refund
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if appointments, err = lockFutureOccurrences(tx, seriesID, patientID); err != nil {
+			return err
+		}
+		for i := range appointments {
+			refund, err := cancelForPatient(tx, &appointments[i], patientID, reason)
+			if err != nil {
+				return err
+			}
+			if refund != nil {
+				refunds = append(refunds, *refund)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return appointments, refunds, nil
+}
+
+// RescheduleFuture moves every occurrence of the patient's series that has not started yet by
+// the same amount of time, so that the next one starts at first. Either all occurrences move or
+// none do. Confirmed occurrences must still be in their free rescheduling window.
+func (service *AppointmentSeriesService) RescheduleFuture(seriesID, patientID uuid.UUID, first time.Time) ([]models.Appointment, error) {
+	var moved []models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		appointments, err := lockFutureOccurrences(tx, seriesID, patientID)
+		if err != nil {
+			return err
+		}
+		var series models.AppointmentSeries
+		if err := tx.First(&series, "id = ?", seriesID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for i := range appointments {
+			appointment := &appointments[i]
+			// A new occurrence would not be covered by the series payment in flight
+			if appointment.Status == models.PendingPayment && series.PaymentMode == models.SeriesPayUpfront {
+				return ErrSeriesPaymentPending
+			}
+			if appointment.Status == models.Confirmed && !cancellationQuote(appointment, now).CanReschedule {
+				return ErrRescheduleWindowClosed
+			}
+		}
+		if err := lockTherapistSchedule(tx, series.TherapistID); err != nil {
+			return err
+		}
+
+		// Free the old slots first, occurrences often move onto each other's dates
+		delta := first.Sub(appointments[0].AppointmentDate)
+		statuses := make([]models.AppointmentScheduleStatus, len(appointments))
+		ids := make([]uuid.UUID, len(appointments))
+		for i := range appointments {
+			appointment := &appointments[i]
+			statuses[i] = appointment.Status
+			ids[i] = uuid.New()
+			next := models.Rescheduled
+			if appointment.Status == models.PendingPayment {
+				next = models.CancelledByPatient
+			}
+			if err := transitionStatus(tx, appointment, next, &patientID, "rescheduled_to:"+ids[i].String()); err != nil {
+				return err
+			}
+		}
+
+		var conflicts []time.Time
+		for i := range appointments {
+			date := appointments[i].AppointmentDate.Add(delta)
+			bookable, err := isSlotBookable(tx, series.TherapistID, appointments[i].Type, appointmentSessionSpec(&appointments[i]), date)
+			if err != nil {
+				return err
+			}
+			if !bookable {
+				conflicts = append(conflicts, date)
+			}
+		}
+		if len(conflicts) > 0 {
+			return &SeriesConflictError{Dates: conflicts}
+		}
+
+		for i := range appointments {
+			old := &appointments[i]
+			date := old.AppointmentDate.Add(delta)
+			if statuses[i] == models.Confirmed {
+				rescheduled, err := moveConfirmedAppointment(tx, old, ids[i], date, patientID)
+				if err != nil {
+					return err
+				}
+				moved = append(moved, *rescheduled)
+				continue
+			}
+
+			rebooked := models.Appointment{
+				ID:                ids[i],
+				UserID:            old.UserID,
+				TherapistID:       old.TherapistID,
+				Type:              old.Type,
+				RescheduledFromID: &old.ID,
+				SeriesID:          old.SeriesID,
+				Price:             old.Price,
+				SessionTypeID:     old.SessionTypeID,
+				DurationMinutes:   old.DurationMinutes,
+				BufferMinutes:     old.BufferMinutes,
+				PaymentStatus:     models.MidtransStatusPending,
+				PaymentDueAt:      old.PaymentDueAt,
+				AppointmentDate:   date,
+				CreatedAt:         now,
+			}
+			if err := bookAppointment(tx, &rebooked, "rescheduled_from:"+old.ID.String()); err != nil {
+				return err
+			}
+			moved = append(moved, rebooked)
+		}
+		return nil
+	})
+	if isSlotConflict(err) {
+		return nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return moved, nil
+}
+
+// lockFutureOccurrences locks the occurrences of the patient's series that have not started and
+// still hold their slot, by date
+func lockFutureOccurrences(tx *gorm.DB, seriesID, patientID uuid.UUID) ([]models.Appointment, error) {
+	var appointments []models.Appointment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("series_id = ? AND user_id = ? AND status IN ? AND appointment_date > ?",
+			seriesID, patientID, []models.AppointmentScheduleStatus{models.PendingPayment, models.Confirmed}, time.Now()).
+		Order("appointment_date asc").
+		Find(&appointments).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(appointments) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return appointments, nil
+}
+
+// lockUpfrontSeriesAppointments locks the appointments of a series paid upfront, the series
+// payment applies to all of them
+func lockUpfrontSeriesAppointments(tx *gorm.DB, seriesID uuid.UUID) ([]models.Appointment, error) {
+	var series models.AppointmentSeries
+	if err := tx.First(&series, "id = ? AND payment_mode = ?", seriesID, models.SeriesPayUpfront).Error; err != nil {
+		return nil, err
+	}
+
+	var appointments []models.Appointment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("series_id = ?", seriesID).Order("appointment_date asc").
+		Find(&appointments).Error
+	return appointments, err
+}
+
+// seriesPaymentDue is when an occurrence has to be paid. Occurrences paid per session after the
+// first are due a while before they start, but never sooner than a fresh payment window.
+func seriesPaymentDue(mode models.SeriesPaymentMode, index int, date, now time.Time) time.Time {
+	due := now.Add(paymentWindow())
+	if mode == models.SeriesPayUpfront || index == 0 {
+		return due
+	}
+	if lead := date.Add(-seriesPaymentLead); lead.After(due) {
+		return lead
+	}
+	return due
+}
@@ -1,19 +1,398 @@
 package services
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"time"
+	"github.com/Hand-TBN1/hand-backend/config"
 	"github.com/Hand-TBN1/hand-backend/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
+var (
+	ErrInvalidStatusTransition = errors.New("invalid appointment status transition")
+	ErrRescheduleWindowClosed  = errors.New("appointment can no longer be rescheduled")
+	ErrSlotUnavailable         = errors.New("time slot is not available")
+	ErrInvalidConsultationType = errors.New("therapist does not offer this consultation type")
+)
+
+// Postgres error codes for unique_violation and exclusion_violation
+const (
+	uniqueViolationCode    = "23505"
+	exclusionViolationCode = "23P01"
+)
+
+// CancellationQuote is what the cancellation policy gives a patient at a point in time
+type CancellationQuote struct {
+	RefundPercent int       `json:"refund_percent"`
+	RefundAmount  int64     `json:"refund_amount"`
+	FreeUntil     time.Time `json:"free_until"`
+	CanReschedule bool      `json:"can_reschedule"`
+}
+
 type AppointmentService struct {
 	DB *gorm.DB
+	// Sender tells patients about what their therapist did with a booking, nil sends nothing
+	Sender NotificationSender
 }
 
-// CreateAppointment creates a new appointment for a user
+// CreateAppointment books a free slot of the therapist for a new appointment awaiting payment
+// and records it as the first entry of its status history. Concurrent bookings of the same slot
+// are serialised, the losers get ErrSlotUnavailable.
 func (service *AppointmentService) CreateAppointment(appointment *models.Appointment) error {	
-	return service.DB.Create(appointment).Error
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		return bookAppointment(tx, appointment, "booked")
+	})
+	if isSlotConflict(err) {
+		return ErrSlotUnavailable
+	}
+	return err
+}
+
+// bookAppointment takes the slot for a new appointment awaiting payment, or fails with
+// ErrSlotUnavailable when the therapist's schedule no longer has it
+func bookAppointment(tx *gorm.DB, appointment *models.Appointment, reason string) error {
+	if err := lockTherapistSchedule(tx, appointment.TherapistID); err != nil {
+		return err
+	}
+	bookable, err := isSlotBookable(tx, appointment.TherapistID, appointment.Type, appointmentSessionSpec(appointment), appointment.AppointmentDate)
+	if err != nil {
+		return err
+	}
+	if !bookable {
+		return ErrSlotUnavailable
+	}
+
+	now := time.Now()
+	appointment.Status = models.PendingPayment
+	appointment.StatusChangedAt = &now
+	if appointment.PaymentDueAt == nil {
+		due := now.Add(paymentWindow())
+		appointment.PaymentDueAt = &due
+	}
+	if err := tx.Create(appointment).Error; err != nil {
+		return err
+	}
+	return recordStatusChange(tx, appointment.ID, nil, appointment.Status, &appointment.UserID, reason)
+}
+
+// ApplySessionType sets the session length, buffer and price of a new appointment from one of
+// the therapist's session types, or from the default one hour session at their rate for its type
+func (service *AppointmentService) ApplySessionType(appointment *models.Appointment, therapist *models.Therapist, sessionTypeID *uuid.UUID) error {
+	return applySessionType(service.DB, appointment, therapist, sessionTypeID)
+}
+
+func applySessionType(db *gorm.DB, appointment *models.Appointment, therapist *models.Therapist, sessionTypeID *uuid.UUID) error {
+	if sessionTypeID == nil {
+		appointment.SessionTypeID = nil
+		appointment.DurationMinutes = defaultSlotMinutes
+		appointment.BufferMinutes = 0
+		appointment.Price = therapist.RateFor(appointment.Type)
+		return nil
+	}
+
+	sessionType, err := findSessionType(db, therapist.UserID, *sessionTypeID, appointment.Type)
+	if err != nil {
+		return err
+	}
+	appointment.SessionTypeID = &sessionType.ID
+	appointment.DurationMinutes = sessionType.DurationMinutes
+	appointment.BufferMinutes = sessionType.BufferMinutes
+	appointment.Price = sessionType.Price
+	return nil
+}
+
+// CheckConsultationType tells whether a therapist offers the requested kind of session,
+// hybrid therapists offer both online and offline ones
+func CheckConsultationType(therapist *models.Therapist, consultationType models.ConsultationType) error {
+	switch consultationType {
+	case models.Online, models.Offline, models.Hybrid:
+	default:
+		return ErrInvalidConsultationType
+	}
+	if therapist.Consultation != models.Hybrid && therapist.Consultation != consultationType {
+		return ErrInvalidConsultationType
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolationCode
+}
+
+// isSlotConflict tells whether an appointment was refused because another one already holds
+// part of its time
+func isSlotConflict(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == exclusionViolationCode
+}
+
+// TransitionStatus moves an appointment to a new status if the lifecycle allows it.
+// changedBy is nil for changes made by the system.
+func (service *AppointmentService) TransitionStatus(appointmentID uuid.UUID, to models.AppointmentScheduleStatus, changedBy *uuid.UUID, reason string) (*models.Appointment, error) {
+	var appointment *models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if appointment, err = lockAppointment(tx, appointmentID); err != nil {
+			return err
+		}
+		return transitionStatus(tx, appointment, to, changedBy, reason)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// QuoteCancellation applies the cancellation policy to an appointment of the patient
+func (service *AppointmentService) QuoteCancellation(appointmentID, patientID uuid.UUID) (*models.Appointment, CancellationQuote, error) {
+	appointment, err := service.GetAppointmentByID(appointmentID)
+	if err != nil {
+		return nil, CancellationQuote{}, err
+	}
+	if appointment.UserID != patientID {
+		return nil, CancellationQuote{}, gorm.ErrRecordNotFound
+	}
+	return appointment, cancellationQuote(appointment, time.Now()), nil
+}
+
+// CancelByPatient cancels an appointment for its patient and records the refund the policy
+// allows, if any
+func (service *AppointmentService) CancelByPatient(appointmentID, patientID uuid.UUID, reason string) (*models.Appointment, *models.Refund, error) {
+	var appointment *models.Appointment
+	var refund *models.Refund
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if appointment, err = lockAppointment(tx, appointmentID); err != nil {
+			return err
+		}
+		if appointment.UserID != patientID {
+			return gorm.ErrRecordNotFound
+		}
+		refund, err = cancelForPatient(tx, appointment, patientID, reason)
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return appointment, refund, nil
+}
+
+// cancelForPatient cancels a locked appointment and records the refund the policy allows, if any
+func cancelForPatient(tx *gorm.DB, appointment *models.Appointment, patientID uuid.UUID, reason string) (*models.Refund, error) {
+	quote := cancellationQuote(appointment, time.Now())
+	if reason == "" {
+		reason = "cancelled_by_patient"
+	}
+	if err := transitionStatus(tx, appointment, models.CancelledByPatient, &patientID, reason); err != nil {
+		return nil, err
+	}
+	if quote.RefundAmount == 0 {
+		return nil, nil
+	}
+	return createRefund(tx, appointment, quote.RefundAmount, quote.RefundPercent, "cancelled_by_patient")
+}
+
+// RescheduleByPatient moves a confirmed appointment to another free slot of the same therapist.
+// The old appointment ends as rescheduled and a new confirmed one carries over the payment.
+func (service *AppointmentService) RescheduleByPatient(appointmentID, patientID uuid.UUID, date time.Time) (*models.Appointment, error) {
+	var rescheduled *models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		appointment, err := lockAppointment(tx, appointmentID)
+		if err != nil {
+			return err
+		}
+		if appointment.UserID != patientID {
+			return gorm.ErrRecordNotFound
+		}
+		if !appointment.Status.CanTransitionTo(models.Rescheduled) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, appointment.Status, models.Rescheduled)
+		}
+		if !cancellationQuote(appointment, time.Now()).CanReschedule {
+			return ErrRescheduleWindowClosed
+		}
+
+		if err := lockTherapistSchedule(tx, appointment.TherapistID); err != nil {
+			return err
+		}
+		// Free the old slot first so the session can move to a time overlapping it, a slot that
+		// turns out to be taken rolls this back
+		id := uuid.New()
+		if err := transitionStatus(tx, appointment, models.Rescheduled, &patientID, "rescheduled_to:"+id.String()); err != nil {
+			return err
+		}
+		bookable, err := isSlotBookable(tx, appointment.TherapistID, appointment.Type, appointmentSessionSpec(appointment), date)
+		if err != nil {
+			return err
+		}
+		if !bookable {
+			return ErrSlotUnavailable
+		}
+
+		rescheduled, err = moveConfirmedAppointment(tx, appointment, id, date, patientID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rescheduled, nil
+}
+
+// moveConfirmedAppointment creates the confirmed appointment with the given ID that replaces
+// one moved to another date, carrying over its payment. The caller checks the slot and moves
+// the old appointment to rescheduled.
+func moveConfirmedAppointment(tx *gorm.DB, appointment *models.Appointment, id uuid.UUID, date time.Time, patientID uuid.UUID) (*models.Appointment, error) {
+	// The moved session gets a room of its own, the old link stops working with the old slot
+	meetingRoom, err := newMeetingRoom(appointment.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	rescheduled := &models.Appointment{
+		ID:                id,
+		UserID:            appointment.UserID,
+		TherapistID:       appointment.TherapistID,
+		Type:              appointment.Type,
+		Status:            models.Confirmed,
+		StatusChangedAt:   &now,
+		RescheduledFromID: &appointment.ID,
+		SeriesID:          appointment.SeriesID,
+		Price:             appointment.Price,
+		SessionTypeID:     appointment.SessionTypeID,
+		DurationMinutes:   appointment.DurationMinutes,
+		BufferMinutes:     appointment.BufferMinutes,
+		PaymentStatus:     appointment.PaymentStatus,
+		MeetingRoom:       meetingRoom,
+		AppointmentDate:   date,
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+	if err := tx.Create(rescheduled).Error; err != nil {
+		if isSlotConflict(err) {
+			return nil, ErrSlotUnavailable
+		}
+		return nil, err
+	}
+	if err := recordStatusChange(tx, rescheduled.ID, nil, models.Confirmed, &patientID, "rescheduled_from:"+appointment.ID.String()); err != nil {
+		return nil, err
+	}
+	return rescheduled, nil
+}
+
+// cancellationQuote refunds everything up to the free window, the configured share until the
+// session starts and nothing after. Unpaid appointments have nothing to refund.
+func cancellationQuote(appointment *models.Appointment, now time.Time) CancellationQuote {
+	freeUntil := appointment.AppointmentDate.Add(-time.Duration(config.Env.CancellationFreeHours) * time.Hour)
+	quote := CancellationQuote{
+		FreeUntil:     freeUntil,
+		CanReschedule: appointment.Status == models.Confirmed && now.Before(freeUntil),
+	}
+
+	if appointment.PaymentStatus == models.MidtransStatusSuccess {
+		quote.RefundPercent = policyRefundPercent(appointment.AppointmentDate, now)
+	}
+	quote.RefundAmount = appointment.Price * int64(quote.RefundPercent) / 100
+	return quote
+}
+
+// policyRefundPercent is the share of the price a paid session that starts at start refunds
+// when it is cancelled at now
+func policyRefundPercent(start, now time.Time) int {
+	freeUntil := start.Add(-time.Duration(config.Env.CancellationFreeHours) * time.Hour)
+	switch {
+	case now.Before(freeUntil):
+		return 100
+	case now.Before(start):
+		return config.Env.LateCancellationRefundPercent
+	}
+	return 0
+}
+
+// GetStatusHistory returns the status changes of an appointment, oldest first
+func (service *AppointmentService) GetStatusHistory(appointmentID uuid.UUID) ([]models.AppointmentStatusHistory, error) {
+	var history []models.AppointmentStatusHistory
+	err := service.DB.Where("appointment_id = ?", appointmentID).Order("created_at asc").Find(&history).Error
+	return history, err
+}
+
+func (service *AppointmentService) GetAppointmentByID(appointmentID uuid.UUID) (*models.Appointment, error) {
+	var appointment models.Appointment
+	if err := service.DB.First(&appointment, "id = ?", appointmentID).Error; err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// GetAppointmentDetails loads an appointment with its patient and therapist
+func (service *AppointmentService) GetAppointmentDetails(appointmentID uuid.UUID) (*models.Appointment, error) {
+	var appointment models.Appointment
+	err := service.DB.Preload("User").Preload("Therapist").Preload("Therapist.Therapist").
+		First(&appointment, "id = ?", appointmentID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+func lockAppointment(tx *gorm.DB, appointmentID uuid.UUID) (*models.Appointment, error) {
+	var appointment models.Appointment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&appointment, "id = ?", appointmentID).Error; err != nil {
+		return nil, err
+	}
+	return &appointment, nil
+}
+
+// transitionStatus is the single place appointment statuses change, the appointment should be
+// locked by the caller's transaction
+func transitionStatus(tx *gorm.DB, appointment *models.Appointment, to models.AppointmentScheduleStatus, changedBy *uuid.UUID, reason string) error {
+	from := appointment.Status
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, from, to)
+	}
+
+	now := time.Now()
+	columns := map[string]interface{}{
+		"status":            to,
+		"status_changed_at": now,
+		"updated_at":        now,
+	}
+	// Online sessions get their meeting room once they are sure to take place
+	if to == models.Confirmed && appointment.MeetingRoom == nil {
+		room, err := newMeetingRoom(appointment.Type)
+		if err != nil {
+			return err
+		}
+		if room != nil {
+			columns["meeting_room"] = room
+			appointment.MeetingRoom = room
+		}
+	}
+	if err := tx.Model(&models.Appointment{}).Where("id = ?", appointment.ID).Updates(columns).Error; err != nil {
+		return err
+	}
+	appointment.Status = to
+	appointment.StatusChangedAt = &now
+	appointment.UpdatedAt = now
+
+	return recordStatusChange(tx, appointment.ID, &from, to, changedBy, reason)
+}
+
+func recordStatusChange(tx *gorm.DB, appointmentID uuid.UUID, from *models.AppointmentScheduleStatus, to models.AppointmentScheduleStatus, changedBy *uuid.UUID, reason string) error {
+	return tx.Create(&models.AppointmentStatusHistory{
+		ID:            uuid.New(),
+		AppointmentID: appointmentID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ChangedBy:     changedBy,
+		Reason:        reason,
+		CreatedAt:     time.Now(),
+	}).Error
 }
 
 func (service *AppointmentService) GetAppointmentsByUserID(userID string, status string) ([]models.Appointment, error) {
@@ -35,30 +414,142 @@ func (service *AppointmentService) GetAppointmentsByUserID(userID string, status
 
 // UpdatePaymentAndAppointmentStatus updates the payment and appointment status
 func (service *AppointmentService) UpdatePaymentAndAppointmentStatus(orderID string, status string) error {
-	var appointment models.Appointment
-
-	// Find the appointment by order ID
-	if err := service.DB.Where("id = ?", orderID).First(&appointment).Error; err != nil {
+	appointmentID, err := uuid.Parse(orderID)
+	if err != nil {
 		return err
 	}
 
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		// Find the appointment by order ID, series paid upfront use the series ID instead and
+		// group sessions the registration ID
+		appointment, err := lockAppointment(tx, appointmentID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			appointments, err := lockUpfrontSeriesAppointments(tx, appointmentID)
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return applyGroupPayment(tx, appointmentID, status)
+			}
+			if err != nil {
+				return err
+			}
+			for i := range appointments {
+				if err := applyPaymentStatus(tx, &appointments[i], status); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return applyPaymentStatus(tx, appointment, status)
+	})
+}
+
+// applyPaymentStatus updates a locked appointment from a Midtrans transaction status
+func applyPaymentStatus(tx *gorm.DB, appointment *models.Appointment, status string) error {
 	// Update payment and appointment status based on Midtrans transaction status
+	previousPayment := appointment.PaymentStatus
+	payment, next := paymentStatusFor(status)
+	if !paymentMovesForward(previousPayment, payment) {
+		if payment != previousPayment {
+			log.Printf("Ignoring payment %s for appointment %s already paid %s", status, appointment.ID, previousPayment)
+		}
+		return nil
+	}
+
+	appointment.PaymentStatus = payment
+	if err := tx.Model(&models.Appointment{}).Where("id = ?", appointment.ID).
+		Update("payment_status", appointment.PaymentStatus).Error; err != nil {
+		return err
+	}
+
+	// Webhooks are retried and can arrive out of order, so a notification that no longer
+	// fits the appointment's status is only logged
+	if next == "" || next == appointment.Status {
+		return nil
+	}
+	if !appointment.Status.CanTransitionTo(next) {
+		log.Printf("Ignoring payment %s for appointment %s in status %s", status, appointment.ID, appointment.Status)
+		// The patient paid for a session that no longer takes place, give it all back
+		if next == models.Confirmed && appointment.Status.IsFinal() && previousPayment != models.MidtransStatusSuccess {
+			_, err := createRefund(tx, appointment, appointment.Price, 100, "paid_after_cancellation")
+			return err
+		}
+		return nil
+	}
+	return transitionStatus(tx, appointment, next, nil, "payment_"+status)
+}
+
+// paymentStatusFor maps a Midtrans transaction status to the payment status it records and the
+// appointment status it leads to, none while the payment is still open
+func paymentStatusFor(status string) (models.MidtransStatus, models.AppointmentScheduleStatus) {
 	switch status {
-	case "settlement":
-		appointment.PaymentStatus = models.MidtransStatusSuccess
-		appointment.Status = models.Success
-	case "expire":
-		appointment.PaymentStatus = models.MidtransStatusFailure
-		appointment.Status = models.Canceled
-	case "deny", "cancel", "failure":
-		appointment.PaymentStatus = models.MidtransStatusFailure
-		appointment.Status = models.Canceled
-	default:
-		appointment.PaymentStatus = models.MidtransStatusPending
+	case "settlement", "capture":
+		return models.MidtransStatusSuccess, models.Confirmed
+	case "expire", "deny", "cancel", "failure":
+		return models.MidtransStatusFailure, models.CancelledByPatient
 	}
+	return models.MidtransStatusPending, ""
+}
 
-	// Save the updated appointment
-	return service.DB.Save(&appointment).Error
+// paymentMovesForward tells whether a payment may go from one status to another. Webhooks are
+// retried and arrive out of order, so an open payment never replaces a settled or failed one and
+// nothing replaces a successful one. A failed payment can still succeed late.
+func paymentMovesForward(from, to models.MidtransStatus) bool {
+	progress := func(status models.MidtransStatus) int {
+		switch status {
+		case models.MidtransStatusSuccess:
+			return 2
+		case models.MidtransStatusFailure:
+			return 1
+		}
+		return 0
+	}
+	return progress(to) > progress(from)
+}
+
+// Unpaid appointments are released in batches of this size, each in its own transaction
+const unpaidReleaseBatchSize = 100
+
+// ReleaseUnpaidAppointments cancels appointments still awaiting payment whose payment was due
+// before the cutoff, for when the payment webhook never arrives, and frees their slots. Each release is
+// recorded in the status history. Rows locked by a webhook or by another instance sweeping at the
+// same time are skipped, so every appointment is released at most once.
+func (service *AppointmentService) ReleaseUnpaidAppointments(cutoff time.Time) (int, error) {
+	released := 0
+	for {
+		var batch int
+		err := service.DB.Transaction(func(tx *gorm.DB) error {
+			var appointments []models.Appointment
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND COALESCE(payment_due_at, status_changed_at, created_at) < ?", models.PendingPayment, cutoff).
+				Order("created_at asc").Limit(unpaidReleaseBatchSize).
+				Find(&appointments).Error
+			if err != nil {
+				return err
+			}
+			batch = len(appointments)
+
+			for i := range appointments {
+				appointment := &appointments[i]
+				if err := tx.Model(&models.Appointment{}).Where("id = ?", appointment.ID).
+					Update("payment_status", models.MidtransStatusFailure).Error; err != nil {
+					return err
+				}
+				if err := transitionStatus(tx, appointment, models.CancelledByPatient, nil, "payment_window_expired"); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return released, err
+		}
+		released += batch
+		if batch < unpaidReleaseBatchSize {
+			return released, nil
+		}
+	}
 }
 
 // GetAppointmentsByTherapistID fetches all appointments associated with a therapist
@@ -85,8 +576,7 @@ func (service *AppointmentService) GetUpcomingAppointmentsByTherapistID(therapis
         Joins("LEFT JOIN consultation_histories ON consultation_histories.appointment_id = appointments.id").
         Where("therapist_id = ?", therapistID).
         Where("consultation_histories.conclusion IS NULL OR consultation_histories.conclusion = ''").
-		Where("status = ?", models.Success). 
-		Where("payment_status = ?", models.MidtransStatusSuccess).
+		Where("status IN ?", []models.AppointmentScheduleStatus{models.Confirmed, models.InSession}).
         Order("appointment_date asc").
         Find(&appointments).Error
 
@@ -96,3 +586,13 @@ func (service *AppointmentService) GetUpcomingAppointmentsByTherapistID(therapis
 
     return appointments, nil
 }
+
+// appointmentLink is the appointment's page in the web app, online sessions are joined from it
+func appointmentLink(appointment *models.Appointment) string {
+	return fmt.Sprintf("%s/appointments/%s", config.Env.AppBaseURL, appointment.ID)
+}
+
+// paymentWindow is how long a patient has to pay once a payment is started
+func paymentWindow() time.Duration {
+	return time.Duration(config.Env.PaymentWindowMinutes) * time.Minute
+}
@@ -0,0 +1,334 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestMain sets the configuration the services read, LoadEnv would need every deployment setting
+func TestMain(m *testing.M) {
+	config.Env = &config.EnvironmentVariables{
+		ENV:                           "test",
+		CancellationFreeHours:         24,
+		LateCancellationRefundPercent: 50,
+		PaymentWindowMinutes:          5,
+	}
+	os.Exit(m.Run())
+}
+
+// testDB connects to the disposable database in TEST_DATABASE_DSN and migrates it, the tests
+// using it are skipped when it isn't set
+func testDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		t.Fatalf("create uuid-ossp: %v", err)
+	}
+	if err := config.Migrate(db, models.All...); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db
+}
+
+// createTestUser adds a user that is removed again with their appointments when the test ends
+func createTestUser(t *testing.T, db *gorm.DB, role models.Role) *models.User {
+	t.Helper()
+	id := uuid.New()
+	user := &models.User{
+		ID:          id,
+		Name:        "Test " + string(role),
+		Email:       id.String() + "@test.hand",
+		PhoneNumber: id.String(),
+		Role:        role,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	t.Cleanup(func() {
+		appointments := db.Model(&models.Appointment{}).Select("id").Where("user_id = ? OR therapist_id = ?", id, id)
+		db.Where("appointment_id IN (?)", appointments).Delete(&models.AppointmentStatusHistory{})
+		db.Where("user_id = ? OR therapist_id = ?", id, id).Delete(&models.Appointment{})
+		db.Delete(&models.User{}, "id = ?", id)
+	})
+	return user
+}
+
+// createTestTherapist adds an online therapist on the default schedule
+func createTestTherapist(t *testing.T, db *gorm.DB) *models.Therapist {
+	t.Helper()
+	user := createTestUser(t, db, models.RoleTherapist)
+	therapist := &models.Therapist{
+		UserID:            user.ID,
+		Consultation:      models.Online,
+		AppointmentRate:   100000,
+		BookingWindowDays: 60,
+	}
+	if err := db.Create(therapist).Error; err != nil {
+		t.Fatalf("create therapist: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Delete(&models.Therapist{}, "id = ?", therapist.ID)
+	})
+	return therapist
+}
+
+// freeSlot finds a bookable one hour slot of the therapist in the coming days
+func freeSlot(t *testing.T, db *gorm.DB, therapist *models.Therapist) time.Time {
+	t.Helper()
+	today := LocalDay(time.Now().In(scheduleLocation))
+	for days := 2; days < 9; days++ {
+		slots, err := availableSlots(db, therapist.UserID, today.AddDate(0, 0, days), models.Online, defaultSession)
+		if err != nil {
+			t.Fatalf("available slots: %v", err)
+		}
+		if len(slots) > 0 {
+			return slots[0]
+		}
+	}
+	t.Fatal("the therapist has no free slot in the coming week")
+	return time.Time{}
+}
+
+func newTestAppointment(patientID uuid.UUID, therapist *models.Therapist, date time.Time) *models.Appointment {
+	return &models.Appointment{
+		ID:              uuid.New(),
+		UserID:          patientID,
+		TherapistID:     therapist.UserID,
+		AppointmentDate: date,
+		PaymentStatus:   models.MidtransStatusPending,
+		Type:            models.Online,
+		CreatedAt:       time.Now(),
+	}
+}
+
+func TestCreateAppointmentConcurrentBookings(t *testing.T) {
+	db := testDB(t)
+	service := &AppointmentService{DB: db}
+	therapist := createTestTherapist(t, db)
+	slot := freeSlot(t, db, therapist)
+
+	const bookings = 8
+	errs := make([]error, bookings)
+	var wg sync.WaitGroup
+	for i := 0; i < bookings; i++ {
+		patient := createTestUser(t, db, models.Patient)
+		appointment := newTestAppointment(patient.ID, therapist, slot)
+		if err := service.ApplySessionType(appointment, therapist, nil); err != nil {
+			t.Fatalf("apply session type: %v", err)
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = service.CreateAppointment(appointment)
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded, unavailable := 0, 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrSlotUnavailable):
+			unavailable++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || unavailable != bookings-1 {
+		t.Errorf("got %d bookings and %d ErrSlotUnavailable, want 1 and %d", succeeded, unavailable, bookings-1)
+	}
+}
+
+// The constraint holds even for writes that skip the schedule lock
+func TestAppointmentSlotConstraint(t *testing.T) {
+	db := testDB(t)
+	therapist := createTestTherapist(t, db)
+	patient := createTestUser(t, db, models.Patient)
+	slot := freeSlot(t, db, therapist)
+
+	insert := func(date time.Time, duration, buffer int, status models.AppointmentScheduleStatus) error {
+		appointment := newTestAppointment(patient.ID, therapist, date)
+		appointment.DurationMinutes = duration
+		appointment.BufferMinutes = buffer
+		appointment.Status = status
+		return db.Create(appointment).Error
+	}
+	if err := insert(slot, 60, 15, models.Confirmed); err != nil {
+		t.Fatalf("first appointment: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		offset   time.Duration
+		duration int
+		status   models.AppointmentScheduleStatus
+		conflict bool
+	}{
+		{"same start", 0, 60, models.PendingPayment, true},
+		{"starts during the session", 30 * time.Minute, 60, models.PendingPayment, true},
+		{"starts during the buffer", 70 * time.Minute, 60, models.Confirmed, true},
+		{"runs into the session", -90 * time.Minute, 120, models.PendingPayment, true},
+		{"inactive status", 0, 60, models.CancelledByPatient, false},
+		{"after the buffer", 75 * time.Minute, 60, models.PendingPayment, false},
+		{"ends at the start", -time.Hour, 60, models.PendingPayment, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := insert(slot.Add(test.offset), test.duration, 0, test.status)
+			switch {
+			case test.conflict && !isSlotConflict(err):
+				t.Errorf("got %v, want a slot conflict", err)
+			case !test.conflict && err != nil:
+				t.Errorf("got %v, want no error", err)
+			}
+		})
+	}
+}
+
+func TestPaymentMovesForward(t *testing.T) {
+	tests := []struct {
+		from, to models.MidtransStatus
+		want     bool
+	}{
+		{models.MidtransStatusPending, models.MidtransStatusSuccess, true},
+		{models.MidtransStatusPending, models.MidtransStatusFailure, true},
+		{models.MidtransStatusFailure, models.MidtransStatusSuccess, true},
+		{models.MidtransStatusPending, models.MidtransStatusPending, false},
+		{models.MidtransStatusSuccess, models.MidtransStatusPending, false},
+		{models.MidtransStatusSuccess, models.MidtransStatusFailure, false},
+		{models.MidtransStatusSuccess, models.MidtransStatusSuccess, false},
+		{models.MidtransStatusFailure, models.MidtransStatusPending, false},
+	}
+	for _, test := range tests {
+		if got := paymentMovesForward(test.from, test.to); got != test.want {
+			t.Errorf("paymentMovesForward(%s, %s) = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+// A pending notification retried after the settlement must not undo the payment
+func TestPaymentSettlementThenPending(t *testing.T) {
+	db := testDB(t)
+	service := &AppointmentService{DB: db}
+	therapist := createTestTherapist(t, db)
+	patient := createTestUser(t, db, models.Patient)
+
+	appointment := newTestAppointment(patient.ID, therapist, freeSlot(t, db, therapist))
+	if err := service.ApplySessionType(appointment, therapist, nil); err != nil {
+		t.Fatalf("apply session type: %v", err)
+	}
+	if err := service.CreateAppointment(appointment); err != nil {
+		t.Fatalf("create appointment: %v", err)
+	}
+	for _, status := range []string{"settlement", "pending"} {
+		if err := service.UpdatePaymentAndAppointmentStatus(appointment.ID.String(), status); err != nil {
+			t.Fatalf("payment %s: %v", status, err)
+		}
+	}
+
+	var stored models.Appointment
+	if err := db.First(&stored, "id = ?", appointment.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if stored.PaymentStatus != models.MidtransStatusSuccess || stored.Status != models.Confirmed {
+		t.Errorf("got payment %s and status %s, want %s and %s",
+			stored.PaymentStatus, stored.Status, models.MidtransStatusSuccess, models.Confirmed)
+	}
+}
+
+func TestCancellationQuote(t *testing.T) {
+	start := time.Date(2026, 3, 2, 10, 0, 0, 0, scheduleLocation)
+	freeUntil := start.Add(-time.Duration(config.Env.CancellationFreeHours) * time.Hour)
+	late := config.Env.LateCancellationRefundPercent
+
+	tests := []struct {
+		name          string
+		now           time.Time
+		payment       models.MidtransStatus
+		percent       int
+		canReschedule bool
+	}{
+		{"a minute inside the free window", freeUntil.Add(-time.Minute), models.MidtransStatusSuccess, 100, true},
+		{"exactly at the free cancellation limit", freeUntil, models.MidtransStatusSuccess, late, false},
+		{"a minute past the free window", freeUntil.Add(time.Minute), models.MidtransStatusSuccess, late, false},
+		{"a minute before the start", start.Add(-time.Minute), models.MidtransStatusSuccess, late, false},
+		{"at the start", start, models.MidtransStatusSuccess, 0, false},
+		{"unpaid", freeUntil.Add(-time.Minute), models.MidtransStatusPending, 0, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			appointment := &models.Appointment{
+				AppointmentDate: start,
+				Status:          models.Confirmed,
+				PaymentStatus:   test.payment,
+				Price:           200000,
+			}
+			quote := cancellationQuote(appointment, test.now)
+			if quote.RefundPercent != test.percent {
+				t.Errorf("refund percent = %d, want %d", quote.RefundPercent, test.percent)
+			}
+			if want := int64(200000 * test.percent / 100); quote.RefundAmount != want {
+				t.Errorf("refund amount = %d, want %d", quote.RefundAmount, want)
+			}
+			if quote.CanReschedule != test.canReschedule {
+				t.Errorf("can reschedule = %v, want %v", quote.CanReschedule, test.canReschedule)
+			}
+			if !quote.FreeUntil.Equal(freeUntil) {
+				t.Errorf("free until = %v, want %v", quote.FreeUntil, freeUntil)
+			}
+		})
+	}
+}
+
+// Consultation notes need the therapist's own session, once it has started
+func TestRecordConsultationRefused(t *testing.T) {
+	db := testDB(t)
+	service := &AppointmentService{DB: db}
+	therapist := createTestTherapist(t, db)
+	other := createTestTherapist(t, db)
+	patient := createTestUser(t, db, models.Patient)
+
+	appointment := newTestAppointment(patient.ID, therapist, freeSlot(t, db, therapist))
+	appointment.Status = models.Confirmed
+	if err := db.Create(appointment).Error; err != nil {
+		t.Fatalf("create appointment: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		therapistID uuid.UUID
+		want        error
+	}{
+		{"not started", therapist.UserID, ErrSessionNotHeld},
+		{"another therapist", other.UserID, gorm.ErrRecordNotFound},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history := &models.ConsultationHistory{ID: uuid.New(), Conclusion: "Notes"}
+			err := service.RecordConsultation(appointment.ID, test.therapistID, history, nil)
+			if !errors.Is(err, test.want) {
+				t.Errorf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
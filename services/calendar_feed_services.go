@@ -0,0 +1,284 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Feeds list appointments from this far back onwards, calendar apps keep older events themselves
+const calendarFeedHistoryDays = 90
+
+// Statuses shown as events, cancellations only for appointments that were paid for and so
+// once appeared in the feed
+var (
+	calendarConfirmedStatuses = []models.AppointmentScheduleStatus{models.Confirmed, models.InSession, models.Completed, models.NoShow}
+	calendarCancelledStatuses = []models.AppointmentScheduleStatus{models.CancelledByPatient, models.CancelledByTherapist, models.Rescheduled}
+)
+
+type CalendarFeedService struct {
+	DB *gorm.DB
+}
+
+// GetFeed returns the user's feed, or nil when they never created one
+func (service *CalendarFeedService) GetFeed(userID uuid.UUID) (*models.CalendarFeed, *apierror.ApiError) {
+	var feed models.CalendarFeed
+	err := service.DB.Where("user_id = ?", userID).First(&feed).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve calendar feed").
+			Build()
+	}
+	return &feed, nil
+}
+
+// RegenerateToken creates the user's feed or replaces its token, the old URL stops working
+func (service *CalendarFeedService) RegenerateToken(userID uuid.UUID) (string, *apierror.ApiError) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to generate calendar token").
+			Build()
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+
+	feed := models.CalendarFeed{
+		ID:        uuid.New(),
+		UserID:    userID,
+		TokenHash: hashCalendarToken(token),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	err := service.DB.Exec(`
+		INSERT INTO calendar_feeds (id, user_id, token_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE
+		SET token_hash = EXCLUDED.token_hash, last_accessed_at = NULL, updated_at = EXCLUDED.updated_at`,
+		feed.ID, feed.UserID, feed.TokenHash, feed.CreatedAt, feed.UpdatedAt).Error
+	if err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save calendar token").
+			Build()
+	}
+	return token, nil
+}
+
+func (service *CalendarFeedService) RevokeFeed(userID uuid.UUID) *apierror.ApiError {
+	result := service.DB.Where("user_id = ?", userID).Delete(&models.CalendarFeed{})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to revoke calendar feed").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Calendar feed not found").
+			Build()
+	}
+	return nil
+}
+
+// RenderFeed builds the iCalendar document for a feed token. Therapists get the sessions they
+// hold, everyone else the sessions they booked, group sessions included.
+func (service *CalendarFeedService) RenderFeed(token string) (string, *apierror.ApiError) {
+	var feed models.CalendarFeed
+	if err := service.DB.Where("token_hash = ?", hashCalendarToken(token)).First(&feed).Error; err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Calendar feed not found").
+			Build()
+	}
+
+	var user models.User
+	if err := service.DB.Select("id, name, role").Where("id = ?", feed.UserID).First(&user).Error; err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Calendar feed not found").
+			Build()
+	}
+
+	isTherapist := user.Role == models.RoleTherapist
+	ownerColumn := "user_id"
+	if isTherapist {
+		ownerColumn = "therapist_id"
+	}
+
+	var appointments []models.Appointment
+	err := service.DB.Preload("User").Preload("Therapist").
+		Where(ownerColumn+" = ? AND appointment_date >= ?", user.ID, time.Now().AddDate(0, 0, -calendarFeedHistoryDays)).
+		Where("status IN ? OR (status IN ? AND payment_status = ?)",
+			calendarConfirmedStatuses, calendarCancelledStatuses, models.MidtransStatusSuccess).
+		Order("appointment_date").
+		Find(&appointments).Error
+	if err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve appointments").
+			Build()
+	}
+
+	sessions, err := feedGroupSessions(service.DB, user.ID, isTherapist)
+	if err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve group sessions").
+			Build()
+	}
+
+	locations, err := therapistLocations(service.DB, appointments, sessions)
+	if err != nil {
+		return "", apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve therapists").
+			Build()
+	}
+
+	events := make([]utilities.ICalEvent, 0, len(appointments)+len(sessions))
+	for i := range appointments {
+		events = append(events, appointmentEvent(&appointments[i], isTherapist, locations[appointments[i].TherapistID]))
+	}
+	for i := range sessions {
+		events = append(events, groupSessionEvent(&sessions[i], locations[sessions[i].TherapistID]))
+	}
+
+	service.DB.Model(&feed).UpdateColumn("last_accessed_at", time.Now())
+
+	return utilities.BuildICalendar("Hand sessions", scheduleLocation, events), nil
+}
+
+func appointmentEvent(appointment *models.Appointment, forTherapist bool, therapistLocation string) utilities.ICalEvent {
+	session := appointmentSessionSpec(appointment)
+	event := utilities.ICalEvent{
+		UID:          appointment.ID.String() + "@hand",
+		Start:        appointment.AppointmentDate,
+		End:          appointment.AppointmentDate.Add(session.duration),
+		Status:       utilities.ICalConfirmed,
+		LastModified: appointment.UpdatedAt,
+	}
+	if appointment.StatusChangedAt != nil {
+		event.LastModified = *appointment.StatusChangedAt
+	}
+
+	counterpart := appointment.Therapist.Name
+	if forTherapist {
+		counterpart = appointment.User.Name
+	}
+	event.Summary = fmt.Sprintf("Hand %s session with %s", appointment.Type, counterpart)
+
+	link := appointmentLink(appointment)
+	if appointment.Type == models.Offline {
+		event.Location = therapistLocation
+		event.Description = "Details: " + link
+	} else {
+		event.Location = link
+		event.Description = "Join the session: " + link
+	}
+	event.URL = link
+
+	for _, status := range calendarCancelledStatuses {
+		if appointment.Status == status {
+			event.Status = utilities.ICalCancelled
+			event.Sequence = 1
+			event.Summary = "Cancelled: " + event.Summary
+		}
+	}
+	return event
+}
+
+// feedGroupSessions returns the group sessions a therapist hosts, or those a patient holds a
+// confirmed seat in. Cancelled sessions stay in the feed for patients who paid for them.
+func feedGroupSessions(db *gorm.DB, userID uuid.UUID, isTherapist bool) ([]models.GroupSession, error) {
+	query := db.Preload("Therapist").
+		Where("group_sessions.starts_at >= ?", time.Now().AddDate(0, 0, -calendarFeedHistoryDays))
+	if isTherapist {
+		query = query.Where("group_sessions.therapist_id = ?", userID)
+	} else {
+		query = query.Joins("JOIN group_registrations ON group_registrations.group_session_id = group_sessions.id").
+			Where("group_registrations.patient_id = ?", userID).
+			Where("group_registrations.status = ? OR (group_sessions.status = ? AND group_registrations.payment_status = ?)",
+				models.RegistrationConfirmed, models.GroupSessionCancelled, models.MidtransStatusSuccess)
+	}
+
+	var sessions []models.GroupSession
+	err := query.Order("group_sessions.starts_at").Find(&sessions).Error
+	return sessions, err
+}
+
+func groupSessionEvent(session *models.GroupSession, therapistLocation string) utilities.ICalEvent {
+	event := utilities.ICalEvent{
+		UID:          session.ID.String() + "@hand-group",
+		Start:        session.StartsAt,
+		End:          groupSessionRange(session).end,
+		Status:       utilities.ICalConfirmed,
+		Summary:      fmt.Sprintf("Hand group session: %s with %s", session.Topic, session.Therapist.Name),
+		LastModified: session.UpdatedAt,
+	}
+
+	link := groupSessionLink(session)
+	if session.Type == models.Offline {
+		event.Location = therapistLocation
+		event.Description = "Details: " + link
+	} else {
+		event.Location = link
+		event.Description = "Join the session: " + link
+	}
+	event.URL = link
+
+	if session.Status == models.GroupSessionCancelled {
+		event.Status = utilities.ICalCancelled
+		event.Sequence = 1
+		event.Summary = "Cancelled: " + event.Summary
+	}
+	return event
+}
+
+func therapistLocations(db *gorm.DB, appointments []models.Appointment, sessions []models.GroupSession) (map[uuid.UUID]string, error) {
+	var therapistIDs []uuid.UUID
+	for _, appointment := range appointments {
+		if appointment.Type == models.Offline {
+			therapistIDs = append(therapistIDs, appointment.TherapistID)
+		}
+	}
+	for _, session := range sessions {
+		if session.Type == models.Offline {
+			therapistIDs = append(therapistIDs, session.TherapistID)
+		}
+	}
+	locations := make(map[uuid.UUID]string)
+	if len(therapistIDs) == 0 {
+		return locations, nil
+	}
+
+	var therapists []models.Therapist
+	if err := db.Select("user_id, location").Where("user_id IN ?", therapistIDs).Find(&therapists).Error; err != nil {
+		return nil, err
+	}
+	for _, therapist := range therapists {
+		locations[therapist.UserID] = therapist.Location
+	}
+	return locations, nil
+}
+
+func hashCalendarToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
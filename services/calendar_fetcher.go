@@ -0,0 +1,93 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Largest calendar that is fetched or uploaded
+const maxCalendarBytes = 5 << 20
+
+// CalendarFetcher downloads an external calendar. The HTTP one is used in production, tests and
+// other deployments can swap in their own.
+type CalendarFetcher interface {
+	Fetch(ctx context.Context, calendarURL string) ([]byte, error)
+}
+
+// HTTPCalendarFetcher fetches calendars over HTTP(S). It refuses to connect to private and
+// loopback addresses, so a calendar URL cannot be used to reach internal services.
+type HTTPCalendarFetcher struct {
+	Client *http.Client
+}
+
+func NewHTTPCalendarFetcher() *HTTPCalendarFetcher {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+				return fmt.Errorf("calendar host %s is not public", host)
+			}
+			return nil
+		},
+	}
+	transport := &http.Transport{
+		DialContext:         dialer.DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &HTTPCalendarFetcher{Client: &http.Client{Transport: transport, Timeout: 30 * time.Second}}
+}
+
+func (fetcher *HTTPCalendarFetcher) Fetch(ctx context.Context, calendarURL string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, calendarURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", "text/calendar")
+
+	response, err := fetcher.Client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar server responded %s", response.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxCalendarBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCalendarBytes {
+		return nil, errors.New("calendar is larger than 5 MB")
+	}
+	return data, nil
+}
+
+// normalizeCalendarURL accepts http, https and webcal URLs, webcal is fetched over https
+func normalizeCalendarURL(raw string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || parsed.Host == "" {
+		return "", errors.New("invalid calendar URL")
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "webcal", "webcals":
+		parsed.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", errors.New("calendar URL must use http, https or webcal")
+	}
+	return parsed.String(), nil
+}
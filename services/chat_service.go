@@ -29,12 +29,41 @@ func (s *ChatService) GetMessagesByRoomID(roomID string) ([]models.ChatMessage,
 }
 
 
+// IsUserInRoom - Group session rooms also admit the patients with a confirmed seat
 func (s *ChatService) IsUserInRoom(userID, roomID uuid.UUID) bool {
 	var chatRoom models.ChatRoom
-	if err := s.DB.Where("id = ? AND (first_user_id = ? OR second_user_id = ?)", roomID, userID, userID).First(&chatRoom).Error; err != nil {
-		return false
+	if err := s.DB.Where("id = ? AND (first_user_id = ? OR second_user_id = ?)", roomID, userID, userID).First(&chatRoom).Error; err == nil {
+		return true
 	}
-	return true
+
+	var attending int64
+	err := s.DB.Model(&models.GroupRegistration{}).
+		Joins("JOIN group_sessions ON group_sessions.id = group_registrations.group_session_id").
+		Where("group_sessions.chat_room_id = ? AND group_registrations.patient_id = ? AND group_registrations.status = ?",
+			roomID, userID, models.RegistrationConfirmed).
+		Count(&attending).Error
+	return err == nil && attending > 0
+}
+
+// RoomMembers returns everyone a message in the room goes to
+func (s *ChatService) RoomMembers(room *models.ChatRoom) ([]uuid.UUID, error) {
+	members := []uuid.UUID{room.FirstUserID}
+	if room.SecondUserID != room.FirstUserID {
+		members = append(members, room.SecondUserID)
+	}
+	if room.Type != models.GroupRoom {
+		return members, nil
+	}
+
+	var attendees []uuid.UUID
+	err := s.DB.Model(&models.GroupRegistration{}).
+		Joins("JOIN group_sessions ON group_sessions.id = group_registrations.group_session_id").
+		Where("group_sessions.chat_room_id = ? AND group_registrations.status = ?", room.ID, models.RegistrationConfirmed).
+		Pluck("group_registrations.patient_id", &attendees).Error
+	if err != nil {
+		return nil, err
+	}
+	return append(members, attendees...), nil
 }
 
 func (s *ChatService) GetChatRoomsWithMessages(userUUID uuid.UUID) ([]models.ChatRoom, error) {
@@ -130,11 +130,12 @@ func (service *CheckInService) CheckUserCheckIns() ([]models.User, error) {
     var users []models.User
     today := time.Now().Format("2006-01-02")
 
-    // Get all verified users who haven't checked in today
+    // Get all verified users who haven't checked in today and still want the reminder
     err := service.DB.Raw(`
         SELECT * FROM users 
         WHERE is_mobile_verified = true AND id NOT IN 
-        (SELECT user_id FROM check_ins WHERE created_at = ?)`, today).Scan(&users).Error
+        (SELECT user_id FROM check_ins WHERE created_at = ?)
+        AND id NOT IN (SELECT user_id FROM notification_preferences WHERE check_in_reminders = false)`, today).Scan(&users).Error
 
     if err != nil {
         return nil, err
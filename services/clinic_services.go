@@ -0,0 +1,227 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxTherapistClinics = 10
+	// MaxSearchRadiusKm bounds radius searches so the bounding box stays meaningful
+	MaxSearchRadiusKm = 200
+	earthRadiusKm     = 6371.0
+	kmPerDegree       = 111.045
+)
+
+type ClinicService struct {
+	DB *gorm.DB
+}
+
+// GeoPoint is a position in degrees
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+func (point GeoPoint) IsValid() bool {
+	return point.Latitude >= -90 && point.Latitude <= 90 && point.Longitude >= -180 && point.Longitude <= 180
+}
+
+// CreateClinic adds a clinic therapists can then say they practice at
+func (service *ClinicService) CreateClinic(clinic *models.Clinic) *apierror.ApiError {
+	if apiErr := validateClinic(clinic); apiErr != nil {
+		return apiErr
+	}
+
+	clinic.ID = uuid.New()
+	clinic.CreatedAt = time.Now()
+	clinic.UpdatedAt = time.Now()
+	if err := service.DB.Create(clinic).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to create clinic").
+			Build()
+	}
+	return nil
+}
+
+// UpdateClinic replaces a clinic's details, e.g. after it moved
+func (service *ClinicService) UpdateClinic(clinicID uuid.UUID, update *models.Clinic) (*models.Clinic, *apierror.ApiError) {
+	if apiErr := validateClinic(update); apiErr != nil {
+		return nil, apiErr
+	}
+
+	var clinic models.Clinic
+	if err := service.DB.First(&clinic, "id = ?", clinicID).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Clinic not found").
+			Build()
+	}
+
+	clinic.Name = update.Name
+	clinic.Address = update.Address
+	clinic.City = update.City
+	clinic.Latitude = update.Latitude
+	clinic.Longitude = update.Longitude
+	clinic.UpdatedAt = time.Now()
+	if err := service.DB.Save(&clinic).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update clinic").
+			Build()
+	}
+	return &clinic, nil
+}
+
+// GetClinics lists clinics by name, optionally only those in a city
+func (service *ClinicService) GetClinics(city string) ([]models.Clinic, *apierror.ApiError) {
+	var clinics []models.Clinic
+	query := service.DB.Order("name asc")
+	if city != "" {
+		query = query.Where("city ILIKE ?", city)
+	}
+	if err := query.Find(&clinics).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve clinics").
+			Build()
+	}
+	return clinics, nil
+}
+
+// GetTherapistClinics lists the clinics a therapist practices at
+func (service *ClinicService) GetTherapistClinics(therapistID uuid.UUID) ([]models.Clinic, *apierror.ApiError) {
+	clinics, err := therapistClinics(service.DB, []uuid.UUID{therapistID})
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve clinics").
+			Build()
+	}
+	if clinics[therapistID] == nil {
+		return []models.Clinic{}, nil
+	}
+	return clinics[therapistID], nil
+}
+
+// SetTherapistClinics replaces the clinics a therapist practices at
+func (service *ClinicService) SetTherapistClinics(therapistID uuid.UUID, clinicIDs []uuid.UUID) ([]models.Clinic, *apierror.ApiError) {
+	unique := make(map[uuid.UUID]bool)
+	for _, id := range clinicIDs {
+		unique[id] = true
+	}
+	if len(unique) > maxTherapistClinics {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("A therapist practices at up to %d clinics", maxTherapistClinics)).
+			Build()
+	}
+
+	var clinics []models.Clinic
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if len(unique) > 0 {
+			if err := tx.Where("id IN ?", clinicIDs).Order("name asc").Find(&clinics).Error; err != nil {
+				return err
+			}
+			if len(clinics) != len(unique) {
+				return gorm.ErrRecordNotFound
+			}
+		}
+
+		if err := tx.Where("therapist_id = ?", therapistID).Delete(&models.TherapistClinic{}).Error; err != nil {
+			return err
+		}
+		for _, clinic := range clinics {
+			link := models.TherapistClinic{TherapistID: therapistID, ClinicID: clinic.ID, CreatedAt: time.Now()}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Clinic not found").
+			Build()
+	}
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save clinics").
+			Build()
+	}
+	if clinics == nil {
+		clinics = []models.Clinic{}
+	}
+	return clinics, nil
+}
+
+func validateClinic(clinic *models.Clinic) *apierror.ApiError {
+	clinic.Name = strings.TrimSpace(clinic.Name)
+	clinic.Address = strings.TrimSpace(clinic.Address)
+	clinic.City = strings.TrimSpace(clinic.City)
+	if clinic.Name == "" || clinic.Address == "" || clinic.City == "" ||
+		!(GeoPoint{Latitude: clinic.Latitude, Longitude: clinic.Longitude}).IsValid() {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A clinic needs a name, an address, a city and a valid latitude and longitude").
+			Build()
+	}
+	return nil
+}
+
+// therapistClinics loads the clinics of several therapists with one query
+func therapistClinics(db *gorm.DB, therapistIDs []uuid.UUID) (map[uuid.UUID][]models.Clinic, error) {
+	clinics := make(map[uuid.UUID][]models.Clinic)
+	if len(therapistIDs) == 0 {
+		return clinics, nil
+	}
+
+	var links []models.TherapistClinic
+	err := db.Preload("Clinic").
+		Joins("JOIN clinics ON clinics.id = therapist_clinics.clinic_id").
+		Where("therapist_clinics.therapist_id IN ?", therapistIDs).
+		Order("clinics.name asc").
+		Find(&links).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, link := range links {
+		clinics[link.TherapistID] = append(clinics[link.TherapistID], link.Clinic)
+	}
+	return clinics, nil
+}
+
+// nearbyTherapists selects each therapist with a clinic within radiusKm of the point, with the
+// great-circle distance to their nearest one. A bounding box on the indexed coordinates narrows
+// the clinics before the haversine formula runs.
+func nearbyTherapists(db *gorm.DB, point GeoPoint, radiusKm float64) *gorm.DB {
+	const distance = `2 * ? * ASIN(LEAST(1, SQRT(
+		POWER(SIN(RADIANS(clinics.latitude - ?) / 2), 2) +
+		COS(RADIANS(?)) * COS(RADIANS(clinics.latitude)) * POWER(SIN(RADIANS(clinics.longitude - ?) / 2), 2))))`
+	args := []interface{}{earthRadiusKm, point.Latitude, point.Latitude, point.Longitude}
+
+	latDelta := radiusKm / kmPerDegree
+	query := db.Table("therapist_clinics").
+		Select("therapist_clinics.therapist_id, MIN("+distance+") AS distance_km", args...).
+		Joins("JOIN clinics ON clinics.id = therapist_clinics.clinic_id").
+		Where("clinics.latitude BETWEEN ? AND ?", point.Latitude-latDelta, point.Latitude+latDelta)
+	// Near the poles a degree of longitude is too short to bound anything
+	if cos := math.Cos(point.Latitude * math.Pi / 180); cos > 0.01 {
+		lngDelta := radiusKm / (kmPerDegree * cos)
+		query = query.Where("clinics.longitude BETWEEN ? AND ?", point.Longitude-lngDelta, point.Longitude+lngDelta)
+	}
+	return query.Group("therapist_clinics.therapist_id").
+		Having("MIN("+distance+") <= ?", append(args, radiusKm)...)
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownMasterKey = errors.New("data key is wrapped by an unknown master key")
+
+// DataKeyService manages the per-user data keys used for envelope encryption
+type DataKeyService struct {
+	DB *gorm.DB
+}
+
+// GetActiveKey returns the user's current data key, creating one on first use
+func (service *DataKeyService) GetActiveKey(tx *gorm.DB, userID uuid.UUID) (*models.UserDataKey, []byte, error) {
+	var dataKey models.UserDataKey
+	err := tx.Where("user_id = ? AND is_active", userID).First(&dataKey).Error
+	if err == nil {
+		key, err := service.unwrap(&dataKey)
+		return &dataKey, key, err
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, nil, err
+	}
+
+	return service.createKey(tx, userID)
+}
+
+// GetKey returns the unwrapped data key with the given ID
+func (service *DataKeyService) GetKey(tx *gorm.DB, keyID uuid.UUID) ([]byte, error) {
+	var dataKey models.UserDataKey
+	if err := tx.First(&dataKey, "id = ?", keyID).Error; err != nil {
+		return nil, err
+	}
+	return service.unwrap(&dataKey)
+}
+
+// RotateKey retires the user's active data key and returns a fresh one. Callers must
+// re-encrypt everything protected by the old key inside the same transaction.
+func (service *DataKeyService) RotateKey(tx *gorm.DB, userID uuid.UUID) (*models.UserDataKey, []byte, error) {
+	now := time.Now()
+	if err := tx.Model(&models.UserDataKey{}).
+		Where("user_id = ? AND is_active", userID).
+		Updates(map[string]interface{}{"is_active": false, "retired_at": now}).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return service.createKey(tx, userID)
+}
+
+// RewrapKeys rewraps every data key that is not wrapped by the active master key,
+// so a retired master key can be removed from the configuration afterwards.
+func (service *DataKeyService) RewrapKeys() (int, error) {
+	var dataKeys []models.UserDataKey
+	if err := service.DB.Where("master_key_id <> ?", config.Env.JournalMasterKeyID).Find(&dataKeys).Error; err != nil {
+		return 0, err
+	}
+
+	for i := range dataKeys {
+		key, err := service.unwrap(&dataKeys[i])
+		if err != nil {
+			return i, fmt.Errorf("unwrap data key %s: %w", dataKeys[i].ID, err)
+		}
+
+		wrapped, err := wrapDataKey(dataKeys[i].UserID, key)
+		if err != nil {
+			return i, err
+		}
+
+		if err := service.DB.Model(&dataKeys[i]).Updates(map[string]interface{}{
+			"master_key_id": config.Env.JournalMasterKeyID,
+			"wrapped_key":   wrapped,
+		}).Error; err != nil {
+			return i, err
+		}
+	}
+
+	if len(dataKeys) > 0 {
+		log.Printf("Rewrapped %d journal data keys with master key %s", len(dataKeys), config.Env.JournalMasterKeyID)
+	}
+	return len(dataKeys), nil
+}
+
+func (service *DataKeyService) createKey(tx *gorm.DB, userID uuid.UUID) (*models.UserDataKey, []byte, error) {
+	key, err := utilities.GenerateKey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	wrapped, err := wrapDataKey(userID, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataKey := models.UserDataKey{
+		ID:          uuid.New(),
+		UserID:      userID,
+		MasterKeyID: config.Env.JournalMasterKeyID,
+		WrappedKey:  wrapped,
+		IsActive:    true,
+		CreatedAt:   time.Now(),
+	}
+	if err := tx.Create(&dataKey).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return &dataKey, key, nil
+}
+
+func (service *DataKeyService) unwrap(dataKey *models.UserDataKey) ([]byte, error) {
+	masterKey, ok := config.Env.JournalMasterKeys[dataKey.MasterKeyID]
+	if !ok {
+		return nil, ErrUnknownMasterKey
+	}
+	return utilities.DecryptAESGCM(masterKey, dataKey.WrappedKey, dataKey.UserID[:])
+}
+
+// wrapDataKey binds the wrapped key to its owner so it cannot be swapped onto another user
+func wrapDataKey(userID uuid.UUID, key []byte) ([]byte, error) {
+	masterKey := config.Env.JournalMasterKeys[config.Env.JournalMasterKeyID]
+	return utilities.EncryptAESGCM(masterKey, key, userID[:])
+}
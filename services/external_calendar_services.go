@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxExternalCalendars = 10
+	// Busy blocks kept per calendar, enough for a packed calendar over the booking horizon
+	maxExternalBusyBlocks = 20000
+)
+
+type ExternalCalendarService struct {
+	DB      *gorm.DB
+	Fetcher CalendarFetcher
+}
+
+func (service *ExternalCalendarService) GetCalendars(therapistID uuid.UUID) ([]models.ExternalCalendar, *apierror.ApiError) {
+	calendars := []models.ExternalCalendar{}
+	if err := service.DB.Where("therapist_id = ?", therapistID).Order("created_at").Find(&calendars).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve calendars").
+			Build()
+	}
+	return calendars, nil
+}
+
+// Subscribe registers a calendar URL, it is fetched once now so a wrong URL is reported right
+// away, and polled from then on
+func (service *ExternalCalendarService) Subscribe(ctx context.Context, therapistID uuid.UUID, name, rawURL string) (*models.ExternalCalendar, *apierror.ApiError) {
+	calendarURL, err := normalizeCalendarURL(rawURL)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+	if apiErr := service.checkCalendarLimit(therapistID); apiErr != nil {
+		return nil, apiErr
+	}
+
+	data, err := service.Fetcher.Fetch(ctx, calendarURL)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Failed to fetch the calendar: " + err.Error()).
+			Build()
+	}
+
+	calendar := models.ExternalCalendar{
+		ID:          uuid.New(),
+		TherapistID: therapistID,
+		Name:        name,
+		SourceURL:   calendarURL,
+		CreatedAt:   time.Now(),
+		UpdatedAt:   time.Now(),
+	}
+	if apiErr := service.storeCalendar(&calendar, data, true); apiErr != nil {
+		return nil, apiErr
+	}
+	return &calendar, nil
+}
+
+// Import adds an uploaded calendar, or replaces the events of an uploaded calendar when
+// calendarID is given
+func (service *ExternalCalendarService) Import(therapistID uuid.UUID, calendarID *uuid.UUID, name string, data []byte) (*models.ExternalCalendar, *apierror.ApiError) {
+	calendar := models.ExternalCalendar{
+		ID:          uuid.New(),
+		TherapistID: therapistID,
+		Name:        name,
+		CreatedAt:   time.Now(),
+	}
+	isNew := calendarID == nil
+	if isNew {
+		if apiErr := service.checkCalendarLimit(therapistID); apiErr != nil {
+			return nil, apiErr
+		}
+	} else {
+		existing, apiErr := service.findCalendar(therapistID, *calendarID)
+		if apiErr != nil {
+			return nil, apiErr
+		}
+		if existing.SourceURL != "" {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Subscribed calendars are updated from their URL").
+				Build()
+		}
+		calendar = *existing
+		if name != "" {
+			calendar.Name = name
+		}
+	}
+	calendar.UpdatedAt = time.Now()
+
+	if apiErr := service.storeCalendar(&calendar, data, isNew); apiErr != nil {
+		return nil, apiErr
+	}
+	return &calendar, nil
+}
+
+// Sync fetches a subscribed calendar now instead of waiting for the next poll
+func (service *ExternalCalendarService) Sync(ctx context.Context, therapistID, calendarID uuid.UUID) (*models.ExternalCalendar, *apierror.ApiError) {
+	calendar, apiErr := service.findCalendar(therapistID, calendarID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if calendar.SourceURL == "" {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Uploaded calendars are updated by uploading them again").
+			Build()
+	}
+
+	if err := service.syncCalendar(ctx, calendar); err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Failed to sync the calendar: " + err.Error()).
+			Build()
+	}
+	return calendar, nil
+}
+
+// SyncAll polls every subscribed calendar. A calendar that fails keeps its last busy blocks and
+// records the error for the therapist to see.
+func (service *ExternalCalendarService) SyncAll(ctx context.Context) (int, error) {
+	var calendars []models.ExternalCalendar
+	if err := service.DB.Where("source_url <> ''").Find(&calendars).Error; err != nil {
+		return 0, err
+	}
+
+	synced := 0
+	for i := range calendars {
+		if err := service.syncCalendar(ctx, &calendars[i]); err != nil {
+			log.Printf("Failed to sync external calendar %s: %v", calendars[i].ID, err)
+			continue
+		}
+		synced++
+	}
+	return synced, nil
+}
+
+func (service *ExternalCalendarService) DeleteCalendar(therapistID, calendarID uuid.UUID) *apierror.ApiError {
+	if _, apiErr := service.findCalendar(therapistID, calendarID); apiErr != nil {
+		return apiErr
+	}
+
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("calendar_id = ?", calendarID).Delete(&models.ExternalBusyBlock{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id = ?", calendarID).Delete(&models.ExternalCalendar{}).Error
+	})
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to delete calendar").
+			Build()
+	}
+	return nil
+}
+
+func (service *ExternalCalendarService) syncCalendar(ctx context.Context, calendar *models.ExternalCalendar) error {
+	data, err := service.Fetcher.Fetch(ctx, calendar.SourceURL)
+	if err == nil {
+		if apiErr := service.storeCalendar(calendar, data, false); apiErr != nil {
+			err = errors.New(apiErr.Message)
+		}
+	}
+	if err != nil {
+		service.DB.Model(calendar).UpdateColumns(map[string]interface{}{"last_sync_error": err.Error(), "updated_at": time.Now()})
+		return err
+	}
+	return nil
+}
+
+// storeCalendar expands the calendar's busy events over the booking horizon and replaces the
+// calendar's busy blocks with them
+func (service *ExternalCalendarService) storeCalendar(calendar *models.ExternalCalendar, data []byte, isNew bool) *apierror.ApiError {
+	if len(data) > maxCalendarBytes {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Calendar is larger than 5 MB").
+			Build()
+	}
+
+	now := time.Now()
+	from := now.AddDate(0, 0, -1)
+	to := LocalDay(now.In(scheduleLocation)).AddDate(0, 0, maxBookingWindowDays+2)
+	periods, err := utilities.ParseICalBusy(data, from, to, scheduleLocation)
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Invalid calendar: " + err.Error()).
+			Build()
+	}
+	if len(periods) > maxExternalBusyBlocks {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Calendar has more than %d busy events in the next year", maxExternalBusyBlocks)).
+			Build()
+	}
+
+	blocks := make([]models.ExternalBusyBlock, len(periods))
+	for i, period := range periods {
+		blocks[i] = models.ExternalBusyBlock{
+			ID:          uuid.New(),
+			CalendarID:  calendar.ID,
+			TherapistID: calendar.TherapistID,
+			StartsAt:    period.Start,
+			EndsAt:      period.End,
+		}
+	}
+
+	calendar.LastSyncedAt = &now
+	calendar.LastSyncError = ""
+	calendar.UpdatedAt = now
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if isNew {
+			if err := tx.Create(calendar).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Save(calendar).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("calendar_id = ?", calendar.ID).Delete(&models.ExternalBusyBlock{}).Error; err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(blocks, 500).Error
+	})
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save calendar").
+			Build()
+	}
+	return nil
+}
+
+func (service *ExternalCalendarService) checkCalendarLimit(therapistID uuid.UUID) *apierror.ApiError {
+	var count int64
+	if err := service.DB.Model(&models.ExternalCalendar{}).Where("therapist_id = ?", therapistID).Count(&count).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve calendars").
+			Build()
+	}
+	if count >= maxExternalCalendars {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("A therapist can connect at most %d calendars", maxExternalCalendars)).
+			Build()
+	}
+	return nil
+}
+
+func (service *ExternalCalendarService) findCalendar(therapistID, calendarID uuid.UUID) (*models.ExternalCalendar, *apierror.ApiError) {
+	var calendar models.ExternalCalendar
+	err := service.DB.Where("id = ? AND therapist_id = ?", calendarID, therapistID).First(&calendar).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Calendar not found").
+			Build()
+	}
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve calendar").
+			Build()
+	}
+	return &calendar, nil
+}
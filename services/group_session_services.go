@@ -0,0 +1,702 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Limits on the group sessions a therapist creates
+const (
+	MaxGroupCapacity       = 50
+	MinGroupSessionMinutes = 15
+	MaxGroupSessionMinutes = 8 * 60
+)
+
+const (
+	groupReleaseBatchSize   = 100
+	groupSessionHistoryDays = 30
+)
+
+var (
+	ErrInvalidGroupSession  = errors.New("invalid group session")
+	ErrGroupSessionNotFound = errors.New("group session not found")
+	ErrGroupSessionClosed   = errors.New("group session is no longer open")
+	ErrGroupSessionConflict = errors.New("group session overlaps the therapist's schedule")
+	ErrAlreadyRegistered    = errors.New("patient is already registered for the group session")
+	ErrRegistrationNotFound = errors.New("group registration not found")
+)
+
+// GroupSessionService runs group sessions. Registrations beyond the capacity wait in line, and
+// seats freed by cancellations or unpaid registrations go to them on the next FillFreedSeats.
+type GroupSessionService struct {
+	DB     *gorm.DB
+	Sender NotificationSender
+	// Waitlisted patients who get a seat have HoldDuration to pay for it
+	HoldDuration time.Duration
+}
+
+// GroupSessionSummary is a group session with how full it is
+type GroupSessionSummary struct {
+	models.GroupSession
+	TherapistName string `json:"therapist_name"`
+	SeatsLeft     int    `json:"seats_left"`
+	Waitlisted    int    `json:"waitlisted"`
+}
+
+// GroupSessionFilter narrows the group sessions patients browse, zero values match everything
+type GroupSessionFilter struct {
+	TherapistID *uuid.UUID
+	Type        models.ConsultationType
+	From        time.Time
+	To          time.Time
+}
+
+// CreateSession schedules a group session for the therapist in time that is free in their
+// schedule, with a chat room for the attendees and a meeting room when it is held online
+func (service *GroupSessionService) CreateSession(session *models.GroupSession, therapist *models.Therapist) error {
+	session.Topic = strings.TrimSpace(session.Topic)
+	if session.Topic == "" || session.Capacity < 1 || session.Capacity > MaxGroupCapacity || session.Price < 0 ||
+		session.DurationMinutes < MinGroupSessionMinutes || session.DurationMinutes > MaxGroupSessionMinutes ||
+		!session.StartsAt.After(time.Now()) {
+		return ErrInvalidGroupSession
+	}
+	if session.Type == models.Hybrid {
+		return ErrInvalidConsultationType
+	}
+	if err := CheckConsultationType(therapist, session.Type); err != nil {
+		return err
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockTherapistSchedule(tx, session.TherapistID); err != nil {
+			return err
+		}
+		free, err := isTimeFree(tx, session.TherapistID, groupSessionRange(session))
+		if err != nil {
+			return err
+		}
+		if !free {
+			return ErrGroupSessionConflict
+		}
+
+		now := time.Now()
+		room := models.ChatRoom{
+			ID:           uuid.New(),
+			FirstUserID:  session.TherapistID,
+			SecondUserID: session.TherapistID,
+			Type:         models.GroupRoom,
+			CreatedAt:    now,
+		}
+		if err := tx.Create(&room).Error; err != nil {
+			return err
+		}
+		meetingRoom, err := newMeetingRoom(session.Type)
+		if err != nil {
+			return err
+		}
+
+		session.ID = uuid.New()
+		session.Status = models.GroupSessionScheduled
+		session.ChatRoomID = room.ID
+		session.MeetingRoom = meetingRoom
+		session.CreatedAt = now
+		session.UpdatedAt = now
+		return tx.Create(session).Error
+	})
+}
+
+// ListSessions returns the scheduled group sessions that have not started, soonest first
+func (service *GroupSessionService) ListSessions(filter GroupSessionFilter) ([]GroupSessionSummary, error) {
+	from := time.Now()
+	if filter.From.After(from) {
+		from = filter.From
+	}
+	query := service.DB.Preload("Therapist").
+		Where("status = ? AND starts_at > ?", models.GroupSessionScheduled, from)
+	if !filter.To.IsZero() {
+		query = query.Where("starts_at < ?", filter.To)
+	}
+	if filter.TherapistID != nil {
+		query = query.Where("therapist_id = ?", *filter.TherapistID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	var sessions []models.GroupSession
+	if err := query.Order("starts_at asc").Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return service.summarize(sessions)
+}
+
+// GetSession returns one group session with how full it is
+func (service *GroupSessionService) GetSession(sessionID uuid.UUID) (*GroupSessionSummary, error) {
+	var session models.GroupSession
+	err := service.DB.Preload("Therapist").First(&session, "id = ?", sessionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	summaries, err := service.summarize([]models.GroupSession{session})
+	if err != nil {
+		return nil, err
+	}
+	return &summaries[0], nil
+}
+
+// GetTherapistSessions returns the therapist's group sessions from the last month on, cancelled
+// ones included
+func (service *GroupSessionService) GetTherapistSessions(therapistID uuid.UUID) ([]GroupSessionSummary, error) {
+	var sessions []models.GroupSession
+	err := service.DB.Preload("Therapist").
+		Where("therapist_id = ? AND starts_at > ?", therapistID, time.Now().AddDate(0, 0, -groupSessionHistoryDays)).
+		Order("starts_at asc").Find(&sessions).Error
+	if err != nil {
+		return nil, err
+	}
+	return service.summarize(sessions)
+}
+
+// GetRoster returns a group session of the therapist with all its registrations, attendees first
+// and the waitlist in order
+func (service *GroupSessionService) GetRoster(sessionID, therapistID uuid.UUID) (*models.GroupSession, []models.GroupRegistration, error) {
+	var session models.GroupSession
+	err := service.DB.Where("id = ? AND therapist_id = ?", sessionID, therapistID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrGroupSessionNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var registrations []models.GroupRegistration
+	err = service.DB.Preload("Patient").
+		Where("group_session_id = ?", sessionID).
+		Order(clause.Expr{SQL: "CASE status WHEN ? THEN 0 WHEN ? THEN 1 WHEN ? THEN 2 ELSE 3 END, created_at asc",
+			Vars: []interface{}{models.RegistrationConfirmed, models.RegistrationPendingPayment, models.RegistrationWaitlisted}}).
+		Find(&registrations).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return &session, registrations, nil
+}
+
+// GetPatientRegistrations returns the patient's registrations with their sessions, latest first
+func (service *GroupSessionService) GetPatientRegistrations(patientID uuid.UUID) ([]models.GroupRegistration, error) {
+	var registrations []models.GroupRegistration
+	err := service.DB.Preload("GroupSession").Preload("GroupSession.Therapist").
+		Joins("JOIN group_sessions ON group_sessions.id = group_registrations.group_session_id").
+		Where("group_registrations.patient_id = ?", patientID).
+		Order("group_sessions.starts_at desc").
+		Find(&registrations).Error
+	return registrations, err
+}
+
+// Register takes a seat in a group session for the patient, or a place on its waitlist when it
+// is full. A seat awaits payment unless the session is free.
+func (service *GroupSessionService) Register(sessionID, patientID uuid.UUID) (*models.GroupRegistration, *models.GroupSession, error) {
+	var registration models.GroupRegistration
+	var session *models.GroupSession
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if session, err = lockGroupSession(tx, sessionID); err != nil {
+			return err
+		}
+		if session.Status != models.GroupSessionScheduled || !session.StartsAt.After(time.Now()) {
+			return ErrGroupSessionClosed
+		}
+
+		err = tx.Where("group_session_id = ? AND patient_id = ?", sessionID, patientID).First(&registration).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		if err == nil && registration.Status != models.RegistrationCancelled {
+			return ErrAlreadyRegistered
+		}
+
+		taken, err := takenSeats(tx, sessionID)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if registration.ID == uuid.Nil {
+			registration = models.GroupRegistration{ID: uuid.New(), GroupSessionID: sessionID, PatientID: patientID, CreatedAt: now}
+		} else {
+			// Back of the line, like a new registration
+			registration.CreatedAt = now
+		}
+		registration.PaymentStatus = models.MidtransStatusPending
+		registration.PaymentDueAt = nil
+		registration.Status = models.RegistrationWaitlisted
+		if taken < session.Capacity {
+			takeSeat(&registration, session, now.Add(paymentWindow()))
+		}
+		registration.UpdatedAt = now
+		return tx.Save(&registration).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &registration, session, nil
+}
+
+// StartPayment readies the patient's seat for payment, they then have the payment window to pay
+// it even if it was due sooner
+func (service *GroupSessionService) StartPayment(sessionID, patientID uuid.UUID) (*models.GroupRegistration, *models.GroupSession, error) {
+	var registration *models.GroupRegistration
+	var session models.GroupSession
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if registration, err = lockPatientRegistration(tx, sessionID, patientID); err != nil {
+			return err
+		}
+		if registration.Status != models.RegistrationPendingPayment {
+			return ErrNothingToPay
+		}
+		if err := tx.First(&session, "id = ?", sessionID).Error; err != nil {
+			return err
+		}
+
+		due := time.Now().Add(paymentWindow())
+		if registration.PaymentDueAt != nil && registration.PaymentDueAt.After(due) {
+			return nil
+		}
+		registration.PaymentDueAt = &due
+		return tx.Model(registration).UpdateColumn("payment_due_at", due).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return registration, &session, nil
+}
+
+// CancelRegistration gives up the patient's seat or waitlist place. A paid seat is refunded by
+// the cancellation policy, the seat goes to the waitlist on the next FillFreedSeats.
+func (service *GroupSessionService) CancelRegistration(sessionID, patientID uuid.UUID) (*models.GroupRegistration, *models.Refund, error) {
+	var registration *models.GroupRegistration
+	var refund *models.Refund
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if registration, err = lockPatientRegistration(tx, sessionID, patientID); err != nil {
+			return err
+		}
+		if registration.Status == models.RegistrationCancelled {
+			return ErrRegistrationNotFound
+		}
+		var session models.GroupSession
+		if err := tx.First(&session, "id = ?", sessionID).Error; err != nil {
+			return err
+		}
+
+		if registration.Status == models.RegistrationConfirmed && registration.PaymentStatus == models.MidtransStatusSuccess {
+			if percent := policyRefundPercent(session.StartsAt, time.Now()); percent > 0 {
+				refund, err = createGroupRefund(tx, registration, session.Price*int64(percent)/100, percent, "cancelled_by_patient")
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return updateRegistrationStatus(tx, registration, models.RegistrationCancelled)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return registration, refund, nil
+}
+
+// CancelSession calls off a group session of the therapist before it starts. Every paid seat is
+// refunded in full and everyone registered is told.
+func (service *GroupSessionService) CancelSession(sessionID, therapistID uuid.UUID, reason string) (*models.GroupSession, []models.Refund, error) {
+	var session *models.GroupSession
+	var registrations []models.GroupRegistration
+	var refunds []models.Refund
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if session, err = lockGroupSession(tx, sessionID); err != nil {
+			return err
+		}
+		if session.TherapistID != therapistID {
+			return ErrGroupSessionNotFound
+		}
+		if session.Status != models.GroupSessionScheduled || !session.StartsAt.After(time.Now()) {
+			return ErrGroupSessionClosed
+		}
+
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Patient").
+			Where("group_session_id = ? AND status <> ?", sessionID, models.RegistrationCancelled).
+			Find(&registrations).Error
+		if err != nil {
+			return err
+		}
+		for i := range registrations {
+			registration := &registrations[i]
+			if registration.Status == models.RegistrationConfirmed && registration.PaymentStatus == models.MidtransStatusSuccess && session.Price > 0 {
+				refund, err := createGroupRefund(tx, registration, session.Price, 100, "group_session_cancelled")
+				if err != nil {
+					return err
+				}
+				refunds = append(refunds, *refund)
+			}
+			if err := updateRegistrationStatus(tx, registration, models.RegistrationCancelled); err != nil {
+				return err
+			}
+		}
+
+		session.Status = models.GroupSessionCancelled
+		session.UpdatedAt = time.Now()
+		if err := tx.Model(session).UpdateColumns(map[string]interface{}{"status": session.Status, "updated_at": session.UpdatedAt}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.ChatRoom{}).Where("id = ?", session.ChatRoomID).Update("is_end", true).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := fmt.Sprintf("The group session \"%s\" on %s has been cancelled by the therapist.", session.Topic, formatGroupSessionTime(session))
+	if reason != "" {
+		message += " Reason: " + reason + "."
+	}
+	for i := range registrations {
+		text := message
+		if registrations[i].PaymentStatus == models.MidtransStatusSuccess && session.Price > 0 {
+			text += fmt.Sprintf(" A full refund of Rp%d is on its way.", session.Price)
+		}
+		service.notify(registrations[i].Patient.PhoneNumber, text)
+	}
+	return session, refunds, nil
+}
+
+// ReleaseUnpaidRegistrations cancels seats still awaiting payment whose payment was due before
+// the cutoff, for when the payment webhook never arrives. Rows another instance is handling are
+// skipped.
+func (service *GroupSessionService) ReleaseUnpaidRegistrations(cutoff time.Time) (int, error) {
+	released := 0
+	for {
+		var batch int
+		err := service.DB.Transaction(func(tx *gorm.DB) error {
+			var registrations []models.GroupRegistration
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ? AND payment_due_at < ?", models.RegistrationPendingPayment, cutoff).
+				Order("payment_due_at asc").Limit(groupReleaseBatchSize).
+				Find(&registrations).Error
+			if err != nil {
+				return err
+			}
+			batch = len(registrations)
+
+			for i := range registrations {
+				registration := &registrations[i]
+				registration.PaymentStatus = models.MidtransStatusFailure
+				if err := updateRegistrationStatus(tx, registration, models.RegistrationCancelled); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return released, err
+		}
+		released += batch
+		if batch < groupReleaseBatchSize {
+			return released, nil
+		}
+	}
+}
+
+// FillFreedSeats gives free seats of upcoming sessions to their waitlists in order of
+// registration and tells the patients, it returns how many moved up
+func (service *GroupSessionService) FillFreedSeats(ctx context.Context) (int, error) {
+	var sessionIDs []uuid.UUID
+	err := service.DB.Model(&models.GroupSession{}).
+		Where("status = ? AND starts_at > ?", models.GroupSessionScheduled, time.Now()).
+		Where("EXISTS (SELECT 1 FROM group_registrations WHERE group_registrations.group_session_id = group_sessions.id AND group_registrations.status = ?)", models.RegistrationWaitlisted).
+		Where("capacity > (SELECT COUNT(*) FROM group_registrations WHERE group_registrations.group_session_id = group_sessions.id AND group_registrations.status IN ?)", models.SeatHoldingRegistrations).
+		Pluck("id", &sessionIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	promoted := 0
+	for _, sessionID := range sessionIDs {
+		var session *models.GroupSession
+		var registrations []models.GroupRegistration
+		err := service.DB.Transaction(func(tx *gorm.DB) error {
+			var err error
+			if session, err = lockGroupSession(tx, sessionID); err != nil {
+				return err
+			}
+			if session.Status != models.GroupSessionScheduled || !session.StartsAt.After(time.Now()) {
+				return nil
+			}
+			taken, err := takenSeats(tx, sessionID)
+			if err != nil || taken >= session.Capacity {
+				return err
+			}
+
+			err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("Patient").
+				Where("group_session_id = ? AND status = ?", sessionID, models.RegistrationWaitlisted).
+				Order("created_at asc").Limit(session.Capacity - taken).
+				Find(&registrations).Error
+			if err != nil {
+				return err
+			}
+			due := time.Now().Add(service.HoldDuration)
+			for i := range registrations {
+				registration := &registrations[i]
+				takeSeat(registration, session, due)
+				err := tx.Model(registration).UpdateColumns(map[string]interface{}{
+					"status":         registration.Status,
+					"payment_status": registration.PaymentStatus,
+					"payment_due_at": registration.PaymentDueAt,
+					"updated_at":     time.Now(),
+				}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			log.Printf("Failed to fill the freed seats of group session %s: %v", sessionID, err)
+			continue
+		}
+
+		for i := range registrations {
+			promoted++
+			registration := &registrations[i]
+			message := fmt.Sprintf("Good news! A seat opened up in the group session \"%s\" on %s.", session.Topic, formatGroupSessionTime(session))
+			if registration.Status == models.RegistrationPendingPayment {
+				message += fmt.Sprintf(" It is held for you until %s, pay for it at %s",
+					registration.PaymentDueAt.In(scheduleLocation).Format("15:04 MST"), groupSessionLink(session))
+			}
+			service.notifyWithContext(ctx, registration.Patient.PhoneNumber, message)
+		}
+	}
+	return promoted, nil
+}
+
+// GroupMeetingAccessFor returns the meeting room of a group session as the given user sees it,
+// or nil when they are neither its therapist nor a confirmed attendee
+func GroupMeetingAccessFor(session *models.GroupSession, registration *models.GroupRegistration, userID uuid.UUID, name string, now time.Time) (*MeetingAccess, error) {
+	if session.MeetingRoom == nil || session.Status != models.GroupSessionScheduled {
+		return nil, nil
+	}
+	attending := registration != nil && registration.PatientID == userID && registration.Status == models.RegistrationConfirmed
+	if userID != session.TherapistID && !attending {
+		return nil, nil
+	}
+	return meetingAccess(*session.MeetingRoom, session.StartsAt, groupSessionRange(session).end, userID, name, now)
+}
+
+// applyGroupPayment updates a registration from a Midtrans transaction status, registrations use
+// their own ID as the order ID
+func applyGroupPayment(tx *gorm.DB, registrationID uuid.UUID, status string) error {
+	var registration models.GroupRegistration
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&registration, "id = ?", registrationID).Error
+	if err != nil {
+		return err
+	}
+
+	previousPayment := registration.PaymentStatus
+	payment, _ := paymentStatusFor(status)
+	if !paymentMovesForward(previousPayment, payment) {
+		if payment != previousPayment {
+			log.Printf("Ignoring payment %s for group registration %s already paid %s", status, registration.ID, previousPayment)
+		}
+		return nil
+	}
+
+	registration.PaymentStatus = payment
+	next := registration.Status
+	if registration.Status == models.RegistrationPendingPayment {
+		switch payment {
+		case models.MidtransStatusSuccess:
+			next = models.RegistrationConfirmed
+		case models.MidtransStatusFailure:
+			next = models.RegistrationCancelled
+		}
+	}
+	if err := updateRegistrationStatus(tx, &registration, next); err != nil {
+		return err
+	}
+
+	// The patient paid for a seat they no longer hold, give it all back
+	if registration.PaymentStatus == models.MidtransStatusSuccess && previousPayment != models.MidtransStatusSuccess &&
+		registration.Status == models.RegistrationCancelled {
+		log.Printf("Refunding late payment for group registration %s", registration.ID)
+		var session models.GroupSession
+		if err := tx.First(&session, "id = ?", registration.GroupSessionID).Error; err != nil {
+			return err
+		}
+		_, err := createGroupRefund(tx, &registration, session.Price, 100, "paid_after_cancellation")
+		return err
+	}
+	return nil
+}
+
+// isTimeFree tells whether nothing in the therapist's schedule overlaps r: appointments,
+// waitlist holds, time off, imported busy time or other group sessions
+func isTimeFree(tx *gorm.DB, therapistID uuid.UUID, r timeRange) (bool, error) {
+	blocked, err := blockedRanges(tx, therapistID, r.start, r.end)
+	if err != nil || len(blocked) > 0 {
+		return false, err
+	}
+
+	taken, err := loadTakenRanges(tx, []uuid.UUID{therapistID}, r.start, r.end, time.Now())
+	if err != nil {
+		return false, err
+	}
+	for _, other := range taken[therapistID] {
+		if other.overlaps(r) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func groupSessionRange(session *models.GroupSession) timeRange {
+	return timeRange{start: session.StartsAt, end: session.StartsAt.Add(time.Duration(session.DurationMinutes) * time.Minute)}
+}
+
+// takeSeat gives a registration a seat, free sessions need no payment
+func takeSeat(registration *models.GroupRegistration, session *models.GroupSession, due time.Time) {
+	if session.Price == 0 {
+		registration.Status = models.RegistrationConfirmed
+		registration.PaymentStatus = models.MidtransStatusSuccess
+		registration.PaymentDueAt = nil
+		return
+	}
+	registration.Status = models.RegistrationPendingPayment
+	registration.PaymentDueAt = &due
+}
+
+func takenSeats(tx *gorm.DB, sessionID uuid.UUID) (int, error) {
+	var taken int64
+	err := tx.Model(&models.GroupRegistration{}).
+		Where("group_session_id = ? AND status IN ?", sessionID, models.SeatHoldingRegistrations).
+		Count(&taken).Error
+	return int(taken), err
+}
+
+func (service *GroupSessionService) summarize(sessions []models.GroupSession) ([]GroupSessionSummary, error) {
+	summaries := make([]GroupSessionSummary, len(sessions))
+	if len(sessions) == 0 {
+		return summaries, nil
+	}
+	ids := make([]uuid.UUID, len(sessions))
+	for i := range sessions {
+		ids[i] = sessions[i].ID
+	}
+
+	var counts []struct {
+		GroupSessionID uuid.UUID
+		Status         models.GroupRegistrationStatus
+		Count          int
+	}
+	err := service.DB.Model(&models.GroupRegistration{}).
+		Select("group_session_id, status, COUNT(*) AS count").
+		Where("group_session_id IN ?", ids).
+		Group("group_session_id, status").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	taken := make(map[uuid.UUID]int)
+	waitlisted := make(map[uuid.UUID]int)
+	for _, count := range counts {
+		switch count.Status {
+		case models.RegistrationPendingPayment, models.RegistrationConfirmed:
+			taken[count.GroupSessionID] += count.Count
+		case models.RegistrationWaitlisted:
+			waitlisted[count.GroupSessionID] += count.Count
+		}
+	}
+
+	for i := range sessions {
+		seatsLeft := sessions[i].Capacity - taken[sessions[i].ID]
+		if seatsLeft < 0 {
+			seatsLeft = 0
+		}
+		summaries[i] = GroupSessionSummary{
+			GroupSession:  sessions[i],
+			TherapistName: sessions[i].Therapist.Name,
+			SeatsLeft:     seatsLeft,
+			Waitlisted:    waitlisted[sessions[i].ID],
+		}
+	}
+	return summaries, nil
+}
+
+func (service *GroupSessionService) notify(phoneNumber, message string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	service.notifyWithContext(ctx, phoneNumber, message)
+}
+
+func (service *GroupSessionService) notifyWithContext(ctx context.Context, phoneNumber, message string) {
+	if service.Sender == nil || phoneNumber == "" {
+		return
+	}
+	if err := service.Sender.Send(ctx, phoneNumber, message); err != nil {
+		log.Printf("Failed to send group session notification: %v", err)
+	}
+}
+
+func lockGroupSession(tx *gorm.DB, sessionID uuid.UUID) (*models.GroupSession, error) {
+	var session models.GroupSession
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&session, "id = ?", sessionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrGroupSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func lockPatientRegistration(tx *gorm.DB, sessionID, patientID uuid.UUID) (*models.GroupRegistration, error) {
+	var registration models.GroupRegistration
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("group_session_id = ? AND patient_id = ?", sessionID, patientID).First(&registration).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRegistrationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &registration, nil
+}
+
+func updateRegistrationStatus(tx *gorm.DB, registration *models.GroupRegistration, status models.GroupRegistrationStatus) error {
+	registration.Status = status
+	registration.UpdatedAt = time.Now()
+	return tx.Model(registration).UpdateColumns(map[string]interface{}{
+		"status":         registration.Status,
+		"payment_status": registration.PaymentStatus,
+		"updated_at":     registration.UpdatedAt,
+	}).Error
+}
+
+// groupSessionLink is where patients find a group session in the app
+func groupSessionLink(session *models.GroupSession) string {
+	return fmt.Sprintf("%s/group-sessions/%s", config.Env.AppBaseURL, session.ID)
+}
+
+func formatGroupSessionTime(session *models.GroupSession) string {
+	return session.StartsAt.In(scheduleLocation).Format("Mon 2 Jan 2006 at 15:04 MST")
+}
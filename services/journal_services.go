@@ -1,45 +1,177 @@
 package services
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Hand-TBN1/hand-backend/apierror"
 	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/utilities"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	journalSearchKeyPurpose = "journal-search-index"
+	legacyJournalBatchSize  = 100
+	maxJournalTags          = 10
+	maxJournalTagLength     = 30
+	// Correlating mood with sentiment needs at least this many days that have both
+	minCorrelationDays = 3
 )
 
 type JournalService struct {
-	DB *gorm.DB
+	DB             *gorm.DB
+	DataKeyService *DataKeyService
 }
 
-func (service *JournalService) GetUserJournals(userID uuid.UUID, date *time.Time) ([]models.Journal, *apierror.ApiError) {
-    var journals []models.Journal
-    query := service.DB.Where("user_id = ?", userID)
+// JournalSearchParams holds the filters for a full-text journal search
+type JournalSearchParams struct {
+	Query    string
+	From     *time.Time
+	To       *time.Time
+	Page     int
+	PageSize int
+}
 
-    if date != nil {
-        startOfDay := date.Truncate(24 * time.Hour)
-        endOfDay := startOfDay.Add(24 * time.Hour).Add(-time.Nanosecond)
+// JournalSearchResult is a single matching journal with a highlighted snippet
+type JournalSearchResult struct {
+	ID        uuid.UUID `json:"id"`
+	Snippet   string    `json:"snippet"`
+	Rank      float64   `json:"rank"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
 
-        log.Printf("Start of Day UTC: %v, End of Day UTC: %v", startOfDay, endOfDay)
+// JournalTagUsage is a tag with the number of journals carrying it
+type JournalTagUsage struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	JournalCount int       `json:"journal_count"`
+}
 
-        query = query.Where("created_at >= ? AND created_at <= ?", startOfDay, endOfDay)
-    }
+// JournalInput holds the optional parts of an entry that are not plain journal columns.
+// On update nil Answers and nil Tags keep the current values.
+type JournalInput struct {
+	Answers       map[string]string
+	Tags          []string
+	CheckInID     *uuid.UUID
+	UnlinkCheckIn bool
+}
+
+// CalendarDay summarises one local day of a user's check-ins and journals
+type CalendarDay struct {
+	Date         string     `json:"date"`
+	HasCheckIn   bool       `json:"has_check_in"`
+	CheckInID    *uuid.UUID `json:"check_in_id"`
+	MoodScore    *int       `json:"mood_score"`
+	JournalCount int        `json:"journal_count"`
+	// Average sentiment of the day's journals, nil when none have been scored
+	SentimentScore *float64 `json:"sentiment_score"`
+}
 
-    if err := query.Find(&journals).Error; err != nil {
-        return nil, apierror.NewApiErrorBuilder().
-            WithStatus(http.StatusInternalServerError).
-            WithMessage("Failed to retrieve journals").
-            Build()
-    }
+// MoodInsights compares check-in moods with the sentiment of journals over a period.
+// MoodSentimentCorrelation is the Pearson correlation over days that have both.
+type MoodInsights struct {
+	From                     string   `json:"from"`
+	To                       string   `json:"to"`
+	CheckInCount             int      `json:"check_in_count"`
+	AverageMood              *float64 `json:"average_mood"`
+	JournalCount             int      `json:"journal_count"`
+	AverageSentiment         *float64 `json:"average_sentiment"`
+	PositiveJournals         int      `json:"positive_journals"`
+	NeutralJournals          int      `json:"neutral_journals"`
+	NegativeJournals         int      `json:"negative_journals"`
+	MoodSentimentCorrelation *float64 `json:"mood_sentiment_correlation"`
+}
 
-    return journals, nil
+type journalSearchRow struct {
+	models.Journal
+	Rank float64
 }
 
-func (service *JournalService) CreateJournal(journal *models.Journal) *apierror.ApiError {
-	if err := service.DB.Create(journal).Error; err != nil {
+func (service *JournalService) GetUserJournals(userID uuid.UUID, date *time.Time, tag string) ([]models.Journal, *apierror.ApiError) {
+	var journals []models.Journal
+	query := service.DB.Preload("Tags").Where("user_id = ?", userID)
+
+	if tag != "" {
+		query = query.Where("id IN (SELECT journal_tag_links.journal_id FROM journal_tag_links "+
+			"JOIN journal_tags ON journal_tags.id = journal_tag_links.journal_tag_id "+
+			"WHERE journal_tags.user_id = ? AND journal_tags.name = ?)", userID, normalizeTagName(tag))
+	}
+
+	if date != nil {
+		startOfDay := date.Truncate(24 * time.Hour)
+		endOfDay := startOfDay.Add(24 * time.Hour).Add(-time.Nanosecond)
+
+		log.Printf("Start of Day UTC: %v, End of Day UTC: %v", startOfDay, endOfDay)
+
+		query = query.Where("created_at >= ? AND created_at <= ?", startOfDay, endOfDay)
+	}
+
+	if err := query.Find(&journals).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journals").
+			Build()
+	}
+
+	if err := service.decryptJournals(journals); err != nil {
+		log.Printf("Failed to decrypt journals for user %s: %v", userID, err)
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to decrypt journals").
+			Build()
+	}
+
+	return journals, nil
+}
+
+// CreateJournal stores a new entry, answers are only accepted for entries with a template
+func (service *JournalService) CreateJournal(journal *models.Journal, input JournalInput) *apierror.ApiError {
+	if journal.ID == uuid.Nil {
+		journal.ID = uuid.New()
+	}
+
+	if journal.PromptID != nil {
+		var prompt models.JournalPrompt
+		if err := service.DB.First(&prompt, "id = ? AND is_active", *journal.PromptID).Error; err != nil {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Journal prompt not found").
+				Build()
+		}
+	}
+	if apiErr := service.applyTemplate(journal, input.Answers, true); apiErr != nil {
+		return apiErr
+	}
+	if apiErr := service.linkCheckIn(journal, input); apiErr != nil {
+		return apiErr
+	}
+	tagNames, apiErr := validateTagNames(input.Tags)
+	if apiErr != nil {
+		return apiErr
+	}
+
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.storeJournal(tx, journal, true); err != nil {
+			return err
+		}
+		return replaceJournalTags(tx, journal, tagNames)
+	})
+	if err != nil {
 		return apierror.NewApiErrorBuilder().
 			WithStatus(http.StatusInternalServerError).
 			WithMessage("Failed to create journal").
@@ -47,3 +179,858 @@ func (service *JournalService) CreateJournal(journal *models.Journal) *apierror.
 	}
 	return nil
 }
+
+// UpdateJournal replaces the content of a journal owned by the given user
+func (service *JournalService) UpdateJournal(userID, journalID uuid.UUID, content string, input JournalInput) (*models.Journal, *apierror.ApiError) {
+	var journal models.Journal
+	if err := service.DB.Preload("Tags").Where("id = ? AND user_id = ?", journalID, userID).First(&journal).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusNotFound).
+				WithMessage("Journal not found").
+				Build()
+		}
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journal").
+			Build()
+	}
+
+	if err := service.openJournal(service.DB, &journal, make(map[uuid.UUID][]byte)); err != nil {
+		log.Printf("Failed to decrypt journal %s: %v", journal.ID, err)
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to decrypt journal").
+			Build()
+	}
+
+	journal.Content = content
+	journal.UpdatedAt = time.Now()
+	if apiErr := service.applyTemplate(&journal, input.Answers, false); apiErr != nil {
+		return nil, apiErr
+	}
+	if apiErr := service.linkCheckIn(&journal, input); apiErr != nil {
+		return nil, apiErr
+	}
+	tagNames, apiErr := validateTagNames(input.Tags)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := service.storeJournal(tx, &journal, false); err != nil {
+			return err
+		}
+		if input.Tags == nil {
+			return nil
+		}
+		return replaceJournalTags(tx, &journal, tagNames)
+	})
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update journal").
+			Build()
+	}
+
+	return &journal, nil
+}
+
+// DeleteJournal removes a journal owned by the given user
+func (service *JournalService) DeleteJournal(userID, journalID uuid.UUID) *apierror.ApiError {
+	var rowsAffected int64
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM journal_tag_links WHERE journal_id IN (SELECT id FROM journals WHERE id = ? AND user_id = ?)",
+			journalID, userID).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", journalID, userID).Delete(&models.Journal{})
+		rowsAffected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to delete journal").
+			Build()
+	}
+	if rowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Journal not found").
+			Build()
+	}
+	return nil
+}
+
+// GetTags lists the user's tags, most used first
+func (service *JournalService) GetTags(userID uuid.UUID) ([]JournalTagUsage, *apierror.ApiError) {
+	tags := []JournalTagUsage{}
+	err := service.DB.Table("journal_tags").
+		Select("journal_tags.id, journal_tags.name, COUNT(journal_tag_links.journal_id) AS journal_count").
+		Joins("LEFT JOIN journal_tag_links ON journal_tag_links.journal_tag_id = journal_tags.id").
+		Where("journal_tags.user_id = ?", userID).
+		Group("journal_tags.id, journal_tags.name").
+		Order("journal_count DESC, journal_tags.name ASC").
+		Scan(&tags).Error
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve tags").
+			Build()
+	}
+	return tags, nil
+}
+
+// DeleteTag removes a tag from all of the user's journals
+func (service *JournalService) DeleteTag(userID, tagID uuid.UUID) *apierror.ApiError {
+	var rowsAffected int64
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM journal_tag_links WHERE journal_tag_id IN (SELECT id FROM journal_tags WHERE id = ? AND user_id = ?)",
+			tagID, userID).Error; err != nil {
+			return err
+		}
+		result := tx.Where("id = ? AND user_id = ?", tagID, userID).Delete(&models.JournalTag{})
+		rowsAffected = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to delete tag").
+			Build()
+	}
+	if rowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Tag not found").
+			Build()
+	}
+	return nil
+}
+
+// GetCalendar returns one entry per local day of the month with the day's check-in and
+// journal count, so the app can draw the combined mood/journal calendar in one request
+func (service *JournalService) GetCalendar(userID uuid.UUID, year int, month time.Month, location *time.Location) ([]CalendarDay, *apierror.ApiError) {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, location)
+	end := start.AddDate(0, 1, 0)
+
+	var checkIns []models.CheckIn
+	if err := service.DB.Where("user_id = ? AND check_in_date >= ? AND check_in_date < ?", userID, start.UTC(), end.UTC()).
+		Order("check_in_date asc").Find(&checkIns).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve check-ins").
+			Build()
+	}
+
+	var journalCounts []struct {
+		Day       string
+		Total     int
+		Sentiment *float64
+	}
+	err := service.DB.Model(&models.Journal{}).
+		Select("to_char(created_at AT TIME ZONE ?, 'YYYY-MM-DD') AS day, COUNT(*) AS total, AVG(sentiment_score) AS sentiment", location.String()).
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start.UTC(), end.UTC()).
+		Group("day").
+		Scan(&journalCounts).Error
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journals").
+			Build()
+	}
+
+	days := make([]CalendarDay, 0, 31)
+	index := make(map[string]int)
+	for day := start; day.Before(end); day = day.AddDate(0, 0, 1) {
+		key := day.Format("2006-01-02")
+		index[key] = len(days)
+		days = append(days, CalendarDay{Date: key})
+	}
+
+	// Later check-ins on the same day win, matching how the app shows the latest mood
+	for _, checkIn := range checkIns {
+		if i, ok := index[checkIn.CheckInDate.In(location).Format("2006-01-02")]; ok {
+			checkInID, moodScore := checkIn.ID, checkIn.MoodScore
+			days[i].HasCheckIn = true
+			days[i].CheckInID = &checkInID
+			days[i].MoodScore = &moodScore
+		}
+	}
+	for _, count := range journalCounts {
+		if i, ok := index[count.Day]; ok {
+			days[i].JournalCount = count.Total
+			if count.Sentiment != nil {
+				sentiment := roundScore(*count.Sentiment)
+				days[i].SentimentScore = &sentiment
+			}
+		}
+	}
+
+	return days, nil
+}
+
+// GetMoodInsights summarises check-in moods and journal sentiment between two local dates,
+// both inclusive
+func (service *JournalService) GetMoodInsights(userID uuid.UUID, from, to time.Time, location *time.Location) (*MoodInsights, *apierror.ApiError) {
+	start := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, location)
+	end := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, location).AddDate(0, 0, 1)
+
+	var checkIns []models.CheckIn
+	if err := service.DB.Where("user_id = ? AND check_in_date >= ? AND check_in_date < ?", userID, start.UTC(), end.UTC()).
+		Order("check_in_date asc").Find(&checkIns).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve check-ins").
+			Build()
+	}
+
+	var journals []struct {
+		CreatedAt      time.Time
+		SentimentScore *float64
+	}
+	if err := service.DB.Model(&models.Journal{}).Select("created_at, sentiment_score").
+		Where("user_id = ? AND created_at >= ? AND created_at < ?", userID, start.UTC(), end.UTC()).
+		Scan(&journals).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journals").
+			Build()
+	}
+
+	insights := &MoodInsights{
+		From:         start.Format("2006-01-02"),
+		To:           end.AddDate(0, 0, -1).Format("2006-01-02"),
+		CheckInCount: len(checkIns),
+		JournalCount: len(journals),
+	}
+
+	// Later check-ins on the same day win, as on the calendar
+	moodByDay := make(map[string]float64)
+	moodTotal := 0.0
+	for _, checkIn := range checkIns {
+		moodByDay[checkIn.CheckInDate.In(location).Format("2006-01-02")] = float64(checkIn.MoodScore)
+		moodTotal += float64(checkIn.MoodScore)
+	}
+	if len(checkIns) > 0 {
+		averageMood := roundScore(moodTotal / float64(len(checkIns)))
+		insights.AverageMood = &averageMood
+	}
+
+	sentimentByDay := make(map[string][]float64)
+	sentimentTotal, scored := 0.0, 0
+	for _, journal := range journals {
+		if journal.SentimentScore == nil {
+			continue
+		}
+		score := *journal.SentimentScore
+		switch utilities.SentimentLabelFor(score) {
+		case utilities.SentimentPositive:
+			insights.PositiveJournals++
+		case utilities.SentimentNegative:
+			insights.NegativeJournals++
+		default:
+			insights.NeutralJournals++
+		}
+		day := journal.CreatedAt.In(location).Format("2006-01-02")
+		sentimentByDay[day] = append(sentimentByDay[day], score)
+		sentimentTotal += score
+		scored++
+	}
+	if scored > 0 {
+		averageSentiment := roundScore(sentimentTotal / float64(scored))
+		insights.AverageSentiment = &averageSentiment
+	}
+
+	var moods, sentiments []float64
+	for day, mood := range moodByDay {
+		scores, ok := sentimentByDay[day]
+		if !ok {
+			continue
+		}
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		moods = append(moods, mood)
+		sentiments = append(sentiments, total/float64(len(scores)))
+	}
+	if correlation, ok := pearsonCorrelation(moods, sentiments); ok {
+		correlation = roundScore(correlation)
+		insights.MoodSentimentCorrelation = &correlation
+	}
+
+	return insights, nil
+}
+
+// SearchJournals runs a full-text search over the user's journals, best matches first. The
+// query uses websearch syntax and is hashed like the index, so neither the journals nor the
+// search reach the database as plain words.
+func (service *JournalService) SearchJournals(userID uuid.UUID, params JournalSearchParams) ([]JournalSearchResult, int64, *apierror.ApiError) {
+	searchFailed := apierror.NewApiErrorBuilder().
+		WithStatus(http.StatusInternalServerError).
+		WithMessage("Failed to search journals").
+		Build()
+
+	_, dataKey, err := service.DataKeyService.GetActiveKey(service.DB, userID)
+	if err != nil {
+		return nil, 0, searchFailed
+	}
+
+	blindQuery := blindSearchQuery(utilities.DeriveKey(dataKey, journalSearchKeyPurpose), params.Query)
+	results := []JournalSearchResult{}
+	if blindQuery == "" {
+		return results, 0, nil
+	}
+
+	filtered := func() *gorm.DB {
+		query := service.DB.Model(&models.Journal{}).
+			Where("user_id = ?", userID).
+			Where("search_vector @@ ?::tsquery", blindQuery)
+		if params.From != nil {
+			query = query.Where("created_at >= ?", *params.From)
+		}
+		if params.To != nil {
+			query = query.Where("created_at < ?", *params.To)
+		}
+		return query
+	}
+
+	var total int64
+	if err := filtered().Count(&total).Error; err != nil {
+		return nil, 0, searchFailed
+	}
+
+	var rows []journalSearchRow
+	err = filtered().
+		Select("id, user_id, content, data_key_id, template_id, prompt_id, created_at, updated_at, ts_rank(search_vector, ?::tsquery) AS rank", blindQuery).
+		Order("rank DESC, created_at DESC").
+		Limit(params.PageSize).
+		Offset((params.Page - 1) * params.PageSize).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, 0, searchFailed
+	}
+
+	keys := make(map[uuid.UUID][]byte)
+	for _, row := range rows {
+		if err := service.openJournal(service.DB, &row.Journal, keys); err != nil {
+			log.Printf("Failed to decrypt journal %s: %v", row.ID, err)
+			return nil, 0, searchFailed
+		}
+
+		results = append(results, JournalSearchResult{
+			ID:        row.ID,
+			Snippet:   utilities.HighlightSnippet(row.Content, params.Query),
+			Rank:      row.Rank,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+		})
+	}
+
+	return results, total, nil
+}
+
+// linkCheckIn applies the requested check-in link, which must be the user's own check-in from
+// the same local day as the journal
+func (service *JournalService) linkCheckIn(journal *models.Journal, input JournalInput) *apierror.ApiError {
+	if input.UnlinkCheckIn {
+		journal.CheckInID = nil
+		return nil
+	}
+	if input.CheckInID == nil {
+		return nil
+	}
+
+	var checkIn models.CheckIn
+	if err := service.DB.Where("id = ? AND user_id = ?", *input.CheckInID, journal.UserID).First(&checkIn).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Check-in not found").
+			Build()
+	}
+
+	location, _ := time.LoadLocation("Asia/Jakarta")
+	if checkIn.CheckInDate.In(location).Format("2006-01-02") != journal.CreatedAt.In(location).Format("2006-01-02") {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A journal can only be linked to a check-in from the same day").
+			Build()
+	}
+
+	journal.CheckInID = &checkIn.ID
+	return nil
+}
+
+// applyTemplate validates the answers of a guided entry against its template and stores them
+// on the journal. Entries left without free text get their content composed from the answers.
+func (service *JournalService) applyTemplate(journal *models.Journal, answers map[string]string, create bool) *apierror.ApiError {
+	if journal.TemplateID == nil {
+		if len(answers) > 0 {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Answers can only be given for journals with a template").
+				Build()
+		}
+	} else {
+		if answers == nil && journal.Answers != "" {
+			if err := json.Unmarshal([]byte(journal.Answers), &answers); err != nil {
+				return apierror.NewApiErrorBuilder().
+					WithStatus(http.StatusInternalServerError).
+					WithMessage(apierror.ErrInternalServerError).
+					Build()
+			}
+		}
+
+		var template models.JournalTemplate
+		query := service.DB.Where("id = ?", *journal.TemplateID)
+		if create {
+			query = query.Where("is_active")
+		}
+		if err := query.First(&template).Error; err != nil {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Journal template not found").
+				Build()
+		}
+
+		if err := ValidateJournalAnswers(template.Fields, answers); err != nil {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(err.Error()).
+				Build()
+		}
+
+		encoded, err := json.Marshal(answers)
+		if err != nil {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusInternalServerError).
+				WithMessage(apierror.ErrInternalServerError).
+				Build()
+		}
+		journal.Answers = string(encoded)
+
+		if strings.TrimSpace(journal.Content) == "" {
+			journal.Content = ComposeJournalContent(template.Fields, answers)
+		}
+	}
+
+	if strings.TrimSpace(journal.Content) == "" {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Journal content is required").
+			Build()
+	}
+	return nil
+}
+
+// EncryptLegacyJournals encrypts and re-indexes journals written before encryption at rest
+func (service *JournalService) EncryptLegacyJournals() (int, error) {
+	encrypted := 0
+	for {
+		var journals []models.Journal
+		if err := service.DB.Where("data_key_id IS NULL").Limit(legacyJournalBatchSize).Find(&journals).Error; err != nil {
+			return encrypted, err
+		}
+		if len(journals) == 0 {
+			break
+		}
+
+		for i := range journals {
+			err := service.DB.Transaction(func(tx *gorm.DB) error {
+				return service.storeJournal(tx, &journals[i], false)
+			})
+			if err != nil {
+				return encrypted, fmt.Errorf("encrypt journal %s: %w", journals[i].ID, err)
+			}
+			encrypted++
+		}
+	}
+
+	if encrypted > 0 {
+		log.Printf("Encrypted %d legacy journals", encrypted)
+	}
+	return encrypted, nil
+}
+
+// BackfillSentiment scores journals that have no score yet or were scored by an older
+// lexicon. Only the sentiment columns are written, the encrypted content is left alone.
+func (service *JournalService) BackfillSentiment() (int, error) {
+	scored := 0
+	keys := make(map[uuid.UUID][]byte)
+	for {
+		var journals []models.Journal
+		if err := service.DB.Where("sentiment_version < ?", utilities.SentimentVersion).
+			Limit(legacyJournalBatchSize).Find(&journals).Error; err != nil {
+			return scored, err
+		}
+		if len(journals) == 0 {
+			break
+		}
+
+		for i := range journals {
+			if err := service.openJournal(service.DB, &journals[i], keys); err != nil {
+				return scored, fmt.Errorf("decrypt journal %s: %w", journals[i].ID, err)
+			}
+			score := utilities.ScoreSentiment(journalSentimentText(&journals[i])).Score
+			err := service.DB.Model(&models.Journal{}).Where("id = ?", journals[i].ID).UpdateColumns(map[string]interface{}{
+				"sentiment_score":   score,
+				"sentiment_version": utilities.SentimentVersion,
+			}).Error
+			if err != nil {
+				return scored, fmt.Errorf("score journal %s: %w", journals[i].ID, err)
+			}
+			scored++
+		}
+	}
+
+	if scored > 0 {
+		log.Printf("Scored sentiment of %d journals", scored)
+	}
+	return scored, nil
+}
+
+// RotateUserKey moves all of a user's journals onto a fresh data key in one transaction
+func (service *JournalService) RotateUserKey(userID uuid.UUID) error {
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		var journals []models.Journal
+		if err := tx.Where("user_id = ?", userID).Find(&journals).Error; err != nil {
+			return err
+		}
+
+		keys := make(map[uuid.UUID][]byte)
+		for i := range journals {
+			if err := service.openJournal(tx, &journals[i], keys); err != nil {
+				return fmt.Errorf("decrypt journal %s: %w", journals[i].ID, err)
+			}
+		}
+
+		if _, _, err := service.DataKeyService.RotateKey(tx, userID); err != nil {
+			return err
+		}
+
+		for i := range journals {
+			if err := service.storeJournal(tx, &journals[i], false); err != nil {
+				return fmt.Errorf("re-encrypt journal %s: %w", journals[i].ID, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RotateAllKeys rotates the data key of every user that has one
+func (service *JournalService) RotateAllKeys() (int, error) {
+	var userIDs []uuid.UUID
+	if err := service.DB.Model(&models.UserDataKey{}).Where("is_active").Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+
+	for i, userID := range userIDs {
+		if err := service.RotateUserKey(userID); err != nil {
+			return i, fmt.Errorf("rotate key for user %s: %w", userID, err)
+		}
+	}
+
+	return len(userIDs), nil
+}
+
+// storeJournal encrypts the journal with the owner's active data key, saves it and rebuilds
+// its search index. The journal passed in keeps its plaintext content.
+func (service *JournalService) storeJournal(tx *gorm.DB, journal *models.Journal, create bool) error {
+	dataKey, key, err := service.DataKeyService.GetActiveKey(tx, journal.UserID)
+	if err != nil {
+		return err
+	}
+
+	score := utilities.ScoreSentiment(journalSentimentText(journal)).Score
+	journal.SentimentScore = &score
+	journal.SentimentVersion = utilities.SentimentVersion
+
+	stored := *journal
+	stored.DataKeyID = &dataKey.ID
+	if stored.Content, err = sealJournalField(key, journal.Content, journalContentAAD(journal.ID)); err != nil {
+		return err
+	}
+	if journal.Answers != "" {
+		if stored.Answers, err = sealJournalField(key, journal.Answers, journalAnswersAAD(journal.ID)); err != nil {
+			return err
+		}
+	}
+
+	if create {
+		err = tx.Omit(clause.Associations).Create(&stored).Error
+	} else {
+		// UpdateColumns keeps updated_at as given, so migrations don't look like user edits
+		err = tx.Model(&models.Journal{}).Where("id = ?", stored.ID).UpdateColumns(map[string]interface{}{
+			"content":           stored.Content,
+			"answers":           stored.Answers,
+			"check_in_id":       stored.CheckInID,
+			"data_key_id":       stored.DataKeyID,
+			"updated_at":        stored.UpdatedAt,
+			"sentiment_score":   stored.SentimentScore,
+			"sentiment_version": stored.SentimentVersion,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	journal.DataKeyID = stored.DataKeyID
+
+	searchVector := blindSearchVector(utilities.DeriveKey(key, journalSearchKeyPurpose), journal.Content)
+	return tx.Exec("UPDATE journals SET search_vector = ?::tsvector WHERE id = ?", searchVector, journal.ID).Error
+}
+
+// openJournal decrypts a stored journal in place, keys caches unwrapped data keys
+func (service *JournalService) openJournal(tx *gorm.DB, journal *models.Journal, keys map[uuid.UUID][]byte) error {
+	if journal.DataKeyID == nil {
+		return nil
+	}
+
+	key, ok := keys[*journal.DataKeyID]
+	if !ok {
+		var err error
+		key, err = service.DataKeyService.GetKey(tx, *journal.DataKeyID)
+		if err != nil {
+			return err
+		}
+		keys[*journal.DataKeyID] = key
+	}
+
+	content, err := openJournalField(key, journal.Content, journalContentAAD(journal.ID))
+	if err != nil {
+		return err
+	}
+	answers := ""
+	if journal.Answers != "" {
+		if answers, err = openJournalField(key, journal.Answers, journalAnswersAAD(journal.ID)); err != nil {
+			return err
+		}
+	}
+
+	journal.Content = content
+	journal.Answers = answers
+	return nil
+}
+
+func (service *JournalService) decryptJournals(journals []models.Journal) error {
+	keys := make(map[uuid.UUID][]byte)
+	for i := range journals {
+		if err := service.openJournal(service.DB, &journals[i], keys); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// journalSentimentText is the plaintext a journal is scored on: its content plus any template
+// answers that were not already composed into the content
+func journalSentimentText(journal *models.Journal) string {
+	text := journal.Content
+	if journal.Answers == "" {
+		return text
+	}
+
+	var answers map[string]string
+	if err := json.Unmarshal([]byte(journal.Answers), &answers); err != nil {
+		return text
+	}
+	keys := make([]string, 0, len(answers))
+	for key := range answers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if answer := strings.TrimSpace(answers[key]); answer != "" && !strings.Contains(journal.Content, answer) {
+			text += "\n" + answer
+		}
+	}
+	return text
+}
+
+func roundScore(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// pearsonCorrelation is undefined when either side has no variance
+func pearsonCorrelation(xs, ys []float64) (float64, bool) {
+	n := float64(len(xs))
+	if len(xs) < minCorrelationDays || len(xs) != len(ys) {
+		return 0, false
+	}
+
+	var sumX, sumY float64
+	for i := range xs {
+		sumX += xs[i]
+		sumY += ys[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, varianceX, varianceY float64
+	for i := range xs {
+		dx, dy := xs[i]-meanX, ys[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return 0, false
+	}
+	return covariance / math.Sqrt(varianceX*varianceY), true
+}
+
+// Each encrypted field is bound to its journal and column so ciphertexts cannot be swapped around
+func journalContentAAD(journalID uuid.UUID) []byte {
+	return journalID[:]
+}
+
+func journalAnswersAAD(journalID uuid.UUID) []byte {
+	return append(journalID[:], []byte("answers")...)
+}
+
+func sealJournalField(key []byte, plaintext string, additionalData []byte) (string, error) {
+	sealed, err := utilities.EncryptAESGCM(key, []byte(plaintext), additionalData)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openJournalField(key []byte, value string, additionalData []byte) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := utilities.DecryptAESGCM(key, sealed, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// blindSearchVector indexes the journal without its words ever leaving the process: the text is
+// stemmed in Go and every lexeme replaced with its keyed hash, keeping the positions used for
+// ranking and phrases. Journals are written in both Indonesian and English, so every word is
+// indexed with both stemmers and every search matches against either of them.
+func blindSearchVector(indexKey []byte, content string) string {
+	lexemes := utilities.SearchLexemes(content)
+	entries := make([]string, len(lexemes))
+	for i, lexeme := range lexemes {
+		positions := make([]string, len(lexeme.Positions))
+		for j, position := range lexeme.Positions {
+			positions[j] = strconv.Itoa(position)
+		}
+		entries[i] = "'" + blindLexeme(indexKey, lexeme.Lexeme) + "':" + strings.Join(positions, ",")
+	}
+	return strings.Join(entries, " ")
+}
+
+// blindSearchQuery turns a search in websearch syntax into a tsquery over the hashed lexemes:
+// "or" becomes |, an excluded "-word" !, a quoted phrase <-> and every word matches either of
+// its stems. Returns "" when nothing is searchable.
+func blindSearchQuery(indexKey []byte, query string) string {
+	parsed := utilities.ParseSearchQuery(query)
+	alternatives := make([]string, len(parsed))
+	for i, clauses := range parsed {
+		terms := make([]string, len(clauses))
+		for j, clause := range clauses {
+			terms[j] = blindPhrase(indexKey, clause.Words)
+			if clause.Exclude {
+				terms[j] = "!" + terms[j]
+			}
+		}
+		alternatives[i] = "(" + strings.Join(terms, " & ") + ")"
+	}
+	return strings.Join(alternatives, " | ")
+}
+
+// blindPhrase matches words next to each other, stopwords between them widen the distance
+func blindPhrase(indexKey []byte, words [][]string) string {
+	var builder strings.Builder
+	distance := 0
+	for _, stems := range words {
+		distance++
+		if stems == nil {
+			continue
+		}
+		if builder.Len() > 0 {
+			builder.WriteString(" <" + strconv.Itoa(distance) + "> ")
+		}
+		distance = 0
+
+		hashed := make([]string, len(stems))
+		for i, stem := range stems {
+			hashed[i] = "'" + blindLexeme(indexKey, stem) + "'"
+		}
+		builder.WriteString("(" + strings.Join(hashed, " | ") + ")")
+	}
+	if len(words) == 1 {
+		return builder.String()
+	}
+	return "(" + builder.String() + ")"
+}
+
+func blindLexeme(indexKey []byte, lexeme string) string {
+	mac := hmac.New(sha256.New, indexKey)
+	mac.Write([]byte(lexeme))
+	return hex.EncodeToString(mac.Sum(nil)[:12])
+}
+
+func normalizeTagName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(name), " "))
+}
+
+// validateTagNames normalizes and de-duplicates tag names
+func validateTagNames(names []string) ([]string, *apierror.ApiError) {
+	if len(names) > maxJournalTags {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("A journal can have at most %d tags", maxJournalTags)).
+			Build()
+	}
+
+	seen := make(map[string]bool)
+	normalized := make([]string, 0, len(names))
+	for _, name := range names {
+		name = normalizeTagName(name)
+		if name == "" || len([]rune(name)) > maxJournalTagLength {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage(fmt.Sprintf("Tags must be between 1 and %d characters", maxJournalTagLength)).
+				Build()
+		}
+		if !seen[name] {
+			seen[name] = true
+			normalized = append(normalized, name)
+		}
+	}
+	return normalized, nil
+}
+
+// replaceJournalTags creates any missing tags for the journal owner and links exactly these
+func replaceJournalTags(tx *gorm.DB, journal *models.Journal, names []string) error {
+	tags := []models.JournalTag{}
+	if len(names) > 0 {
+		newTags := make([]models.JournalTag, len(names))
+		for i, name := range names {
+			newTags[i] = models.JournalTag{ID: uuid.New(), UserID: journal.UserID, Name: name, CreatedAt: time.Now()}
+		}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&newTags).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND name IN ?", journal.UserID, names).Find(&tags).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Exec("DELETE FROM journal_tag_links WHERE journal_id = ?", journal.ID).Error; err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := tx.Exec("INSERT INTO journal_tag_links (journal_id, journal_tag_id) VALUES (?, ?)", journal.ID, tag.ID).Error; err != nil {
+			return err
+		}
+	}
+	journal.Tags = tags
+	return nil
+}
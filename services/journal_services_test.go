@@ -0,0 +1,45 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBlindSearchQuery(t *testing.T) {
+	key := []byte("journal-search-test-key")
+	lexeme := func(stem string) string { return "'" + blindLexeme(key, stem) + "'" }
+	sleep, work, bad, dream := "("+lexeme("sleep")+")", "("+lexeme("work")+")", "("+lexeme("bad")+")", "("+lexeme("dream")+")"
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"all words", "sleep work", "(" + sleep + " & " + work + ")"},
+		{"excluded word", "sleep -work", "(" + sleep + " & !" + work + ")"},
+		{"or", "sleep or work", "(" + sleep + ") | (" + work + ")"},
+		{"phrase", `"bad dream"`, "((" + bad + " <1> " + dream + "))"},
+		{"phrase with stopword", `"bad of dream"`, "((" + bad + " <2> " + dream + "))"},
+		{"nothing searchable", "the", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := blindSearchQuery(key, test.query); got != test.want {
+				t.Errorf("blindSearchQuery(%q) = %s, want %s", test.query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestBlindSearchVectorHidesWords(t *testing.T) {
+	key := []byte("journal-search-test-key")
+	vector := blindSearchVector(key, "Could not sleep before work")
+	for _, word := range []string{"sleep", "work", "could"} {
+		if strings.Contains(vector, word) {
+			t.Errorf("search vector %q contains %q", vector, word)
+		}
+	}
+	if want := "'" + blindLexeme(key, "sleep") + "':3"; !strings.Contains(vector, want) {
+		t.Errorf("search vector %q lacks %q", vector, want)
+	}
+}
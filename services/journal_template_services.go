@@ -0,0 +1,363 @@
+package services
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type JournalTemplateService struct {
+	DB *gorm.DB
+}
+
+func (service *JournalTemplateService) GetTemplates(includeInactive bool) ([]models.JournalTemplate, *apierror.ApiError) {
+	templates := []models.JournalTemplate{}
+	query := service.DB.Order("name asc")
+	if !includeInactive {
+		query = query.Where("is_active")
+	}
+
+	if err := query.Find(&templates).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journal templates").
+			Build()
+	}
+	return templates, nil
+}
+
+func (service *JournalTemplateService) GetTemplate(id uuid.UUID) (*models.JournalTemplate, *apierror.ApiError) {
+	var template models.JournalTemplate
+	if err := service.DB.First(&template, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusNotFound).
+				WithMessage("Journal template not found").
+				Build()
+		}
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journal template").
+			Build()
+	}
+	return &template, nil
+}
+
+func (service *JournalTemplateService) SaveTemplate(template *models.JournalTemplate) *apierror.ApiError {
+	if err := ValidateTemplateFields(template.Fields); err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+
+	if err := service.DB.Save(template).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save journal template").
+			Build()
+	}
+	return nil
+}
+
+// ArchiveTemplate hides a template from patients, journals that used it keep their answers
+func (service *JournalTemplateService) ArchiveTemplate(id uuid.UUID) *apierror.ApiError {
+	result := service.DB.Model(&models.JournalTemplate{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to archive journal template").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Journal template not found").
+			Build()
+	}
+	return nil
+}
+
+func (service *JournalTemplateService) GetPrompts(includeInactive bool) ([]models.JournalPrompt, *apierror.ApiError) {
+	prompts := []models.JournalPrompt{}
+	query := service.DB.Preload("Template").Order("created_at asc, id asc")
+	if !includeInactive {
+		query = query.Where("is_active")
+	}
+
+	if err := query.Find(&prompts).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journal prompts").
+			Build()
+	}
+	return prompts, nil
+}
+
+func (service *JournalTemplateService) GetPrompt(id uuid.UUID) (*models.JournalPrompt, *apierror.ApiError) {
+	var prompt models.JournalPrompt
+	if err := service.DB.First(&prompt, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusNotFound).
+				WithMessage("Journal prompt not found").
+				Build()
+		}
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve journal prompt").
+			Build()
+	}
+	return &prompt, nil
+}
+
+func (service *JournalTemplateService) SavePrompt(prompt *models.JournalPrompt) *apierror.ApiError {
+	if prompt.MinMood != nil && prompt.MaxMood != nil && *prompt.MinMood > *prompt.MaxMood {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("min_mood must not be greater than max_mood").
+			Build()
+	}
+	if prompt.TemplateID != nil {
+		if _, apiErr := service.GetTemplate(*prompt.TemplateID); apiErr != nil {
+			return apiErr
+		}
+	}
+
+	if err := service.DB.Omit("Template").Save(prompt).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save journal prompt").
+			Build()
+	}
+	return nil
+}
+
+func (service *JournalTemplateService) ArchivePrompt(id uuid.UUID) *apierror.ApiError {
+	result := service.DB.Model(&models.JournalPrompt{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to archive journal prompt").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Journal prompt not found").
+			Build()
+	}
+	return nil
+}
+
+// GetDailyPrompt picks today's prompt for a user. Prompts matching the mood of today's
+// check-in win, the pick is stable for the whole day so refreshing doesn't reshuffle it.
+func (service *JournalTemplateService) GetDailyPrompt(userID uuid.UUID, mood *int, day string) (*models.JournalPrompt, *apierror.ApiError) {
+	prompts, apiErr := service.GetPrompts(false)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	candidates := PromptsForMood(prompts, mood)
+	if len(candidates) == 0 {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("No journal prompts available").
+			Build()
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(userID.String() + day))
+	return &candidates[hash.Sum32()%uint32(len(candidates))], nil
+}
+
+// SeedDefaultTemplates creates the built-in templates and prompts on an empty library
+func (service *JournalTemplateService) SeedDefaultTemplates() error {
+	var count int64
+	if err := service.DB.Model(&models.JournalTemplate{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	low, high := 2, 4
+	now := time.Now()
+	templates := []models.JournalTemplate{
+		{
+			ID:          uuid.New(),
+			Name:        "Three good things",
+			Category:    models.GratitudeTemplate,
+			Description: "Write down three things that went well today and why.",
+			Fields: models.JournalTemplateFields{
+				{Key: "first", Label: "First good thing", Type: models.TextField, Required: true},
+				{Key: "second", Label: "Second good thing", Type: models.TextField},
+				{Key: "third", Label: "Third good thing", Type: models.TextField},
+				{Key: "why", Label: "Why did these happen?", Type: models.TextField},
+			},
+		},
+		{
+			ID:          uuid.New(),
+			Name:        "Thought record",
+			Category:    models.ThoughtRecordTemplate,
+			Description: "Catch an automatic thought, look at the evidence and find a balanced view.",
+			Fields: models.JournalTemplateFields{
+				{Key: "situation", Label: "Situation", Type: models.TextField, Required: true},
+				{Key: "automatic_thought", Label: "Automatic thought", Type: models.TextField, Required: true},
+				{Key: "emotion", Label: "Emotion", Type: models.TextField, Required: true},
+				{Key: "intensity_before", Label: "Intensity before (0-10)", Type: models.ScaleField, Required: true},
+				{Key: "evidence_for", Label: "Evidence for the thought", Type: models.TextField},
+				{Key: "evidence_against", Label: "Evidence against the thought", Type: models.TextField},
+				{Key: "balanced_thought", Label: "Balanced thought", Type: models.TextField, Required: true},
+				{Key: "intensity_after", Label: "Intensity after (0-10)", Type: models.ScaleField},
+			},
+		},
+		{
+			ID:          uuid.New(),
+			Name:        "Worry log",
+			Category:    models.WorryLogTemplate,
+			Description: "Park a worry on paper and decide what, if anything, to do about it.",
+			Fields: models.JournalTemplateFields{
+				{Key: "worry", Label: "What are you worried about?", Type: models.TextField, Required: true},
+				{Key: "likelihood", Label: "How likely is it to happen (0-10)?", Type: models.ScaleField, Required: true},
+				{Key: "in_control", Label: "Which part of it is in your control?", Type: models.TextField},
+				{Key: "next_step", Label: "One small next step", Type: models.TextField},
+			},
+		},
+	}
+	for i := range templates {
+		templates[i].IsActive = true
+		templates[i].CreatedAt = now
+		templates[i].UpdatedAt = now
+	}
+
+	prompts := []models.JournalPrompt{
+		{Text: "What is one thing you are grateful for today?", TemplateID: &templates[0].ID, MinMood: &high},
+		{Text: "Who made your day a little better, and how?", TemplateID: &templates[0].ID, MinMood: &high},
+		{Text: "What thought has been bothering you the most today?", TemplateID: &templates[1].ID, MaxMood: &low},
+		{Text: "Is there a worry you keep coming back to? Write it down and set it aside.", TemplateID: &templates[2].ID, MaxMood: &low},
+		{Text: "How are you feeling right now, and what might be behind it?"},
+		{Text: "What is something small you are looking forward to?"},
+	}
+	for i := range prompts {
+		prompts[i].ID = uuid.New()
+		prompts[i].IsActive = true
+		prompts[i].CreatedAt = now
+		prompts[i].UpdatedAt = now
+	}
+
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&templates).Error; err != nil {
+			return err
+		}
+		return tx.Create(&prompts).Error
+	})
+}
+
+// PromptsForMood returns the prompts whose mood range contains mood. Without a check-in only
+// prompts that don't target a mood are eligible. Falls back to all prompts if none match.
+func PromptsForMood(prompts []models.JournalPrompt, mood *int) []models.JournalPrompt {
+	var matching []models.JournalPrompt
+	for _, prompt := range prompts {
+		if mood == nil {
+			if prompt.MinMood == nil && prompt.MaxMood == nil {
+				matching = append(matching, prompt)
+			}
+			continue
+		}
+		if prompt.MinMood != nil && *mood < *prompt.MinMood {
+			continue
+		}
+		if prompt.MaxMood != nil && *mood > *prompt.MaxMood {
+			continue
+		}
+		matching = append(matching, prompt)
+	}
+
+	if len(matching) == 0 {
+		return prompts
+	}
+	return matching
+}
+
+// ValidateTemplateFields checks a template definition before it is saved
+func ValidateTemplateFields(fields models.JournalTemplateFields) error {
+	if len(fields) == 0 {
+		return fmt.Errorf("a template needs at least one field")
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range fields {
+		if field.Key == "" || field.Label == "" {
+			return fmt.Errorf("every field needs a key and a label")
+		}
+		if seen[field.Key] {
+			return fmt.Errorf("duplicate field key %q", field.Key)
+		}
+		seen[field.Key] = true
+
+		switch field.Type {
+		case models.TextField, models.NumberField, models.ScaleField:
+		default:
+			return fmt.Errorf("field %q has unknown type %q", field.Key, field.Type)
+		}
+	}
+	return nil
+}
+
+// ValidateJournalAnswers checks structured answers against the fields of a template
+func ValidateJournalAnswers(fields models.JournalTemplateFields, answers map[string]string) error {
+	known := make(map[string]bool)
+	for _, field := range fields {
+		known[field.Key] = true
+		answer := strings.TrimSpace(answers[field.Key])
+
+		if answer == "" {
+			if field.Required {
+				return fmt.Errorf("%s is required", field.Label)
+			}
+			continue
+		}
+
+		switch field.Type {
+		case models.NumberField:
+			if _, err := strconv.ParseFloat(answer, 64); err != nil {
+				return fmt.Errorf("%s must be a number", field.Label)
+			}
+		case models.ScaleField:
+			value, err := strconv.Atoi(answer)
+			if err != nil || value < 0 || value > 10 {
+				return fmt.Errorf("%s must be a whole number from 0 to 10", field.Label)
+			}
+		}
+	}
+
+	for key := range answers {
+		if !known[key] {
+			return fmt.Errorf("unknown field %q", key)
+		}
+	}
+	return nil
+}
+
+// ComposeJournalContent renders structured answers as plain text, used when a guided entry
+// has no free text so listing and search keep working on Content alone.
+func ComposeJournalContent(fields models.JournalTemplateFields, answers map[string]string) string {
+	var sections []string
+	for _, field := range fields {
+		if answer := strings.TrimSpace(answers[field.Key]); answer != "" {
+			sections = append(sections, field.Label+"\n"+answer)
+		}
+	}
+	return strings.Join(sections, "\n\n")
+}
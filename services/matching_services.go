@@ -0,0 +1,535 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Recommendations score at most this many therapists, those sharing the most concerns first
+	matchingPoolSize = 200
+	// Availability counts free slots at the patient's preferred times over the next two weeks,
+	// with this many slots counting as fully available
+	matchingDays       = 14
+	wellAvailableSlots = 3
+	maxMatchingWeight  = 100
+	maxConcerns        = 10
+	matchingWeightsID  = 1
+	// Unreviewed therapists score in the middle on rating
+	unratedScore = 0.5
+)
+
+// Criteria of the match score, the keys of a recommendation's breakdown
+const (
+	CriterionConcerns     = "concerns"
+	CriterionLanguage     = "language"
+	CriterionGender       = "gender"
+	CriterionBudget       = "budget"
+	CriterionAvailability = "availability"
+	CriterionRating       = "rating"
+)
+
+// Weights used until an admin tunes them
+var defaultMatchingWeights = models.MatchingWeights{
+	ID:           matchingWeightsID,
+	Concerns:     35,
+	Language:     15,
+	Gender:       10,
+	Budget:       15,
+	Availability: 15,
+	Rating:       10,
+}
+
+// Local hours [start, end) of each part of the day
+var partsOfDay = map[string][2]int{
+	models.PartOfDayMorning:   {6, 12},
+	models.PartOfDayAfternoon: {12, 17},
+	models.PartOfDayEvening:   {17, 22},
+}
+
+type MatchingService struct {
+	DB *gorm.DB
+}
+
+// Recommendation is a therapist ranked for a patient. Score runs from 0 to 100, Breakdown has
+// the 0 to 1 score of each criterion that counted and Reasons explain it in words.
+type Recommendation struct {
+	TherapistID       uuid.UUID               `json:"therapist_id"`
+	Name              string                  `json:"name"`
+	ImageURL          string                  `json:"image_url"`
+	Specialization    string                  `json:"specialization"`
+	Consultation      models.ConsultationType `json:"consultation_type"`
+	Rate              int64                   `json:"rate"`
+	Rating            float64                 `json:"rating"`
+	ReviewCount       int                     `json:"review_count"`
+	Score             float64                 `json:"score"`
+	Breakdown         map[string]float64      `json:"breakdown"`
+	Reasons           []string                `json:"reasons"`
+	NextPreferredSlot *time.Time              `json:"next_preferred_slot"`
+}
+
+// matchCandidate is what the score of one therapist is computed from
+type matchCandidate struct {
+	therapist models.Therapist
+	// IDs of the therapist's terms
+	terms map[uuid.UUID]bool
+	// Free slots at the patient's preferred times, soonest first
+	preferredSlots []time.Time
+}
+
+// GetQuestionnaire returns the patient's latest answers
+func (service *MatchingService) GetQuestionnaire(patientID uuid.UUID) (*models.MatchingQuestionnaire, *apierror.ApiError) {
+	var questionnaire models.MatchingQuestionnaire
+	if err := service.DB.Where("patient_id = ?", patientID).First(&questionnaire).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusNotFound).
+				WithMessage("The matching questionnaire has not been answered yet").
+				Build()
+		}
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve questionnaire").
+			Build()
+	}
+	return &questionnaire, nil
+}
+
+// SaveQuestionnaire stores the patient's answers, replacing earlier ones
+func (service *MatchingService) SaveQuestionnaire(patientID uuid.UUID, answers models.MatchingAnswers) (*models.MatchingQuestionnaire, *apierror.ApiError) {
+	answers, apiErr := normalizeAnswers(answers)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var questionnaire models.MatchingQuestionnaire
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTerms(tx, models.KindSpecialization, answers.ConcernIDs); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("patient_id = ?", patientID).First(&questionnaire).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			questionnaire = models.MatchingQuestionnaire{
+				ID:        uuid.New(),
+				PatientID: patientID,
+				Answers:   answers,
+				CreatedAt: now,
+				UpdatedAt: now,
+			}
+			return tx.Create(&questionnaire).Error
+		}
+		if err != nil {
+			return err
+		}
+		questionnaire.Answers = answers
+		questionnaire.UpdatedAt = now
+		return tx.Model(&questionnaire).UpdateColumns(map[string]interface{}{
+			"answers":    questionnaire.Answers,
+			"updated_at": questionnaire.UpdatedAt,
+		}).Error
+	})
+	switch {
+	case err == nil:
+		return &questionnaire, nil
+	case errors.Is(err, ErrInvalidTerm):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Pick concerns from the offered specializations").
+			Build()
+	case isUniqueViolation(err):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("The questionnaire was answered twice at the same time").
+			Build()
+	default:
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save questionnaire").
+			Build()
+	}
+}
+
+// GetWeights returns the weights of the match score, the defaults until an admin sets them
+func (service *MatchingService) GetWeights() (*models.MatchingWeights, *apierror.ApiError) {
+	weights := defaultMatchingWeights
+	err := service.DB.First(&weights, "id = ?", matchingWeightsID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve matching weights").
+			Build()
+	}
+	return &weights, nil
+}
+
+// UpdateWeights replaces the weights of the match score. Weights are relative, only how they
+// compare to each other matters.
+func (service *MatchingService) UpdateWeights(adminID uuid.UUID, weights models.MatchingWeights) (*models.MatchingWeights, *apierror.ApiError) {
+	values := []float64{weights.Concerns, weights.Language, weights.Gender, weights.Budget, weights.Availability, weights.Rating}
+	total := 0.0
+	for _, value := range values {
+		if value < 0 || value > maxMatchingWeight || math.IsNaN(value) {
+			total = -1
+			break
+		}
+		total += value
+	}
+	if total <= 0 {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Weights range from 0 to %d and at least one must be above 0", maxMatchingWeight)).
+			Build()
+	}
+
+	weights.ID = matchingWeightsID
+	weights.UpdatedBy = &adminID
+	weights.UpdatedAt = time.Now()
+	if err := service.DB.Save(&weights).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save matching weights").
+			Build()
+	}
+	return &weights, nil
+}
+
+// Recommend ranks therapists by how well they fit the patient's questionnaire: their
+// specializations, language, gender, price, free slots at the preferred times and rating.
+func (service *MatchingService) Recommend(patientID uuid.UUID, limit int) ([]Recommendation, *apierror.ApiError) {
+	failed := apierror.NewApiErrorBuilder().
+		WithStatus(http.StatusInternalServerError).
+		WithMessage("Failed to recommend therapists").
+		Build()
+
+	questionnaire, apiErr := service.GetQuestionnaire(patientID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	weights, apiErr := service.GetWeights()
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	answers := questionnaire.Answers
+
+	therapists, err := service.matchingPool(answers)
+	if err != nil {
+		return nil, failed
+	}
+	ids := make([]uuid.UUID, len(therapists))
+	for i := range therapists {
+		ids[i] = therapists[i].UserID
+	}
+
+	terms := make(map[uuid.UUID]map[uuid.UUID]bool)
+	if len(ids) > 0 {
+		var links []models.TherapistTaxonomyTerm
+		if err := service.DB.Where("therapist_id IN ?", ids).Find(&links).Error; err != nil {
+			return nil, failed
+		}
+		for _, link := range links {
+			if terms[link.TherapistID] == nil {
+				terms[link.TherapistID] = make(map[uuid.UUID]bool)
+			}
+			terms[link.TherapistID][link.TaxonomyTermID] = true
+		}
+	}
+	concernNames := make(map[uuid.UUID]string)
+	if len(answers.ConcernIDs) > 0 {
+		var concerns []models.TaxonomyTerm
+		if err := service.DB.Where("id IN ?", answers.ConcernIDs).Find(&concerns).Error; err != nil {
+			return nil, failed
+		}
+		for _, concern := range concerns {
+			concernNames[concern.ID] = concern.Name
+		}
+	}
+
+	now := time.Now()
+	today := LocalDay(now.In(scheduleLocation))
+	schedules, err := loadSchedules(service.DB, therapists, today, today.AddDate(0, 0, matchingDays))
+	if err != nil {
+		return nil, failed
+	}
+	users, err := therapistUsers(service.DB, ids)
+	if err != nil {
+		return nil, failed
+	}
+
+	recommendations := make([]Recommendation, 0, len(therapists))
+	for _, therapist := range therapists {
+		candidate := matchCandidate{
+			therapist:      therapist,
+			terms:          terms[therapist.UserID],
+			preferredSlots: preferredSlots(schedules[therapist.UserID], answers, today, now),
+		}
+		recommendation := scoreMatch(candidate, answers, weights, concernNames)
+		user := users[therapist.UserID]
+		recommendation.Name = user.Name
+		recommendation.ImageURL = user.ImageURL
+		recommendations = append(recommendations, recommendation)
+	}
+
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		a, b := recommendations[i], recommendations[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		return a.TherapistID.String() < b.TherapistID.String()
+	})
+	if len(recommendations) > limit {
+		recommendations = recommendations[:limit]
+	}
+	return recommendations, nil
+}
+
+// matchingPool selects the therapists worth scoring: those offering the consultation type, the
+// ones sharing the most concerns and then the best rated first
+func (service *MatchingService) matchingPool(answers models.MatchingAnswers) ([]models.Therapist, error) {
+	query := service.DB.Model(&models.Therapist{})
+	if answers.ConsultationType != "" {
+		query = query.Where("consultation IN ?", []models.ConsultationType{answers.ConsultationType, models.Hybrid})
+	}
+
+	order := clause.Expr{SQL: "rating_average DESC, review_count DESC, user_id ASC", WithoutParentheses: true}
+	if len(answers.ConcernIDs) > 0 {
+		order = clause.Expr{
+			SQL: `(SELECT COUNT(*) FROM therapist_taxonomy_terms
+				WHERE therapist_taxonomy_terms.therapist_id = therapists.user_id AND therapist_taxonomy_terms.taxonomy_term_id IN (?)) DESC,
+				rating_average DESC, review_count DESC, user_id ASC`,
+			Vars:               []interface{}{answers.ConcernIDs},
+			WithoutParentheses: true,
+		}
+	}
+
+	var therapists []models.Therapist
+	err := query.Clauses(clause.OrderBy{Expression: order}).Limit(matchingPoolSize).Find(&therapists).Error
+	return therapists, err
+}
+
+// preferredSlots lists the therapist's free slots over the coming days that fall on the
+// patient's preferred days and times
+func preferredSlots(schedule *therapistSchedule, answers models.MatchingAnswers, today, now time.Time) []time.Time {
+	var result []time.Time
+	for i := 0; i < matchingDays; i++ {
+		day := today.AddDate(0, 0, i)
+		if len(answers.PreferredDays) > 0 && !containsWeekday(answers.PreferredDays, day.Weekday()) {
+			continue
+		}
+		for _, slot := range schedule.slots(day, answers.ConsultationType, defaultSession, now) {
+			if inPreferredTimes(slot, answers.PreferredTimes) {
+				result = append(result, slot)
+			}
+		}
+	}
+	return result
+}
+
+// scoreMatch scores a therapist against the answers. Criteria the patient left open do not
+// count, availability and rating always do.
+func scoreMatch(candidate matchCandidate, answers models.MatchingAnswers, weights *models.MatchingWeights, concernNames map[uuid.UUID]string) Recommendation {
+	therapist := candidate.therapist
+	recommendation := Recommendation{
+		TherapistID:    therapist.UserID,
+		Specialization: therapist.Specialization,
+		Consultation:   therapist.Consultation,
+		Rate:           matchingRate(&therapist, answers.ConsultationType),
+		Rating:         therapist.RatingAverage,
+		ReviewCount:    therapist.ReviewCount,
+		Breakdown:      make(map[string]float64),
+		Reasons:        []string{},
+	}
+	var weighted, total float64
+	add := func(criterion string, weight, score float64) {
+		recommendation.Breakdown[criterion] = math.Round(score*100) / 100
+		weighted += weight * score
+		total += weight
+	}
+
+	if len(answers.ConcernIDs) > 0 {
+		var matched []string
+		for _, id := range answers.ConcernIDs {
+			if candidate.terms[id] {
+				matched = append(matched, concernNames[id])
+			}
+		}
+		add(CriterionConcerns, weights.Concerns, float64(len(matched))/float64(len(answers.ConcernIDs)))
+		if len(matched) > 0 {
+			recommendation.Reasons = append(recommendation.Reasons, "Works with "+strings.Join(matched, ", "))
+		}
+	}
+
+	if answers.Language != "" {
+		speaks := false
+		for _, language := range therapist.Languages {
+			speaks = speaks || language == answers.Language
+		}
+		if speaks {
+			add(CriterionLanguage, weights.Language, 1)
+			recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("Holds sessions in your language (%s)", answers.Language))
+		} else {
+			add(CriterionLanguage, weights.Language, 0)
+		}
+	}
+
+	if answers.Gender != "" {
+		if therapist.Gender == answers.Gender {
+			add(CriterionGender, weights.Gender, 1)
+			recommendation.Reasons = append(recommendation.Reasons, "Matches your gender preference")
+		} else {
+			add(CriterionGender, weights.Gender, 0)
+		}
+	}
+
+	if answers.BudgetMax != nil {
+		budget := *answers.BudgetMax
+		switch {
+		case recommendation.Rate <= budget:
+			add(CriterionBudget, weights.Budget, 1)
+			recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("Rp%d per session, within your budget", recommendation.Rate))
+		default:
+			// The score drops to 0 as the rate reaches twice the budget
+			score := 0.0
+			if budget > 0 {
+				score = math.Max(0, 1-float64(recommendation.Rate-budget)/float64(budget))
+			}
+			add(CriterionBudget, weights.Budget, score)
+			recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("Rp%d per session, above your budget of Rp%d", recommendation.Rate, budget))
+		}
+	}
+
+	slots := candidate.preferredSlots
+	add(CriterionAvailability, weights.Availability, math.Min(1, float64(len(slots))/wellAvailableSlots))
+	when := "in the next two weeks"
+	if len(answers.PreferredDays) > 0 || len(answers.PreferredTimes) > 0 {
+		when = "at your preferred times in the next two weeks"
+	}
+	if len(slots) > 0 {
+		recommendation.NextPreferredSlot = &slots[0]
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("%d open slots %s, the first on %s",
+			len(slots), when, slots[0].In(scheduleLocation).Format("Mon 2 Jan 15:04")))
+	} else {
+		recommendation.Reasons = append(recommendation.Reasons, "No open slots "+when)
+	}
+
+	if therapist.ReviewCount > 0 {
+		add(CriterionRating, weights.Rating, therapist.RatingAverage/5)
+		recommendation.Reasons = append(recommendation.Reasons, fmt.Sprintf("Rated %.1f from %d reviews", therapist.RatingAverage, therapist.ReviewCount))
+	} else {
+		add(CriterionRating, weights.Rating, unratedScore)
+	}
+
+	if total > 0 {
+		recommendation.Score = math.Round(weighted/total*1000) / 10
+	}
+	return recommendation
+}
+
+// matchingRate is what a default session costs the patient, the cheaper kind when they have no
+// preference and the therapist offers both
+func matchingRate(therapist *models.Therapist, consultationType models.ConsultationType) int64 {
+	if consultationType != "" {
+		return therapist.RateFor(consultationType)
+	}
+	switch therapist.Consultation {
+	case models.Online, models.Offline:
+		return therapist.RateFor(therapist.Consultation)
+	}
+	return min(therapist.RateFor(models.Online), therapist.RateFor(models.Offline))
+}
+
+func normalizeAnswers(answers models.MatchingAnswers) (models.MatchingAnswers, *apierror.ApiError) {
+	invalid := func(message string) (models.MatchingAnswers, *apierror.ApiError) {
+		return answers, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(message).
+			Build()
+	}
+
+	answers.ConcernIDs = uniqueIDs(answers.ConcernIDs)
+	if len(answers.ConcernIDs) > maxConcerns {
+		return invalid(fmt.Sprintf("Pick at most %d concerns", maxConcerns))
+	}
+	answers.Language = strings.ToLower(strings.TrimSpace(answers.Language))
+	if answers.Gender != "" && answers.Gender != models.Female && answers.Gender != models.Male {
+		return invalid("Invalid gender")
+	}
+	if answers.BudgetMax != nil && *answers.BudgetMax < 0 {
+		return invalid("The budget cannot be negative")
+	}
+	switch answers.ConsultationType {
+	case "", models.Online, models.Offline:
+	default:
+		return invalid("The consultation type is online, offline or left empty for either")
+	}
+
+	days := []time.Weekday{}
+	for _, day := range answers.PreferredDays {
+		if day < time.Sunday || day > time.Saturday {
+			return invalid("Preferred days run from 0 (Sunday) to 6 (Saturday)")
+		}
+		if !containsWeekday(days, day) {
+			days = append(days, day)
+		}
+	}
+	answers.PreferredDays = days
+
+	times := []string{}
+	for _, part := range answers.PreferredTimes {
+		part = strings.ToLower(strings.TrimSpace(part))
+		if _, ok := partsOfDay[part]; !ok {
+			return invalid("Preferred times are morning, afternoon or evening")
+		}
+		if !containsString(times, part) {
+			times = append(times, part)
+		}
+	}
+	answers.PreferredTimes = times
+	return answers, nil
+}
+
+func inPreferredTimes(slot time.Time, parts []string) bool {
+	if len(parts) == 0 {
+		return true
+	}
+	hour := slot.In(scheduleLocation).Hour()
+	for _, part := range parts {
+		if hours := partsOfDay[part]; hour >= hours[0] && hour < hours[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func containsWeekday(days []time.Weekday, day time.Weekday) bool {
+	for _, d := range days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/utilities"
+	"github.com/google/uuid"
+)
+
+// MeetingAccess is what a participant of an online appointment sees of its meeting room.
+// JoinURL is only filled in while the room is open.
+type MeetingAccess struct {
+	JoinURL  string    `json:"join_url,omitempty"`
+	OpensAt  time.Time `json:"opens_at"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// MeetingAccessFor returns the meeting room of an appointment as the given user sees it, or nil
+// when the user is not one of its two participants or the appointment has no room
+func MeetingAccessFor(appointment *models.Appointment, userID uuid.UUID, name string, now time.Time) (*MeetingAccess, error) {
+	if appointment.MeetingRoom == nil || (userID != appointment.UserID && userID != appointment.TherapistID) {
+		return nil, nil
+	}
+	if appointment.Status != models.Confirmed && appointment.Status != models.InSession {
+		return nil, nil
+	}
+	end := appointment.AppointmentDate.Add(time.Duration(appointment.DurationMinutes) * time.Minute)
+	return meetingAccess(*appointment.MeetingRoom, appointment.AppointmentDate, end, userID, name, now)
+}
+
+func meetingAccess(room string, start, end time.Time, userID uuid.UUID, name string, now time.Time) (*MeetingAccess, error) {
+	access := &MeetingAccess{
+		OpensAt:  start.Add(-time.Duration(config.Env.MeetingJoinLeadMinutes) * time.Minute),
+		ClosesAt: end,
+	}
+	if now.Before(access.OpensAt) || !now.Before(access.ClosesAt) {
+		return access, nil
+	}
+
+	// The token is what keeps everyone else out, the room name alone doesn't
+	base, err := url.Parse(config.Env.MeetingBaseURL)
+	if err != nil {
+		return nil, err
+	}
+	token, err := utilities.GenerateMeetingJWT(config.Env.MeetingJWTAppID, config.Env.MeetingJWTSecret, base.Hostname(),
+		room, utilities.MeetingUser{ID: userID.String(), Name: name}, access.OpensAt, access.ClosesAt)
+	if err != nil {
+		return nil, err
+	}
+	access.JoinURL = config.Env.MeetingBaseURL + "/" + room + "?jwt=" + url.QueryEscape(token)
+	return access, nil
+}
+
+// newMeetingRoom makes an unguessable room name for an online appointment, or nil for others
+func newMeetingRoom(consultationType models.ConsultationType) (*string, error) {
+	if consultationType != models.Online {
+		return nil, nil
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	room := "hand-" + hex.EncodeToString(buf)
+	return &room, nil
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// NotificationSender delivers a text message to a phone number
+type NotificationSender interface {
+	Send(ctx context.Context, phoneNumber, message string) error
+}
+
+// FonnteSender sends WhatsApp messages through Fonnte, like the check-in reminder
+type FonnteSender struct {
+	APIKey string
+	Client *http.Client
+}
+
+func (sender *FonnteSender) Send(ctx context.Context, phoneNumber, message string) error {
+	body, err := json.Marshal(map[string]string{"target": phoneNumber, "message": message})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.fonnte.com/send", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", sender.APIKey)
+	request.Header.Set("Content-Type", "application/json")
+
+	client := sender.Client
+	if client == nil {
+		client = &http.Client{Timeout: 15 * time.Second}
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("fonnte responded %s", response.Status)
+	}
+	return nil
+}
+
+type NotificationService struct {
+	DB *gorm.DB
+}
+
+// GetPreferences returns the user's preferences, everything is on until the user changes it
+func (service *NotificationService) GetPreferences(userID uuid.UUID) (*models.NotificationPreference, *apierror.ApiError) {
+	preference, err := notificationPreference(service.DB, userID)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve notification preferences").
+			Build()
+	}
+	return preference, nil
+}
+
+// UpdatePreferences changes the preferences that are given and keeps the others
+func (service *NotificationService) UpdatePreferences(userID uuid.UUID, appointmentReminders, checkInReminders *bool) (*models.NotificationPreference, *apierror.ApiError) {
+	preference, apiErr := service.GetPreferences(userID)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+	if appointmentReminders != nil {
+		preference.AppointmentReminders = *appointmentReminders
+	}
+	if checkInReminders != nil {
+		preference.CheckInReminders = *checkInReminders
+	}
+	preference.UpdatedAt = time.Now()
+
+	if err := service.DB.Save(preference).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update notification preferences").
+			Build()
+	}
+	return preference, nil
+}
+
+func notificationPreference(db *gorm.DB, userID uuid.UUID) (*models.NotificationPreference, error) {
+	var preference models.NotificationPreference
+	err := db.Where("user_id = ?", userID).First(&preference).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.NotificationPreference{
+			UserID:               userID,
+			AppointmentReminders: true,
+			CheckInReminders:     true,
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &preference, nil
+}
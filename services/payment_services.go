@@ -1,6 +1,7 @@
 package services
 
 import (
+	"github.com/Hand-TBN1/hand-backend/config"
 	"github.com/midtrans/midtrans-go"
 	"github.com/midtrans/midtrans-go/snap"
 )
@@ -16,7 +17,7 @@ func (service *PaymentService) CreatePayment(orderID string, grossAmount int64)
 		},
 		Expiry: &snap.ExpiryDetails{
 			Unit:     "minute",
-			Duration: 5,
+			Duration: int64(config.Env.PaymentWindowMinutes),
 		},
 		Callbacks: &snap.Callbacks{
 			Finish: "https://hand.tbn1.site/appointment-history", 
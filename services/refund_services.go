@@ -0,0 +1,79 @@
+package services
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type RefundService struct {
+	DB *gorm.DB
+}
+
+// GetRefunds lists refunds newest first, optionally only those with the given status
+func (service *RefundService) GetRefunds(status models.RefundStatus) ([]models.Refund, *apierror.ApiError) {
+	var refunds []models.Refund
+	query := service.DB.Order("created_at desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&refunds).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve refunds").
+			Build()
+	}
+	return refunds, nil
+}
+
+// GetUserRefunds lists the refunds of one patient, newest first
+func (service *RefundService) GetUserRefunds(userID uuid.UUID) ([]models.Refund, *apierror.ApiError) {
+	var refunds []models.Refund
+	if err := service.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&refunds).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve refunds").
+			Build()
+	}
+	return refunds, nil
+}
+
+func createRefund(tx *gorm.DB, appointment *models.Appointment, amount int64, percent int, reason string) (*models.Refund, error) {
+	refund := &models.Refund{
+		ID:            uuid.New(),
+		AppointmentID: &appointment.ID,
+		UserID:        appointment.UserID,
+		Amount:        amount,
+		Percent:       percent,
+		Reason:        reason,
+		Status:        models.RefundPending,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func createGroupRefund(tx *gorm.DB, registration *models.GroupRegistration, amount int64, percent int, reason string) (*models.Refund, error) {
+	refund := &models.Refund{
+		ID:                  uuid.New(),
+		GroupRegistrationID: &registration.ID,
+		UserID:              registration.PatientID,
+		Amount:              amount,
+		Percent:             percent,
+		Reason:              reason,
+		Status:              models.RefundPending,
+		CreatedAt:           time.Now(),
+		UpdatedAt:           time.Now(),
+	}
+	if err := tx.Create(refund).Error; err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
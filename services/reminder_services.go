@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// Reminders the sender rejected are retried this many times in total
+	maxReminderAttempts = 3
+	// A reminder still sending after this long was interrupted, e.g. by a restart
+	reminderClaimTimeout = 10 * time.Minute
+)
+
+// ReminderService reminds patients and therapists of confirmed appointments at each offset
+// before they start. Every reminder is claimed through a unique row before it is sent, so
+// instances running side by side never send the same reminder twice. A send that was
+// interrupted midway is not retried either, since it may have gone out already.
+type ReminderService struct {
+	DB      *gorm.DB
+	Sender  NotificationSender
+	Offsets []time.Duration
+}
+
+type reminderRecipient struct {
+	user         models.User
+	counterpart  string
+	forTherapist bool
+}
+
+// SendDueReminders sends the reminders that are due now and returns how many went out
+func (service *ReminderService) SendDueReminders(ctx context.Context) (int, error) {
+	if len(service.Offsets) == 0 {
+		return 0, nil
+	}
+	now := time.Now()
+
+	err := service.DB.Model(&models.AppointmentReminder{}).
+		Where("status = ? AND claimed_at < ?", models.ReminderSending, now.Add(-reminderClaimTimeout)).
+		UpdateColumns(map[string]interface{}{
+			"status":     models.ReminderFailed,
+			"attempts":   maxReminderAttempts,
+			"last_error": "interrupted while sending, not retried to avoid a duplicate",
+			"updated_at": now,
+		}).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var appointments []models.Appointment
+	err = service.DB.Preload("User").Preload("Therapist").
+		Where("status = ? AND appointment_date > ? AND appointment_date <= ?", models.Confirmed, now, now.Add(service.Offsets[0])).
+		Find(&appointments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range appointments {
+		appointment := &appointments[i]
+		recipients := []reminderRecipient{
+			{user: appointment.User, counterpart: appointment.Therapist.Name},
+			{user: appointment.Therapist, counterpart: appointment.User.Name, forTherapist: true},
+		}
+		for _, recipient := range recipients {
+			if service.remind(ctx, appointment, recipient, now) {
+				sent++
+			}
+		}
+	}
+	return sent, nil
+}
+
+// remind sends the reminder for the shortest offset that is due. Longer offsets that were
+// missed, e.g. because the appointment was booked late, are skipped rather than sent together.
+func (service *ReminderService) remind(ctx context.Context, appointment *models.Appointment, recipient reminderRecipient, now time.Time) bool {
+	var due []time.Duration
+	for _, offset := range service.Offsets {
+		if !appointment.AppointmentDate.Add(-offset).After(now) {
+			due = append(due, offset)
+		}
+	}
+	if len(due) == 0 {
+		return false
+	}
+	current := due[len(due)-1]
+	for _, missed := range due[:len(due)-1] {
+		if _, err := service.claim(appointment.ID, recipient.user.ID, missed, models.ReminderSkipped, now); err != nil {
+			log.Printf("Failed to skip reminder for appointment %s: %v", appointment.ID, err)
+		}
+	}
+
+	reminder, err := service.claim(appointment.ID, recipient.user.ID, current, models.ReminderSending, now)
+	if err != nil {
+		log.Printf("Failed to claim reminder for appointment %s: %v", appointment.ID, err)
+		return false
+	}
+	if reminder == nil {
+		reminder, err = service.claimRetry(appointment.ID, recipient.user.ID, current, now)
+		if err != nil || reminder == nil {
+			return false
+		}
+	}
+
+	preference, err := notificationPreference(service.DB, recipient.user.ID)
+	if err != nil {
+		service.finish(reminder, models.ReminderFailed, err.Error())
+		return false
+	}
+	if !preference.AppointmentReminders || recipient.user.PhoneNumber == "" {
+		service.finish(reminder, models.ReminderSkipped, "")
+		return false
+	}
+
+	message, err := service.reminderMessage(appointment, recipient, current)
+	if err == nil {
+		err = service.Sender.Send(ctx, recipient.user.PhoneNumber, message)
+	}
+	if err != nil {
+		log.Printf("Failed to send reminder for appointment %s: %v", appointment.ID, err)
+		service.finish(reminder, models.ReminderFailed, err.Error())
+		return false
+	}
+	service.finish(reminder, models.ReminderSent, "")
+	return true
+}
+
+// claim inserts the reminder row, it returns nil when another run already has it
+func (service *ReminderService) claim(appointmentID, recipientID uuid.UUID, offset time.Duration, status models.ReminderStatus, now time.Time) (*models.AppointmentReminder, error) {
+	reminder := models.AppointmentReminder{
+		ID:            uuid.New(),
+		AppointmentID: appointmentID,
+		RecipientID:   recipientID,
+		OffsetMinutes: int(offset / time.Minute),
+		Status:        status,
+		ClaimedAt:     now,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if status == models.ReminderSending {
+		reminder.Attempts = 1
+	}
+
+	result := service.DB.Exec(`
+		INSERT INTO appointment_reminders (id, appointment_id, recipient_id, offset_minutes, status, attempts, claimed_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (appointment_id, recipient_id, offset_minutes) DO NOTHING`,
+		reminder.ID, reminder.AppointmentID, reminder.RecipientID, reminder.OffsetMinutes, reminder.Status,
+		reminder.Attempts, reminder.ClaimedAt, reminder.CreatedAt, reminder.UpdatedAt)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &reminder, nil
+}
+
+// claimRetry takes back a reminder the sender rejected, if it has attempts left
+func (service *ReminderService) claimRetry(appointmentID, recipientID uuid.UUID, offset time.Duration, now time.Time) (*models.AppointmentReminder, error) {
+	result := service.DB.Model(&models.AppointmentReminder{}).
+		Where("appointment_id = ? AND recipient_id = ? AND offset_minutes = ? AND status = ? AND attempts < ?",
+			appointmentID, recipientID, int(offset/time.Minute), models.ReminderFailed, maxReminderAttempts).
+		UpdateColumns(map[string]interface{}{
+			"status":     models.ReminderSending,
+			"attempts":   gorm.Expr("attempts + 1"),
+			"claimed_at": now,
+			"updated_at": now,
+		})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, result.Error
+	}
+
+	var reminder models.AppointmentReminder
+	err := service.DB.Where("appointment_id = ? AND recipient_id = ? AND offset_minutes = ?",
+		appointmentID, recipientID, int(offset/time.Minute)).First(&reminder).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reminder, nil
+}
+
+func (service *ReminderService) finish(reminder *models.AppointmentReminder, status models.ReminderStatus, lastError string) {
+	columns := map[string]interface{}{
+		"status":     status,
+		"last_error": lastError,
+		"updated_at": time.Now(),
+	}
+	if status == models.ReminderSent {
+		columns["sent_at"] = time.Now()
+	}
+	if err := service.DB.Model(reminder).UpdateColumns(columns).Error; err != nil {
+		log.Printf("Failed to record reminder %s as %s: %v", reminder.ID, status, err)
+	}
+}
+
+func (service *ReminderService) reminderMessage(appointment *models.Appointment, recipient reminderRecipient, offset time.Duration) (string, error) {
+	startsAt := appointment.AppointmentDate.In(scheduleLocation).Format("Mon 2 Jan 2006 at 15:04 MST")
+	message := fmt.Sprintf("Reminder: your Hand %s session with %s starts in %s, on %s.",
+		appointment.Type, recipient.counterpart, formatReminderOffset(offset), startsAt)
+
+	if appointment.Type == models.Offline {
+		if recipient.forTherapist {
+			return message, nil
+		}
+		var therapist models.Therapist
+		if err := service.DB.Select("location").Where("user_id = ?", appointment.TherapistID).First(&therapist).Error; err != nil {
+			return "", err
+		}
+		return message + " Location: " + therapist.Location, nil
+	}
+	return message + " Join the session: " + appointmentLink(appointment), nil
+}
+
+func formatReminderOffset(offset time.Duration) string {
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s", unit)
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	if offset%time.Hour == 0 {
+		return plural(int(offset/time.Hour), "hour")
+	}
+	return plural(int(offset/time.Minute), "minute")
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxReviewLength = 2000
+
+type ReviewService struct {
+	DB *gorm.DB
+}
+
+// PublicReview is a review as patients browsing a therapist see it
+type PublicReview struct {
+	ID          uuid.UUID  `json:"id"`
+	Rating      int        `json:"rating"`
+	Comment     string     `json:"comment"`
+	PatientName string     `json:"patient_name"`
+	IsAnonymous bool       `json:"is_anonymous"`
+	Reply       string     `json:"reply"`
+	RepliedAt   *time.Time `json:"replied_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// SubmitReview rates a completed appointment of the patient, each appointment is reviewed once
+func (service *ReviewService) SubmitReview(patientID, appointmentID uuid.UUID, rating int, comment string, anonymous bool) (*models.Review, *apierror.ApiError) {
+	comment = strings.TrimSpace(comment)
+	if rating < 1 || rating > 5 || len(comment) > maxReviewLength {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A review has a rating from 1 to 5 and a comment of at most 2000 characters").
+			Build()
+	}
+
+	var review models.Review
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		var appointment models.Appointment
+		if err := tx.Where("id = ? AND user_id = ?", appointmentID, patientID).First(&appointment).Error; err != nil {
+			return err
+		}
+		if appointment.Status != models.Completed {
+			return ErrInvalidStatusTransition
+		}
+
+		now := time.Now()
+		review = models.Review{
+			ID:            uuid.New(),
+			AppointmentID: appointment.ID,
+			PatientID:     patientID,
+			TherapistID:   appointment.TherapistID,
+			Rating:        rating,
+			Comment:       comment,
+			IsAnonymous:   anonymous,
+			Status:        models.ReviewPublished,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return refreshTherapistRating(tx, appointment.TherapistID)
+	})
+	switch {
+	case err == nil:
+		return &review, nil
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Appointment not found").
+			Build()
+	case errors.Is(err, ErrInvalidStatusTransition):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("Only completed appointments can be reviewed").
+			Build()
+	case isUniqueViolation(err):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("The appointment has already been reviewed").
+			Build()
+	default:
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save review").
+			Build()
+	}
+}
+
+// GetPatientReviews lists the reviews the patient wrote, hidden ones included, newest first
+func (service *ReviewService) GetPatientReviews(patientID uuid.UUID) ([]models.Review, *apierror.ApiError) {
+	var reviews []models.Review
+	if err := service.DB.Where("patient_id = ?", patientID).Order("created_at desc").Find(&reviews).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve reviews").
+			Build()
+	}
+	return reviews, nil
+}
+
+// GetTherapistReviews lists a page of the therapist's published reviews, newest first, with the
+// total number of published reviews
+func (service *ReviewService) GetTherapistReviews(therapistID uuid.UUID, page, pageSize int) ([]PublicReview, int64, *apierror.ApiError) {
+	failed := apierror.NewApiErrorBuilder().
+		WithStatus(http.StatusInternalServerError).
+		WithMessage("Failed to retrieve reviews").
+		Build()
+
+	query := service.DB.Model(&models.Review{}).
+		Where("therapist_id = ? AND status = ?", therapistID, models.ReviewPublished)
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, failed
+	}
+
+	var reviews []models.Review
+	err := query.Preload("Patient", func(db *gorm.DB) *gorm.DB {
+		return db.Select("id, name")
+	}).
+		Order("created_at desc").
+		Limit(pageSize).
+		Offset((page - 1) * pageSize).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, 0, failed
+	}
+
+	result := make([]PublicReview, len(reviews))
+	for i, review := range reviews {
+		result[i] = PublicReview{
+			ID:          review.ID,
+			Rating:      review.Rating,
+			Comment:     review.Comment,
+			PatientName: review.Patient.Name,
+			IsAnonymous: review.IsAnonymous,
+			Reply:       review.Reply,
+			RepliedAt:   review.RepliedAt,
+			CreatedAt:   review.CreatedAt,
+		}
+		if review.IsAnonymous {
+			result[i].PatientName = "Anonymous"
+		}
+	}
+	return result, total, nil
+}
+
+// ReplyToReview sets the therapist's public reply to one of their reviews, replying again
+// replaces it and an empty reply removes it
+func (service *ReviewService) ReplyToReview(therapistID, reviewID uuid.UUID, reply string) (*models.Review, *apierror.ApiError) {
+	reply = strings.TrimSpace(reply)
+	if len(reply) > maxReviewLength {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A reply has at most 2000 characters").
+			Build()
+	}
+
+	var review models.Review
+	if err := service.DB.Where("id = ? AND therapist_id = ?", reviewID, therapistID).First(&review).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Review not found").
+			Build()
+	}
+
+	now := time.Now()
+	review.Reply = reply
+	review.RepliedAt = &now
+	if reply == "" {
+		review.RepliedAt = nil
+	}
+	review.UpdatedAt = now
+	err := service.DB.Model(&review).UpdateColumns(map[string]interface{}{
+		"reply":      review.Reply,
+		"replied_at": review.RepliedAt,
+		"updated_at": review.UpdatedAt,
+	}).Error
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save reply").
+			Build()
+	}
+	return &review, nil
+}
+
+// GetReviews lists reviews for admins newest first, optionally only those with the given status
+func (service *ReviewService) GetReviews(status models.ReviewStatus) ([]models.Review, *apierror.ApiError) {
+	var reviews []models.Review
+	query := service.DB.Order("created_at desc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&reviews).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve reviews").
+			Build()
+	}
+	return reviews, nil
+}
+
+// ModerateReview hides a review or publishes it again, the therapist's rating follows
+func (service *ReviewService) ModerateReview(adminID, reviewID uuid.UUID, status models.ReviewStatus, reason string) (*models.Review, *apierror.ApiError) {
+	var review models.Review
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&review, "id = ?", reviewID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		review.Status = status
+		review.ModerationReason = strings.TrimSpace(reason)
+		review.ModeratedBy = &adminID
+		review.ModeratedAt = &now
+		review.UpdatedAt = now
+		err := tx.Model(&review).UpdateColumns(map[string]interface{}{
+			"status":            review.Status,
+			"moderation_reason": review.ModerationReason,
+			"moderated_by":      review.ModeratedBy,
+			"moderated_at":      review.ModeratedAt,
+			"updated_at":        review.UpdatedAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return refreshTherapistRating(tx, review.TherapistID)
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Review not found").
+			Build()
+	}
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to moderate review").
+			Build()
+	}
+	return &review, nil
+}
+
+// refreshTherapistRating recomputes the rating stored on the therapist from their published
+// reviews, so therapist search can sort by it. Locking the therapist first makes concurrent
+// review changes take turns, so each recomputes after the previous one committed and sees it.
+func refreshTherapistRating(tx *gorm.DB, therapistID uuid.UUID) error {
+	var therapist models.Therapist
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").Where("user_id = ?", therapistID).Find(&therapist).Error; err != nil {
+		return err
+	}
+	return tx.Exec(`
+		UPDATE therapists SET
+			rating_average = COALESCE((SELECT AVG(rating) FROM reviews WHERE therapist_id = ? AND status = ?), 0),
+			review_count = (SELECT COUNT(*) FROM reviews WHERE therapist_id = ? AND status = ?),
+			updated_at = ?
+		WHERE user_id = ?`,
+		therapistID, models.ReviewPublished, therapistID, models.ReviewPublished, time.Now(), therapistID).Error
+}
@@ -0,0 +1,845 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultSlotMinutes = 60
+	minutesPerDay      = 24 * 60
+	// Sessions may start every slotStepMinutes within the working hours
+	slotStepMinutes      = 30
+	maxMinNoticeHours    = 14 * 24
+	maxBookingWindowDays = 365
+	// Limits on a single bulk availability or time off request
+	maxExceptionDates = 400
+	maxTimeOffRanges  = 50
+	maxRepeatYears    = 5
+)
+
+// Working hours, overrides and slots are all in the platform's local time
+var scheduleLocation = loadScheduleLocation()
+
+// Therapists who never set up their week work the hours every therapist used to, 08:00-11:00 and
+// 13:00-17:00, though their sessions can now start every slotStepMinutes instead of on the hour
+var (
+	defaultWorkingWindow = models.ScheduleWindow{Start: "08:00", End: "17:00"}
+	defaultBreaks        = models.ScheduleWindows{{Start: "11:00", End: "13:00"}}
+)
+
+type ScheduleService struct {
+	DB *gorm.DB
+}
+
+type timeRange struct {
+	start time.Time
+	end   time.Time
+}
+
+// sessionSpec is how long a session runs and how much free time has to follow it
+type sessionSpec struct {
+	duration time.Duration
+	buffer   time.Duration
+}
+
+// Appointments booked without a session type are one hour without a buffer
+var defaultSession = sessionSpec{duration: defaultSlotMinutes * time.Minute}
+
+func sessionSpecFor(sessionType *models.SessionType) sessionSpec {
+	if sessionType == nil {
+		return defaultSession
+	}
+	return sessionSpec{
+		duration: time.Duration(sessionType.DurationMinutes) * time.Minute,
+		buffer:   time.Duration(sessionType.BufferMinutes) * time.Minute,
+	}
+}
+
+func appointmentSessionSpec(appointment *models.Appointment) sessionSpec {
+	if appointment.DurationMinutes <= 0 {
+		return defaultSession
+	}
+	return sessionSpec{
+		duration: time.Duration(appointment.DurationMinutes) * time.Minute,
+		buffer:   time.Duration(appointment.BufferMinutes) * time.Minute,
+	}
+}
+
+// appointmentRange is the time an appointment blocks, its buffer included
+func appointmentRange(appointment *models.Appointment) timeRange {
+	session := appointmentSessionSpec(appointment)
+	return timeRange{
+		start: appointment.AppointmentDate,
+		end:   appointment.AppointmentDate.Add(session.duration + session.buffer),
+	}
+}
+
+func (r timeRange) overlaps(other timeRange) bool {
+	return r.start.Before(other.end) && other.start.Before(r.end)
+}
+
+func loadScheduleLocation() *time.Location {
+	location, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		return time.FixedZone("WIB", 7*60*60)
+	}
+	return location
+}
+
+// LocalDay returns midnight of the given calendar date in the schedule's local time
+func LocalDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, scheduleLocation)
+}
+
+// GetWorkingHours returns the therapist's weekly hours. When none are set up the defaults are
+// returned and the second result is true.
+func (service *ScheduleService) GetWorkingHours(therapistID uuid.UUID) ([]models.WorkingHours, bool, *apierror.ApiError) {
+	var hours []models.WorkingHours
+	if err := service.DB.Where("therapist_id = ?", therapistID).Order("weekday asc, start_time asc").Find(&hours).Error; err != nil {
+		return nil, false, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve working hours").
+			Build()
+	}
+	if len(hours) > 0 {
+		return hours, false, nil
+	}
+
+	therapist, err := findTherapist(service.DB, therapistID)
+	if err != nil {
+		return nil, false, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	for weekday := time.Sunday; weekday <= time.Saturday; weekday++ {
+		for _, consultationType := range offeredTypes(therapist.Consultation) {
+			hours = append(hours, models.WorkingHours{
+				TherapistID:      therapistID,
+				Weekday:          weekday,
+				ConsultationType: consultationType,
+				StartTime:        defaultWorkingWindow.Start,
+				EndTime:          defaultWorkingWindow.End,
+				Breaks:           defaultBreaks,
+			})
+		}
+	}
+	return hours, true, nil
+}
+
+// ReplaceWorkingHours swaps the therapist's whole week for the given blocks. An empty week is
+// not allowed, therapists block time with overrides and time off instead.
+func (service *ScheduleService) ReplaceWorkingHours(therapistID uuid.UUID, hours []models.WorkingHours) ([]models.WorkingHours, *apierror.ApiError) {
+	therapist, err := findTherapist(service.DB, therapistID)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	if err := validateWorkingHours(therapist, hours); err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+
+	now := time.Now()
+	for i := range hours {
+		hours[i].ID = uuid.New()
+		hours[i].TherapistID = therapistID
+		hours[i].CreatedAt = now
+		hours[i].UpdatedAt = now
+	}
+
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("therapist_id = ?", therapistID).Delete(&models.WorkingHours{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&hours).Error
+	})
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save working hours").
+			Build()
+	}
+
+	sort.Slice(hours, func(i, j int) bool {
+		if hours[i].Weekday != hours[j].Weekday {
+			return hours[i].Weekday < hours[j].Weekday
+		}
+		return hours[i].StartTime < hours[j].StartTime
+	})
+	return hours, nil
+}
+
+// GetDateOverrides lists the therapist's date overrides between two local dates, both inclusive
+func (service *ScheduleService) GetDateOverrides(therapistID uuid.UUID, from, to time.Time) ([]models.Availability, *apierror.ApiError) {
+	var overrides []models.Availability
+	err := service.DB.Where("therapist_id = ? AND date >= ? AND date <= ?", therapistID, availabilityDate(from), availabilityDate(to)).
+		Order("date asc").Find(&overrides).Error
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve availability").
+			Build()
+	}
+	return overrides, nil
+}
+
+// SetDateOverride marks a date as unavailable, or as available with its own windows replacing
+// the weekly hours. Available without windows simply keeps the weekly hours.
+func (service *ScheduleService) SetDateOverride(therapistID uuid.UUID, date time.Time, isAvailable bool, windows models.ScheduleWindows) (*models.Availability, *apierror.ApiError) {
+	therapist, err := findTherapist(service.DB, therapistID)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	if !isAvailable && len(windows) > 0 {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Windows can only be given for available dates").
+			Build()
+	}
+	if err := validateOverrideWindows(therapist, windows); err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+
+	var availability models.Availability
+	err = service.DB.Where("therapist_id = ? AND date = ?", therapistID, availabilityDate(date)).First(&availability).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to check availability").
+			Build()
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		availability = models.Availability{
+			ID:          uuid.New(),
+			TherapistID: therapistID,
+			Date:        availabilityDate(date),
+			CreatedAt:   time.Now(),
+		}
+	}
+	availability.IsAvailable = isAvailable
+	availability.Windows = windows
+	availability.UpdatedAt = time.Now()
+
+	if err := service.DB.Save(&availability).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update availability").
+			Build()
+	}
+	return &availability, nil
+}
+
+// DeleteDateOverride puts a date back on the weekly hours
+func (service *ScheduleService) DeleteDateOverride(therapistID uuid.UUID, date time.Time) *apierror.ApiError {
+	result := service.DB.Where("therapist_id = ? AND date = ?", therapistID, availabilityDate(date)).Delete(&models.Availability{})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to delete availability").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("No override for this date").
+			Build()
+	}
+	return nil
+}
+
+// GetTimeOff lists the therapist's time off that has not ended yet
+func (service *ScheduleService) GetTimeOff(therapistID uuid.UUID) ([]models.TimeOff, *apierror.ApiError) {
+	var timeOff []models.TimeOff
+	if err := service.DB.Where("therapist_id = ? AND ends_at > ?", therapistID, time.Now()).Order("starts_at asc").Find(&timeOff).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve time off").
+			Build()
+	}
+	return timeOff, nil
+}
+
+func (service *ScheduleService) AddTimeOff(timeOff *models.TimeOff) *apierror.ApiError {
+	if !timeOff.EndsAt.After(timeOff.StartsAt) {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Time off must end after it starts").
+			Build()
+	}
+	if err := service.DB.Create(timeOff).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save time off").
+			Build()
+	}
+	return nil
+}
+
+func (service *ScheduleService) DeleteTimeOff(therapistID, timeOffID uuid.UUID) *apierror.ApiError {
+	result := service.DB.Where("id = ? AND therapist_id = ?", timeOffID, therapistID).Delete(&models.TimeOff{})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to delete time off").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Time off not found").
+			Build()
+	}
+	return nil
+}
+
+// UpdateBookingSettings sets how short notice and how far ahead patients may book
+func (service *ScheduleService) UpdateBookingSettings(therapistID uuid.UUID, minNoticeHours, bookingWindowDays int) *apierror.ApiError {
+	if minNoticeHours < 0 || minNoticeHours > maxMinNoticeHours {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Minimum notice must be between 0 and %d hours", maxMinNoticeHours)).
+			Build()
+	}
+	if bookingWindowDays < 1 || bookingWindowDays > maxBookingWindowDays {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Booking window must be between 1 and %d days", maxBookingWindowDays)).
+			Build()
+	}
+
+	result := service.DB.Model(&models.Therapist{}).Where("user_id = ?", therapistID).Updates(map[string]interface{}{
+		"min_notice_hours":    minNoticeHours,
+		"booking_window_days": bookingWindowDays,
+		"updated_at":          time.Now(),
+	})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update booking settings").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	return nil
+}
+
+// availableSlots derives the start times at which a session fits on a local day: weekly hours
+// or the date's override, minus breaks, time off, busy time from imported calendars and group
+// sessions, within the therapist's notice and booking window, and not overlapping another
+// appointment or its buffer
+func availableSlots(db *gorm.DB, therapistID uuid.UUID, day time.Time, consultationType models.ConsultationType, session sessionSpec) ([]time.Time, error) {
+	therapist, err := findTherapist(db, therapistID)
+	if err != nil {
+		return nil, err
+	}
+	if !offersType(therapist.Consultation, consultationType) {
+		return []time.Time{}, nil
+	}
+
+	day = LocalDay(day)
+	schedules, err := loadSchedules(db, []models.Therapist{*therapist}, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return nil, err
+	}
+	return schedules[therapist.UserID].slots(day, consultationType, session, time.Now()), nil
+}
+
+// blockedRanges lists time off, busy time from imported calendars and scheduled group sessions
+// between from and to
+func blockedRanges(db *gorm.DB, therapistID uuid.UUID, from, to time.Time) ([]timeRange, error) {
+	blocked, err := loadBlockedRanges(db, []uuid.UUID{therapistID}, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return blocked[therapistID], nil
+}
+
+// subtractRange cuts one range out of a list of ranges
+func subtractRange(ranges []timeRange, cut timeRange) []timeRange {
+	var result []timeRange
+	for _, r := range ranges {
+		if !cut.start.Before(r.end) || !cut.end.After(r.start) {
+			result = append(result, r)
+			continue
+		}
+		if cut.start.After(r.start) {
+			result = append(result, timeRange{start: r.start, end: cut.start})
+		}
+		if cut.end.Before(r.end) {
+			result = append(result, timeRange{start: cut.end, end: r.end})
+		}
+	}
+	return result
+}
+
+// windowRange places a validated "HH:MM" window on a local day
+func windowRange(day time.Time, window models.ScheduleWindow) timeRange {
+	start, _ := parseClock(window.Start)
+	end, _ := parseClock(window.End)
+	return timeRange{
+		start: day.Add(time.Duration(start) * time.Minute),
+		end:   day.Add(time.Duration(end) * time.Minute),
+	}
+}
+
+// parseClock reads "HH:MM" as minutes after midnight, "24:00" is allowed as the end of the day
+func parseClock(value string) (int, error) {
+	hourPart, minutePart, found := strings.Cut(value, ":")
+	hour, hourErr := strconv.Atoi(hourPart)
+	minute, minuteErr := strconv.Atoi(minutePart)
+	if !found || len(hourPart) != 2 || len(minutePart) != 2 || hourErr != nil || minuteErr != nil ||
+		hour < 0 || minute < 0 || minute > 59 || hour*60+minute > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q, use HH:MM", value)
+	}
+	return hour*60 + minute, nil
+}
+
+func parseWindow(window models.ScheduleWindow) (int, int, error) {
+	start, err := parseClock(window.Start)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(window.End)
+	if err != nil {
+		return 0, 0, err
+	}
+	if end <= start {
+		return 0, 0, fmt.Errorf("%s-%s must end after it starts", window.Start, window.End)
+	}
+	return start, end, nil
+}
+
+func validateWorkingHours(therapist *models.Therapist, hours []models.WorkingHours) error {
+	if len(hours) == 0 {
+		return errors.New("at least one block of working hours is required")
+	}
+
+	byDay := make(map[time.Weekday][][2]int)
+	for _, block := range hours {
+		if block.Weekday < time.Sunday || block.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d, use 0 (Sunday) to 6 (Saturday)", block.Weekday)
+		}
+		if block.ConsultationType != models.Online && block.ConsultationType != models.Offline {
+			return errors.New("working hours consultation type must be online or offline")
+		}
+		if !offersType(therapist.Consultation, block.ConsultationType) {
+			return fmt.Errorf("therapist does not offer %s consultations", block.ConsultationType)
+		}
+
+		start, end, err := parseWindow(models.ScheduleWindow{Start: block.StartTime, End: block.EndTime})
+		if err != nil {
+			return err
+		}
+		for _, pause := range block.Breaks {
+			breakStart, breakEnd, err := parseWindow(pause)
+			if err != nil {
+				return err
+			}
+			if breakStart < start || breakEnd > end {
+				return fmt.Errorf("break %s-%s is outside %s-%s", pause.Start, pause.End, block.StartTime, block.EndTime)
+			}
+		}
+
+		// A therapist cannot hold online and offline sessions at the same time
+		for _, other := range byDay[block.Weekday] {
+			if start < other[1] && other[0] < end {
+				return fmt.Errorf("working hours on weekday %d overlap", block.Weekday)
+			}
+		}
+		byDay[block.Weekday] = append(byDay[block.Weekday], [2]int{start, end})
+	}
+	return nil
+}
+
+func validateOverrideWindows(therapist *models.Therapist, windows models.ScheduleWindows) error {
+	// No windows at all would close the day while looking like the weekly hours are kept
+	if windows != nil && len(windows) == 0 {
+		return errors.New("windows must not be empty, leave them out to keep the weekly hours or mark the date unavailable")
+	}
+	var parsed [][2]int
+	for _, window := range windows {
+		if window.ConsultationType != "" {
+			if window.ConsultationType != models.Online && window.ConsultationType != models.Offline {
+				return errors.New("window consultation type must be online or offline")
+			}
+			if !offersType(therapist.Consultation, window.ConsultationType) {
+				return fmt.Errorf("therapist does not offer %s consultations", window.ConsultationType)
+			}
+		}
+		start, end, err := parseWindow(window)
+		if err != nil {
+			return err
+		}
+		for _, other := range parsed {
+			if start < other[1] && other[0] < end {
+				return errors.New("availability windows overlap")
+			}
+		}
+		parsed = append(parsed, [2]int{start, end})
+	}
+	return nil
+}
+
+// offeredTypes lists the consultation types a therapist can be booked for
+func offeredTypes(consultation models.ConsultationType) []models.ConsultationType {
+	if consultation == models.Hybrid {
+		return []models.ConsultationType{models.Online, models.Offline}
+	}
+	return []models.ConsultationType{consultation}
+}
+
+// offersType treats an empty or hybrid request as "any type"
+func offersType(consultation, requested models.ConsultationType) bool {
+	return requested == "" || requested == models.Hybrid || consultation == models.Hybrid || consultation == requested
+}
+
+func typeMatches(blockType, requested models.ConsultationType) bool {
+	return requested == "" || requested == models.Hybrid || blockType == requested
+}
+
+// Availability rows keep the date as UTC midnight, like the original date toggle did
+func availabilityDate(day time.Time) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func findTherapist(db *gorm.DB, therapistID uuid.UUID) (*models.Therapist, error) {
+	var therapist models.Therapist
+	if err := db.Where("user_id = ?", therapistID).First(&therapist).Error; err != nil {
+		return nil, err
+	}
+	return &therapist, nil
+}
+
+// AvailabilityException overrides many dates at once, e.g. leave or holidays. Every date in the
+// ranges is covered, or only the given weekdays of it, and RepeatYears repeats the same dates in
+// the following years.
+type AvailabilityException struct {
+	Ranges      []DateRange
+	Weekdays    []time.Weekday
+	RepeatYears int
+	IsAvailable bool
+	Windows     models.ScheduleWindows
+}
+
+// DateRange is an inclusive range of dates
+type DateRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// AppointmentConflict is a booked appointment that falls in time the therapist is about to block
+type AppointmentConflict struct {
+	AppointmentID    uuid.UUID                        `json:"appointment_id"`
+	PatientID        uuid.UUID                        `json:"patient_id"`
+	PatientName      string                           `json:"patient_name"`
+	AppointmentDate  time.Time                        `json:"appointment_date"`
+	DurationMinutes  int                              `json:"duration_minutes"`
+	ConsultationType models.ConsultationType          `json:"consultation_type"`
+	Status           models.AppointmentScheduleStatus `json:"status"`
+}
+
+// ApplyAvailabilityException saves an override for every date of the exception and lists the
+// booked appointments it conflicts with. A dry run only lists the conflicts. Conflicting
+// appointments are kept, the therapist reschedules or cancels them separately.
+func (service *ScheduleService) ApplyAvailabilityException(therapistID uuid.UUID, exception AvailabilityException, dryRun bool) ([]models.Availability, []AppointmentConflict, *apierror.ApiError) {
+	therapist, err := findTherapist(service.DB, therapistID)
+	if err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	if !exception.IsAvailable && len(exception.Windows) > 0 {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Windows can only be given for available dates").
+			Build()
+	}
+	if err := validateOverrideWindows(therapist, exception.Windows); err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+	dates, err := exceptionDates(exception)
+	if err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+
+	conflicts, err := service.overrideConflicts(therapistID, dates, exception)
+	if err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to check appointments").
+			Build()
+	}
+	if dryRun {
+		return nil, conflicts, nil
+	}
+
+	overrides := make([]models.Availability, 0, len(dates))
+	err = service.DB.Transaction(func(tx *gorm.DB) error {
+		var existing []models.Availability
+		if err := tx.Where("therapist_id = ? AND date IN ?", therapistID, dates).Find(&existing).Error; err != nil {
+			return err
+		}
+		byDate := make(map[string]models.Availability, len(existing))
+		for _, availability := range existing {
+			byDate[availability.Date.Format("2006-01-02")] = availability
+		}
+
+		for _, date := range dates {
+			availability, found := byDate[date.Format("2006-01-02")]
+			if !found {
+				availability = models.Availability{
+					ID:          uuid.New(),
+					TherapistID: therapistID,
+					Date:        date,
+					CreatedAt:   time.Now(),
+				}
+			}
+			availability.IsAvailable = exception.IsAvailable
+			availability.Windows = exception.Windows
+			availability.UpdatedAt = time.Now()
+			if err := tx.Save(&availability).Error; err != nil {
+				return err
+			}
+			overrides = append(overrides, availability)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to update availability").
+			Build()
+	}
+	return overrides, conflicts, nil
+}
+
+// AddTimeOffRanges saves several time off ranges at once, each repeated on the same dates for
+// repeatYears following years, and lists the booked appointments they conflict with. A dry run
+// only lists the conflicts.
+func (service *ScheduleService) AddTimeOffRanges(therapistID uuid.UUID, ranges []models.TimeOff, repeatYears int, dryRun bool) ([]models.TimeOff, []AppointmentConflict, *apierror.ApiError) {
+	if len(ranges) == 0 || len(ranges) > maxTimeOffRanges {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Give between 1 and %d time off ranges", maxTimeOffRanges)).
+			Build()
+	}
+	if repeatYears < 0 || repeatYears > maxRepeatYears {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("Exceptions can repeat for at most %d years", maxRepeatYears)).
+			Build()
+	}
+
+	var timeOff []models.TimeOff
+	for _, r := range ranges {
+		if !r.EndsAt.After(r.StartsAt) {
+			return nil, nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Time off must end after it starts").
+				Build()
+		}
+		for year := 0; year <= repeatYears; year++ {
+			timeOff = append(timeOff, models.TimeOff{
+				ID:          uuid.New(),
+				TherapistID: therapistID,
+				StartsAt:    r.StartsAt.AddDate(year, 0, 0),
+				EndsAt:      r.EndsAt.AddDate(year, 0, 0),
+				Reason:      r.Reason,
+				CreatedAt:   time.Now(),
+				UpdatedAt:   time.Now(),
+			})
+		}
+	}
+
+	var conflicts []AppointmentConflict
+	seen := make(map[uuid.UUID]bool)
+	for _, off := range timeOff {
+		blocked := timeRange{start: off.StartsAt, end: off.EndsAt}
+		found, err := findConflicts(service.DB, therapistID, off.StartsAt, off.EndsAt, func(appointment *models.Appointment) bool {
+			return appointmentRange(appointment).overlaps(blocked)
+		})
+		if err != nil {
+			return nil, nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusInternalServerError).
+				WithMessage("Failed to check appointments").
+				Build()
+		}
+		for _, conflict := range found {
+			if !seen[conflict.AppointmentID] {
+				seen[conflict.AppointmentID] = true
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	sortConflicts(conflicts)
+	if dryRun {
+		return nil, conflicts, nil
+	}
+
+	if err := service.DB.Create(&timeOff).Error; err != nil {
+		return nil, nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save time off").
+			Build()
+	}
+	return timeOff, conflicts, nil
+}
+
+// overrideConflicts finds appointments that would no longer fit the therapist's day once the
+// exception is applied: any appointment on an unavailable date, or one outside the windows
+func (service *ScheduleService) overrideConflicts(therapistID uuid.UUID, dates []time.Time, exception AvailabilityException) ([]AppointmentConflict, error) {
+	// Available dates without windows go back to the weekly hours and block nothing
+	if exception.IsAvailable && exception.Windows == nil {
+		return []AppointmentConflict{}, nil
+	}
+
+	days := make([]time.Time, len(dates))
+	for i, date := range dates {
+		days[i] = time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, scheduleLocation)
+	}
+
+	conflicts, err := findConflicts(service.DB, therapistID, days[0], days[len(days)-1].AddDate(0, 0, 1), func(appointment *models.Appointment) bool {
+		booked := appointmentRange(appointment)
+		for _, day := range days {
+			if !booked.overlaps(timeRange{start: day, end: day.AddDate(0, 0, 1)}) {
+				continue
+			}
+			if !exception.IsAvailable {
+				return true
+			}
+			fits := false
+			for _, window := range exception.Windows {
+				allowed := windowRange(day, window)
+				matches := window.ConsultationType == "" || typeMatches(window.ConsultationType, appointment.Type)
+				if matches && !booked.start.Before(allowed.start) && !appointment.AppointmentDate.Add(appointmentSessionSpec(appointment).duration).After(allowed.end) {
+					fits = true
+					break
+				}
+			}
+			return !fits
+		}
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	sortConflicts(conflicts)
+	return conflicts, nil
+}
+
+// findConflicts lists the therapist's slot holding appointments between from and to, including
+// sessions from the day before that may run into it, for which blocks returns true
+func findConflicts(db *gorm.DB, therapistID uuid.UUID, from, to time.Time, blocks func(*models.Appointment) bool) ([]AppointmentConflict, error) {
+	var appointments []models.Appointment
+	err := db.Preload("User").
+		Where("therapist_id = ? AND appointment_date >= ? AND appointment_date < ? AND status IN ?",
+			therapistID, from.AddDate(0, 0, -1), to, models.SlotHoldingStatuses).
+		Order("appointment_date").
+		Find(&appointments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	conflicts := []AppointmentConflict{}
+	for i := range appointments {
+		appointment := &appointments[i]
+		if !blocks(appointment) {
+			continue
+		}
+		conflicts = append(conflicts, AppointmentConflict{
+			AppointmentID:    appointment.ID,
+			PatientID:        appointment.UserID,
+			PatientName:      appointment.User.Name,
+			AppointmentDate:  appointment.AppointmentDate,
+			DurationMinutes:  int(appointmentSessionSpec(appointment).duration / time.Minute),
+			ConsultationType: appointment.Type,
+			Status:           appointment.Status,
+		})
+	}
+	return conflicts, nil
+}
+
+func sortConflicts(conflicts []AppointmentConflict) {
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].AppointmentDate.Before(conflicts[j].AppointmentDate)
+	})
+}
+
+// exceptionDates expands an exception into sorted, distinct dates at UTC midnight
+func exceptionDates(exception AvailabilityException) ([]time.Time, error) {
+	if len(exception.Ranges) == 0 {
+		return nil, errors.New("at least one date range is required")
+	}
+	if exception.RepeatYears < 0 || exception.RepeatYears > maxRepeatYears {
+		return nil, fmt.Errorf("exceptions can repeat for at most %d years", maxRepeatYears)
+	}
+	weekdays := make(map[time.Weekday]bool, len(exception.Weekdays))
+	for _, weekday := range exception.Weekdays {
+		if weekday < time.Sunday || weekday > time.Saturday {
+			return nil, errors.New("weekdays must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		weekdays[weekday] = true
+	}
+
+	seen := make(map[time.Time]bool)
+	var dates []time.Time
+	for _, r := range exception.Ranges {
+		from, to := availabilityDate(r.From), availabilityDate(r.To)
+		if to.Before(from) {
+			return nil, errors.New("a date range must not end before it starts")
+		}
+		for year := 0; year <= exception.RepeatYears; year++ {
+			for date := from.AddDate(year, 0, 0); !date.After(to.AddDate(year, 0, 0)); date = date.AddDate(0, 0, 1) {
+				if len(weekdays) > 0 && !weekdays[date.Weekday()] {
+					continue
+				}
+				if seen[date] {
+					continue
+				}
+				if len(dates) == maxExceptionDates {
+					return nil, fmt.Errorf("an exception can cover at most %d dates", maxExceptionDates)
+				}
+				seen[date] = true
+				dates = append(dates, date)
+			}
+		}
+	}
+	if len(dates) == 0 {
+		return nil, errors.New("the ranges do not contain any of the weekdays")
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	return dates, nil
+}
@@ -0,0 +1,31 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+)
+
+func TestValidateOverrideWindows(t *testing.T) {
+	therapist := &models.Therapist{Consultation: models.Online}
+	tests := []struct {
+		name    string
+		windows models.ScheduleWindows
+		valid   bool
+	}{
+		{"left out", nil, true},
+		{"one window", models.ScheduleWindows{{Start: "09:00", End: "12:00"}}, true},
+		{"empty", models.ScheduleWindows{}, false},
+		{"ends before it starts", models.ScheduleWindows{{Start: "12:00", End: "09:00"}}, false},
+		{"overlapping", models.ScheduleWindows{{Start: "09:00", End: "12:00"}, {Start: "11:00", End: "14:00"}}, false},
+		{"type not offered", models.ScheduleWindows{{Start: "09:00", End: "12:00", ConsultationType: models.Offline}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := validateOverrideWindows(therapist, test.windows)
+			if (err == nil) != test.valid {
+				t.Errorf("got %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"sort"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Schedules are loaded this many therapists at a time to keep the IN lists reasonable
+const scheduleBatchSize = 500
+
+// therapistSchedule is everything that decides a therapist's free slots over a range of days.
+// It is loaded for many therapists at once with a fixed number of queries, so therapist search
+// does not query per therapist and booking checks the same rules search shows.
+type therapistSchedule struct {
+	therapist models.Therapist
+	// nil when the therapist never set up their week and works the default hours
+	hours     []models.WorkingHours
+	overrides map[string]models.Availability
+	blocked   []timeRange
+	taken     []timeRange
+}
+
+// loadSchedules loads the schedules of the therapists for the local days from up to to
+func loadSchedules(db *gorm.DB, therapists []models.Therapist, from, to time.Time) (map[uuid.UUID]*therapistSchedule, error) {
+	schedules := make(map[uuid.UUID]*therapistSchedule, len(therapists))
+	now := time.Now()
+	for start := 0; start < len(therapists); start += scheduleBatchSize {
+		batch := therapists[start:min(start+scheduleBatchSize, len(therapists))]
+		ids := make([]uuid.UUID, len(batch))
+		for i := range batch {
+			ids[i] = batch[i].UserID
+			schedules[batch[i].UserID] = &therapistSchedule{
+				therapist: batch[i],
+				overrides: make(map[string]models.Availability),
+			}
+		}
+
+		var hours []models.WorkingHours
+		if err := db.Where("therapist_id IN ?", ids).Order("weekday asc, start_time asc").Find(&hours).Error; err != nil {
+			return nil, err
+		}
+		for _, block := range hours {
+			schedule := schedules[block.TherapistID]
+			schedule.hours = append(schedule.hours, block)
+		}
+
+		var overrides []models.Availability
+		if err := db.Where("therapist_id IN ? AND date >= ? AND date <= ?", ids, availabilityDate(from), availabilityDate(to)).
+			Find(&overrides).Error; err != nil {
+			return nil, err
+		}
+		for _, override := range overrides {
+			schedules[override.TherapistID].overrides[overrideKey(override.Date)] = override
+		}
+
+		blocked, err := loadBlockedRanges(db, ids, from, to)
+		if err != nil {
+			return nil, err
+		}
+		taken, err := loadTakenRanges(db, ids, from, to, now)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			schedules[id].blocked = blocked[id]
+			schedules[id].taken = taken[id]
+		}
+	}
+	return schedules, nil
+}
+
+// loadBlockedRanges lists time off, busy time from imported calendars and scheduled group
+// sessions of each therapist between from and to
+func loadBlockedRanges(db *gorm.DB, therapistIDs []uuid.UUID, from, to time.Time) (map[uuid.UUID][]timeRange, error) {
+	var timeOff []models.TimeOff
+	if err := db.Where("therapist_id IN ? AND starts_at < ? AND ends_at > ?", therapistIDs, to, from).Find(&timeOff).Error; err != nil {
+		return nil, err
+	}
+	var busy []models.ExternalBusyBlock
+	if err := db.Where("therapist_id IN ? AND starts_at < ? AND ends_at > ?", therapistIDs, to, from).Find(&busy).Error; err != nil {
+		return nil, err
+	}
+	var groupSessions []models.GroupSession
+	if err := db.Where("therapist_id IN ? AND status = ? AND starts_at < ? AND starts_at + duration_minutes * interval '1 minute' > ?",
+		therapistIDs, models.GroupSessionScheduled, to, from).Find(&groupSessions).Error; err != nil {
+		return nil, err
+	}
+
+	ranges := make(map[uuid.UUID][]timeRange)
+	for _, off := range timeOff {
+		ranges[off.TherapistID] = append(ranges[off.TherapistID], timeRange{start: off.StartsAt, end: off.EndsAt})
+	}
+	for _, block := range busy {
+		ranges[block.TherapistID] = append(ranges[block.TherapistID], timeRange{start: block.StartsAt, end: block.EndsAt})
+	}
+	for i := range groupSessions {
+		ranges[groupSessions[i].TherapistID] = append(ranges[groupSessions[i].TherapistID], groupSessionRange(&groupSessions[i]))
+	}
+	return ranges, nil
+}
+
+// loadTakenRanges lists the time each therapist's appointments and pending waitlist holds take
+// between from and to, buffers included. Sessions from the evening before can run past midnight.
+func loadTakenRanges(db *gorm.DB, therapistIDs []uuid.UUID, from, to, now time.Time) (map[uuid.UUID][]timeRange, error) {
+	var appointments []models.Appointment
+	if err := db.Where("therapist_id IN ? AND appointment_date >= ? AND appointment_date < ? AND status IN ?",
+		therapistIDs, from.AddDate(0, 0, -1), to, models.SlotHoldingStatuses).Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+	// Slots held for a waitlisted patient are taken until the hold expires
+	var offers []models.WaitlistOffer
+	if err := db.Where("therapist_id IN ? AND slot_start >= ? AND slot_start < ? AND status = ? AND expires_at > ?",
+		therapistIDs, from.AddDate(0, 0, -1), to, models.OfferPending, now).Find(&offers).Error; err != nil {
+		return nil, err
+	}
+
+	ranges := make(map[uuid.UUID][]timeRange)
+	for i := range appointments {
+		ranges[appointments[i].TherapistID] = append(ranges[appointments[i].TherapistID], appointmentRange(&appointments[i]))
+	}
+	for _, offer := range offers {
+		ranges[offer.TherapistID] = append(ranges[offer.TherapistID], timeRange{
+			start: offer.SlotStart,
+			end:   offer.SlotStart.Add(time.Duration(offer.DurationMinutes+offer.BufferMinutes) * time.Minute),
+		})
+	}
+	return ranges, nil
+}
+
+// slots lists the free session starts on a local day within the loaded range
+func (schedule *therapistSchedule) slots(day time.Time, consultationType models.ConsultationType, session sessionSpec, now time.Time) []time.Time {
+	therapist := &schedule.therapist
+	if !offersType(therapist.Consultation, consultationType) {
+		return []time.Time{}
+	}
+
+	day = LocalDay(day)
+	ranges := schedule.workingRanges(day, consultationType)
+	for _, r := range schedule.blocked {
+		ranges = subtractRange(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return []time.Time{}
+	}
+
+	earliest := now.Add(time.Duration(therapist.MinNoticeHours) * time.Hour)
+	latest := LocalDay(now.In(scheduleLocation)).AddDate(0, 0, therapist.BookingWindowDays+1)
+
+	seen := make(map[int64]bool)
+	var slots []time.Time
+	step := slotStepMinutes * time.Minute
+	for _, r := range ranges {
+		for start := r.start; !start.Add(session.duration).After(r.end); start = start.Add(step) {
+			if start.After(now) && !start.Before(earliest) && start.Before(latest) && !seen[start.Unix()] {
+				seen[start.Unix()] = true
+				slots = append(slots, start)
+			}
+		}
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].Before(slots[j]) })
+	return filterAvailableSlots(slots, session, schedule.taken)
+}
+
+// nextSlot is the first free session start from now on within days local days, or nil
+func (schedule *therapistSchedule) nextSlot(consultationType models.ConsultationType, session sessionSpec, now time.Time, days int) *time.Time {
+	today := LocalDay(now.In(scheduleLocation))
+	for i := 0; i < days; i++ {
+		if slots := schedule.slots(today.AddDate(0, 0, i), consultationType, session, now); len(slots) > 0 {
+			return &slots[0]
+		}
+	}
+	return nil
+}
+
+// workingRanges turns the day's override or weekly hours into absolute ranges with breaks removed
+func (schedule *therapistSchedule) workingRanges(day time.Time, consultationType models.ConsultationType) []timeRange {
+	if override, ok := schedule.overrides[overrideKey(availabilityDate(day))]; ok {
+		if !override.IsAvailable {
+			return nil
+		}
+		if override.Windows != nil {
+			var ranges []timeRange
+			for _, window := range override.Windows {
+				if window.ConsultationType == "" || typeMatches(window.ConsultationType, consultationType) {
+					ranges = append(ranges, windowRange(day, window))
+				}
+			}
+			return ranges
+		}
+	}
+
+	hours := []models.WorkingHours{{
+		StartTime: defaultWorkingWindow.Start,
+		EndTime:   defaultWorkingWindow.End,
+		Breaks:    defaultBreaks,
+	}}
+	if schedule.hours != nil {
+		hours = nil
+		for _, block := range schedule.hours {
+			if block.Weekday == day.Weekday() {
+				hours = append(hours, block)
+			}
+		}
+	}
+
+	var ranges []timeRange
+	for _, block := range hours {
+		if block.ConsultationType != "" && !typeMatches(block.ConsultationType, consultationType) {
+			continue
+		}
+		blockRanges := []timeRange{windowRange(day, models.ScheduleWindow{Start: block.StartTime, End: block.EndTime})}
+		for _, pause := range block.Breaks {
+			blockRanges = subtractRange(blockRanges, windowRange(day, pause))
+		}
+		ranges = append(ranges, blockRanges...)
+	}
+	return ranges
+}
+
+// overrideKey identifies the date of an availability row however the driver returns it
+func overrideKey(date time.Time) string {
+	return date.UTC().Format("2006-01-02")
+}
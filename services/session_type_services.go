@@ -0,0 +1,138 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	minSessionMinutes = 15
+	maxSessionMinutes = 240
+	maxBufferMinutes  = 120
+)
+
+var ErrSessionTypeNotFound = errors.New("session type not found")
+
+type SessionTypeService struct {
+	DB *gorm.DB
+}
+
+// GetSessionTypes lists a therapist's session types, inactive ones only when asked for
+func (service *SessionTypeService) GetSessionTypes(therapistID uuid.UUID, includeInactive bool) ([]models.SessionType, *apierror.ApiError) {
+	var sessionTypes []models.SessionType
+	query := service.DB.Where("therapist_id = ?", therapistID)
+	if !includeInactive {
+		query = query.Where("is_active")
+	}
+	if err := query.Order("duration_minutes asc, name asc").Find(&sessionTypes).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve session types").
+			Build()
+	}
+	return sessionTypes, nil
+}
+
+func (service *SessionTypeService) GetSessionType(therapistID, sessionTypeID uuid.UUID) (*models.SessionType, *apierror.ApiError) {
+	var sessionType models.SessionType
+	if err := service.DB.Where("id = ? AND therapist_id = ?", sessionTypeID, therapistID).First(&sessionType).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Session type not found").
+			Build()
+	}
+	return &sessionType, nil
+}
+
+// SaveSessionType validates and creates or updates a session type. Appointments keep the
+// duration, buffer and price they were booked with.
+func (service *SessionTypeService) SaveSessionType(sessionType *models.SessionType) *apierror.ApiError {
+	therapist, err := findTherapist(service.DB, sessionType.TherapistID)
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	if err := validateSessionType(therapist, sessionType); err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(err.Error()).
+			Build()
+	}
+
+	if err := service.DB.Save(sessionType).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to save session type").
+			Build()
+	}
+	return nil
+}
+
+// DeactivateSessionType stops a session type from being booked, it stays on past appointments
+func (service *SessionTypeService) DeactivateSessionType(therapistID, sessionTypeID uuid.UUID) *apierror.ApiError {
+	result := service.DB.Model(&models.SessionType{}).Where("id = ? AND therapist_id = ?", sessionTypeID, therapistID).
+		Updates(map[string]interface{}{"is_active": false, "updated_at": time.Now()})
+	if result.Error != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to deactivate session type").
+			Build()
+	}
+	if result.RowsAffected == 0 {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Session type not found").
+			Build()
+	}
+	return nil
+}
+
+// findSessionType loads an active session type of the therapist that can be held as the
+// requested consultation type
+func findSessionType(db *gorm.DB, therapistID, sessionTypeID uuid.UUID, consultationType models.ConsultationType) (*models.SessionType, error) {
+	var sessionType models.SessionType
+	err := db.Where("id = ? AND therapist_id = ? AND is_active", sessionTypeID, therapistID).First(&sessionType).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSessionTypeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !offersType(sessionType.ConsultationType, consultationType) {
+		return nil, ErrInvalidConsultationType
+	}
+	return &sessionType, nil
+}
+
+func validateSessionType(therapist *models.Therapist, sessionType *models.SessionType) error {
+	if sessionType.Name == "" {
+		return errors.New("session type name is required")
+	}
+	switch sessionType.ConsultationType {
+	case models.Online, models.Offline, models.Hybrid:
+	default:
+		return errors.New("consultation type must be online, offline or hybrid")
+	}
+	if therapist.Consultation != models.Hybrid && sessionType.ConsultationType != therapist.Consultation {
+		return fmt.Errorf("therapist does not offer %s consultations", sessionType.ConsultationType)
+	}
+	if sessionType.DurationMinutes < minSessionMinutes || sessionType.DurationMinutes > maxSessionMinutes || sessionType.DurationMinutes%5 != 0 {
+		return fmt.Errorf("duration must be a multiple of 5 between %d and %d minutes", minSessionMinutes, maxSessionMinutes)
+	}
+	if sessionType.BufferMinutes < 0 || sessionType.BufferMinutes > maxBufferMinutes {
+		return fmt.Errorf("buffer must be between 0 and %d minutes", maxBufferMinutes)
+	}
+	if sessionType.Price < 0 {
+		return errors.New("price cannot be negative")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const maxTermNameLength = 100
+
+var ErrInvalidTerm = errors.New("unknown or inactive specialization or approach")
+
+type TaxonomyService struct {
+	DB *gorm.DB
+}
+
+// GetTerms lists the terms by name, optionally of one kind. Patients and therapists only see
+// active terms, admins may include the deactivated ones.
+func (service *TaxonomyService) GetTerms(kind models.TaxonomyKind, includeInactive bool) ([]models.TaxonomyTerm, *apierror.ApiError) {
+	var terms []models.TaxonomyTerm
+	query := service.DB.Order("kind asc, name asc")
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if !includeInactive {
+		query = query.Where("is_active = ?", true)
+	}
+	if err := query.Find(&terms).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve terms").
+			Build()
+	}
+	return terms, nil
+}
+
+// CreateTerm adds a specialization or approach therapists can pick
+func (service *TaxonomyService) CreateTerm(kind models.TaxonomyKind, name string) (*models.TaxonomyTerm, *apierror.ApiError) {
+	name = strings.TrimSpace(name)
+	if apiErr := validateTerm(kind, name); apiErr != nil {
+		return nil, apiErr
+	}
+
+	now := time.Now()
+	term := models.TaxonomyTerm{ID: uuid.New(), Kind: kind, Name: name, IsActive: true, CreatedAt: now, UpdatedAt: now}
+	if err := service.DB.Create(&term).Error; err != nil {
+		return nil, termSaveError(err)
+	}
+	return &term, nil
+}
+
+// UpdateTerm renames a term or (de)activates it. Renaming changes it on every profile using it.
+func (service *TaxonomyService) UpdateTerm(termID uuid.UUID, name *string, isActive *bool) (*models.TaxonomyTerm, *apierror.ApiError) {
+	var term models.TaxonomyTerm
+	if err := service.DB.First(&term, "id = ?", termID).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Term not found").
+			Build()
+	}
+
+	if name != nil {
+		term.Name = strings.TrimSpace(*name)
+		if apiErr := validateTerm(term.Kind, term.Name); apiErr != nil {
+			return nil, apiErr
+		}
+	}
+	if isActive != nil {
+		term.IsActive = *isActive
+	}
+	term.UpdatedAt = time.Now()
+	if err := service.DB.Save(&term).Error; err != nil {
+		return nil, termSaveError(err)
+	}
+	return &term, nil
+}
+
+func validateTerm(kind models.TaxonomyKind, name string) *apierror.ApiError {
+	if (kind != models.KindSpecialization && kind != models.KindApproach) || name == "" || len(name) > maxTermNameLength {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A term is a specialization or an approach with a name of at most 100 characters").
+			Build()
+	}
+	return nil
+}
+
+func termSaveError(err error) *apierror.ApiError {
+	if isUniqueViolation(err) {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("A term with this name already exists").
+			Build()
+	}
+	return apierror.NewApiErrorBuilder().
+		WithStatus(http.StatusInternalServerError).
+		WithMessage("Failed to save term").
+		Build()
+}
+
+// checkTerms makes sure every ID is an active term of the kind
+func checkTerms(db *gorm.DB, kind models.TaxonomyKind, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	err := db.Model(&models.TaxonomyTerm{}).
+		Where("id IN ? AND kind = ? AND is_active = ?", ids, kind, true).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return ErrInvalidTerm
+	}
+	return nil
+}
+
+// therapistTerms loads the terms on the therapist's profile by name
+func therapistTerms(db *gorm.DB, therapistID uuid.UUID) ([]models.TaxonomyTerm, error) {
+	var terms []models.TaxonomyTerm
+	err := db.Joins("JOIN therapist_taxonomy_terms ON therapist_taxonomy_terms.taxonomy_term_id = taxonomy_terms.id").
+		Where("therapist_taxonomy_terms.therapist_id = ?", therapistID).
+		Order("taxonomy_terms.name asc").
+		Find(&terms).Error
+	return terms, err
+}
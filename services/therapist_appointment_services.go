@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAppointmentStarted    = errors.New("appointment has already started")
+	ErrAppointmentNotStarted = errors.New("appointment has not started yet")
+	ErrSessionNotOpen        = errors.New("session can only be started around its scheduled time")
+	ErrSessionNotHeld        = errors.New("session has not been held")
+)
+
+// DeclineByTherapist cancels a booking for its therapist before it starts. Whatever the patient
+// paid is refunded in full, the freed slot goes to the waitlist on its next run.
+func (service *AppointmentService) DeclineByTherapist(appointmentID, therapistID uuid.UUID, reason string) (*models.Appointment, *models.Refund, error) {
+	var refund *models.Refund
+	if reason == "" {
+		reason = "declined_by_therapist"
+	}
+	appointment, err := service.therapistTransition(appointmentID, therapistID, models.CancelledByTherapist, reason, func(appointment *models.Appointment, now time.Time) error {
+		if !now.Before(appointment.AppointmentDate) {
+			return ErrAppointmentStarted
+		}
+		return nil
+	}, func(tx *gorm.DB, appointment *models.Appointment) error {
+		if appointment.PaymentStatus != models.MidtransStatusSuccess {
+			return nil
+		}
+		var err error
+		refund, err = createRefund(tx, appointment, appointment.Price, 100, "declined_by_therapist")
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := fmt.Sprintf("Your %s session with %s on %s was declined by the therapist.",
+		appointment.Type, appointment.Therapist.Name, formatAppointmentTime(appointment))
+	if refund != nil {
+		message += fmt.Sprintf(" A full refund of Rp%d is on its way.", refund.Amount)
+	}
+	service.notifyPatient(appointment, message)
+	return appointment, refund, nil
+}
+
+// StartSession puts a confirmed appointment in session, from when its meeting room opens until
+// its scheduled end
+func (service *AppointmentService) StartSession(appointmentID, therapistID uuid.UUID) (*models.Appointment, error) {
+	appointment, err := service.therapistTransition(appointmentID, therapistID, models.InSession, "session_started", func(appointment *models.Appointment, now time.Time) error {
+		opensAt := appointment.AppointmentDate.Add(-time.Duration(config.Env.MeetingJoinLeadMinutes) * time.Minute)
+		endsAt := appointment.AppointmentDate.Add(time.Duration(appointment.DurationMinutes) * time.Minute)
+		if now.Before(opensAt) || !now.Before(endsAt) {
+			return ErrSessionNotOpen
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	message := fmt.Sprintf("%s has started your session.", appointment.Therapist.Name)
+	if appointment.Type == models.Online {
+		message += " Join it now: " + appointmentLink(appointment)
+	}
+	service.notifyPatient(appointment, message)
+	return appointment, nil
+}
+
+// CompleteSession ends a session that is in progress
+func (service *AppointmentService) CompleteSession(appointmentID, therapistID uuid.UUID) (*models.Appointment, error) {
+	appointment, err := service.therapistTransition(appointmentID, therapistID, models.Completed, "session_completed", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	service.notifyPatient(appointment, fmt.Sprintf("Your session with %s is complete. Thank you for trusting Hand.", appointment.Therapist.Name))
+	return appointment, nil
+}
+
+// MarkNoShow records that the patient did not come to a confirmed appointment, only once it
+// has started. Nothing is refunded.
+func (service *AppointmentService) MarkNoShow(appointmentID, therapistID uuid.UUID) (*models.Appointment, error) {
+	appointment, err := service.therapistTransition(appointmentID, therapistID, models.NoShow, "patient_no_show", func(appointment *models.Appointment, now time.Time) error {
+		if now.Before(appointment.AppointmentDate) {
+			return ErrAppointmentNotStarted
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	service.notifyPatient(appointment, fmt.Sprintf("You were marked as absent from your session with %s on %s. Please contact your therapist if this is a mistake.",
+		appointment.Therapist.Name, formatAppointmentTime(appointment)))
+	return appointment, nil
+}
+
+// RecordConsultation saves the conclusion and prescriptions of one of the therapist's sessions,
+// once it is in progress or completed
+func (service *AppointmentService) RecordConsultation(appointmentID, therapistID uuid.UUID, history *models.ConsultationHistory, prescriptions []models.Prescription) error {
+	return service.DB.Transaction(func(tx *gorm.DB) error {
+		appointment, err := lockAppointment(tx, appointmentID)
+		if err != nil {
+			return err
+		}
+		if appointment.TherapistID != therapistID {
+			return gorm.ErrRecordNotFound
+		}
+		if appointment.Status != models.InSession && appointment.Status != models.Completed {
+			return fmt.Errorf("%w: appointment is %s", ErrSessionNotHeld, appointment.Status)
+		}
+
+		history.AppointmentID = appointment.ID
+		if err := tx.Create(history).Error; err != nil {
+			return err
+		}
+		for i := range prescriptions {
+			prescriptions[i].ConsultationHistoryID = history.ID
+			if err := tx.Create(&prescriptions[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// therapistTransition moves one of the therapist's appointments to another status. check can
+// refuse the change before it is made, after runs in the same transaction once it is made.
+func (service *AppointmentService) therapistTransition(appointmentID, therapistID uuid.UUID, to models.AppointmentScheduleStatus, reason string,
+	check func(appointment *models.Appointment, now time.Time) error, after func(tx *gorm.DB, appointment *models.Appointment) error) (*models.Appointment, error) {
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		appointment, err := lockAppointment(tx, appointmentID)
+		if err != nil {
+			return err
+		}
+		if appointment.TherapistID != therapistID {
+			return gorm.ErrRecordNotFound
+		}
+		if !appointment.Status.CanTransitionTo(to) {
+			return fmt.Errorf("%w: %s to %s", ErrInvalidStatusTransition, appointment.Status, to)
+		}
+		if check != nil {
+			if err := check(appointment, time.Now()); err != nil {
+				return err
+			}
+		}
+		if err := transitionStatus(tx, appointment, to, &therapistID, reason); err != nil {
+			return err
+		}
+		if after != nil {
+			return after(tx, appointment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return service.GetAppointmentDetails(appointmentID)
+}
+
+// notifyPatient sends a message about the appointment to its patient, failures are only logged
+// since the change itself already happened
+func (service *AppointmentService) notifyPatient(appointment *models.Appointment, message string) {
+	if service.Sender == nil || appointment.User.PhoneNumber == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	if err := service.Sender.Send(ctx, appointment.User.PhoneNumber, message); err != nil {
+		log.Printf("Failed to notify the patient of appointment %s: %v", appointment.ID, err)
+	}
+}
+
+func formatAppointmentTime(appointment *models.Appointment) string {
+	return appointment.AppointmentDate.In(scheduleLocation).Format("Mon 2 Jan 2006 at 15:04 MST")
+}
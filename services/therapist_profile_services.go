@@ -0,0 +1,375 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxBioLength          = 5000
+	maxProfileTerms       = 10
+	maxProfileCredentials = 20
+	maxYearsOfExperience  = 70
+)
+
+var ErrRevisionNotPending = errors.New("profile revision has already been reviewed")
+
+type TherapistProfileService struct {
+	DB *gorm.DB
+}
+
+// TherapistProfileView is a therapist's approved profile with their terms spelled out and the
+// rate they charge for each kind of session
+type TherapistProfileView struct {
+	Bio               string                `json:"bio"`
+	Specializations   []models.TaxonomyTerm `json:"specializations"`
+	Approaches        []models.TaxonomyTerm `json:"approaches"`
+	Languages         models.Languages      `json:"languages"`
+	Education         models.Credentials    `json:"education"`
+	Certifications    models.Credentials    `json:"certifications"`
+	YearsOfExperience int                   `json:"years_of_experience"`
+	OnlineRate        int64                 `json:"online_rate"`
+	OfflineRate       int64                 `json:"offline_rate"`
+}
+
+// GetProfile returns the therapist's approved profile
+func (service *TherapistProfileService) GetProfile(therapistID uuid.UUID) (*TherapistProfileView, *apierror.ApiError) {
+	var therapist models.Therapist
+	if err := service.DB.Where("user_id = ?", therapistID).First(&therapist).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	terms, err := therapistTerms(service.DB, therapistID)
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve profile").
+			Build()
+	}
+
+	view := &TherapistProfileView{
+		Bio:               therapist.Bio,
+		Specializations:   []models.TaxonomyTerm{},
+		Approaches:        []models.TaxonomyTerm{},
+		Languages:         therapist.Languages,
+		Education:         therapist.Education,
+		Certifications:    therapist.Certifications,
+		YearsOfExperience: therapist.YearsOfExperience,
+		OnlineRate:        therapist.RateFor(models.Online),
+		OfflineRate:       therapist.RateFor(models.Offline),
+	}
+	for _, term := range terms {
+		if term.Kind == models.KindSpecialization {
+			view.Specializations = append(view.Specializations, term)
+		} else {
+			view.Approaches = append(view.Approaches, term)
+		}
+	}
+	return view, nil
+}
+
+// GetLatestRevision returns the therapist's most recent profile revision, nil when they never
+// submitted one
+func (service *TherapistProfileService) GetLatestRevision(therapistID uuid.UUID) (*models.TherapistProfileRevision, *apierror.ApiError) {
+	var revision models.TherapistProfileRevision
+	err := service.DB.Where("therapist_id = ?", therapistID).Order("created_at desc").First(&revision).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve profile revision").
+			Build()
+	}
+	return &revision, nil
+}
+
+// SubmitRevision proposes a new profile for admin review, replacing a revision still pending
+func (service *TherapistProfileService) SubmitRevision(therapistID uuid.UUID, profile models.TherapistProfile) (*models.TherapistProfileRevision, *apierror.ApiError) {
+	profile, apiErr := normalizeProfile(profile)
+	if apiErr != nil {
+		return nil, apiErr
+	}
+
+	var revision models.TherapistProfileRevision
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := checkTerms(tx, models.KindSpecialization, profile.SpecializationIDs); err != nil {
+			return err
+		}
+		if err := checkTerms(tx, models.KindApproach, profile.ApproachIDs); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("therapist_id = ? AND status = ?", therapistID, models.RevisionPending).
+			First(&revision).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			revision = models.TherapistProfileRevision{
+				ID:          uuid.New(),
+				TherapistID: therapistID,
+				Profile:     profile,
+				Status:      models.RevisionPending,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			return tx.Create(&revision).Error
+		}
+		if err != nil {
+			return err
+		}
+		revision.Profile = profile
+		revision.UpdatedAt = now
+		return tx.Model(&revision).UpdateColumns(map[string]interface{}{
+			"profile":    revision.Profile,
+			"updated_at": revision.UpdatedAt,
+		}).Error
+	})
+	switch {
+	case err == nil:
+		return &revision, nil
+	case errors.Is(err, ErrInvalidTerm):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Pick specializations and approaches from the offered ones").
+			Build()
+	case isUniqueViolation(err):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("Another profile change was submitted at the same time").
+			Build()
+	default:
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to submit profile").
+			Build()
+	}
+}
+
+// GetRevisions lists profile revisions for admins, oldest first so the queue is worked in order
+func (service *TherapistProfileService) GetRevisions(status models.ProfileRevisionStatus) ([]models.TherapistProfileRevision, *apierror.ApiError) {
+	var revisions []models.TherapistProfileRevision
+	query := service.DB.Order("created_at asc")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&revisions).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve profile revisions").
+			Build()
+	}
+	return revisions, nil
+}
+
+// ApproveRevision publishes a pending revision on the therapist's profile
+func (service *TherapistProfileService) ApproveRevision(adminID, revisionID uuid.UUID) (*models.TherapistProfileRevision, *apierror.ApiError) {
+	var revision models.TherapistProfileRevision
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingRevision(tx, revisionID, &revision); err != nil {
+			return err
+		}
+		// Terms may have been deactivated while the revision waited
+		profile := revision.Profile
+		if err := checkTerms(tx, models.KindSpecialization, profile.SpecializationIDs); err != nil {
+			return err
+		}
+		if err := checkTerms(tx, models.KindApproach, profile.ApproachIDs); err != nil {
+			return err
+		}
+		if err := applyProfile(tx, revision.TherapistID, profile); err != nil {
+			return err
+		}
+		return reviewRevision(tx, &revision, adminID, models.RevisionApproved, "")
+	})
+	switch {
+	case err == nil:
+		return &revision, nil
+	case errors.Is(err, ErrInvalidTerm):
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("The revision uses a specialization or approach that is no longer offered").
+			Build()
+	default:
+		return nil, revisionReviewError(err)
+	}
+}
+
+// RejectRevision turns down a pending revision, the therapist sees the reason
+func (service *TherapistProfileService) RejectRevision(adminID, revisionID uuid.UUID, reason string) (*models.TherapistProfileRevision, *apierror.ApiError) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("A rejection needs a reason").
+			Build()
+	}
+
+	var revision models.TherapistProfileRevision
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockPendingRevision(tx, revisionID, &revision); err != nil {
+			return err
+		}
+		return reviewRevision(tx, &revision, adminID, models.RevisionRejected, reason)
+	})
+	if err != nil {
+		return nil, revisionReviewError(err)
+	}
+	return &revision, nil
+}
+
+func lockPendingRevision(tx *gorm.DB, revisionID uuid.UUID, revision *models.TherapistProfileRevision) error {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(revision, "id = ?", revisionID).Error; err != nil {
+		return err
+	}
+	if revision.Status != models.RevisionPending {
+		return ErrRevisionNotPending
+	}
+	return nil
+}
+
+func reviewRevision(tx *gorm.DB, revision *models.TherapistProfileRevision, adminID uuid.UUID, status models.ProfileRevisionStatus, reason string) error {
+	now := time.Now()
+	revision.Status = status
+	revision.ReviewedBy = &adminID
+	revision.ReviewedAt = &now
+	revision.RejectionReason = reason
+	revision.UpdatedAt = now
+	return tx.Model(revision).UpdateColumns(map[string]interface{}{
+		"status":           revision.Status,
+		"reviewed_by":      revision.ReviewedBy,
+		"reviewed_at":      revision.ReviewedAt,
+		"rejection_reason": revision.RejectionReason,
+		"updated_at":       revision.UpdatedAt,
+	}).Error
+}
+
+func revisionReviewError(err error) *apierror.ApiError {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Profile revision not found").
+			Build()
+	case errors.Is(err, ErrRevisionNotPending):
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusConflict).
+			WithMessage("The profile revision has already been reviewed").
+			Build()
+	default:
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to review profile revision").
+			Build()
+	}
+}
+
+// applyProfile writes an approved profile to the therapist and their terms. The specialization
+// text shown in listings and matched by search becomes the names of the picked specializations.
+func applyProfile(tx *gorm.DB, therapistID uuid.UUID, profile models.TherapistProfile) error {
+	updates := map[string]interface{}{
+		"bio":                 profile.Bio,
+		"languages":           profile.Languages,
+		"education":           profile.Education,
+		"certifications":      profile.Certifications,
+		"years_of_experience": profile.YearsOfExperience,
+		"online_rate":         profile.OnlineRate,
+		"offline_rate":        profile.OfflineRate,
+		"updated_at":          time.Now(),
+	}
+	// A profile without specializations clears the text rather than keeping the old ones
+	var names []string
+	if len(profile.SpecializationIDs) > 0 {
+		err := tx.Model(&models.TaxonomyTerm{}).
+			Where("id IN ?", profile.SpecializationIDs).
+			Order("name asc").
+			Pluck("name", &names).Error
+		if err != nil {
+			return err
+		}
+	}
+	updates["specialization"] = strings.Join(names, ", ")
+	if err := tx.Model(&models.Therapist{}).Where("user_id = ?", therapistID).UpdateColumns(updates).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("therapist_id = ?", therapistID).Delete(&models.TherapistTaxonomyTerm{}).Error; err != nil {
+		return err
+	}
+	for _, termID := range append(profile.SpecializationIDs, profile.ApproachIDs...) {
+		link := models.TherapistTaxonomyTerm{TherapistID: therapistID, TaxonomyTermID: termID}
+		if err := tx.Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeProfile trims and deduplicates a submitted profile and checks its limits
+func normalizeProfile(profile models.TherapistProfile) (models.TherapistProfile, *apierror.ApiError) {
+	invalid := func(message string) (models.TherapistProfile, *apierror.ApiError) {
+		return profile, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(message).
+			Build()
+	}
+
+	profile.Bio = strings.TrimSpace(profile.Bio)
+	profile.SpecializationIDs = uniqueIDs(profile.SpecializationIDs)
+	profile.ApproachIDs = uniqueIDs(profile.ApproachIDs)
+	profile.Languages = NormalizeLanguages(profile.Languages)
+	if len(profile.Bio) > maxBioLength {
+		return invalid(fmt.Sprintf("The bio has at most %d characters", maxBioLength))
+	}
+	if len(profile.SpecializationIDs) > maxProfileTerms || len(profile.ApproachIDs) > maxProfileTerms {
+		return invalid(fmt.Sprintf("Pick at most %d specializations and %d approaches", maxProfileTerms, maxProfileTerms))
+	}
+	if profile.YearsOfExperience < 0 || profile.YearsOfExperience > maxYearsOfExperience {
+		return invalid(fmt.Sprintf("Years of experience must be between 0 and %d", maxYearsOfExperience))
+	}
+	if (profile.OnlineRate != nil && *profile.OnlineRate < 0) || (profile.OfflineRate != nil && *profile.OfflineRate < 0) {
+		return invalid("Rates cannot be negative")
+	}
+
+	year := time.Now().Year()
+	for _, credentials := range []*models.Credentials{&profile.Education, &profile.Certifications} {
+		if len(*credentials) > maxProfileCredentials {
+			return invalid(fmt.Sprintf("List at most %d degrees and %d certifications", maxProfileCredentials, maxProfileCredentials))
+		}
+		normalized := models.Credentials{}
+		for _, credential := range *credentials {
+			credential.Title = strings.TrimSpace(credential.Title)
+			credential.Institution = strings.TrimSpace(credential.Institution)
+			if credential.Title == "" || credential.Year < 0 || credential.Year > year {
+				return invalid("Every degree and certification needs a title and a year that has passed")
+			}
+			normalized = append(normalized, credential)
+		}
+		*credentials = normalized
+	}
+	return profile, nil
+}
+
+func uniqueIDs(ids []uuid.UUID) []uuid.UUID {
+	result := []uuid.UUID{}
+	seen := make(map[uuid.UUID]bool)
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	return result
+}
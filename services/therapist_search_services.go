@@ -0,0 +1,453 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Sort keys of therapist search, best rated first by default and nearest first when searching
+// near a point
+const (
+	TherapistSortRating       = "rating"
+	TherapistSortPriceAsc     = "price_asc"
+	TherapistSortPriceDesc    = "price_desc"
+	TherapistSortAvailability = "availability"
+	TherapistSortDistance     = "distance"
+)
+
+// Search looks this many days ahead for a therapist's next free slot
+const nextAvailableDays = 14
+
+// TherapistSearchParams filters therapist search, zero values match every therapist
+type TherapistSearchParams struct {
+	ConsultationType models.ConsultationType
+	Location         string
+	Specialization   string
+	MinPrice         *int64
+	MaxPrice         *int64
+	MinRating        *float64
+	Language         string
+	Gender           models.Gender
+	// Only therapists seeing patients at a clinic within RadiusKm of Near, or at a clinic in City
+	Near     *GeoPoint
+	RadiusKm float64
+	City     string
+	// Only therapists with a free slot on this date
+	Date   time.Time
+	Sort   string
+	Cursor string
+	Limit  int
+}
+
+// TherapistSearchResult is one therapist in search results. NextAvailableAt is nil when they
+// have no free slot within the next two weeks, DistanceKm is the distance to their nearest
+// clinic when searching near a point.
+type TherapistSearchResult struct {
+	TherapistID     uuid.UUID               `json:"therapist_id"`
+	Name            string                  `json:"name"`
+	ImageURL        string                  `json:"image_url"`
+	Location        string                  `json:"location"`
+	Specialization  string                  `json:"specialization"`
+	Consultation    models.ConsultationType `json:"consultation_type"`
+	AppointmentRate int64                   `json:"appointment_rate"`
+	OnlineRate      int64                   `json:"online_rate"`
+	OfflineRate     int64                   `json:"offline_rate"`
+	Rating          float64                 `json:"rating"`
+	ReviewCount     int                     `json:"review_count"`
+	Languages       models.Languages        `json:"languages"`
+	Gender          models.Gender           `json:"gender,omitempty"`
+	NextAvailableAt *time.Time              `json:"next_available_at"`
+	DistanceKm      *float64                `json:"distance_km,omitempty"`
+	Clinics         []models.Clinic         `json:"clinics"`
+}
+
+// TherapistSearchPage is one page of search results, NextCursor fetches the next one
+type TherapistSearchPage struct {
+	Therapists []TherapistSearchResult `json:"therapists"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// therapistCursor is the sort key of the last therapist on a page
+type therapistCursor struct {
+	Sort     string     `json:"s"`
+	Rate     int64      `json:"r,omitempty"`
+	Rating   float64    `json:"a,omitempty"`
+	Reviews  int        `json:"c,omitempty"`
+	Next     *time.Time `json:"n,omitempty"`
+	Distance *float64   `json:"d,omitempty"`
+	ID       uuid.UUID  `json:"i"`
+}
+
+type searchCandidate struct {
+	therapist models.Therapist
+	next      *time.Time
+	distance  *float64
+}
+
+// therapistRow is a therapist as search selects them, with the distance to their nearest clinic
+// when searching near a point
+type therapistRow struct {
+	models.Therapist
+	DistanceKm *float64
+}
+
+// SearchTherapists returns a page of therapists matching the filters. Price and rating order
+// and paginate in the database; availability needs every match's schedule, which is loaded in
+// batches rather than per therapist.
+func (service *TherapistService) SearchTherapists(params TherapistSearchParams) (*TherapistSearchPage, *apierror.ApiError) {
+	failed := apierror.NewApiErrorBuilder().
+		WithStatus(http.StatusInternalServerError).
+		WithMessage("Failed to retrieve therapists").
+		Build()
+
+	if params.Near != nil {
+		// Only clinics are near anything, so a radius search is a search for in-person sessions
+		switch params.ConsultationType {
+		case "":
+			params.ConsultationType = models.Offline
+		case models.Online:
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Searching near a location only finds offline and hybrid therapists").
+				Build()
+		}
+		if params.Sort == "" {
+			params.Sort = TherapistSortDistance
+		}
+	}
+	if params.Sort == TherapistSortDistance && params.Near == nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("Sorting by distance needs a location").
+			Build()
+	}
+	if params.Sort == "" {
+		params.Sort = TherapistSortRating
+	}
+	var cursor *therapistCursor
+	if params.Cursor != "" {
+		var err error
+		if cursor, err = decodeTherapistCursor(params.Cursor); err != nil || cursor.Sort != params.Sort {
+			return nil, apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Invalid cursor").
+				Build()
+		}
+	}
+
+	now := time.Now()
+	today := LocalDay(now.In(scheduleLocation))
+	until := today.AddDate(0, 0, nextAvailableDays)
+	var date time.Time
+	if !params.Date.IsZero() {
+		date = LocalDay(params.Date)
+		if date.Before(today) {
+			return &TherapistSearchPage{Therapists: []TherapistSearchResult{}}, nil
+		}
+		if !date.Before(until) {
+			until = date.AddDate(0, 0, 1)
+		}
+	}
+
+	var page []searchCandidate
+	if params.Sort != TherapistSortAvailability && date.IsZero() {
+		// Sorted and paginated by the database, only the page needs schedules
+		var rows []therapistRow
+		query := orderTherapists(service.filteredTherapists(params), params.Sort, params.ConsultationType, cursor)
+		if err := query.Limit(params.Limit + 1).Find(&rows).Error; err != nil {
+			return nil, failed
+		}
+		schedules, err := loadSchedules(service.DB, therapistsOf(rows), today, until)
+		if err != nil {
+			return nil, failed
+		}
+		for _, row := range rows {
+			next := schedules[row.UserID].nextSlot(params.ConsultationType, defaultSession, now, nextAvailableDays)
+			page = append(page, searchCandidate{therapist: row.Therapist, next: next, distance: row.DistanceKm})
+		}
+	} else {
+		// Schedules decide which therapists match or how they sort, so they are checked a batch
+		// at a time. A date filter stops once the page is full, sorting by availability needs all.
+		batchCursor := cursor
+		if params.Sort == TherapistSortAvailability {
+			batchCursor = nil
+		}
+		for {
+			var rows []therapistRow
+			query := orderTherapists(service.filteredTherapists(params), params.Sort, params.ConsultationType, batchCursor)
+			if err := query.Limit(scheduleBatchSize).Find(&rows).Error; err != nil {
+				return nil, failed
+			}
+			schedules, err := loadSchedules(service.DB, therapistsOf(rows), today, until)
+			if err != nil {
+				return nil, failed
+			}
+			for _, row := range rows {
+				schedule := schedules[row.UserID]
+				if !date.IsZero() && len(schedule.slots(date, params.ConsultationType, defaultSession, now)) == 0 {
+					continue
+				}
+				next := schedule.nextSlot(params.ConsultationType, defaultSession, now, nextAvailableDays)
+				page = append(page, searchCandidate{therapist: row.Therapist, next: next, distance: row.DistanceKm})
+			}
+
+			if len(rows) < scheduleBatchSize || (params.Sort != TherapistSortAvailability && len(page) > params.Limit) {
+				break
+			}
+			last := rows[len(rows)-1]
+			batchCursor = cursorAt(params.Sort, params.ConsultationType, searchCandidate{therapist: last.Therapist, distance: last.DistanceKm})
+		}
+
+		if params.Sort == TherapistSortAvailability {
+			sortByAvailability(page)
+			if cursor != nil {
+				page = page[sort.Search(len(page), func(i int) bool { return availableAfter(page[i], cursor) }):]
+			}
+		}
+	}
+
+	result := &TherapistSearchPage{Therapists: []TherapistSearchResult{}}
+	if len(page) > params.Limit {
+		page = page[:params.Limit]
+		result.NextCursor = encodeTherapistCursor(params.Sort, params.ConsultationType, page[len(page)-1])
+	}
+
+	ids := make([]uuid.UUID, len(page))
+	for i, candidate := range page {
+		ids[i] = candidate.therapist.UserID
+	}
+	users, err := therapistUsers(service.DB, ids)
+	if err != nil {
+		return nil, failed
+	}
+	clinics, err := therapistClinics(service.DB, ids)
+	if err != nil {
+		return nil, failed
+	}
+	for _, candidate := range page {
+		therapist := candidate.therapist
+		user := users[therapist.UserID]
+		if clinics[therapist.UserID] == nil {
+			clinics[therapist.UserID] = []models.Clinic{}
+		}
+		result.Therapists = append(result.Therapists, TherapistSearchResult{
+			TherapistID:     therapist.UserID,
+			Name:            user.Name,
+			ImageURL:        user.ImageURL,
+			Location:        therapist.Location,
+			Specialization:  therapist.Specialization,
+			Consultation:    therapist.Consultation,
+			AppointmentRate: therapist.AppointmentRate,
+			OnlineRate:      therapist.RateFor(models.Online),
+			OfflineRate:     therapist.RateFor(models.Offline),
+			Rating:          therapist.RatingAverage,
+			ReviewCount:     therapist.ReviewCount,
+			Languages:       therapist.Languages,
+			Gender:          therapist.Gender,
+			NextAvailableAt: candidate.next,
+			DistanceKm:      candidate.distance,
+			Clinics:         clinics[therapist.UserID],
+		})
+	}
+	return result, nil
+}
+
+// NormalizeLanguages lowercases and deduplicates language codes
+func NormalizeLanguages(languages []string) models.Languages {
+	result := models.Languages{}
+	seen := make(map[string]bool)
+	for _, language := range languages {
+		language = strings.ToLower(strings.TrimSpace(language))
+		if language != "" && !seen[language] {
+			seen[language] = true
+			result = append(result, language)
+		}
+	}
+	return result
+}
+
+func (service *TherapistService) filteredTherapists(params TherapistSearchParams) *gorm.DB {
+	// Rows also carry the distance to the nearest clinic in radius searches
+	query := service.DB.Model(&models.Therapist{}).Select("therapists.*")
+	if params.Near != nil {
+		query = service.DB.Model(&models.Therapist{}).Select("therapists.*, nearby.distance_km").
+			Joins("JOIN (?) AS nearby ON nearby.therapist_id = therapists.user_id", nearbyTherapists(service.DB, *params.Near, params.RadiusKm))
+	}
+
+	switch params.ConsultationType {
+	case "":
+	case models.Online, models.Offline:
+		// Hybrid therapists offer both
+		query = query.Where("consultation IN ?", []models.ConsultationType{params.ConsultationType, models.Hybrid})
+	default:
+		query = query.Where("consultation = ?", params.ConsultationType)
+	}
+	if params.Location != "" {
+		query = query.Where("location ILIKE ?", "%"+params.Location+"%")
+	}
+	if params.Specialization != "" {
+		query = query.Where("specialization ILIKE ?", "%"+params.Specialization+"%")
+	}
+	if params.MinPrice != nil {
+		query = query.Where(rateColumn(params.ConsultationType)+" >= ?", *params.MinPrice)
+	}
+	if params.MaxPrice != nil {
+		query = query.Where(rateColumn(params.ConsultationType)+" <= ?", *params.MaxPrice)
+	}
+	if params.MinRating != nil {
+		query = query.Where("rating_average >= ?", *params.MinRating)
+	}
+	if params.Language != "" {
+		language, _ := json.Marshal([]string{strings.ToLower(params.Language)})
+		query = query.Where("languages @> ?::jsonb", string(language))
+	}
+	if params.Gender != "" {
+		query = query.Where("gender = ?", params.Gender)
+	}
+	if params.City != "" {
+		query = query.Where(`EXISTS (SELECT 1 FROM therapist_clinics JOIN clinics ON clinics.id = therapist_clinics.clinic_id
+			WHERE therapist_clinics.therapist_id = therapists.user_id AND clinics.city ILIKE ?)`, params.City)
+	}
+	return query
+}
+
+// rateColumn is the SQL for what a session of the consultation type costs, as Therapist.RateFor
+func rateColumn(consultationType models.ConsultationType) string {
+	switch consultationType {
+	case models.Online:
+		return "COALESCE(online_rate, appointment_rate)"
+	case models.Offline:
+		return "COALESCE(offline_rate, appointment_rate)"
+	}
+	return "appointment_rate"
+}
+
+// orderTherapists sorts by price for the consultation type, rating or distance with the user ID
+// breaking ties, and starts after the cursor. Availability is sorted later, the database only
+// goes through therapists by user ID.
+func orderTherapists(query *gorm.DB, sortKey string, consultationType models.ConsultationType, cursor *therapistCursor) *gorm.DB {
+	rate := rateColumn(consultationType)
+	switch sortKey {
+	case TherapistSortDistance:
+		query = query.Order("nearby.distance_km asc, therapists.user_id asc")
+		if cursor != nil && cursor.Distance != nil {
+			query = query.Where("(nearby.distance_km, therapists.user_id) > (?, ?)", *cursor.Distance, cursor.ID)
+		}
+	case TherapistSortAvailability:
+		query = query.Order("user_id asc")
+		if cursor != nil {
+			query = query.Where("user_id > ?", cursor.ID)
+		}
+	case TherapistSortPriceAsc:
+		query = query.Order(rate + " asc, user_id asc")
+		if cursor != nil {
+			query = query.Where("("+rate+", user_id) > (?, ?)", cursor.Rate, cursor.ID)
+		}
+	case TherapistSortPriceDesc:
+		query = query.Order(rate + " desc, user_id asc")
+		if cursor != nil {
+			query = query.Where(rate+" < ? OR ("+rate+" = ? AND user_id > ?)", cursor.Rate, cursor.Rate, cursor.ID)
+		}
+	default:
+		query = query.Order("rating_average desc, review_count desc, user_id asc")
+		if cursor != nil {
+			query = query.Where("rating_average < ? OR (rating_average = ? AND (review_count < ? OR (review_count = ? AND user_id > ?)))",
+				cursor.Rating, cursor.Rating, cursor.Reviews, cursor.Reviews, cursor.ID)
+		}
+	}
+	return query
+}
+
+// sortByAvailability puts the soonest available first and those without a free slot last
+func sortByAvailability(candidates []searchCandidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		switch {
+		case a.next == nil || b.next == nil:
+			if (a.next == nil) != (b.next == nil) {
+				return b.next == nil
+			}
+		case !a.next.Equal(*b.next):
+			return a.next.Before(*b.next)
+		}
+		return a.therapist.UserID.String() < b.therapist.UserID.String()
+	})
+}
+
+// availableAfter tells whether a candidate comes after the cursor in availability order
+func availableAfter(candidate searchCandidate, cursor *therapistCursor) bool {
+	id := candidate.therapist.UserID.String()
+	switch {
+	case cursor.Next == nil && candidate.next != nil:
+		return false
+	case cursor.Next == nil:
+		return id > cursor.ID.String()
+	case candidate.next == nil:
+		return true
+	case !candidate.next.Equal(*cursor.Next):
+		return candidate.next.After(*cursor.Next)
+	}
+	return id > cursor.ID.String()
+}
+
+func cursorAt(sortKey string, consultationType models.ConsultationType, candidate searchCandidate) *therapistCursor {
+	return &therapistCursor{
+		Sort:     sortKey,
+		Rate:     candidate.therapist.RateFor(consultationType),
+		Rating:   candidate.therapist.RatingAverage,
+		Reviews:  candidate.therapist.ReviewCount,
+		Next:     candidate.next,
+		Distance: candidate.distance,
+		ID:       candidate.therapist.UserID,
+	}
+}
+
+func therapistsOf(rows []therapistRow) []models.Therapist {
+	therapists := make([]models.Therapist, len(rows))
+	for i := range rows {
+		therapists[i] = rows[i].Therapist
+	}
+	return therapists
+}
+
+func encodeTherapistCursor(sortKey string, consultationType models.ConsultationType, last searchCandidate) string {
+	raw, _ := json.Marshal(cursorAt(sortKey, consultationType, last))
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeTherapistCursor(value string) (*therapistCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, err
+	}
+	var cursor therapistCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+func therapistUsers(db *gorm.DB, ids []uuid.UUID) (map[uuid.UUID]models.User, error) {
+	users := make(map[uuid.UUID]models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	var rows []models.User
+	if err := db.Select("id, name, image_url").Where("id IN ?", ids).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range rows {
+		users[user.ID] = user
+	}
+	return users, nil
+}
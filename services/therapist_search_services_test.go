@@ -0,0 +1,192 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+)
+
+func searchCandidateAt(id string, next *time.Time) searchCandidate {
+	return searchCandidate{therapist: models.Therapist{UserID: uuid.MustParse(id)}, next: next}
+}
+
+func TestSortByAvailability(t *testing.T) {
+	soon := time.Date(2026, 3, 2, 9, 0, 0, 0, scheduleLocation)
+	later := soon.Add(time.Hour)
+	candidates := []searchCandidate{
+		searchCandidateAt("00000000-0000-0000-0000-000000000005", nil),
+		searchCandidateAt("00000000-0000-0000-0000-000000000004", &later),
+		searchCandidateAt("00000000-0000-0000-0000-000000000003", nil),
+		searchCandidateAt("00000000-0000-0000-0000-000000000002", &soon),
+		searchCandidateAt("00000000-0000-0000-0000-000000000001", &later),
+	}
+	sortByAvailability(candidates)
+
+	var got []string
+	for _, candidate := range candidates {
+		got = append(got, candidate.therapist.UserID.String()[35:])
+	}
+	// Soonest first, ties and therapists without a free slot by user ID
+	if want := []string{"2", "1", "4", "3", "5"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestAvailableAfter(t *testing.T) {
+	soon := time.Date(2026, 3, 2, 9, 0, 0, 0, scheduleLocation)
+	later := soon.Add(time.Hour)
+	low, high := "00000000-0000-0000-0000-000000000001", "00000000-0000-0000-0000-000000000002"
+	cursorFor := func(id string, next *time.Time) *therapistCursor {
+		return &therapistCursor{Sort: TherapistSortAvailability, Next: next, ID: uuid.MustParse(id)}
+	}
+
+	tests := []struct {
+		name      string
+		candidate searchCandidate
+		cursor    *therapistCursor
+		want      bool
+	}{
+		{"later slot", searchCandidateAt(low, &later), cursorFor(high, &soon), true},
+		{"earlier slot", searchCandidateAt(high, &soon), cursorFor(low, &later), false},
+		{"same slot higher id", searchCandidateAt(high, &soon), cursorFor(low, &soon), true},
+		{"same slot lower id", searchCandidateAt(low, &soon), cursorFor(high, &soon), false},
+		{"same slot same id", searchCandidateAt(low, &soon), cursorFor(low, &soon), false},
+		{"no slot after a slot", searchCandidateAt(low, nil), cursorFor(high, &later), true},
+		{"slot after no slot", searchCandidateAt(high, &soon), cursorFor(low, nil), false},
+		{"no slot higher id", searchCandidateAt(high, nil), cursorFor(low, nil), true},
+		{"no slot lower id", searchCandidateAt(low, nil), cursorFor(high, nil), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := availableAfter(test.candidate, test.cursor); got != test.want {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTherapistCursorRoundTrip(t *testing.T) {
+	next := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	distance := 2.5
+	candidate := searchCandidate{
+		therapist: models.Therapist{UserID: uuid.New(), AppointmentRate: 150000, RatingAverage: 4.5, ReviewCount: 12},
+		next:      &next,
+		distance:  &distance,
+	}
+
+	cursor, err := decodeTherapistCursor(encodeTherapistCursor(TherapistSortRating, models.Online, candidate))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if want := cursorAt(TherapistSortRating, models.Online, candidate); !reflect.DeepEqual(cursor, want) {
+		t.Errorf("got %+v, want %+v", cursor, want)
+	}
+	if _, err := decodeTherapistCursor("not a cursor"); err == nil {
+		t.Error("decoding garbage gave no error")
+	}
+}
+
+// Paging through every sort key returns each matching therapist exactly once, including
+// therapists tied on their sort key
+func TestSearchTherapistsPagesEveryTherapistOnce(t *testing.T) {
+	db := testDB(t)
+	service := &TherapistService{DB: db}
+
+	// The specialization keeps therapists of other tests out of the results
+	specialization := "paging-" + uuid.NewString()
+	therapists := []struct {
+		rate    int64
+		rating  float64
+		reviews int
+	}{
+		{100000, 4.5, 10},
+		{100000, 4.5, 10},
+		{100000, 4.5, 3},
+		{150000, 4.5, 10},
+		{150000, 5, 1},
+		{200000, 3, 0},
+		{200000, 0, 0},
+	}
+	want := make(map[uuid.UUID]bool)
+	for _, values := range therapists {
+		therapist := createTestTherapist(t, db)
+		err := db.Model(therapist).Updates(map[string]any{
+			"specialization":   specialization,
+			"appointment_rate": values.rate,
+			"rating_average":   values.rating,
+			"review_count":     values.reviews,
+		}).Error
+		if err != nil {
+			t.Fatalf("update therapist: %v", err)
+		}
+		want[therapist.UserID] = true
+	}
+
+	sortKeys := []string{TherapistSortRating, TherapistSortPriceAsc, TherapistSortPriceDesc, TherapistSortAvailability}
+	for _, sortKey := range sortKeys {
+		t.Run(sortKey, func(t *testing.T) {
+			seen := make(map[uuid.UUID]bool)
+			var previous *TherapistSearchResult
+			params := TherapistSearchParams{Specialization: specialization, Sort: sortKey, Limit: 2}
+			for pages := 0; ; pages++ {
+				if pages > len(therapists) {
+					t.Fatal("paging does not end")
+				}
+				page, apiErr := service.SearchTherapists(params)
+				if apiErr != nil {
+					t.Fatalf("search: %v", apiErr.Message)
+				}
+				for i := range page.Therapists {
+					result := &page.Therapists[i]
+					if seen[result.TherapistID] {
+						t.Errorf("therapist %s returned twice", result.TherapistID)
+					}
+					seen[result.TherapistID] = true
+					if previous != nil && !searchOrdered(sortKey, previous, result) {
+						t.Errorf("%+v sorted before %+v", previous, result)
+					}
+					previous = result
+				}
+				if page.NextCursor == "" {
+					break
+				}
+				params.Cursor = page.NextCursor
+			}
+			if !reflect.DeepEqual(seen, want) {
+				t.Errorf("got %d therapists, want %d", len(seen), len(want))
+			}
+		})
+	}
+}
+
+// searchOrdered tells whether a may come before b in results sorted by sortKey
+func searchOrdered(sortKey string, a, b *TherapistSearchResult) bool {
+	idOrdered := strings.Compare(a.TherapistID.String(), b.TherapistID.String()) < 0
+	switch sortKey {
+	case TherapistSortPriceAsc:
+		return a.AppointmentRate < b.AppointmentRate || (a.AppointmentRate == b.AppointmentRate && idOrdered)
+	case TherapistSortPriceDesc:
+		return a.AppointmentRate > b.AppointmentRate || (a.AppointmentRate == b.AppointmentRate && idOrdered)
+	case TherapistSortAvailability:
+		switch {
+		case a.NextAvailableAt == nil || b.NextAvailableAt == nil:
+			if (a.NextAvailableAt == nil) != (b.NextAvailableAt == nil) {
+				return b.NextAvailableAt == nil
+			}
+		case !a.NextAvailableAt.Equal(*b.NextAvailableAt):
+			return a.NextAvailableAt.Before(*b.NextAvailableAt)
+		}
+		return idOrdered
+	}
+	if a.Rating != b.Rating {
+		return a.Rating > b.Rating
+	}
+	if a.ReviewCount != b.ReviewCount {
+		return a.ReviewCount > b.ReviewCount
+	}
+	return idOrdered
+}
@@ -2,7 +2,6 @@ package services
 
 import (
 	"errors"
-	"fmt"
 	"net/http"
 	"time"
 
@@ -16,88 +15,6 @@ type TherapistService struct {
 	DB *gorm.DB
 }
 
-func (service *TherapistService) GetTherapistsFiltered(consultationType, location string, date time.Time) ([]models.Therapist, *apierror.ApiError) {
-	var therapists []models.Therapist
-
-	query := service.DB.Model(&models.Therapist{}).Preload("User", func(db *gorm.DB) *gorm.DB {
-		return db.Select("id, name, image_url")
-	})
-
-	if consultationType != "" {
-		query = query.Where("consultation = ?", consultationType)
-	}
-	if location != "" {
-		query = query.Where("location ILIKE ?", "%"+location+"%")
-	}
-
-	if err := query.Find(&therapists).Error; err != nil {
-		return nil, apierror.NewApiErrorBuilder().
-			WithStatus(http.StatusInternalServerError).
-			WithMessage("Failed to retrieve therapists").
-			Build()
-	}
-
-	if date.IsZero() {
-		return therapists, nil
-	}
-
-	var availableTherapists []models.Therapist
-	for _, therapist := range therapists {
-		if isTherapistAvailableForDate(service.DB, therapist.UserID, date) && hasAvailableTimeSlots(service.DB, therapist.UserID, date) {
-			availableTherapists = append(availableTherapists, therapist)
-		}
-	}
-
-	return availableTherapists, nil
-}
-
-
-func isTherapistAvailableForDate(db *gorm.DB, therapistID uuid.UUID, date time.Time) bool {
-	var availability models.Availability
-
-	err := db.Where("therapist_id = ? AND date = ?", therapistID, date).First(&availability).Error
-
-	if err == gorm.ErrRecordNotFound {
-		fmt.Printf("No availability record found for therapist %s on %s. Defaulting to available.\n", therapistID, date.Format("2006-01-02"))
-		return true
-	} else if err != nil {
-		fmt.Printf("Error querying availability for therapist %s on %s: %v\n", therapistID, date.Format("2006-01-02"), err)
-		return false
-	}
-
-	fmt.Printf("Availability record found for therapist %s on %s: IsAvailable = %v\n", therapistID, date.Format("2006-01-02"), availability.IsAvailable)
-
-	return availability.IsAvailable
-}
-
-
-
-func hasAvailableTimeSlots(db *gorm.DB, therapistID uuid.UUID, date time.Time) bool {
-	// Define time slots (8 AM - 12 PM, 1 PM - 5 PM)
-	timeSlots := []time.Time{}
-	for hour := 8; hour < 12; hour++ {
-		timeSlots = append(timeSlots, time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.UTC))
-	}
-	for hour := 13; hour < 17; hour++ {
-		timeSlots = append(timeSlots, time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.UTC))
-	}
-
-	for _, timeSlot := range timeSlots {
-		var count int64
-		db.Model(&models.Appointment{}).
-			Where("therapist_id = ?", therapistID).
-			Where("appointment_date = ?", timeSlot).
-			Where("status = ?", models.Success).
-			Count(&count)
-		
-		if count == 0 {
-			return true 
-		}
-	}
-
-	return false
-}
-
 func (service *TherapistService) UpdateAvailabilityByDate(therapistID string, date time.Time, isAvailable bool) *apierror.ApiError {
 	var availability models.Availability
 	err := service.DB.Where("therapist_id = ? AND date = ?", therapistID, date).First(&availability).Error
@@ -168,67 +85,82 @@ func (service *TherapistService) GetTherapistDetails(therapistID string) (*model
 	return &therapist, nil
 }
 
-
-// GetAvailableSchedules fetches available schedules for a therapist
-func (service *TherapistService) GetAvailableSchedules(therapistID, date, consultationType string) ([]string, error) {
-	var appointments []models.Appointment
-
-	// Parse the provided date or default to today's date
-	parsedDate, err := time.Parse("2006-01-02", date)
+// GetAvailableSchedules fetches available schedules for a therapist, for one of their session
+// types or the default one hour session when sessionTypeID is empty
+func (service *TherapistService) GetAvailableSchedules(therapistID, date, consultationType, sessionTypeID string) ([]string, error) {
+	therapistUUID, err := uuid.Parse(therapistID)
 	if err != nil {
-		parsedDate = time.Now() // Default to today if parsing fails
+		return nil, errors.New("invalid therapist ID")
 	}
 
-	// Query successful appointments for the therapist on the given date and consultation type
-	if err := service.DB.Where("therapist_id = ? AND type = ? AND status = ? AND DATE(appointment_date) = ?", therapistID, models.ConsultationType(consultationType), models.Success, parsedDate).Find(&appointments).Error; err != nil {
-		return nil, errors.New("error fetching appointments")
+	var sessionType *models.SessionType
+	if sessionTypeID != "" {
+		sessionTypeUUID, err := uuid.Parse(sessionTypeID)
+		if err != nil {
+			return nil, ErrSessionTypeNotFound
+		}
+		if sessionType, err = findSessionType(service.DB, therapistUUID, sessionTypeUUID, models.ConsultationType(consultationType)); err != nil {
+			return nil, err
+		}
 	}
 
-	// Define time slots (e.g., 8 AM to 11 AM, 1 PM to 5 PM)
-	timeSlots := generateTimeSlots(parsedDate)
+	// Parse the provided date or default to today's date
+	day := time.Now().In(scheduleLocation)
+	if parsedDate, err := time.Parse("2006-01-02", date); err == nil {
+		day = parsedDate
+	}
 
-	// Loop through time slots and check if there's an appointment that blocks the slot
-	availableSlots := filterAvailableSlots(timeSlots, appointments)
+	slots, err := availableSlots(service.DB, therapistUUID, LocalDay(day), models.ConsultationType(consultationType), sessionSpecFor(sessionType))
+	if err != nil {
+		return nil, errors.New("error fetching schedule")
+	}
 
-	return availableSlots, nil
+	schedules := make([]string, len(slots))
+	for i, slot := range slots {
+		schedules[i] = slot.In(scheduleLocation).Format("15:04") // Format as "HH:MM"
+	}
+	return schedules, nil
 }
 
-// Helper function to generate time slots between 8 AM - 11 AM and 1 PM - 5 PM
-func generateTimeSlots(date time.Time) []time.Time {
-	var slots []time.Time
+// lockTherapistSchedule serialises bookings for one therapist until the transaction ends, so
+// checking a slot and taking it cannot interleave with another booking
+func lockTherapistSchedule(tx *gorm.DB, therapistID uuid.UUID) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "therapist-schedule:"+therapistID.String()).Error
+}
 
-	// 8 AM to 11 AM slots
-	for hour := 8; hour <= 10; hour++ {
-		slots = append(slots, time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.Local))
+// isSlotBookable checks that a session starting at date fits the therapist's schedule for the
+// consultation type. Call it after lockTherapistSchedule.
+func isSlotBookable(tx *gorm.DB, therapistID uuid.UUID, consultationType models.ConsultationType, session sessionSpec, date time.Time) (bool, error) {
+	slots, err := availableSlots(tx, therapistID, LocalDay(date.In(scheduleLocation)), consultationType, session)
+	if err != nil {
+		return false, err
 	}
-
-	// 1 PM to 5 PM slots
-	for hour := 13; hour <= 16; hour++ {
-		slots = append(slots, time.Date(date.Year(), date.Month(), date.Day(), hour, 0, 0, 0, time.Local))
+	for _, slot := range slots {
+		if slot.Equal(date) {
+			return true, nil
+		}
 	}
-
-	return slots
+	return false, nil
 }
 
-// Helper function to filter available time slots based on existing appointments
-func filterAvailableSlots(timeSlots []time.Time, appointments []models.Appointment) []string {
-	var availableSlots []string
+// Helper function to filter available time slots based on the time taken by appointments and holds
+func filterAvailableSlots(timeSlots []time.Time, session sessionSpec, taken []timeRange) []time.Time {
+	availableSlots := []time.Time{}
 
 	for _, slot := range timeSlots {
 		isAvailable := true
+		candidate := timeRange{start: slot, end: slot.Add(session.duration + session.buffer)}
 
-		for _, appointment := range appointments {
-			appointmentStart := appointment.AppointmentDate
-
-			// Compare the time slot with the appointment's start time
-			if appointmentStart.Equal(slot) {
+		for _, r := range taken {
+			// The new session and its buffer may not overlap another session or its buffer
+			if candidate.overlaps(r) {
 				isAvailable = false
 				break
 			}
 		}
 
 		if isAvailable {
-			availableSlots = append(availableSlots, slot.Format("15:04")) // Format as "HH:MM"
+			availableSlots = append(availableSlots, slot)
 		}
 	}
 
@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Hand-TBN1/hand-backend/apierror"
+	"github.com/Hand-TBN1/hand-backend/config"
+	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	maxWaitlistDays          = 31
+	maxActiveWaitlistEntries = 5
+)
+
+var (
+	ErrWaitlistOfferNotFound = errors.New("waitlist offer not found")
+	ErrWaitlistOfferExpired  = errors.New("waitlist offer has expired")
+)
+
+var activeWaitlistStatuses = []models.WaitlistStatus{models.WaitlistWaiting, models.WaitlistOffered}
+
+// WaitlistService lets patients wait for a fully booked therapist. Freed slots are offered to
+// waiting patients in the order they joined, and held for them for HoldDuration.
+type WaitlistService struct {
+	DB           *gorm.DB
+	Sender       NotificationSender
+	HoldDuration time.Duration
+}
+
+type waitlistNotice struct {
+	offer   models.WaitlistOffer
+	patient models.User
+}
+
+// JoinWaitlist adds a patient to a therapist's waitlist for the dates of the entry
+func (service *WaitlistService) JoinWaitlist(entry *models.WaitlistEntry) *apierror.ApiError {
+	therapist, err := findTherapist(service.DB, entry.TherapistID)
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Therapist not found").
+			Build()
+	}
+	if err := CheckConsultationType(therapist, entry.ConsultationType); err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("The therapist does not offer this consultation type").
+			Build()
+	}
+	if entry.SessionTypeID != nil {
+		if _, err := findSessionType(service.DB, entry.TherapistID, *entry.SessionTypeID, entry.ConsultationType); err != nil {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusBadRequest).
+				WithMessage("Session type not found").
+				Build()
+		}
+	}
+
+	today := availabilityDate(time.Now().In(scheduleLocation))
+	entry.FromDate, entry.ToDate = availabilityDate(entry.FromDate), availabilityDate(entry.ToDate)
+	if entry.FromDate.Before(today) || entry.ToDate.Before(entry.FromDate) {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage("The date range must start today or later and not end before it starts").
+			Build()
+	}
+	if entry.ToDate.Sub(entry.FromDate) >= maxWaitlistDays*24*time.Hour {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("A waitlist entry can cover at most %d days", maxWaitlistDays)).
+			Build()
+	}
+
+	var active []models.WaitlistEntry
+	if err := service.DB.Where("patient_id = ? AND status IN ?", entry.PatientID, activeWaitlistStatuses).Find(&active).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to check the waitlist").
+			Build()
+	}
+	for _, existing := range active {
+		if existing.TherapistID == entry.TherapistID {
+			return apierror.NewApiErrorBuilder().
+				WithStatus(http.StatusConflict).
+				WithMessage("You are already on this therapist's waitlist").
+				Build()
+		}
+	}
+	if len(active) >= maxActiveWaitlistEntries {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusBadRequest).
+			WithMessage(fmt.Sprintf("You can wait for at most %d therapists at a time", maxActiveWaitlistEntries)).
+			Build()
+	}
+
+	entry.Status = models.WaitlistWaiting
+	if err := service.DB.Create(entry).Error; err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to join the waitlist").
+			Build()
+	}
+	return nil
+}
+
+func (service *WaitlistService) GetEntries(patientID uuid.UUID) ([]models.WaitlistEntry, *apierror.ApiError) {
+	entries := []models.WaitlistEntry{}
+	if err := service.DB.Where("patient_id = ?", patientID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve the waitlist").
+			Build()
+	}
+	return entries, nil
+}
+
+// GetPendingOffers lists the slots currently held for the patient
+func (service *WaitlistService) GetPendingOffers(patientID uuid.UUID) ([]models.WaitlistOffer, *apierror.ApiError) {
+	offers := []models.WaitlistOffer{}
+	err := service.DB.Where("patient_id = ? AND status = ? AND expires_at > ?", patientID, models.OfferPending, time.Now()).
+		Order("expires_at").Find(&offers).Error
+	if err != nil {
+		return nil, apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to retrieve waitlist offers").
+			Build()
+	}
+	return offers, nil
+}
+
+// LeaveWaitlist removes the patient from the waitlist, a slot held for them is released
+func (service *WaitlistService) LeaveWaitlist(patientID, entryID uuid.UUID) *apierror.ApiError {
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.WaitlistEntry{}).
+			Where("id = ? AND patient_id = ? AND status IN ?", entryID, patientID, activeWaitlistStatuses).
+			UpdateColumns(map[string]interface{}{"status": models.WaitlistCancelled, "updated_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&models.WaitlistOffer{}).
+			Where("entry_id = ? AND status = ?", entryID, models.OfferPending).
+			UpdateColumns(map[string]interface{}{"status": models.OfferDeclined, "updated_at": time.Now()}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("Waitlist entry not found").
+			Build()
+	}
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to leave the waitlist").
+			Build()
+	}
+	return nil
+}
+
+// DeclineOffer releases the held slot, the patient stays on the waitlist for another one
+func (service *WaitlistService) DeclineOffer(patientID, offerID uuid.UUID) *apierror.ApiError {
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		offer, err := lockWaitlistOffer(tx, patientID, offerID)
+		if err != nil {
+			return err
+		}
+		if err := updateOfferStatus(tx, offer, models.OfferDeclined); err != nil {
+			return err
+		}
+		return tx.Model(&models.WaitlistEntry{}).
+			Where("id = ? AND status = ?", offer.EntryID, models.WaitlistOffered).
+			UpdateColumns(map[string]interface{}{"status": models.WaitlistWaiting, "updated_at": time.Now()}).Error
+	})
+	if errors.Is(err, ErrWaitlistOfferNotFound) || errors.Is(err, ErrWaitlistOfferExpired) {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusNotFound).
+			WithMessage("No pending offer found").
+			Build()
+	}
+	if err != nil {
+		return apierror.NewApiErrorBuilder().
+			WithStatus(http.StatusInternalServerError).
+			WithMessage("Failed to decline the offer").
+			Build()
+	}
+	return nil
+}
+
+// AcceptOffer books the held slot for the patient. The appointment awaits payment like any
+// other booking.
+func (service *WaitlistService) AcceptOffer(patientID, offerID uuid.UUID) (*models.Appointment, error) {
+	var appointment *models.Appointment
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		offer, err := lockWaitlistOffer(tx, patientID, offerID)
+		if err != nil {
+			return err
+		}
+		therapist, err := findTherapist(tx, offer.TherapistID)
+		if err != nil {
+			return err
+		}
+
+		// Accepting first stops the hold from blocking its own booking
+		if err := updateOfferStatus(tx, offer, models.OfferAccepted); err != nil {
+			return err
+		}
+
+		appointment = &models.Appointment{
+			ID:              uuid.New(),
+			UserID:          patientID,
+			TherapistID:     offer.TherapistID,
+			AppointmentDate: offer.SlotStart,
+			PaymentStatus:   models.MidtransStatusPending,
+			Type:            offer.ConsultationType,
+			CreatedAt:       time.Now(),
+		}
+		if err := applySessionType(tx, appointment, therapist, offer.SessionTypeID); err != nil {
+			return err
+		}
+		if err := bookAppointment(tx, appointment, "booked_from_waitlist"); err != nil {
+			return err
+		}
+
+		if err := tx.Model(offer).UpdateColumn("appointment_id", appointment.ID).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WaitlistEntry{}).Where("id = ?", offer.EntryID).
+			UpdateColumns(map[string]interface{}{"status": models.WaitlistBooked, "updated_at": time.Now()}).Error
+	})
+	if isSlotConflict(err) {
+		return nil, ErrSlotUnavailable
+	}
+	if err != nil {
+		return nil, err
+	}
+	return appointment, nil
+}
+
+// ExpireOffers releases holds that ran out, the patient loses their place on the waitlist, and
+// ends entries whose dates have passed
+func (service *WaitlistService) ExpireOffers() (int, error) {
+	now := time.Now()
+	var expired []models.WaitlistOffer
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND expires_at <= ?", models.OfferPending, now).
+			Find(&expired).Error
+		if err != nil || len(expired) == 0 {
+			return err
+		}
+
+		entryIDs := make([]uuid.UUID, len(expired))
+		offerIDs := make([]uuid.UUID, len(expired))
+		for i, offer := range expired {
+			entryIDs[i], offerIDs[i] = offer.EntryID, offer.ID
+		}
+		err = tx.Model(&models.WaitlistOffer{}).Where("id IN ?", offerIDs).
+			UpdateColumns(map[string]interface{}{"status": models.OfferExpired, "updated_at": now}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.WaitlistEntry{}).Where("id IN ? AND status = ?", entryIDs, models.WaitlistOffered).
+			UpdateColumns(map[string]interface{}{"status": models.WaitlistExpired, "updated_at": now}).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = service.DB.Model(&models.WaitlistEntry{}).
+		Where("status = ? AND to_date < ?", models.WaitlistWaiting, availabilityDate(now.In(scheduleLocation))).
+		UpdateColumns(map[string]interface{}{"status": models.WaitlistExpired, "updated_at": now}).Error
+	return len(expired), err
+}
+
+// MatchAll offers freed slots for every therapist with patients waiting
+func (service *WaitlistService) MatchAll(ctx context.Context) (int, error) {
+	var therapistIDs []uuid.UUID
+	err := service.DB.Model(&models.WaitlistEntry{}).
+		Where("status = ?", models.WaitlistWaiting).
+		Distinct().Pluck("therapist_id", &therapistIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	offered := 0
+	for _, therapistID := range therapistIDs {
+		count, err := service.MatchTherapist(ctx, therapistID)
+		if err != nil {
+			log.Printf("Failed to match waitlist for therapist %s: %v", therapistID, err)
+			continue
+		}
+		offered += count
+	}
+	return offered, nil
+}
+
+// MatchTherapist offers each waiting patient, in the order they joined, the earliest free slot
+// in their dates. It holds the therapist's schedule lock, so concurrent runs and bookings see
+// each other's holds.
+func (service *WaitlistService) MatchTherapist(ctx context.Context, therapistID uuid.UUID) (int, error) {
+	var notices []waitlistNotice
+	err := service.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockTherapistSchedule(tx, therapistID); err != nil {
+			return err
+		}
+
+		var entries []models.WaitlistEntry
+		err := tx.Where("therapist_id = ? AND status = ?", therapistID, models.WaitlistWaiting).
+			Order("created_at").Find(&entries).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range entries {
+			offer, err := service.offerSlot(tx, &entries[i])
+			if err != nil {
+				return err
+			}
+			if offer == nil {
+				continue
+			}
+			var patient models.User
+			if err := tx.Select("id, name, phone_number").Where("id = ?", offer.PatientID).First(&patient).Error; err != nil {
+				return err
+			}
+			notices = append(notices, waitlistNotice{offer: *offer, patient: patient})
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, notice := range notices {
+		service.notify(ctx, notice)
+	}
+	return len(notices), nil
+}
+
+// offerSlot holds the earliest free slot of the entry's dates for its patient, if there is one
+func (service *WaitlistService) offerSlot(tx *gorm.DB, entry *models.WaitlistEntry) (*models.WaitlistOffer, error) {
+	session := defaultSession
+	if entry.SessionTypeID != nil {
+		sessionType, err := findSessionType(tx, entry.TherapistID, *entry.SessionTypeID, entry.ConsultationType)
+		if errors.Is(err, ErrSessionTypeNotFound) || errors.Is(err, ErrInvalidConsultationType) {
+			// The therapist no longer offers what the patient waits for
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		session = sessionSpecFor(sessionType)
+	}
+
+	// Slots the patient turned down are not offered to them again
+	var declined []time.Time
+	err := tx.Model(&models.WaitlistOffer{}).
+		Where("entry_id = ? AND status = ?", entry.ID, models.OfferDeclined).
+		Pluck("slot_start", &declined).Error
+	if err != nil {
+		return nil, err
+	}
+
+	first := time.Date(entry.FromDate.Year(), entry.FromDate.Month(), entry.FromDate.Day(), 0, 0, 0, 0, scheduleLocation)
+	last := time.Date(entry.ToDate.Year(), entry.ToDate.Month(), entry.ToDate.Day(), 0, 0, 0, 0, scheduleLocation)
+	if today := LocalDay(time.Now()); first.Before(today) {
+		first = today
+	}
+
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		slots, err := availableSlots(tx, entry.TherapistID, day, entry.ConsultationType, session)
+		if err != nil {
+			return nil, err
+		}
+		for _, slot := range slots {
+			if containsTime(declined, slot) {
+				continue
+			}
+
+			offer := models.WaitlistOffer{
+				ID:               uuid.New(),
+				EntryID:          entry.ID,
+				PatientID:        entry.PatientID,
+				TherapistID:      entry.TherapistID,
+				ConsultationType: entry.ConsultationType,
+				SessionTypeID:    entry.SessionTypeID,
+				SlotStart:        slot,
+				DurationMinutes:  int(session.duration / time.Minute),
+				BufferMinutes:    int(session.buffer / time.Minute),
+				Status:           models.OfferPending,
+				ExpiresAt:        time.Now().Add(service.HoldDuration),
+				CreatedAt:        time.Now(),
+				UpdatedAt:        time.Now(),
+			}
+			if err := tx.Create(&offer).Error; err != nil {
+				return nil, err
+			}
+			err := tx.Model(entry).UpdateColumns(map[string]interface{}{"status": models.WaitlistOffered, "updated_at": time.Now()}).Error
+			return &offer, err
+		}
+	}
+	return nil, nil
+}
+
+func (service *WaitlistService) notify(ctx context.Context, notice waitlistNotice) {
+	if service.Sender == nil || notice.patient.PhoneNumber == "" {
+		return
+	}
+	var therapist models.User
+	if err := service.DB.Select("name").Where("id = ?", notice.offer.TherapistID).First(&therapist).Error; err != nil {
+		log.Printf("Failed to notify waitlist offer %s: %v", notice.offer.ID, err)
+		return
+	}
+
+	message := fmt.Sprintf("Good news! A %s session with %s opened up on %s. It is held for you until %s, book it at %s/waitlist",
+		notice.offer.ConsultationType, therapist.Name,
+		notice.offer.SlotStart.In(scheduleLocation).Format("Mon 2 Jan 2006 at 15:04 MST"),
+		notice.offer.ExpiresAt.In(scheduleLocation).Format("15:04 MST"),
+		config.Env.AppBaseURL)
+	if err := service.Sender.Send(ctx, notice.patient.PhoneNumber, message); err != nil {
+		log.Printf("Failed to notify waitlist offer %s: %v", notice.offer.ID, err)
+	}
+}
+
+func lockWaitlistOffer(tx *gorm.DB, patientID, offerID uuid.UUID) (*models.WaitlistOffer, error) {
+	var offer models.WaitlistOffer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND patient_id = ?", offerID, patientID).First(&offer).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrWaitlistOfferNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if offer.Status != models.OfferPending {
+		return nil, ErrWaitlistOfferNotFound
+	}
+	if !offer.ExpiresAt.After(time.Now()) {
+		return nil, ErrWaitlistOfferExpired
+	}
+	return &offer, nil
+}
+
+func updateOfferStatus(tx *gorm.DB, offer *models.WaitlistOffer, status models.WaitlistOfferStatus) error {
+	offer.Status = status
+	return tx.Model(offer).UpdateColumns(map[string]interface{}{"status": status, "updated_at": time.Now()}).Error
+}
+
+func containsTime(times []time.Time, t time.Time) bool {
+	for _, candidate := range times {
+		if candidate.Equal(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/Hand-TBN1/hand-backend/config"
 	"github.com/Hand-TBN1/hand-backend/models"
+	"github.com/Hand-TBN1/hand-backend/services"
 	"github.com/Hand-TBN1/hand-backend/utilities"
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
@@ -45,6 +46,7 @@ var (
     clientsM     sync.Mutex
     redisClient  *redis.Client
     db           *gorm.DB
+    chatService  *services.ChatService
 )
 
 func loadEnvironment() {
@@ -57,6 +59,7 @@ func initializeServices() {
 	config.LoadEnv()
     db = config.NewPostgresql()
     redisClient = config.NewRedis()
+    chatService = &services.ChatService{DB: db}
 }
 
 func main() {
@@ -477,10 +480,20 @@ func sendMessageToRoom(userID, roomID string, messageContent string) {
         return
     }
 
-    if room.FirstUserID.String() != userID && room.SecondUserID.String() != userID {
+    // Group session rooms have every confirmed attendee as a member, not just the two users
+    if !chatService.IsUserInRoom(uuid.MustParse(userID), room.ID) {
         log.Printf("User %s not part of the room %s", userID, roomID)
         return
     }
+    if room.Type == models.GroupRoom && room.IsEnd {
+        log.Printf("Group room %s has ended", roomID)
+        return
+    }
+    members, err := chatService.RoomMembers(room)
+    if err != nil {
+        log.Printf("Error finding members of room %s: %v", roomID, err)
+        return
+    }
 
     // Create the chat message
     chatMessage := models.ChatMessage{
@@ -496,7 +509,7 @@ func sendMessageToRoom(userID, roomID string, messageContent string) {
         return
     }
 
-    // Prepare the data to be sent to both participants
+    // Prepare the data to be sent to the participants
     data := map[string]interface{}{
         "event": "messageTherapis",
         "data": chatMessage,
@@ -507,9 +520,10 @@ func sendMessageToRoom(userID, roomID string, messageContent string) {
         return
     }
 
-    // Send message to both participants
-    sendMessageToClient(room.FirstUserID.String(), jsonData)
-    sendMessageToClient(room.SecondUserID.String(), jsonData)
+    // Send message to every participant
+    for _, member := range members {
+        sendMessageToClient(member.String(), jsonData)
+    }
 }
 
 func sendMessageToClient(userID string, message []byte) {
@@ -0,0 +1,88 @@
+package utilities
+
+import "strings"
+
+const (
+	snippetFragmentWords = 20
+	snippetMaxFragments  = 2
+	// Words shown before the first match of a fragment
+	snippetLeadWords = 5
+	snippetStartSel  = "<mark>"
+	snippetStopSel   = "</mark>"
+)
+
+type wordSpan struct {
+	start, end int
+	match      bool
+}
+
+// HighlightSnippet picks up to two fragments of text around the words of a search query and
+// wraps the matching words in <mark> tags, like Postgres' ts_headline but without the text
+// leaving the process. Words match when they share a stem with a word the query looks for,
+// the same way the search index matches them. Without any match the start of the text is
+// returned.
+func HighlightSnippet(text, query string) string {
+	stems := ParseSearchQuery(query).Stems()
+
+	var words []wordSpan
+	start := -1
+	for i, r := range text + " " {
+		if i < len(text) && !isSearchSeparator(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			words = append(words, wordSpan{start: start, end: i, match: snippetMatches(text[start:i], stems)})
+			start = -1
+		}
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	var fragments [][2]int
+	for i := 0; i < len(words) && len(fragments) < snippetMaxFragments; i++ {
+		if !words[i].match || (len(fragments) > 0 && i < fragments[len(fragments)-1][1]) {
+			continue
+		}
+		from := max(0, i-snippetLeadWords)
+		if last := len(fragments) - 1; last >= 0 && from <= fragments[last][1] {
+			// Close enough to run on from the previous fragment
+			limit := fragments[last][0] + snippetFragmentWords*snippetMaxFragments
+			fragments[last][1] = min(len(words), i+snippetFragmentWords-snippetLeadWords, limit)
+			continue
+		}
+		fragments = append(fragments, [2]int{from, min(len(words), from+snippetFragmentWords)})
+	}
+	if len(fragments) == 0 {
+		fragments = append(fragments, [2]int{0, min(len(words), snippetFragmentWords*snippetMaxFragments)})
+	}
+
+	parts := make([]string, len(fragments))
+	for i, fragment := range fragments {
+		var builder strings.Builder
+		position := words[fragment[0]].start
+		for _, word := range words[fragment[0]:fragment[1]] {
+			builder.WriteString(text[position:word.start])
+			if word.match {
+				builder.WriteString(snippetStartSel + text[word.start:word.end] + snippetStopSel)
+			} else {
+				builder.WriteString(text[word.start:word.end])
+			}
+			position = word.end
+		}
+		parts[i] = builder.String()
+	}
+	return strings.Join(parts, " ... ")
+}
+
+func snippetMatches(word string, stems map[string]bool) bool {
+	for _, stem := range SearchStems(strings.ToLower(word)) {
+		if stems[stem] {
+			return true
+		}
+	}
+	return false
+}
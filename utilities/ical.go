@@ -0,0 +1,126 @@
+package utilities
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+type ICalStatus string
+
+const (
+	ICalConfirmed ICalStatus = "CONFIRMED"
+	ICalCancelled ICalStatus = "CANCELLED"
+)
+
+type ICalEvent struct {
+	UID          string
+	Start        time.Time
+	End          time.Time
+	Summary      string
+	Description  string
+	Location     string
+	URL          string
+	Status       ICalStatus
+	Sequence     int
+	LastModified time.Time
+}
+
+// BuildICalendar renders events as an RFC 5545 calendar. Event times are written in loc, which
+// is described by a VTIMEZONE with its current offset, so loc must not observe daylight saving.
+func BuildICalendar(name string, loc *time.Location, events []ICalEvent) string {
+	var b strings.Builder
+	line := func(content string) {
+		b.WriteString(foldICalLine(content))
+		b.WriteString("\r\n")
+	}
+
+	tzName, offset := time.Now().In(loc).Zone()
+	tzOffset := formatICalOffset(offset)
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Hand//Appointments//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:" + escapeICalText(name))
+	line("X-WR-TIMEZONE:" + loc.String())
+	line("BEGIN:VTIMEZONE")
+	line("TZID:" + loc.String())
+	line("BEGIN:STANDARD")
+	line("DTSTART:19700101T000000")
+	line("TZOFFSETFROM:" + tzOffset)
+	line("TZOFFSETTO:" + tzOffset)
+	line("TZNAME:" + tzName)
+	line("END:STANDARD")
+	line("END:VTIMEZONE")
+
+	stamp := time.Now().UTC().Format("20060102T150405Z")
+	for _, event := range events {
+		line("BEGIN:VEVENT")
+		line("UID:" + event.UID)
+		line("DTSTAMP:" + stamp)
+		line("DTSTART;TZID=" + loc.String() + ":" + event.Start.In(loc).Format("20060102T150405"))
+		line("DTEND;TZID=" + loc.String() + ":" + event.End.In(loc).Format("20060102T150405"))
+		line("SUMMARY:" + escapeICalText(event.Summary))
+		if event.Description != "" {
+			line("DESCRIPTION:" + escapeICalText(event.Description))
+		}
+		if event.Location != "" {
+			line("LOCATION:" + escapeICalText(event.Location))
+		}
+		if event.URL != "" {
+			line("URL:" + event.URL)
+		}
+		line("STATUS:" + string(event.Status))
+		line(fmt.Sprintf("SEQUENCE:%d", event.Sequence))
+		if !event.LastModified.IsZero() {
+			line("LAST-MODIFIED:" + event.LastModified.UTC().Format("20060102T150405Z"))
+		}
+		line("END:VEVENT")
+	}
+	line("END:VCALENDAR")
+
+	return b.String()
+}
+
+func escapeICalText(text string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(text)
+}
+
+// foldICalLine splits lines longer than 75 octets, continuation lines start with a space.
+// It never splits inside a UTF-8 sequence.
+func foldICalLine(content string) string {
+	const limit = 75
+	if len(content) <= limit {
+		return content
+	}
+
+	var b strings.Builder
+	width := 0
+	for _, r := range content {
+		size := len(string(r))
+		if width+size > limit {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
+
+func formatICalOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	return fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+}
@@ -0,0 +1,609 @@
+package utilities
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A recurrence is expanded over at most this many periods (days, weeks, months or years)
+const maxICalPeriods = 50000
+
+// ICalPeriod is a time in which an external calendar is busy
+type ICalPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+type icalProperty struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+type icalTime struct {
+	time   time.Time
+	isDate bool
+}
+
+type icalEventData struct {
+	uid          string
+	start        icalTime
+	end          time.Time
+	rrule        string
+	exdates      []icalTime
+	recurrenceID *icalTime
+	cancelled    bool
+	transparent  bool
+}
+
+type icalByDay struct {
+	ordinal int
+	weekday time.Weekday
+}
+
+type icalRule struct {
+	freq       string
+	interval   int
+	count      int
+	until      *time.Time
+	byDay      []icalByDay
+	byMonthDay []int
+	byMonth    []time.Month
+}
+
+type icalParser struct {
+	defaultLoc *time.Location
+	timezones  map[string]*time.Location
+}
+
+// ParseICalBusy reads an iCalendar document and returns the busy periods overlapping from and
+// to. Recurring events are expanded, EXDATEs removed and RECURRENCE-ID overrides applied.
+// Cancelled and transparent (free) events are skipped. Floating and all-day times are read in
+// defaultLoc.
+func ParseICalBusy(data []byte, from, to time.Time, defaultLoc *time.Location) ([]ICalPeriod, error) {
+	properties := unfoldICal(string(data))
+	if len(properties) == 0 || properties[0].name != "BEGIN" || !strings.EqualFold(properties[0].value, "VCALENDAR") {
+		return nil, errors.New("not an iCalendar file")
+	}
+
+	parser := &icalParser{defaultLoc: defaultLoc, timezones: make(map[string]*time.Location)}
+	parser.readTimezones(properties)
+	events, err := parser.readEvents(properties)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overrides of single occurrences, by UID and the start they replace
+	overridden := make(map[string]map[int64]bool)
+	for _, event := range events {
+		if event.recurrenceID != nil {
+			if overridden[event.uid] == nil {
+				overridden[event.uid] = make(map[int64]bool)
+			}
+			overridden[event.uid][event.recurrenceID.time.Unix()] = true
+		}
+	}
+
+	var periods []ICalPeriod
+	add := func(start, end time.Time) {
+		if start.Before(to) && end.After(from) {
+			periods = append(periods, ICalPeriod{Start: start, End: end})
+		}
+	}
+	for _, event := range events {
+		if event.cancelled || event.transparent || !event.end.After(event.start.time) {
+			continue
+		}
+		length := event.end.Sub(event.start.time)
+		if event.rrule == "" || event.recurrenceID != nil {
+			add(event.start.time, event.end)
+			continue
+		}
+
+		rule, err := parser.parseRule(event.rrule, event.start)
+		if err != nil {
+			return nil, fmt.Errorf("event %s: %w", event.uid, err)
+		}
+		for _, occurrence := range rule.occurrences(event.start.time, to) {
+			if overridden[event.uid][occurrence.Unix()] || isExcluded(occurrence, event.exdates) {
+				continue
+			}
+			add(occurrence, occurrence.Add(length))
+		}
+	}
+
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Start.Before(periods[j].Start) })
+	return periods, nil
+}
+
+// unfoldICal joins folded lines and splits each line into name, parameters and value
+func unfoldICal(text string) []icalProperty {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n ", "")
+	text = strings.ReplaceAll(text, "\n\t", "")
+
+	var properties []icalProperty
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		if property, ok := parseICalLine(line); ok {
+			properties = append(properties, property)
+		}
+	}
+	return properties
+}
+
+func parseICalLine(line string) (icalProperty, bool) {
+	// The value starts at the first colon outside a quoted parameter
+	inQuotes := false
+	split := -1
+	for i, r := range line {
+		if r == '"' {
+			inQuotes = !inQuotes
+		} else if r == ':' && !inQuotes {
+			split = i
+			break
+		}
+	}
+	if split < 0 {
+		return icalProperty{}, false
+	}
+
+	parts := strings.Split(line[:split], ";")
+	property := icalProperty{
+		name:   strings.ToUpper(parts[0]),
+		params: make(map[string]string),
+		value:  line[split+1:],
+	}
+	for _, param := range parts[1:] {
+		key, value, found := strings.Cut(param, "=")
+		if found {
+			property.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return property, true
+}
+
+// readTimezones maps each VTIMEZONE to its standard offset, used when its TZID is not an IANA
+// name, e.g. the Windows names Outlook writes
+func (parser *icalParser) readTimezones(properties []icalProperty) {
+	var tzid string
+	inStandard := false
+	for _, property := range properties {
+		switch {
+		case property.name == "BEGIN" && strings.EqualFold(property.value, "STANDARD"):
+			inStandard = true
+		case property.name == "END" && strings.EqualFold(property.value, "STANDARD"):
+			inStandard = false
+		case property.name == "END" && strings.EqualFold(property.value, "VTIMEZONE"):
+			tzid = ""
+		case property.name == "TZID":
+			tzid = property.value
+		case property.name == "TZOFFSETTO" && inStandard && tzid != "":
+			if offset, err := parseICalOffset(property.value); err == nil {
+				parser.timezones[tzid] = time.FixedZone(tzid, offset)
+			}
+		}
+	}
+}
+
+func (parser *icalParser) readEvents(properties []icalProperty) ([]icalEventData, error) {
+	var events []icalEventData
+	var event *icalEventData
+	var duration *time.Duration
+	hasEnd := false
+	nested := 0
+
+	for _, property := range properties {
+		if event == nil {
+			if property.name == "BEGIN" && strings.EqualFold(property.value, "VEVENT") {
+				event = &icalEventData{}
+				duration = nil
+				hasEnd = false
+			}
+			continue
+		}
+
+		// Alarms and other components inside the event are not needed
+		if property.name == "BEGIN" {
+			nested++
+			continue
+		}
+		if property.name == "END" && nested > 0 {
+			nested--
+			continue
+		}
+		if nested > 0 {
+			continue
+		}
+
+		var err error
+		switch property.name {
+		case "END":
+			if event.start.time.IsZero() {
+				return nil, fmt.Errorf("event %s has no DTSTART", event.uid)
+			}
+			switch {
+			case hasEnd:
+			case duration != nil:
+				event.end = event.start.time.Add(*duration)
+			case event.start.isDate:
+				event.end = event.start.time.AddDate(0, 0, 1)
+			default:
+				event.end = event.start.time
+			}
+			events = append(events, *event)
+			event = nil
+		case "UID":
+			event.uid = property.value
+		case "DTSTART":
+			event.start, err = parser.parseTime(property.value, property.params)
+		case "DTEND":
+			var end icalTime
+			end, err = parser.parseTime(property.value, property.params)
+			event.end, hasEnd = end.time, true
+		case "DURATION":
+			var d time.Duration
+			d, err = parseICalDuration(property.value)
+			duration = &d
+		case "RRULE":
+			event.rrule = property.value
+		case "EXDATE":
+			for _, value := range strings.Split(property.value, ",") {
+				var exdate icalTime
+				if exdate, err = parser.parseTime(value, property.params); err != nil {
+					break
+				}
+				event.exdates = append(event.exdates, exdate)
+			}
+		case "RECURRENCE-ID":
+			var recurrenceID icalTime
+			recurrenceID, err = parser.parseTime(property.value, property.params)
+			event.recurrenceID = &recurrenceID
+		case "STATUS":
+			event.cancelled = strings.EqualFold(property.value, "CANCELLED")
+		case "TRANSP":
+			event.transparent = strings.EqualFold(property.value, "TRANSPARENT")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("event %s: invalid %s: %w", event.uid, property.name, err)
+		}
+	}
+	return events, nil
+}
+
+func (parser *icalParser) location(tzid string) *time.Location {
+	if tzid == "" {
+		return parser.defaultLoc
+	}
+	// IANA names keep their daylight saving rules, the VTIMEZONE only gives a fixed offset
+	if loc, err := time.LoadLocation(tzid); err == nil {
+		return loc
+	}
+	if loc, ok := parser.timezones[tzid]; ok {
+		return loc
+	}
+	return parser.defaultLoc
+}
+
+func (parser *icalParser) parseTime(value string, params map[string]string) (icalTime, error) {
+	value = strings.TrimSpace(value)
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, parser.defaultLoc)
+		return icalTime{time: t, isDate: true}, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return icalTime{time: t}, err
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, parser.location(params["TZID"]))
+	return icalTime{time: t}, err
+}
+
+func (parser *icalParser) parseRule(value string, start icalTime) (*icalRule, error) {
+	rule := &icalRule{interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(part, "=")
+		if !found {
+			continue
+		}
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.freq = strings.ToUpper(val)
+		case "INTERVAL":
+			rule.interval, err = strconv.Atoi(val)
+			if err == nil && rule.interval < 1 {
+				err = errors.New("INTERVAL must be positive")
+			}
+		case "COUNT":
+			rule.count, err = strconv.Atoi(val)
+		case "UNTIL":
+			var until icalTime
+			until, err = parser.parseTime(val, nil)
+			if until.isDate {
+				// A date UNTIL includes occurrences on that day
+				until.time = time.Date(until.time.Year(), until.time.Month(), until.time.Day(), 23, 59, 59, 0, start.time.Location())
+			}
+			rule.until = &until.time
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				var byDay icalByDay
+				if byDay, err = parseICalByDay(day); err != nil {
+					break
+				}
+				rule.byDay = append(rule.byDay, byDay)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(val, ",") {
+				var n int
+				if n, err = strconv.Atoi(day); err != nil {
+					break
+				}
+				rule.byMonthDay = append(rule.byMonthDay, n)
+			}
+		case "BYMONTH":
+			for _, month := range strings.Split(val, ",") {
+				var n int
+				if n, err = strconv.Atoi(month); err != nil || n < 1 || n > 12 {
+					err = fmt.Errorf("invalid BYMONTH %s", month)
+					break
+				}
+				rule.byMonth = append(rule.byMonth, time.Month(n))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid RRULE %s: %w", key, err)
+		}
+	}
+
+	switch rule.freq {
+	case "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+	case "":
+		return nil, errors.New("RRULE without FREQ")
+	default:
+		// Sub-daily recurrences are not expanded, only the first occurrence blocks time
+		rule.freq, rule.count = "DAILY", 1
+	}
+	return rule, nil
+}
+
+func parseICalByDay(value string) (icalByDay, error) {
+	weekdays := map[string]time.Weekday{
+		"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+		"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+	}
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if len(value) < 2 {
+		return icalByDay{}, fmt.Errorf("invalid BYDAY %s", value)
+	}
+	weekday, ok := weekdays[value[len(value)-2:]]
+	if !ok {
+		return icalByDay{}, fmt.Errorf("invalid BYDAY %s", value)
+	}
+	byDay := icalByDay{weekday: weekday}
+	if prefix := value[:len(value)-2]; prefix != "" {
+		ordinal, err := strconv.Atoi(prefix)
+		if err != nil {
+			return icalByDay{}, fmt.Errorf("invalid BYDAY %s", value)
+		}
+		byDay.ordinal = ordinal
+	}
+	return byDay, nil
+}
+
+// occurrences lists the starts of the rule's occurrences up to until, the first being start.
+// Occurrences keep the wall clock time of start in its location.
+func (rule *icalRule) occurrences(start, until time.Time) []time.Time {
+	var result []time.Time
+	emitted := 0
+	for period := 0; period < maxICalPeriods; period++ {
+		for _, candidate := range rule.candidates(start, period*rule.interval) {
+			if candidate.Before(start) {
+				continue
+			}
+			if (rule.until != nil && candidate.After(*rule.until)) || candidate.After(until) {
+				return result
+			}
+			if rule.count > 0 && emitted >= rule.count {
+				return result
+			}
+			emitted++
+			result = append(result, candidate)
+		}
+	}
+	return result
+}
+
+// candidates lists the sorted occurrence starts within the period offset units after start
+func (rule *icalRule) candidates(start time.Time, offset int) []time.Time {
+	var candidates []time.Time
+	switch rule.freq {
+	case "DAILY":
+		day := start.AddDate(0, 0, offset)
+		if rule.matchesFilters(day) {
+			candidates = append(candidates, day)
+		}
+	case "WEEKLY":
+		if len(rule.byDay) == 0 {
+			candidates = append(candidates, start.AddDate(0, 0, 7*offset))
+			break
+		}
+		// Weeks start on Monday
+		monday := start.AddDate(0, 0, 7*offset-(int(start.Weekday())+6)%7)
+		for _, byDay := range rule.byDay {
+			candidates = append(candidates, monday.AddDate(0, 0, (int(byDay.weekday)+6)%7))
+		}
+	case "MONTHLY":
+		candidates = rule.monthDays(start, start.Year(), start.Month()+time.Month(offset))
+	case "YEARLY":
+		months := rule.byMonth
+		if len(months) == 0 {
+			months = []time.Month{start.Month()}
+		}
+		for _, month := range months {
+			candidates = append(candidates, rule.monthDays(start, start.Year()+offset, month)...)
+		}
+	}
+
+	var filtered []time.Time
+	for _, candidate := range candidates {
+		if len(rule.byMonth) == 0 || containsMonth(rule.byMonth, candidate.Month()) {
+			filtered = append(filtered, candidate)
+		}
+	}
+	sort.Slice(filtered, func(i, j int) bool { return filtered[i].Before(filtered[j]) })
+	return filtered
+}
+
+// monthDays lists the days of a month the rule selects, at the time of day of start
+func (rule *icalRule) monthDays(start time.Time, year int, month time.Month) []time.Time {
+	first := time.Date(year, month, 1, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+	daysInMonth := first.AddDate(0, 1, -1).Day()
+	at := func(day int) time.Time { return first.AddDate(0, 0, day-1) }
+
+	var days []time.Time
+	switch {
+	case len(rule.byMonthDay) > 0:
+		for _, n := range rule.byMonthDay {
+			if n < 0 {
+				n = daysInMonth + n + 1
+			}
+			if n >= 1 && n <= daysInMonth {
+				days = append(days, at(n))
+			}
+		}
+	case len(rule.byDay) > 0:
+		for _, byDay := range rule.byDay {
+			var matching []time.Time
+			for day := 1; day <= daysInMonth; day++ {
+				if at(day).Weekday() == byDay.weekday {
+					matching = append(matching, at(day))
+				}
+			}
+			switch {
+			case byDay.ordinal == 0:
+				days = append(days, matching...)
+			case byDay.ordinal > 0 && byDay.ordinal <= len(matching):
+				days = append(days, matching[byDay.ordinal-1])
+			case byDay.ordinal < 0 && -byDay.ordinal <= len(matching):
+				days = append(days, matching[len(matching)+byDay.ordinal])
+			}
+		}
+	case start.Day() <= daysInMonth:
+		// Months without the start's day, e.g. the 31st, are skipped
+		days = append(days, at(start.Day()))
+	}
+	return days
+}
+
+func (rule *icalRule) matchesFilters(day time.Time) bool {
+	if len(rule.byDay) > 0 {
+		matched := false
+		for _, byDay := range rule.byDay {
+			if byDay.weekday == day.Weekday() {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if len(rule.byMonthDay) > 0 {
+		matched := false
+		for _, n := range rule.byMonthDay {
+			if n == day.Day() {
+				matched = true
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+func containsMonth(months []time.Month, month time.Month) bool {
+	for _, m := range months {
+		if m == month {
+			return true
+		}
+	}
+	return false
+}
+
+func isExcluded(occurrence time.Time, exdates []icalTime) bool {
+	for _, exdate := range exdates {
+		if exdate.isDate {
+			y1, m1, d1 := occurrence.In(exdate.time.Location()).Date()
+			y2, m2, d2 := exdate.time.Date()
+			if y1 == y2 && m1 == m2 && d1 == d2 {
+				return true
+			}
+		} else if exdate.time.Equal(occurrence) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseICalDuration reads durations like P1D, PT1H30M or P2W
+func parseICalDuration(value string) (time.Duration, error) {
+	value = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(value)), "+")
+	if strings.HasPrefix(value, "-") || !strings.HasPrefix(value, "P") {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+
+	var total time.Duration
+	number := ""
+	inTime := false
+	units := map[bool]map[rune]time.Duration{
+		false: {'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour},
+		true:  {'H': time.Hour, 'M': time.Minute, 'S': time.Second},
+	}
+	for _, r := range value[1:] {
+		switch {
+		case r == 'T':
+			inTime = true
+		case r >= '0' && r <= '9':
+			number += string(r)
+		default:
+			unit, ok := units[inTime][r]
+			n, err := strconv.Atoi(number)
+			if !ok || err != nil {
+				return 0, fmt.Errorf("invalid duration %s", value)
+			}
+			total += time.Duration(n) * unit
+			number = ""
+		}
+	}
+	if number != "" {
+		return 0, fmt.Errorf("invalid duration %s", value)
+	}
+	return total, nil
+}
+
+func parseICalOffset(value string) (int, error) {
+	if len(value) != 5 && len(value) != 7 {
+		return 0, fmt.Errorf("invalid offset %s", value)
+	}
+	hours, err := strconv.Atoi(value[1:3])
+	if err != nil {
+		return 0, err
+	}
+	minutes, err := strconv.Atoi(value[3:5])
+	if err != nil {
+		return 0, err
+	}
+	offset := hours*3600 + minutes*60
+	if value[0] == '-' {
+		offset = -offset
+	}
+	return offset, nil
+}
@@ -0,0 +1,217 @@
+package utilities
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// icalDocument wraps lines of components in a calendar, with CRLF line endings like real feeds
+func icalDocument(lines ...string) []byte {
+	lines = append(append([]string{"BEGIN:VCALENDAR", "VERSION:2.0"}, lines...), "END:VCALENDAR")
+	return []byte(strings.Join(lines, "\r\n"))
+}
+
+func TestParseICalBusy(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Fatalf("load location: %v", err)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		document []byte
+		// want holds the start and end of each period in UTC, in RFC 3339
+		want [][2]string
+	}{
+		{
+			name: "weekly by day until",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:weekly",
+				"DTSTART;TZID=Asia/Jakarta:20260105T090000",
+				"DTEND;TZID=Asia/Jakarta:20260105T100000",
+				"RRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20260114T000000Z",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T03:00:00Z"},
+				{"2026-01-07T02:00:00Z", "2026-01-07T03:00:00Z"},
+				{"2026-01-12T02:00:00Z", "2026-01-12T03:00:00Z"},
+			},
+		},
+		{
+			name: "count",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:count",
+				"DTSTART;TZID=Asia/Jakarta:20260105T090000",
+				"DURATION:PT30M",
+				"RRULE:FREQ=DAILY;COUNT=3",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T02:30:00Z"},
+				{"2026-01-06T02:00:00Z", "2026-01-06T02:30:00Z"},
+				{"2026-01-07T02:00:00Z", "2026-01-07T02:30:00Z"},
+			},
+		},
+		{
+			name: "exdate removes an occurrence",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:exdate",
+				"DTSTART;TZID=Asia/Jakarta:20260105T090000",
+				"DTEND;TZID=Asia/Jakarta:20260105T100000",
+				"RRULE:FREQ=DAILY;COUNT=3",
+				"EXDATE;TZID=Asia/Jakarta:20260106T090000",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T03:00:00Z"},
+				{"2026-01-07T02:00:00Z", "2026-01-07T03:00:00Z"},
+			},
+		},
+		{
+			name: "recurrence id overrides an occurrence",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:override",
+				"DTSTART;TZID=Asia/Jakarta:20260105T090000",
+				"DTEND;TZID=Asia/Jakarta:20260105T100000",
+				"RRULE:FREQ=DAILY;COUNT=3",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:override",
+				"RECURRENCE-ID;TZID=Asia/Jakarta:20260106T090000",
+				"DTSTART;TZID=Asia/Jakarta:20260106T140000",
+				"DTEND;TZID=Asia/Jakarta:20260106T150000",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T03:00:00Z"},
+				{"2026-01-06T07:00:00Z", "2026-01-06T08:00:00Z"},
+				{"2026-01-07T02:00:00Z", "2026-01-07T03:00:00Z"},
+			},
+		},
+		{
+			name: "transparent and cancelled events are skipped",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:busy",
+				"DTSTART:20260105T020000Z",
+				"DTEND:20260105T030000Z",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:free",
+				"DTSTART:20260106T020000Z",
+				"DTEND:20260106T030000Z",
+				"TRANSP:TRANSPARENT",
+				"END:VEVENT",
+				"BEGIN:VEVENT",
+				"UID:cancelled",
+				"DTSTART:20260107T020000Z",
+				"DTEND:20260107T030000Z",
+				"STATUS:CANCELLED",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T03:00:00Z"},
+			},
+		},
+		{
+			name: "non iana tzid",
+			document: icalDocument(
+				"BEGIN:VTIMEZONE",
+				"TZID:Tokyo Standard Time",
+				"BEGIN:STANDARD",
+				"DTSTART:16010101T000000",
+				"TZOFFSETFROM:+0900",
+				"TZOFFSETTO:+0900",
+				"END:STANDARD",
+				"END:VTIMEZONE",
+				"BEGIN:VEVENT",
+				"UID:windows",
+				`DTSTART;TZID="Tokyo Standard Time":20260105T090000`,
+				`DTEND;TZID="Tokyo Standard Time":20260105T100000`,
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T00:00:00Z", "2026-01-05T01:00:00Z"},
+			},
+		},
+		{
+			name: "floating time is read in the default location",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:floating",
+				"DTSTART:20260105T090000",
+				"DTEND:20260105T100000",
+				"END:VEVENT",
+			),
+			want: [][2]string{
+				{"2026-01-05T02:00:00Z", "2026-01-05T03:00:00Z"},
+			},
+		},
+		{
+			name: "outside the window",
+			document: icalDocument(
+				"BEGIN:VEVENT",
+				"UID:past",
+				"DTSTART:20251201T020000Z",
+				"DTEND:20251201T030000Z",
+				"END:VEVENT",
+			),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			periods, err := ParseICalBusy(test.document, from, to, jakarta)
+			if err != nil {
+				t.Fatalf("ParseICalBusy: %v", err)
+			}
+			var got [][2]string
+			for _, period := range periods {
+				got = append(got, [2]string{
+					period.Start.UTC().Format(time.RFC3339),
+					period.End.UTC().Format(time.RFC3339),
+				})
+			}
+			if len(got) != len(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("period %d = %v, want %v", i, got[i], test.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseICalBusyInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		document []byte
+	}{
+		{"not a calendar", []byte("hello")},
+		{"event without start", icalDocument("BEGIN:VEVENT", "UID:nostart", "END:VEVENT")},
+		{"rule without freq", icalDocument(
+			"BEGIN:VEVENT",
+			"UID:nofreq",
+			"DTSTART:20260105T020000Z",
+			"DTEND:20260105T030000Z",
+			"RRULE:COUNT=3",
+			"END:VEVENT",
+		)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := ParseICalBusy(test.document, time.Time{}, time.Now(), time.UTC); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+}
@@ -53,4 +53,37 @@ func ValidateJWT(tokenString string) (*Claims, error) {
 	}
 
 	return claims, nil
-}
\ No newline at end of file
+}
+
+// MeetingUser is the participant a meeting token is for, shown by name in the room
+type MeetingUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// MeetingClaims follow the token format of Jitsi's token authentication, the room only lets
+// the holder in between NotBefore and ExpiresAt
+type MeetingClaims struct {
+	Room    string `json:"room"`
+	Context struct {
+		User MeetingUser `json:"user"`
+	} `json:"context"`
+	jwt.RegisteredClaims
+}
+
+// GenerateMeetingJWT signs a token for one participant of a meeting room
+func GenerateMeetingJWT(appID, secret, domain, room string, user MeetingUser, notBefore, expiresAt time.Time) (string, error) {
+	claims := &MeetingClaims{
+		Room: room,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    appID,
+			Audience:  jwt.ClaimStrings{appID},
+			Subject:   domain,
+			NotBefore: jwt.NewNumericDate(notBefore),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	claims.Context.User = user
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+}
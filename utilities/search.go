@@ -0,0 +1,268 @@
+package utilities
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Postgres keeps at most this many positions of a lexeme and none above maxSearchPosition
+const (
+	maxSearchPositions = 256
+	maxSearchPosition  = 16383
+)
+
+// Words too common to be worth indexing, in either language
+var searchStopwords = map[string]bool{
+	"a": true, "an": true, "the": true, "and": true, "or": true, "of": true, "to": true, "in": true,
+	"on": true, "at": true, "for": true, "with": true, "by": true, "from": true, "as": true,
+	"is": true, "am": true, "are": true, "was": true, "were": true, "be": true, "been": true,
+	"it": true, "this": true, "that": true,
+	"yang": true, "dan": true, "di": true, "ke": true, "dari": true, "ini": true, "itu": true,
+	"dengan": true, "untuk": true, "pada": true, "adalah": true, "atau": true, "juga": true,
+}
+
+// SearchLexeme is a stemmed word and the positions of the words it stems, counted from 1
+type SearchLexeme struct {
+	Lexeme    string
+	Positions []int
+}
+
+// SearchLexemes tokenizes and stems text for a search index. Journals are written in both
+// Indonesian and English, so every word is stemmed with both rules and the index holds both
+// stems at the word's position. Stopwords are left out but still count as positions.
+func SearchLexemes(text string) []SearchLexeme {
+	var lexemes []SearchLexeme
+	index := make(map[string]int)
+	for i, word := range searchWords(text) {
+		position := min(i+1, maxSearchPosition)
+		for _, stem := range SearchStems(word) {
+			at, ok := index[stem]
+			if !ok {
+				at = len(lexemes)
+				index[stem] = at
+				lexemes = append(lexemes, SearchLexeme{Lexeme: stem})
+			}
+			positions := lexemes[at].Positions
+			if len(positions) < maxSearchPositions && (len(positions) == 0 || positions[len(positions)-1] != position) {
+				lexemes[at].Positions = append(positions, position)
+			}
+		}
+	}
+	return lexemes
+}
+
+// SearchStems are the English and Indonesian stems of a lowercase word, nil for a stopword
+func SearchStems(word string) []string {
+	if searchStopwords[word] {
+		return nil
+	}
+	english, indonesian := stemEnglish(word), stemIndonesian(word)
+	if english == indonesian {
+		return []string{english}
+	}
+	return []string{english, indonesian}
+}
+
+// SearchClause is one part of a search. Words holds the stems of each word of a phrase, nil for
+// stopwords, which still count towards the distance between the words around them.
+type SearchClause struct {
+	Words   [][]string
+	Exclude bool
+}
+
+// SearchQuery is a parsed search: a journal matches when it matches every clause of any of the
+// alternatives
+type SearchQuery [][]SearchClause
+
+// ParseSearchQuery reads a search in the syntax of Postgres' websearch_to_tsquery. Words must all
+// appear, "or" between words offers alternatives, a leading "-" excludes a word or phrase and
+// quoted words must appear next to each other.
+func ParseSearchQuery(query string) SearchQuery {
+	var alternatives SearchQuery
+	var clauses []SearchClause
+	alternative := false
+	for _, token := range searchTokens(query) {
+		if !token.quoted && !token.exclude && token.text == "or" {
+			alternative = len(clauses) > 0
+			continue
+		}
+
+		clause := SearchClause{Exclude: token.exclude}
+		for _, word := range searchWords(token.text) {
+			clause.Words = append(clause.Words, SearchStems(word))
+		}
+		// A phrase starts and ends with a word that can be searched for
+		for len(clause.Words) > 0 && clause.Words[0] == nil {
+			clause.Words = clause.Words[1:]
+		}
+		for len(clause.Words) > 0 && clause.Words[len(clause.Words)-1] == nil {
+			clause.Words = clause.Words[:len(clause.Words)-1]
+		}
+		if len(clause.Words) == 0 {
+			continue
+		}
+
+		if alternative {
+			alternatives = append(alternatives, clauses)
+			clauses = nil
+			alternative = false
+		}
+		clauses = append(clauses, clause)
+	}
+	if len(clauses) > 0 {
+		alternatives = append(alternatives, clauses)
+	}
+	return alternatives
+}
+
+// Stems are the stems of the words the query looks for, the excluded ones left out
+func (query SearchQuery) Stems() map[string]bool {
+	stems := make(map[string]bool)
+	for _, clauses := range query {
+		for _, clause := range clauses {
+			if clause.Exclude {
+				continue
+			}
+			for _, word := range clause.Words {
+				for _, stem := range word {
+					stems[stem] = true
+				}
+			}
+		}
+	}
+	return stems
+}
+
+type searchToken struct {
+	text    string
+	quoted  bool
+	exclude bool
+}
+
+// searchTokens splits a query into words and quoted phrases, an unterminated quote runs to the
+// end of the query
+func searchTokens(query string) []searchToken {
+	var tokens []searchToken
+	runes := []rune(strings.ToLower(query))
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		token := searchToken{}
+		if runes[i] == '-' {
+			token.exclude = true
+			i++
+		}
+		if i < len(runes) && runes[i] == '"' {
+			token.quoted = true
+			end := i + 1
+			for end < len(runes) && runes[end] != '"' {
+				end++
+			}
+			token.text = string(runes[i+1 : end])
+			i = end + 1
+		} else {
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && runes[end] != '"' {
+				end++
+			}
+			token.text = string(runes[i:end])
+			i = end
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// searchWords splits text into lowercase words of letters and digits
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), isSearchSeparator)
+}
+
+func isSearchSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// stemEnglish is a light suffix stripper in the spirit of Porter's first steps: plurals,
+// -ing/-ed/-ly and a few derivations, with a final "e" and "y" normalised so "hope", "hoped"
+// and "hoping" or "happy" and "happiness" meet
+func stemEnglish(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		word = word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "sses"):
+		word = word[:len(word)-2]
+	case strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss") &&
+		!strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is"):
+		word = word[:len(word)-1]
+	}
+	for _, suffix := range []string{"ingly", "edly", "ness", "ment", "ful", "ing", "ed", "ly"} {
+		if stem := strings.TrimSuffix(word, suffix); stem != word && len(stem) >= 3 && hasVowel(stem) {
+			word = stem
+			// "running" to "run", but "falling" keeps its double l
+			if n := len(word); n > 3 && word[n-1] == word[n-2] && !strings.ContainsRune("aeioulsz", rune(word[n-1])) {
+				word = word[:n-1]
+			}
+			break
+		}
+	}
+	if n := len(word); n > 3 && word[n-1] == 'e' {
+		word = word[:n-1]
+	} else if n > 3 && word[n-1] == 'y' {
+		word = word[:n-1] + "i"
+	}
+	return word
+}
+
+// stemIndonesian strips particles, possessives, prefixes and suffixes in the order of the Tala
+// stemmer. It works without a dictionary, so it is only as good as the rules, but indexing and
+// searching make the same mistakes.
+func stemIndonesian(word string) string {
+	const minStem = 4
+	trimSuffix := func(suffixes ...string) {
+		for _, suffix := range suffixes {
+			if stem := strings.TrimSuffix(word, suffix); stem != word && len(stem) >= minStem {
+				word = stem
+				return
+			}
+		}
+	}
+
+	trimSuffix("lah", "kah", "tah", "pun")
+	trimSuffix("nya", "ku", "mu")
+
+	// Nasal prefixes swallow the first letter of the root: "menulis" is "tulis", "memakai" "pakai"
+	for _, prefix := range []struct{ prefix, vowelRoot string }{
+		{"meny", "s"}, {"meng", ""}, {"mem", "p"}, {"men", "t"}, {"me", ""},
+		{"peny", "s"}, {"peng", ""}, {"pem", "p"}, {"pen", "t"}, {"di", ""}, {"ter", ""}, {"ke", ""},
+	} {
+		stem := strings.TrimPrefix(word, prefix.prefix)
+		if stem == word || stem == "" {
+			continue
+		}
+		if prefix.vowelRoot != "" && strings.ContainsRune("aeiou", rune(stem[0])) {
+			stem = prefix.vowelRoot + stem
+		}
+		if len(stem) >= minStem {
+			word = stem
+			break
+		}
+	}
+	for _, prefix := range []string{"ber", "bel", "be", "per", "pel", "pe"} {
+		if stem := strings.TrimPrefix(word, prefix); stem != word && len(stem) >= minStem {
+			word = stem
+			break
+		}
+	}
+
+	trimSuffix("kan", "an", "i")
+	return word
+}
+
+func hasVowel(word string) bool {
+	return strings.ContainsAny(word, "aeiouy")
+}
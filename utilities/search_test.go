@@ -0,0 +1,113 @@
+package utilities
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSearchStemsMeet(t *testing.T) {
+	tests := []struct {
+		name  string
+		words []string
+	}{
+		{"english plural", []string{"feeling", "feelings", "feel"}},
+		{"english e", []string{"hope", "hoped", "hoping"}},
+		{"english y", []string{"happy", "happiness", "happily"}},
+		{"english ies", []string{"anxiety", "anxieties"}},
+		{"english double consonant", []string{"run", "running"}},
+		{"indonesian particle", []string{"sedih", "sedihnya", "sedihlah"}},
+		{"indonesian prefix", []string{"sedih", "bersedih"}},
+		{"indonesian suffix", []string{"makan", "makanan"}},
+		{"indonesian confix", []string{"takut", "ketakutan"}},
+		{"indonesian nasal", []string{"tulis", "menulis"}},
+		{"indonesian nasal s", []string{"sapu", "menyapu"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shared := make(map[string]bool)
+			for _, stem := range SearchStems(test.words[0]) {
+				shared[stem] = true
+			}
+			for _, word := range test.words[1:] {
+				found := false
+				for _, stem := range SearchStems(word) {
+					found = found || shared[stem]
+				}
+				if !found {
+					t.Errorf("%q (%v) shares no stem with %q (%v)", word, SearchStems(word), test.words[0], SearchStems(test.words[0]))
+				}
+			}
+		})
+	}
+}
+
+func TestSearchStemsStopwords(t *testing.T) {
+	for _, word := range []string{"the", "and", "yang", "dengan"} {
+		if stems := SearchStems(word); stems != nil {
+			t.Errorf("SearchStems(%q) = %v, want a stopword", word, stems)
+		}
+	}
+}
+
+func TestSearchLexemesPositions(t *testing.T) {
+	lexemes := SearchLexemes("Sleep, then the sleep")
+	want := []SearchLexeme{
+		{Lexeme: "sleep", Positions: []int{1, 4}},
+		{Lexeme: "then", Positions: []int{2}},
+	}
+	if !reflect.DeepEqual(lexemes, want) {
+		t.Errorf("got %+v, want %+v", lexemes, want)
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	word := func(w string) []string { return SearchStems(w) }
+	tests := []struct {
+		name  string
+		query string
+		want  SearchQuery
+	}{
+		{"all words", "sleep anxiety", SearchQuery{{{Words: [][]string{word("sleep")}}, {Words: [][]string{word("anxiety")}}}}},
+		{"excluded word", "anxiety -work", SearchQuery{{{Words: [][]string{word("anxiety")}}, {Words: [][]string{word("work")}, Exclude: true}}}},
+		{"or", "sleep or anxiety", SearchQuery{{{Words: [][]string{word("sleep")}}}, {{Words: [][]string{word("anxiety")}}}}},
+		{"or binds looser than and", "bad sleep or anxiety", SearchQuery{
+			{{Words: [][]string{word("bad")}}, {Words: [][]string{word("sleep")}}},
+			{{Words: [][]string{word("anxiety")}}},
+		}},
+		{"phrase", `"panic attack"`, SearchQuery{{{Words: [][]string{word("panic"), word("attack")}}}}},
+		{"phrase with stopword", `"fear of flying"`, SearchQuery{{{Words: [][]string{word("fear"), nil, word("flying")}}}}},
+		{"excluded phrase", `sleep -"bad dream"`, SearchQuery{{{Words: [][]string{word("sleep")}}, {Words: [][]string{word("bad"), word("dream")}, Exclude: true}}}},
+		{"leading or", "or sleep", SearchQuery{{{Words: [][]string{word("sleep")}}}}},
+		{"only stopwords", "the and", nil},
+		{"empty", "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ParseSearchQuery(test.query); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ParseSearchQuery(%q) = %+v, want %+v", test.query, got, test.want)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		query string
+		want  string
+	}{
+		{"stemmed match", "I keep hoping it gets better", "hope", "I keep <mark>hoping</mark> it gets better"},
+		{"excluded word", "Anxiety about work again", "anxiety -work", "<mark>Anxiety</mark> about work again"},
+		{"or", "Could not sleep, anxious", "sleep or anxious", "Could not <mark>sleep</mark>, <mark>anxious</mark>"},
+		{"indonesian", "Hari ini aku bersedih", "sedih", "Hari ini aku <mark>bersedih</mark>"},
+		{"no match", "Nothing here", "sleep", "Nothing here"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := HighlightSnippet(test.text, test.query); got != test.want {
+				t.Errorf("HighlightSnippet(%q, %q) = %q, want %q", test.text, test.query, got, test.want)
+			}
+		})
+	}
+}
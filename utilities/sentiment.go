@@ -0,0 +1,244 @@
+package utilities
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// SentimentVersion changes whenever the lexicon or the scoring rules change, so stored
+// scores from an older version can be recomputed
+const SentimentVersion = 1
+
+type SentimentLabel string
+
+const (
+	SentimentPositive SentimentLabel = "positive"
+	SentimentNeutral  SentimentLabel = "neutral"
+	SentimentNegative SentimentLabel = "negative"
+)
+
+const (
+	// Normalisation constant for the compound score, same idea as VADER
+	sentimentAlpha = 15.0
+	// How far a negator reaches ahead and how much it dampens the flipped word
+	negationWindow   = 3
+	negationFactor   = -0.74
+	intensifierBoost = 0.293
+	// Clauses after "but"/"tapi" carry more weight than the ones before
+	contrastBefore   = 0.5
+	contrastAfter    = 1.5
+	neutralThreshold = 0.05
+)
+
+type Sentiment struct {
+	Score    float64        `json:"score"` // -1 (very negative) to 1 (very positive)
+	Label    SentimentLabel `json:"label"`
+	Positive int            `json:"positive_words"`
+	Negative int            `json:"negative_words"`
+}
+
+// ScoreSentiment scores Indonesian and English text with a lexicon. It is deterministic and
+// works fully offline, nothing leaves the process.
+func ScoreSentiment(text string) Sentiment {
+	tokens := tokenize(text)
+	valences := make([]float64, len(tokens))
+	result := Sentiment{}
+
+	contrastAt := -1
+	for i, token := range tokens {
+		if contrastWords[token] {
+			contrastAt = i
+			continue
+		}
+
+		valence, ok := lookupValence(token)
+		if !ok {
+			continue
+		}
+
+		// Intensifiers before the word ("very sad", "sangat sedih") or right after it
+		// ("sedih banget", "senang sekali")
+		if i > 0 {
+			valence = intensify(valence, intensifiers[tokens[i-1]])
+		}
+		if i+1 < len(tokens) {
+			valence = intensify(valence, postIntensifiers[tokens[i+1]])
+		}
+
+		// A negator only flips the first sentiment word after it
+		for j := i - 1; j >= 0 && j >= i-negationWindow; j-- {
+			if negators[tokens[j]] {
+				valence *= negationFactor
+				break
+			}
+			if _, ok := lookupValence(tokens[j]); ok {
+				break
+			}
+		}
+
+		valences[i] = valence
+	}
+
+	sum := 0.0
+	for i, valence := range valences {
+		if valence == 0 {
+			continue
+		}
+		if contrastAt >= 0 {
+			if i < contrastAt {
+				valence *= contrastBefore
+			} else {
+				valence *= contrastAfter
+			}
+		}
+		if valence > 0 {
+			result.Positive++
+		} else {
+			result.Negative++
+		}
+		sum += valence
+	}
+
+	result.Score = math.Round(sum/math.Sqrt(sum*sum+sentimentAlpha)*10000) / 10000
+	result.Label = SentimentLabelFor(result.Score)
+	return result
+}
+
+// SentimentLabelFor buckets a score, scores close to zero count as neutral
+func SentimentLabelFor(score float64) SentimentLabel {
+	switch {
+	case score >= neutralThreshold:
+		return SentimentPositive
+	case score <= -neutralThreshold:
+		return SentimentNegative
+	}
+	return SentimentNeutral
+}
+
+func intensify(valence, boost float64) float64 {
+	if boost == 0 {
+		return valence
+	}
+	if valence > 0 {
+		return valence + boost
+	}
+	return valence - boost
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+}
+
+// lookupValence finds a word in the lexicon, falling back to stripping common Indonesian
+// particles and prefixes ("sedihnya", "bersedih", "ketakutan" is listed as is)
+func lookupValence(token string) (float64, bool) {
+	if valence, ok := lexicon[token]; ok {
+		return valence, true
+	}
+
+	// Reduplication such as "senang-senang" is split into two tokens already, but
+	// "kata-kata" style words without a dash still hit the lexicon directly
+	base := token
+	for _, particle := range []string{"nya", "lah", "kah", "pun", "ku", "mu"} {
+		if trimmed := strings.TrimSuffix(base, particle); trimmed != base && len(trimmed) > 3 {
+			if valence, ok := lexicon[trimmed]; ok {
+				return valence, true
+			}
+			base = trimmed
+			break
+		}
+	}
+	for _, prefix := range []string{"ber", "ter", "me", "di", "ke", "se"} {
+		if trimmed := strings.TrimPrefix(base, prefix); trimmed != base && len(trimmed) > 3 {
+			if valence, ok := lexicon[trimmed]; ok {
+				return valence, true
+			}
+		}
+	}
+	return 0, false
+}
+
+var negators = map[string]bool{
+	"not": true, "no": true, "never": true, "none": true, "nothing": true, "nobody": true,
+	"without": true, "don't": true, "dont": true, "doesn't": true, "didn't": true, "isn't": true,
+	"wasn't": true, "aren't": true, "weren't": true, "can't": true, "cannot": true, "won't": true,
+	"wouldn't": true, "couldn't": true, "shouldn't": true, "haven't": true, "hasn't": true,
+	"tidak": true, "tak": true, "bukan": true, "belum": true, "jangan": true, "gak": true,
+	"nggak": true, "ngga": true, "enggak": true, "ga": true, "tanpa": true, "kurang": true,
+}
+
+var intensifiers = map[string]float64{
+	"very": intensifierBoost, "really": intensifierBoost, "so": intensifierBoost,
+	"extremely": intensifierBoost * 1.5, "incredibly": intensifierBoost * 1.5, "too": intensifierBoost,
+	"totally": intensifierBoost, "absolutely": intensifierBoost, "super": intensifierBoost,
+	"slightly": -intensifierBoost, "somewhat": -intensifierBoost, "barely": -intensifierBoost,
+	"sangat": intensifierBoost, "amat": intensifierBoost, "terlalu": intensifierBoost,
+	"paling": intensifierBoost * 1.5, "begitu": intensifierBoost, "sungguh": intensifierBoost,
+	"agak": -intensifierBoost, "sedikit": -intensifierBoost,
+}
+
+var postIntensifiers = map[string]float64{
+	"sekali": intensifierBoost, "banget": intensifierBoost, "bgt": intensifierBoost,
+	"abis": intensifierBoost,
+}
+
+var contrastWords = map[string]bool{
+	"but": true, "however": true, "yet": true,
+	"tapi": true, "tetapi": true, "namun": true, "padahal": true,
+}
+
+// lexicon maps words to a valence from -4 (most negative) to 4 (most positive). The list leans
+// towards words patients use to describe their mood rather than general purpose sentiment.
+var lexicon = map[string]float64{
+	// English, positive
+	"happy": 2.7, "happier": 2.6, "happiness": 2.6, "glad": 2.0, "joy": 2.8, "joyful": 2.9,
+	"good": 1.9, "great": 3.1, "better": 1.9, "best": 3.2, "fine": 0.8, "okay": 0.9, "ok": 0.9,
+	"calm": 1.3, "relaxed": 2.0, "peaceful": 2.2, "grateful": 2.7, "thankful": 2.3, "blessed": 2.4,
+	"love": 3.2, "loved": 2.9, "lovely": 2.8, "hope": 1.9, "hopeful": 2.3, "optimistic": 2.3,
+	"proud": 2.1, "confident": 2.2, "excited": 2.2, "enjoy": 2.2, "enjoyed": 2.3, "fun": 2.3,
+	"smile": 1.5, "laugh": 2.2, "laughed": 2.0, "nice": 1.8, "wonderful": 2.7, "amazing": 2.8,
+	"awesome": 3.1, "safe": 1.9, "supported": 1.8, "strong": 2.3, "motivated": 2.0, "energetic": 1.9,
+	"accomplished": 2.2, "productive": 1.9, "relieved": 1.6, "content": 1.6, "cheerful": 2.5,
+	"comfortable": 1.8, "improving": 1.6, "improved": 1.8, "progress": 1.6, "rested": 1.5,
+	"loving": 2.8, "kind": 2.4, "beautiful": 2.9, "healthy": 1.7, "success": 2.7, "successful": 2.8,
+	// English, negative
+	"sad": -2.1, "sadness": -1.9, "unhappy": -1.8, "depressed": -2.9, "depression": -2.7,
+	"anxious": -1.7, "anxiety": -2.0, "worried": -1.9, "worry": -1.9, "nervous": -1.5,
+	"stressed": -2.0, "stress": -1.8, "overwhelmed": -2.2, "tired": -1.2, "exhausted": -1.9,
+	"lonely": -2.0, "alone": -1.0, "empty": -1.6, "hopeless": -3.0, "helpless": -2.4,
+	"worthless": -3.0, "useless": -2.4, "angry": -2.3, "anger": -2.3, "mad": -2.2, "furious": -2.7,
+	"upset": -1.6, "hurt": -2.3, "pain": -2.3, "painful": -2.4, "cry": -2.1, "cried": -2.1,
+	"crying": -2.1, "afraid": -2.0, "scared": -2.2, "fear": -2.2, "panic": -2.3, "terrible": -2.5,
+	"awful": -2.0, "bad": -2.5, "worse": -2.1, "worst": -3.1, "hate": -2.7, "hated": -2.6,
+	"guilty": -1.8, "guilt": -1.8, "ashamed": -2.1, "shame": -2.1, "frustrated": -1.9,
+	"frustrating": -1.9, "annoyed": -1.6, "disappointed": -1.9, "miserable": -2.9, "broken": -2.0,
+	"numb": -1.6, "insomnia": -1.6, "sick": -1.9, "suicidal": -3.8, "die": -2.9, "dead": -3.3,
+	"failure": -2.5, "failed": -2.3, "fail": -2.5, "lost": -1.3, "confused": -1.3, "jealous": -2.0,
+	"grief": -2.2, "grieving": -2.3, "bored": -1.1, "restless": -1.2, "irritated": -1.8,
+	// Indonesian, positive
+	"senang": 2.4, "bahagia": 2.8, "gembira": 2.7, "suka": 1.8, "baik": 1.9, "bagus": 2.0,
+	"hebat": 2.6, "tenang": 1.6, "damai": 2.0, "lega": 1.7, "bersyukur": 2.7,
+	"syukur": 2.4, "kasih": 1.2, "cinta": 3.0, "sayang": 2.5, "harapan": 1.9,
+	"berharap": 1.4, "optimis": 2.3, "bangga": 2.1, "percaya": 1.5, "semangat": 2.3, "bersemangat": 2.4,
+	"nyaman": 1.8, "aman": 1.8, "menyenangkan": 2.5, "seru": 2.1, "asyik": 2.0, "asik": 2.0,
+	"tertawa": 2.1, "ketawa": 2.0, "senyum": 1.6, "tersenyum": 1.7, "indah": 2.5, "mantap": 2.2,
+	"sukses": 2.7, "berhasil": 2.4, "produktif": 1.9, "sehat": 1.7, "kuat": 2.0, "segar": 1.5,
+	"puas": 2.0, "membaik": 1.8, "enak": 1.7, "beruntung": 2.3, "didukung": 1.7,
+	"dukungan": 1.6, "rileks": 1.9, "santai": 1.4, "ceria": 2.5, "hangat": 1.5,
+	// Indonesian, negative
+	"sedih": -2.2, "kesedihan": -2.0, "depresi": -2.9, "cemas": -1.9, "kecemasan": -2.0,
+	"khawatir": -1.9, "kuatir": -1.9, "gelisah": -1.7, "takut": -2.1, "ketakutan": -2.3,
+	"panik": -2.3, "stres": -2.0, "tertekan": -2.3, "capek": -1.3,
+	"lelah": -1.4, "letih": -1.4, "kesepian": -2.1, "sendirian": -1.3, "sepi": -1.2, "hampa": -1.9,
+	"kosong": -1.3, "putus": -0.8, "asa": -1.2, "marah": -2.3, "kesal": -1.8,
+	"jengkel": -1.8, "benci": -2.7, "sakit": -2.0, "terluka": -2.3, "luka": -1.9, "nangis": -2.1,
+	"menangis": -2.1, "buruk": -2.3, "jelek": -1.9, "parah": -2.1, "gagal": -2.4, "kegagalan": -2.4,
+	"bersalah": -1.9, "malu": -1.6, "kecewa": -2.0, "frustasi": -2.0, "frustrasi": -2.0,
+	"galau": -1.6, "bingung": -1.2, "bosan": -1.1, "muak": -2.3, "hancur": -2.7, "mati": -2.9,
+	"bunuh": -3.6, "menyerah": -2.0, "sia": -1.0, "berat": -1.3, "susah": -1.5, "sulit": -1.4,
+	"pusing": -1.4, "mual": -1.5, "iri": -1.8, "duka": -2.3, "berduka": -2.3,
+	"murung": -2.1, "resah": -1.7, "trauma": -2.5, "kacau": -2.0, "tersiksa": -2.8,
+}
@@ -0,0 +1,87 @@
+package utilities
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScoreSentimentLabels(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want SentimentLabel
+	}{
+		{"english positive", "I feel happy and grateful today", SentimentPositive},
+		{"english negative", "I am sad and anxious", SentimentNegative},
+		{"indonesian positive", "Aku senang dan bahagia hari ini", SentimentPositive},
+		{"indonesian negative", "Aku sedih dan cemas", SentimentNegative},
+		{"no sentiment words", "I went to the market", SentimentNeutral},
+		{"empty", "", SentimentNeutral},
+		{"english negation", "I am not happy", SentimentNegative},
+		{"indonesian negation", "Aku tidak senang", SentimentNegative},
+		{"negated negative", "I am not sad", SentimentPositive},
+		{"english contrast", "I was sad but now I am happy", SentimentPositive},
+		{"indonesian contrast", "Tadi senang tapi sekarang sedih", SentimentNegative},
+		{"particle suffix", "sedihnya", SentimentNegative},
+		{"prefix", "bersedih", SentimentNegative},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := ScoreSentiment(test.text); got.Label != test.want {
+				t.Errorf("ScoreSentiment(%q) = %+v, want label %s", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestScoreSentimentStrength(t *testing.T) {
+	tests := []struct {
+		name     string
+		stronger string
+		weaker   string
+	}{
+		{"english intensifier", "very happy", "happy"},
+		{"indonesian intensifier", "sangat senang", "senang"},
+		{"indonesian trailing intensifier", "senang sekali", "senang"},
+		{"negative intensifier", "really sad", "sad"},
+		{"dampener", "happy", "slightly happy"},
+		{"negation dampens", "happy", "not sad"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stronger, weaker := ScoreSentiment(test.stronger).Score, ScoreSentiment(test.weaker).Score
+			if math.Abs(stronger) <= math.Abs(weaker) {
+				t.Errorf("|%q| = %v should exceed |%q| = %v", test.stronger, stronger, test.weaker, weaker)
+			}
+		})
+	}
+}
+
+func TestScoreSentimentAffixes(t *testing.T) {
+	base := ScoreSentiment("sedih")
+	for _, word := range []string{"sedihnya", "sedihlah", "bersedih", "tersedih"} {
+		if got := ScoreSentiment(word); got.Score != base.Score || got.Negative != 1 {
+			t.Errorf("ScoreSentiment(%q) = %+v, want the score of %q %v", word, got, "sedih", base.Score)
+		}
+	}
+}
+
+func TestScoreSentimentCounts(t *testing.T) {
+	got := ScoreSentiment("happy but tired and sad")
+	if got.Positive != 1 || got.Negative != 2 {
+		t.Errorf("got %d positive and %d negative words, want 1 and 2", got.Positive, got.Negative)
+	}
+}
+
+func TestScoreSentimentDeterministic(t *testing.T) {
+	text := "Hari ini aku sangat lelah, tapi aku tidak sedih karena teman-teman baik sekali"
+	first := ScoreSentiment(text)
+	for i := 0; i < 10; i++ {
+		if got := ScoreSentiment(text); got != first {
+			t.Fatalf("ScoreSentiment is not deterministic: %+v then %+v", first, got)
+		}
+	}
+	if first.Score < -1 || first.Score > 1 {
+		t.Errorf("score %v is outside [-1, 1]", first.Score)
+	}
+}